@@ -7,13 +7,15 @@ require (
 	github.com/cheggaaa/pb/v3 v3.0.6
 	github.com/davidbyttow/govips/v2 v2.5.1-0.20210310125832-d6697b9d4676
 	github.com/fatih/color v1.10.0 // indirect
+	github.com/fsnotify/fsnotify v1.5.4
 	github.com/kr/text v0.2.0 // indirect
 	github.com/mattn/go-runewidth v0.0.10 // indirect
 	github.com/rivo/uniseg v0.2.0 // indirect
 	github.com/stretchr/testify v1.6.1
-	golang.org/x/image v0.0.0-20210220032944-ac19c3e999fb // indirect
+	github.com/yuin/goldmark v1.4.12
+	golang.org/x/image v0.0.0-20210220032944-ac19c3e999fb
 	golang.org/x/net v0.0.0-20210226172049-e18ecbb05110 // indirect
 	golang.org/x/sys v0.1.0 // indirect
 	golang.org/x/text v0.3.5 // indirect
-	gopkg.in/yaml.v3 v3.0.0-20200615113413-eeeca48fe776 // indirect
+	gopkg.in/yaml.v3 v3.0.0-20200615113413-eeeca48fe776
 )
@@ -0,0 +1,108 @@
+package gallery
+
+import (
+	"math"
+	"path/filepath"
+)
+
+// Aspect ratios of adopted full-size images may differ this much from their source files'
+// because of rounding
+const adoptAspectTolerance = 0.01
+
+// Layouts of galleries made by other tools, whose thumbnails and full-size images can be
+// adopted. Paths are relative to the gallery root.
+const (
+	sigalThumbnailDir    = "thumbnails"
+	sigalThumbnailSuffix = ".tn"
+	thumbsupThumbnailDir = "media/thumbs"
+	thumbsupFullsizeDir  = "media/large"
+)
+
+// getAdoptionCandidates returns the paths where galleries made by fastgallery, sigal and
+// thumbsup keep the thumbnail and full-size image of a source file, by its path relative
+// to the source root
+func getAdoptionCandidates(adoptDirectory string, relPath string, config configuration) (thumbnails []string, fullsizes []string) {
+	album := filepath.Dir(relPath)
+	basename := stripExtension(filepath.Base(relPath))
+	galleryFilename := getGalleryBasename(filepath.Base(relPath), config) + config.files.imageExtension
+
+	thumbnails = []string{
+		filepath.Join(adoptDirectory, album, config.files.thumbnailDir, galleryFilename),
+		filepath.Join(adoptDirectory, album, sigalThumbnailDir, basename+sigalThumbnailSuffix+".jpg"),
+		filepath.Join(adoptDirectory, filepath.FromSlash(thumbsupThumbnailDir), album, basename+".jpg"),
+	}
+	fullsizes = []string{
+		filepath.Join(adoptDirectory, album, config.files.fullsizeDir, galleryFilename),
+		filepath.Join(adoptDirectory, album, basename+".jpg"),
+		filepath.Join(adoptDirectory, filepath.FromSlash(thumbsupFullsizeDir), album, basename+".jpg"),
+	}
+	return thumbnails, fullsizes
+}
+
+// isAdoptableThumbnail checks whether an existing thumbnail has the current thumbnail size
+func isAdoptableThumbnail(thumbnailPath string, config configuration) bool {
+	width, height, err := readImageDimensions(thumbnailPath)
+	return err == nil && width == config.media.thumbnailWidth && height == config.media.thumbnailHeight
+}
+
+// isAdoptableFullsize checks whether an existing full-size image is the size fastgallery
+// would make it: fitting the current maximum size and as large as it fits. If the source
+// file's dimensions can be read, the aspect ratio has to match them either way round, as
+// the source may be rotated.
+func isAdoptableFullsize(fullsizePath string, sourcePath string, config configuration) bool {
+	width, height, err := readImageDimensions(fullsizePath)
+	if err != nil || width == 0 || height == 0 {
+		return false
+	}
+	if width > config.media.fullsizeMaxWidth || height > config.media.fullsizeMaxHeight {
+		return false
+	}
+	if width != config.media.fullsizeMaxWidth && height != config.media.fullsizeMaxHeight {
+		return false
+	}
+
+	sourceWidth, sourceHeight, err := readImageDimensions(sourcePath)
+	if err != nil || sourceWidth == 0 || sourceHeight == 0 {
+		return true
+	}
+	ratio := float64(width) / float64(height)
+	sourceRatio := float64(sourceWidth) / float64(sourceHeight)
+	return math.Abs(ratio/sourceRatio-1) <= adoptAspectTolerance || math.Abs(ratio*sourceRatio-1) <= adoptAspectTolerance
+}
+
+// adoptGalleryFiles copies the thumbnail and full-size image of a job from the adopted
+// gallery to the temporary paths, if they match the current settings. Only JPEG images
+// are adopted, and not with WebP versions, which other galleries don't have. Returns
+// which ones were adopted and don't need to be built.
+func adoptGalleryFiles(thisJob transformationJob, thumbnailTemp string, fullsizeTemp string, config configuration) (adoptedThumbnail bool, adoptedFullsize bool) {
+	if !isImageFile(thisJob.sourceFilepath, config) || config.files.imageExtension != ".jpg" || config.files.webp {
+		return false, false
+	}
+
+	thumbnails, fullsizes := getAdoptionCandidates(config.files.adoptDir, thisJob.relPath, config)
+	if thumbnailTemp != "" {
+		adoptedThumbnail = adoptFile(thumbnails, thumbnailTemp, func(candidate string) bool {
+			return isAdoptableThumbnail(candidate, config)
+		}, config)
+	}
+	if fullsizeTemp != "" {
+		adoptedFullsize = adoptFile(fullsizes, fullsizeTemp, func(candidate string) bool {
+			return isAdoptableFullsize(candidate, thisJob.sourceFilepath, config)
+		}, config)
+	}
+	return adoptedThumbnail, adoptedFullsize
+}
+
+// adoptFile copies the first of the candidates which is adoptable to the temporary path
+func adoptFile(candidates []string, temp string, adoptable func(string) bool, config configuration) bool {
+	for _, candidate := range candidates {
+		if !exists(candidate) || !adoptable(candidate) {
+			continue
+		}
+		if copyIntoGallery(candidate, temp, config) == nil {
+			logProgress(config, "Adopted file:", candidate)
+			return true
+		}
+	}
+	return false
+}
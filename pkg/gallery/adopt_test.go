@@ -0,0 +1,80 @@
+package gallery
+
+import (
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestJPEG writes a gray JPEG of given size, creating its directory
+func writeTestJPEG(t *testing.T, path string, width int, height int) {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	assert.NoError(t, err)
+	handle, err := os.Create(path)
+	assert.NoError(t, err)
+	defer handle.Close()
+	err = jpeg.Encode(handle, image.NewGray(image.Rect(0, 0, width, height)), nil)
+	assert.NoError(t, err)
+}
+
+func TestGetAdoptionCandidates(t *testing.T) {
+	config := initializeConfig()
+	thumbnails, fullsizes := getAdoptionCandidates("/old", filepath.Join("trips", "a.heic"), config)
+	assert.EqualValues(t, []string{
+		filepath.Join("/old", "trips", "_thumbnail", "a.jpg"),
+		filepath.Join("/old", "trips", "thumbnails", "a.tn.jpg"),
+		filepath.Join("/old", "media", "thumbs", "trips", "a.jpg"),
+	}, thumbnails)
+	assert.EqualValues(t, []string{
+		filepath.Join("/old", "trips", "_fullsize", "a.jpg"),
+		filepath.Join("/old", "trips", "a.jpg"),
+		filepath.Join("/old", "media", "large", "trips", "a.jpg"),
+	}, fullsizes)
+}
+
+func TestAdoptGalleryFiles(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	config.files.adoptDir = filepath.Join(tempDir, "old")
+	sourcePath := filepath.Join(tempDir, "source", "trips", "a.jpg")
+	writeTestJPEG(t, sourcePath, 400, 300)
+
+	// A sigal thumbnail of the wrong size and a thumbsup one of the right size, and a
+	// full-size image of another shape
+	writeTestJPEG(t, filepath.Join(config.files.adoptDir, "trips", "thumbnails", "a.tn.jpg"), 200, 150)
+	writeTestJPEG(t, filepath.Join(config.files.adoptDir, "media", "thumbs", "trips", "a.jpg"), 280, 210)
+	writeTestJPEG(t, filepath.Join(config.files.adoptDir, "trips", "a.jpg"), 1920, 1080)
+
+	job := transformationJob{filename: "a.jpg", relPath: filepath.Join("trips", "a.jpg"), sourceFilepath: sourcePath}
+	thumbnailTemp := filepath.Join(tempDir, "thumbnail.jpg")
+	fullsizeTemp := filepath.Join(tempDir, "fullsize.jpg")
+	adoptedThumbnail, adoptedFullsize := adoptGalleryFiles(job, thumbnailTemp, fullsizeTemp, config)
+	assert.True(t, adoptedThumbnail)
+	assert.False(t, adoptedFullsize)
+	width, height, err := readImageDimensions(thumbnailTemp)
+	assert.NoError(t, err)
+	assert.Equal(t, 280, width)
+	assert.Equal(t, 210, height)
+	assert.NoFileExists(t, fullsizeTemp)
+
+	// A full-size image as large as fits with the source's aspect ratio is adopted
+	writeTestJPEG(t, filepath.Join(config.files.adoptDir, "trips", "a.jpg"), 1440, 1080)
+	_, adoptedFullsize = adoptGalleryFiles(job, "", fullsizeTemp, config)
+	assert.True(t, adoptedFullsize)
+	assert.FileExists(t, fullsizeTemp)
+
+	// Other galleries don't have WebP versions
+	config.files.webp = true
+	adoptedThumbnail, adoptedFullsize = adoptGalleryFiles(job, thumbnailTemp, fullsizeTemp, config)
+	assert.False(t, adoptedThumbnail)
+	assert.False(t, adoptedFullsize)
+}
@@ -0,0 +1,146 @@
+package gallery
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Name of the optional per-directory album configuration file in the source tree
+const albumConfigFile = "album.yaml"
+
+// Name of the optional per-directory Markdown description file in the source tree
+const albumDescriptionFile = "README.md"
+
+// albumConfig struct holds the settings of an album.yaml file. time_offset applies to
+// the directory the file is in and, unless overridden, its subdirectories. The title,
+// hero image, intro text and description only apply to the album page of the directory
+// itself. hero is the path of an image relative to the directory, e.g. "best/sunset.jpg".
+// description is Markdown, read from README.md if not set in album.yaml. private keeps
+// the directory and its subdirectories out of the gallery. music is the path of an audio
+// file in the directory, played in the album's slideshow. frozen marks a finished album:
+// once it's in the gallery, it and its subdirectories are never scanned, rendered or
+// cleaned up again.
+type albumConfig struct {
+	TimeOffset  string `yaml:"time_offset"`
+	Title       string `yaml:"title"`
+	Hero        string `yaml:"hero"`
+	Intro       string `yaml:"intro"`
+	Description string `yaml:"description"`
+	Private     bool   `yaml:"private"`
+	Music       string `yaml:"music"`
+	Frozen      bool   `yaml:"frozen"`
+}
+
+// readAlbumConfig parses the album.yaml of given directory, if there is one, and
+// reads the album description from README.md unless album.yaml has one
+func readAlbumConfig(directoryPath string) (album albumConfig, err error) {
+	buffer, err := os.ReadFile(filepath.Join(directoryPath, albumConfigFile))
+	if err == nil {
+		err = yaml.Unmarshal(buffer, &album)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return album, err
+	}
+
+	if album.Description == "" {
+		description, err := os.ReadFile(filepath.Join(directoryPath, albumDescriptionFile))
+		if err != nil && !os.IsNotExist(err) {
+			return album, err
+		}
+		album.Description = string(description)
+	}
+
+	return album, nil
+}
+
+// readAlbumConfigs reads album.yaml files of the whole source tree into the directory structs
+func readAlbumConfigs(source *directory) {
+	readDirectoryAlbumConfig(source)
+
+	for i := range source.subdirectories {
+		readAlbumConfigs(&source.subdirectories[i])
+	}
+}
+
+// readDirectoryAlbumConfig reads the album.yaml of one source directory into its struct
+func readDirectoryAlbumConfig(source *directory) {
+	album, err := readAlbumConfig(source.absPath)
+	if err != nil {
+		log.Println("couldn't parse album configuration:", filepath.Join(source.absPath, albumConfigFile), err.Error())
+	}
+	source.album = album
+}
+
+// albumTitle returns the title of an album page: album.yaml title first, then any
+// title from export metadata and finally the directory name
+func albumTitle(source directory) string {
+	if source.album.Title != "" {
+		return source.album.Title
+	}
+	if source.title != "" {
+		return source.title
+	}
+	return source.name
+}
+
+// findHeroImage returns the path of the album's hero image in the gallery, relative
+// to the album page. The hero image must be an image file in the album or below it.
+// Returns an empty string if there's no hero image or it can't be found.
+func findHeroImage(source directory, config configuration) string {
+	if source.album.Hero == "" {
+		return ""
+	}
+
+	heroPath := filepath.Clean(source.album.Hero)
+	heroDirectory, heroFilename := filepath.Split(heroPath)
+	album := &source
+	for _, name := range strings.Split(filepath.Clean(heroDirectory), string(filepath.Separator)) {
+		if name == "." {
+			continue
+		}
+		album = findSubdirectory(*album, name)
+		if album == nil {
+			break
+		}
+	}
+
+	if album != nil {
+		for _, file := range album.files {
+			if file.name == heroFilename && isImageFile(file.absPath, config) {
+				_, fullsizeFilename := getGalleryFilenames(file.absPath, config)
+				return filepath.ToSlash(filepath.Join(filepath.Dir(heroPath), config.files.fullsizeDir, fullsizeFilename))
+			}
+		}
+	}
+
+	log.Println("couldn't find hero image in album:", source.absPath, source.album.Hero)
+	return ""
+}
+
+// findSubdirectory returns the subdirectory with given name, or nil if there's none
+func findSubdirectory(source directory, name string) *directory {
+	for i := range source.subdirectories {
+		if source.subdirectories[i].name == name {
+			return &source.subdirectories[i]
+		}
+	}
+	return nil
+}
+
+// applyLandingPageArgs overrides the root album's title, hero image and intro text
+// with the ones given on the command line
+func applyLandingPageArgs(source *directory, title string, hero string, intro string) {
+	if title != "" {
+		source.album.Title = title
+	}
+	if hero != "" {
+		source.album.Hero = hero
+	}
+	if intro != "" {
+		source.album.Intro = intro
+	}
+}
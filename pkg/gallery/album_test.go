@@ -0,0 +1,63 @@
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadAlbumConfigs(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	err = os.Mkdir(filepath.Join(tempDir, "trip"), 0755)
+	assert.NoError(t, err)
+	testFiles := map[string]string{
+		"cover.jpg":                            "",
+		albumConfigFile:                        "title: My photos\nhero: trip/sunset.jpg\nintro: |\n  Hello.\n  Welcome!\n",
+		filepath.Join("trip", "sunset.jpg"):    "",
+		filepath.Join("trip", albumConfigFile): "hero: missing.jpg\n",
+		filepath.Join("trip", "README.md"):     "# Day one\n\nWe *walked*.\n",
+	}
+	for filename, contents := range testFiles {
+		err = os.WriteFile(filepath.Join(tempDir, filename), []byte(contents), 0644)
+		assert.NoError(t, err)
+	}
+
+	config := initializeConfig()
+	source, _ := createDirectoryTree(tempDir, "", false, config)
+	readAlbumConfigs(&source)
+
+	assert.EqualValues(t, "My photos", albumTitle(source))
+	assert.EqualValues(t, "Hello.\nWelcome!\n", source.album.Intro)
+	assert.EqualValues(t, "trip/_fullsize/sunset.jpg", findHeroImage(source, config))
+
+	assert.EqualValues(t, "trip", albumTitle(source.subdirectories[0]))
+	assert.EqualValues(t, "", findHeroImage(source.subdirectories[0], config))
+	assert.EqualValues(t, "", source.album.Description)
+	assert.EqualValues(t, "# Day one\n\nWe *walked*.\n", source.subdirectories[0].album.Description)
+
+	applyLandingPageArgs(&source, "Landing", "cover.jpg", "")
+	assert.EqualValues(t, "Landing", albumTitle(source))
+	assert.EqualValues(t, "_fullsize/cover.jpg", findHeroImage(source, config))
+	assert.EqualValues(t, "Hello.\nWelcome!\n", source.album.Intro)
+
+	galleryDirectory := filepath.Join(tempDir, "gallery")
+	err = os.Mkdir(galleryDirectory, 0755)
+	assert.NoError(t, err)
+	createHTML(0, source, galleryDirectory, testTemplates(t, config).html, false, config)
+	html, err := os.ReadFile(filepath.Join(galleryDirectory, config.assets.htmlFile))
+	assert.NoError(t, err)
+	assert.Contains(t, string(html), "background-image: url('_fullsize/cover.jpg')")
+	assert.Contains(t, string(html), "Hello.\nWelcome!")
+
+	createHTML(1, source.subdirectories[0], galleryDirectory, testTemplates(t, config).html, false, config)
+	html, err = os.ReadFile(filepath.Join(galleryDirectory, config.assets.htmlFile))
+	assert.NoError(t, err)
+	assert.Contains(t, string(html), "<h1>Day one</h1>\n<p>We <em>walked</em>.</p>")
+}
@@ -0,0 +1,217 @@
+package gallery
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Size of the album map's SVG canvas, and the margin kept around the tracks and photos
+const (
+	albumMapWidth  = 1000
+	albumMapHeight = 400
+	albumMapMargin = 20
+)
+
+// Tracks are thinned out to at most this many points each, to keep album pages small
+const albumMapMaxTrackPoints = 1000
+
+// geoPoint is a location in decimal degrees, with its elevation in meters if known
+type geoPoint struct {
+	latitude     float64
+	longitude    float64
+	elevation    float64
+	hasElevation bool
+}
+
+// gpxFile is the part of a GPX file we read: the points of its tracks and routes
+type gpxFile struct {
+	Tracks []struct {
+		Segments []struct {
+			Points []gpxPoint `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+	Routes []struct {
+		Points []gpxPoint `xml:"rtept"`
+	} `xml:"rte"`
+}
+
+type gpxPoint struct {
+	Latitude  float64  `xml:"lat,attr"`
+	Longitude float64  `xml:"lon,attr"`
+	Elevation *float64 `xml:"ele"`
+}
+
+// htmlMap struct is the map of an album page, drawn as SVG without any map tiles.
+// Tracks are SVG path data and Markers the album's geotagged photos.
+type htmlMap struct {
+	Width   int
+	Height  int
+	Tracks  []string
+	Markers []htmlMarker
+}
+
+// htmlMarker struct is one geotagged photo on the album map. Index is its position in
+// the album, for opening it in the lightbox.
+type htmlMarker struct {
+	X        string
+	Y        string
+	Index    int
+	Filename string
+}
+
+// readGPXTracks returns the track segments and routes of a GPX file, each as a line of points
+func readGPXTracks(gpxPath string) (tracks [][]geoPoint, err error) {
+	contents, err := os.ReadFile(gpxPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var gpx gpxFile
+	err = xml.Unmarshal(contents, &gpx)
+	if err != nil {
+		return nil, err
+	}
+
+	addLine := func(points []gpxPoint) {
+		var line []geoPoint
+		for _, point := range points {
+			linePoint := geoPoint{latitude: point.Latitude, longitude: point.Longitude}
+			if point.Elevation != nil {
+				linePoint.elevation, linePoint.hasElevation = *point.Elevation, true
+			}
+			line = append(line, linePoint)
+		}
+		if len(line) > 0 {
+			tracks = append(tracks, line)
+		}
+	}
+	for _, track := range gpx.Tracks {
+		for _, segment := range track.Segments {
+			addLine(segment.Points)
+		}
+	}
+	for _, route := range gpx.Routes {
+		addLine(route.Points)
+	}
+	return tracks, nil
+}
+
+// readDirectoryTracks reads the GPX files of a source directory, leaving out the ones
+// marked private
+func readDirectoryTracks(source *directory, config configuration) {
+	if !(config.media.albumMap || config.media.trackStats) || source.album.Private {
+		return
+	}
+
+	entries, err := os.ReadDir(source.absPath)
+	if err != nil {
+		log.Println("couldn't read GPX files of directory:", source.absPath, err.Error())
+		return
+	}
+
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || strings.ToLower(filepath.Ext(entry.Name())) != ".gpx" {
+			continue
+		}
+		gpxPath := filepath.Join(source.absPath, entry.Name())
+		if isPrivateFile(file{name: entry.Name(), absPath: gpxPath}) {
+			continue
+		}
+		tracks, err := readGPXTracks(gpxPath)
+		if err != nil {
+			log.Println("couldn't read GPX file:", gpxPath, err.Error())
+			continue
+		}
+		source.tracks = append(source.tracks, tracks...)
+	}
+}
+
+// createHTMLMap draws the GPX tracks and geotagged photos of an album on a map, scaled to
+// fit the canvas. Longitudes are shrunk by the cosine of the latitude, so the shapes of
+// tracks aren't stretched away from the equator. Returns nil if there's nothing to draw.
+func createHTMLMap(source directory) *htmlMap {
+	var points []geoPoint
+	for _, track := range source.tracks {
+		points = append(points, track...)
+	}
+	for _, sourceFile := range source.files {
+		if sourceFile.geotagged {
+			points = append(points, geoPoint{latitude: sourceFile.latitude, longitude: sourceFile.longitude})
+		}
+	}
+	if len(points) == 0 {
+		return nil
+	}
+
+	minLatitude, maxLatitude := points[0].latitude, points[0].latitude
+	minLongitude, maxLongitude := points[0].longitude, points[0].longitude
+	for _, point := range points {
+		minLatitude = math.Min(minLatitude, point.latitude)
+		maxLatitude = math.Max(maxLatitude, point.latitude)
+		minLongitude = math.Min(minLongitude, point.longitude)
+		maxLongitude = math.Max(maxLongitude, point.longitude)
+	}
+
+	aspect := math.Cos((minLatitude + maxLatitude) / 2 * math.Pi / 180)
+	spanX := (maxLongitude - minLongitude) * aspect
+	spanY := maxLatitude - minLatitude
+	scale := math.Inf(1)
+	if spanX > 0 {
+		scale = float64(albumMapWidth-2*albumMapMargin) / spanX
+	}
+	if spanY > 0 {
+		scale = math.Min(scale, float64(albumMapHeight-2*albumMapMargin)/spanY)
+	}
+	if math.IsInf(scale, 1) {
+		scale = 0
+	}
+
+	// The drawing is centered on the canvas
+	offsetX := (albumMapWidth - spanX*scale) / 2
+	offsetY := (albumMapHeight - spanY*scale) / 2
+	project := func(point geoPoint) (x float64, y float64) {
+		x = offsetX + (point.longitude-minLongitude)*aspect*scale
+		y = offsetY + (maxLatitude-point.latitude)*scale
+		return x, y
+	}
+
+	albumMap := htmlMap{Width: albumMapWidth, Height: albumMapHeight}
+	for _, track := range source.tracks {
+		step := (len(track) + albumMapMaxTrackPoints - 1) / albumMapMaxTrackPoints
+		var path strings.Builder
+		for i := 0; i < len(track); i += step {
+			x, y := project(track[i])
+			command := "L"
+			if i == 0 {
+				command = "M"
+			}
+			fmt.Fprintf(&path, "%s%.1f %.1f ", command, x, y)
+		}
+		// The end of the track is always drawn
+		if (len(track)-1)%step != 0 {
+			x, y := project(track[len(track)-1])
+			fmt.Fprintf(&path, "L%.1f %.1f ", x, y)
+		}
+		albumMap.Tracks = append(albumMap.Tracks, strings.TrimSpace(path.String()))
+	}
+
+	for i, sourceFile := range source.files {
+		if !sourceFile.geotagged {
+			continue
+		}
+		x, y := project(geoPoint{latitude: sourceFile.latitude, longitude: sourceFile.longitude})
+		albumMap.Markers = append(albumMap.Markers, htmlMarker{
+			X:        fmt.Sprintf("%.1f", x),
+			Y:        fmt.Sprintf("%.1f", y),
+			Index:    i,
+			Filename: sourceFile.name,
+		})
+	}
+
+	return &albumMap
+}
@@ -0,0 +1,68 @@
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testGPX = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1">
+  <trk><trkseg>
+    <trkpt lat="60.0" lon="24.0"><ele>10</ele></trkpt>
+    <trkpt lat="60.1" lon="24.2"></trkpt>
+  </trkseg></trk>
+  <rte><rtept lat="60.2" lon="24.4"></rtept></rte>
+</gpx>`
+
+func TestReadDirectoryTracks(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	for _, filename := range []string{"hike.GPX", "secret.private.gpx"} {
+		err = os.WriteFile(filepath.Join(tempDir, filename), []byte(testGPX), 0644)
+		assert.NoError(t, err)
+	}
+	err = os.WriteFile(filepath.Join(tempDir, "broken.gpx"), []byte("<gpx"), 0644)
+	assert.NoError(t, err)
+
+	config := initializeConfig()
+	source := directory{absPath: tempDir}
+	readDirectoryTracks(&source, config)
+	assert.Nil(t, source.tracks)
+
+	config.media.albumMap = true
+	readDirectoryTracks(&source, config)
+	assert.Len(t, source.tracks, 2)
+	assert.EqualValues(t, []geoPoint{{latitude: 60.0, longitude: 24.0, elevation: 10, hasElevation: true}, {latitude: 60.1, longitude: 24.2}}, source.tracks[0])
+	assert.EqualValues(t, []geoPoint{{latitude: 60.2, longitude: 24.4}}, source.tracks[1])
+}
+
+func TestCreateHTMLMap(t *testing.T) {
+	assert.Nil(t, createHTMLMap(directory{files: []file{{name: "a.jpg"}}}))
+
+	// A single photo is drawn in the middle
+	albumMap := createHTMLMap(directory{files: []file{{name: "a.jpg"}, {name: "b.jpg", geotagged: true, latitude: 60, longitude: 24}}})
+	assert.Len(t, albumMap.Markers, 1)
+	assert.EqualValues(t, htmlMarker{X: "500.0", Y: "200.0", Index: 1, Filename: "b.jpg"}, albumMap.Markers[0])
+
+	// A track going north fills the height of the map
+	albumMap = createHTMLMap(directory{tracks: [][]geoPoint{{{latitude: 60, longitude: 24}, {latitude: 60.5, longitude: 24}, {latitude: 61, longitude: 24}}}})
+	assert.EqualValues(t, []string{"M500.0 380.0 L500.0 200.0 L500.0 20.0"}, albumMap.Tracks)
+
+	// Long tracks are thinned out, keeping their end
+	var track []geoPoint
+	for i := 0; i <= 2500; i++ {
+		track = append(track, geoPoint{latitude: 60, longitude: 24 + float64(i)/1000})
+	}
+	albumMap = createHTMLMap(directory{tracks: [][]geoPoint{track}})
+	assert.Len(t, albumMap.Tracks, 1)
+	assert.Contains(t, albumMap.Tracks[0], "M20.0 200.0 ")
+	assert.True(t, len(albumMap.Tracks[0]) < 20000)
+	assert.Regexp(t, "L980.0 200.0$", albumMap.Tracks[0])
+}
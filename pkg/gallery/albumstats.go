@@ -0,0 +1,117 @@
+package gallery
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Layouts used to display the date range and last update of albums
+const (
+	albumMonthLayout   = "Jan 2006"
+	albumUpdatedLayout = "2006-01-02"
+)
+
+// albumStats struct holds the counts and dates of all media files in an album and its
+// subalbums. Dates are zero if unknown.
+type albumStats struct {
+	photos  int
+	videos  int
+	first   time.Time
+	last    time.Time
+	updated time.Time
+}
+
+// htmlAlbumStats struct is an album's statistics formatted for the HTML page.
+// Counts is the number of photos and videos, DateRange the months they were taken in
+// and Updated the date the album's newest source file was modified.
+type htmlAlbumStats struct {
+	Counts    string
+	DateRange string
+	Updated   string
+}
+
+// htmlSubdirectory struct is one subalbum tile shown in the HTML page
+type htmlSubdirectory struct {
+	Name  string
+	Stats htmlAlbumStats
+}
+
+// collectAlbumStats recursively counts the photos and videos in an album and finds the
+// range of their capture times and the newest modification time. Albums outside the
+// subtree of a partial run have the statistics of the previous run.
+func collectAlbumStats(source directory, config configuration) (stats albumStats) {
+	if source.keptStats != nil {
+		return *source.keptStats
+	}
+
+	for _, sourceFile := range source.files {
+		if isVideoFile(sourceFile.absPath, config) {
+			stats.videos++
+		} else {
+			stats.photos++
+		}
+		if !sourceFile.takenTime.IsZero() {
+			if stats.first.IsZero() || sourceFile.takenTime.Before(stats.first) {
+				stats.first = sourceFile.takenTime
+			}
+			if sourceFile.takenTime.After(stats.last) {
+				stats.last = sourceFile.takenTime
+			}
+		}
+		if sourceFile.modTime.After(stats.updated) {
+			stats.updated = sourceFile.modTime
+		}
+	}
+
+	for _, subdir := range source.subdirectories {
+		subdirStats := collectAlbumStats(subdir, config)
+		stats.photos += subdirStats.photos
+		stats.videos += subdirStats.videos
+		if !subdirStats.first.IsZero() && (stats.first.IsZero() || subdirStats.first.Before(stats.first)) {
+			stats.first = subdirStats.first
+		}
+		if subdirStats.last.After(stats.last) {
+			stats.last = subdirStats.last
+		}
+		if subdirStats.updated.After(stats.updated) {
+			stats.updated = subdirStats.updated
+		}
+	}
+	return stats
+}
+
+// formatAlbumStats formats album statistics for the HTML page, e.g. "12 photos, 1 video",
+// "Jun 2019 – Aug 2020" and "2021-03-04". Empty counts and unknown dates are left out.
+func formatAlbumStats(stats albumStats, config configuration) (formatted htmlAlbumStats) {
+	var counts []string
+	if stats.photos > 0 {
+		counts = append(counts, pluralize(stats.photos, "photo"))
+	}
+	if stats.videos > 0 {
+		counts = append(counts, pluralize(stats.videos, "video"))
+	}
+	formatted.Counts = strings.Join(counts, ", ")
+
+	if !stats.first.IsZero() {
+		first := stats.first.In(config.media.timezone).Format(albumMonthLayout)
+		last := stats.last.In(config.media.timezone).Format(albumMonthLayout)
+		formatted.DateRange = first
+		if last != first {
+			formatted.DateRange = first + " – " + last
+		}
+	}
+
+	if !stats.updated.IsZero() {
+		formatted.Updated = stats.updated.In(config.media.timezone).Format(albumUpdatedLayout)
+	}
+	return formatted
+}
+
+// pluralize returns a count with a noun, adding an s to the noun unless the count is one
+func pluralize(count int, noun string) string {
+	if count == 1 {
+		return fmt.Sprint(count, " ", noun)
+	}
+	return fmt.Sprint(count, " ", noun, "s")
+}
@@ -0,0 +1,76 @@
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectAlbumStats(t *testing.T) {
+	config := initializeConfig()
+	config.media.timezone = time.UTC
+	source := directory{
+		files: []file{
+			{name: "a.jpg", absPath: "/photos/a.jpg", takenTime: time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC), modTime: time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC)},
+			{name: "b.mp4", absPath: "/photos/b.mp4"},
+		},
+		subdirectories: []directory{
+			{files: []file{
+				{name: "c.jpg", absPath: "/photos/c.jpg", takenTime: time.Date(2020, 8, 1, 12, 0, 0, 0, time.UTC), modTime: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+				{name: "d.heic", absPath: "/photos/d.heic", takenTime: time.Date(2019, 7, 1, 12, 0, 0, 0, time.UTC)},
+			}},
+		},
+	}
+
+	stats := collectAlbumStats(source, config)
+	assert.EqualValues(t, 3, stats.photos)
+	assert.EqualValues(t, 1, stats.videos)
+
+	formatted := formatAlbumStats(stats, config)
+	assert.EqualValues(t, "3 photos, 1 video", formatted.Counts)
+	assert.EqualValues(t, "Jun 2019 – Aug 2020", formatted.DateRange)
+	assert.EqualValues(t, "2021-03-04", formatted.Updated)
+
+	formatted = formatAlbumStats(collectAlbumStats(source.subdirectories[0], config), config)
+	assert.EqualValues(t, "2 photos", formatted.Counts)
+	assert.EqualValues(t, "Jul 2019 – Aug 2020", formatted.DateRange)
+
+	assert.EqualValues(t, htmlAlbumStats{}, formatAlbumStats(albumStats{}, config))
+}
+
+func TestCollectHTMLJobsParentAlbums(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	for _, path := range []string{"", "a", filepath.Join("a", "b"), "c"} {
+		err = os.MkdirAll(filepath.Join(tempDir, path), 0755)
+		assert.NoError(t, err)
+		err = os.WriteFile(filepath.Join(tempDir, path, config.assets.htmlFile), []byte{}, 0644)
+		assert.NoError(t, err)
+	}
+	source := directory{subdirectories: []directory{
+		{name: "a", relPath: "a", exists: true, subdirectories: []directory{
+			{name: "b", relPath: filepath.Join("a", "b"), exists: true, files: []file{{name: "old.jpg", absPath: "/photos/old.jpg", exists: true}}},
+		}},
+		{name: "c", relPath: "c", exists: true, files: []file{{name: "old.jpg", absPath: "/photos/old.jpg", exists: true}}},
+	}}
+	gallery := directory{absPath: tempDir}
+	settingsHash := getPageSettingsHash(config)
+	previousPages := make(map[string]string)
+	_, _ = collectHTMLJobs(0, source, gallery, settingsHash, nil, previousPages, config)
+
+	// A new photo deep down changes the counts shown in all the albums above it
+	source.subdirectories[0].subdirectories[0].files = append(source.subdirectories[0].subdirectories[0].files, file{name: "new.jpg", absPath: "/photos/new.jpg"})
+	jobs, _ := collectHTMLJobs(0, source, gallery, settingsHash, previousPages, make(map[string]string), config)
+	assert.Len(t, jobs, 3)
+	assert.EqualValues(t, tempDir, jobs[0].galleryDirectory)
+	assert.EqualValues(t, filepath.Join(tempDir, "a"), jobs[1].galleryDirectory)
+	assert.EqualValues(t, filepath.Join(tempDir, "a", "b"), jobs[2].galleryDirectory)
+}
@@ -0,0 +1,53 @@
+package gallery
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"path/filepath"
+)
+
+// Name of the album tree file in the gallery root, read by the sidebar on every album page
+const albumTreeFile = "albumtree.json"
+
+// albumTreeNode is one album in the album tree. Paths are URL-escaped and relative to
+// the gallery root, the root album's path is empty.
+type albumTreeNode struct {
+	Title  string          `json:"title"`
+	Path   string          `json:"path"`
+	Albums []albumTreeNode `json:"albums,omitempty"`
+}
+
+// createAlbumTree recursively creates the album tree of the source directory
+func createAlbumTree(source directory) albumTreeNode {
+	node := albumTreeNode{
+		Title: albumTitle(source),
+		Path:  escapeURLPath(filepath.ToSlash(source.relPath)),
+	}
+	for _, subdir := range source.subdirectories {
+		node.Albums = append(node.Albums, createAlbumTree(subdir))
+	}
+	return node
+}
+
+// writeAlbumTree writes the tree of all albums as JSON into the gallery root
+func writeAlbumTree(source directory, gallery directory, dryRun bool, config configuration) error {
+	treePath := filepath.Join(gallery.absPath, albumTreeFile)
+	if dryRun {
+		log.Println("Would create album tree:", treePath)
+		return nil
+	}
+
+	tree, err := json.Marshal(createAlbumTree(source))
+	if err != nil {
+		return fmt.Errorf("couldn't encode album tree %s: %w", treePath, err)
+	}
+
+	err = writeFile(treePath, tree, config)
+	if err != nil {
+		return fmt.Errorf("couldn't write album tree %s: %w", treePath, err)
+	}
+
+	logProgress(config, "Created album tree:", treePath)
+	return nil
+}
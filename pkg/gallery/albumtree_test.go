@@ -0,0 +1,59 @@
+package gallery
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateAlbumTree(t *testing.T) {
+	source := directory{
+		name: "Photos",
+		subdirectories: []directory{
+			{name: "2019", relPath: "2019", subdirectories: []directory{
+				{name: "New York", relPath: filepath.Join("2019", "New York"), album: albumConfig{Title: "Big Apple"}},
+			}},
+			{name: "2020", relPath: "2020"},
+		},
+	}
+
+	tree := createAlbumTree(source)
+	assert.EqualValues(t, "Photos", tree.Title)
+	assert.EqualValues(t, "", tree.Path)
+	assert.Len(t, tree.Albums, 2)
+	assert.EqualValues(t, "2019/New%20York", tree.Albums[0].Albums[0].Path)
+	assert.EqualValues(t, "Big Apple", tree.Albums[0].Albums[0].Title)
+	assert.Nil(t, tree.Albums[1].Albums)
+}
+
+func TestWriteAlbumTree(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	config.assets.albumTree = true
+	source := directory{name: "Photos", subdirectories: []directory{{name: "trip", relPath: "trip"}}}
+	gallery := directory{absPath: tempDir}
+
+	writeAlbumTree(source, gallery, true, config)
+	assert.NoFileExists(t, filepath.Join(tempDir, albumTreeFile))
+
+	writeAlbumTree(source, gallery, false, config)
+	contents, err := os.ReadFile(filepath.Join(tempDir, albumTreeFile))
+	assert.NoError(t, err)
+	var tree albumTreeNode
+	err = json.Unmarshal(contents, &tree)
+	assert.NoError(t, err)
+	assert.EqualValues(t, createAlbumTree(source), tree)
+
+	createHTML(1, source.subdirectories[0], tempDir, testTemplates(t, config).html, false, config)
+	html, err := os.ReadFile(filepath.Join(tempDir, config.assets.htmlFile))
+	assert.NoError(t, err)
+	assert.Contains(t, string(html), `data-tree="../albumtree.json" data-path="trip"`)
+}
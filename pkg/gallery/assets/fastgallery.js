@@ -0,0 +1,578 @@
+// check that the HTML page including us has set the pictures array
+if (typeof pictures == 'undefined') {
+    throw new Error("pictures array not defined")
+}
+
+// Hard-coded configuration
+const videoExtension = "mp4"
+const videoMIMEType = "video/mp4"
+
+// global variable maintains currently shown picture number (pictures[] array)
+var currentPicture
+
+// create hover effect shadow for all box elements
+const hoverOnBox = (event) => {
+    event.target.classList.remove("box-shadow")
+    event.target.classList.remove("border-gray")
+    event.target.classList.add("box-shadow-large")
+    event.target.classList.add("border-gray-dark")
+}
+
+const hoverOffBox = (event) => {
+    event.target.classList.remove("border-gray-dark")
+    event.target.classList.remove("box-shadow-large")
+    event.target.classList.add("box-shadow")
+    event.target.classList.add("border-gray")
+}
+
+const registerBoxEventHandlers = (element) => {
+    element.addEventListener("mouseenter", hoverOnBox)
+    element.addEventListener("mouseleave", hoverOffBox)
+}
+
+var boxes = document.getElementsByClassName("box")
+for (let box of boxes) {
+    registerBoxEventHandlers(box)
+}
+
+// create hover effect for modal navigation elements
+// const hoverOnNav = (event) => {}
+
+// logic to show and hide picture modal
+const displayModal = (display) => {
+    if (display) {
+        document.getElementById("modal").hidden = false
+        // document.getElementById("thumbnails").hidden = true
+    } else {
+        // document.getElementById("thumbnails").hidden = false
+        document.getElementById("modal").hidden = true
+        document.getElementById("modalMedia").innerHTML = ""
+        window.location.hash = ""
+        stopSlideshow()
+    }
+}
+
+// TODO add swipe support https://stackoverflow.com/questions/2264072/detect-a-finger-swipe-through-javascript-on-the-iphone-and-android
+
+// modal previous and next picture button logic
+const preload = (number) => {
+    var preloadLink = document.createElement("link")
+    preloadLink.rel = "prefetch"
+    preloadLink.href = encodeURI(pictures[number].fullsize)
+    const fileExtension = preloadLink.href.split("\.").pop()
+    if (fileExtension == videoExtension) {
+        preloadLink.as = "video"
+    } else {
+        preloadLink.as = "image"
+    }
+    document.head.appendChild(preloadLink)
+}
+
+const prevPicture = () => {
+    changePicture(getPrevPicture())
+    preload(getPrevPicture())
+}
+
+const getPrevPicture = () => {
+    if (!isNaN(currentPicture)) {
+        if (currentPicture === 0) {
+            return (pictures.length - 1)
+        } else if (currentPicture < 0 || currentPicture >= pictures.length) {
+            console.error("Invalid currentPicture, 0.." + pictures.length - 1 + ": " + currentPicture)
+        } else {
+            return (currentPicture - 1)
+        }
+    } else {
+        console.error("Invalid currentPicture, NaN: " + currentPicture)
+    }
+}
+
+const nextPicture = () => {
+    changePicture(getNextPicture())
+    preload(getNextPicture())
+}
+
+const getNextPicture = () => {
+    if (!isNaN(currentPicture)) {
+        if (currentPicture === pictures.length - 1) {
+            return (0)
+        } else if (currentPicture < 0 || currentPicture >= pictures.length) {
+            console.error("Invalid currentPicture, 0.." + pictures.length - 1 + ": " + currentPicture)
+        } else {
+            return (currentPicture + 1)
+        }
+    } else {
+        console.error("Invalid currentPicture, NaN: " + currentPicture)
+    }
+}
+
+// modal description shows the caption from the XMP sidecar, falling back to the filename,
+// followed by the capture date, star rating and keywords if there are any
+const describePicture = (picture) => {
+    var description = picture.caption ? picture.caption : picture.filename
+    if (picture.taken) {
+        description = description + " \u00b7 " + picture.taken
+    }
+    if (picture.rating > 0) {
+        description = description + " " + "\u2605".repeat(picture.rating)
+    }
+    if (picture.keywords) {
+        description = description + " (" + picture.keywords + ")"
+    }
+    return description
+}
+
+// modal details show the original's dimensions and file size, e.g. "4032×3024 · 3.2 MB"
+const describeOriginal = (picture) => {
+    var details = []
+    if (picture.width > 0 && picture.height > 0) {
+        details.push(picture.width + "\u00d7" + picture.height)
+    }
+    if (picture.size) {
+        details.push(picture.size)
+    }
+    return details.join(" \u00b7 ")
+}
+
+// info panel lists the capture date, camera, exposure and focal length from EXIF and the
+// original's dimensions and size, leaving out what isn't known
+const describeInfo = (picture) => {
+    const rows = [
+        ["Taken", picture.taken],
+        ["Camera", picture.camera],
+        ["Exposure", picture.exposure],
+        ["Focal length", picture.focalLength],
+        ["Original", describeOriginal(picture)]
+    ]
+    return rows.filter((row) => row[1])
+}
+
+const showInfo = (picture) => {
+    const panel = document.getElementById("modalInfo")
+    panel.innerHTML = ""
+    for (const [term, description] of describeInfo(picture)) {
+        const termElement = document.createElement("dt")
+        termElement.textContent = term
+        const descriptionElement = document.createElement("dd")
+        descriptionElement.textContent = description
+        panel.appendChild(termElement)
+        panel.appendChild(descriptionElement)
+    }
+}
+
+// the info panel stays open while browsing, until it's closed again
+const toggleInfo = () => {
+    const panel = document.getElementById("modalInfo")
+    panel.hidden = !panel.hidden
+}
+
+// named faces are outlined when hovering over the image, and named when hovering over them
+const showFaces = (picture) => {
+    if (!picture.faces || picture.faces.length === 0) {
+        return
+    }
+    const media = document.getElementById("modalMedia")
+    const container = document.createElement("div")
+    container.className = "modalFaces"
+    container.appendChild(media.firstChild)
+    for (const face of picture.faces) {
+        const region = document.createElement("div")
+        region.className = "modalFace"
+        region.style.left = face.left + "%"
+        region.style.top = face.top + "%"
+        region.style.width = face.width + "%"
+        region.style.height = face.height + "%"
+        const name = document.createElement("span")
+        name.textContent = face.name
+        region.appendChild(name)
+        container.appendChild(region)
+    }
+    media.appendChild(container)
+}
+
+// function to change picture in modal, used by hashNavigate, and next/prevPicture
+const changePicture = (number) => {
+    thumbnailFilename = pictures[number].thumbnail
+    window.location.hash = pictures[number].filename
+    const fileExtension = pictures[number].fullsize.split("\.").pop()
+    if (fileExtension == videoExtension) {
+        // Pages from older versions don't tell the codecs of videos
+        const type = (typeof videoType == 'undefined' || !videoType) ? videoMIMEType : videoType
+        const video = document.createElement("video")
+        video.controls = true
+        video.playsInline = true
+        video.preload = "metadata"
+        video.setAttribute("x-webkit-airplay", "allow")
+        const source = document.createElement("source")
+        source.src = encodeURI(pictures[number].fullsize)
+        source.type = type
+        video.appendChild(source)
+        document.getElementById("modalMedia").innerHTML = ""
+        document.getElementById("modalMedia").appendChild(video)
+    } else {
+        // Size the image up front if we know its dimensions, so the modal doesn't jump around while loading
+        var dimensions = ""
+        if (pictures[number].fullsizeWidth > 0 && pictures[number].fullsizeHeight > 0) {
+            dimensions = " width=\"" + pictures[number].fullsizeWidth + "\" height=\"" + pictures[number].fullsizeHeight + "\""
+        }
+        // Browsers supporting WebP load its version instead, the others fall back to the JPEG
+        var webp = ""
+        if (pictures[number].webp) {
+            webp = "<source type=\"image/webp\" srcset=\"" + pictures[number].webp + "\">"
+        }
+        document.getElementById("modalMedia").innerHTML = "<picture>" + webp + "<img src=\"" + encodeURI(pictures[number].fullsize) + "\" alt=\"" + pictures[number].filename + "\" class=\"modalImage\"" + dimensions + "></picture>"
+        showFaces(pictures[number])
+    }
+    document.getElementById("modalDescription").textContent = describePicture(pictures[number])
+    document.getElementById("modalDownload").href = pictures[number].original
+    document.getElementById("modalDetails").textContent = describeOriginal(pictures[number])
+    showInfo(pictures[number])
+    currentPicture = number
+}
+
+// album tree sidebar lists all albums, expanded down to the current one. Album links end
+// with the filename of album pages, unless they're index files.
+const createAlbumTreeList = (albums, root, currentPath, index) => {
+    const list = document.createElement("ul")
+    for (const album of albums) {
+        const item = document.createElement("li")
+        const link = document.createElement("a")
+        link.href = album.path ? root + album.path + "/" + index : root + index || "./"
+        link.textContent = album.title
+        if (album.path === currentPath) {
+            link.classList.add("text-bold")
+        }
+        if (album.albums) {
+            const details = document.createElement("details")
+            const summary = document.createElement("summary")
+            summary.appendChild(link)
+            details.appendChild(summary)
+            details.appendChild(createAlbumTreeList(album.albums, root, currentPath, index))
+            details.open = album.path === "" || currentPath === album.path || currentPath.startsWith(album.path + "/")
+            item.appendChild(details)
+        } else {
+            item.appendChild(link)
+        }
+        list.appendChild(item)
+    }
+    return list
+}
+
+// the album tree is loaded from the gallery root, which album links are relative to
+const loadAlbumTree = () => {
+    const sidebar = document.getElementById("albumTree")
+    if (!sidebar) {
+        return
+    }
+    const treeFile = sidebar.dataset.tree
+    const root = treeFile.substring(0, treeFile.lastIndexOf("/") + 1)
+    fetch(treeFile)
+        .then((response) => response.json())
+        .then((tree) => sidebar.appendChild(createAlbumTreeList([tree], root, sidebar.dataset.path, sidebar.dataset.index || "")))
+        .catch((error) => console.error("couldn't load album tree:", error))
+}
+
+const toggleAlbumTree = () => {
+    const sidebar = document.getElementById("albumTree")
+    sidebar.hidden = !sidebar.hidden
+}
+
+loadAlbumTree()
+
+// proofing mode lets visitors pick photos, remembering the picks of each album
+const picksKey = "fastgallery-picks:" + window.location.pathname
+
+const getPickedBoxes = () => {
+    return Array.from(document.getElementsByClassName("pick")).filter((box) => box.checked)
+}
+
+// list of picked photos by their number and filename, one per line
+const describePicks = () => {
+    return getPickedBoxes().map((box) => box.nextElementSibling.textContent + " " + box.dataset.filename).join("\n")
+}
+
+const updatePicks = () => {
+    const picked = getPickedBoxes()
+    localStorage.setItem(picksKey, JSON.stringify(picked.map((box) => box.dataset.id)))
+    document.getElementById("pickCount").textContent = picked.length
+    const email = document.getElementById("pickEmail")
+    if (email) {
+        const proofing = document.getElementById("proofing")
+        email.href = "mailto:" + proofing.dataset.email +
+            "?subject=" + encodeURIComponent("Picks: " + proofing.dataset.title) +
+            "&body=" + encodeURIComponent(describePicks())
+    }
+}
+
+const loadPicks = () => {
+    if (!document.getElementById("proofing")) {
+        return
+    }
+    let picks = []
+    try {
+        picks = JSON.parse(localStorage.getItem(picksKey)) || []
+    } catch (error) {
+        console.error("couldn't read picks:", error)
+    }
+    for (const box of document.getElementsByClassName("pick")) {
+        box.checked = picks.includes(box.dataset.id)
+    }
+    updatePicks()
+}
+
+const copyPicks = () => {
+    navigator.clipboard.writeText(describePicks())
+        .catch((error) => console.error("couldn't copy picks:", error))
+}
+
+const downloadPicks = () => {
+    const link = document.createElement("a")
+    link.href = URL.createObjectURL(new Blob([describePicks() + "\n"], { type: "text/plain" }))
+    link.download = document.getElementById("proofing").dataset.title + " picks.txt"
+    link.click()
+    setTimeout(() => URL.revokeObjectURL(link.href), 0)
+}
+
+const clearPicks = () => {
+    for (const box of document.getElementsByClassName("pick")) {
+        box.checked = false
+    }
+    updatePicks()
+}
+
+loadPicks()
+
+// thumbnail grid density is chosen with the S/M/L buttons, remembered across albums
+const densityKey = "fastgallery-density"
+const densities = ["small", "medium", "large"]
+
+const setDensity = (density) => {
+    if (!densities.includes(density)) {
+        density = "medium"
+    }
+    const tiles = document.getElementById("tiles")
+    for (const name of densities) {
+        tiles.classList.toggle("density-" + name, name === density)
+    }
+    for (const button of document.querySelectorAll("#density button")) {
+        button.classList.toggle("selected", button.dataset.density === density)
+        button.setAttribute("aria-pressed", button.dataset.density === density)
+    }
+    try {
+        localStorage.setItem(densityKey, density)
+    } catch (error) {
+        console.error("couldn't save thumbnail size:", error)
+    }
+}
+
+const loadDensity = () => {
+    let density = "medium"
+    try {
+        density = localStorage.getItem(densityKey) || density
+    } catch (error) {
+        console.error("couldn't read thumbnail size:", error)
+    }
+    setDensity(density)
+}
+
+loadDensity()
+
+// visitors on slow or metered connections are offered the lite version of the gallery
+const showLiteBanner = () => {
+    const banner = document.getElementById("liteBanner")
+    const connection = navigator.connection
+    if (banner && connection && (connection.saveData || ["slow-2g", "2g", "3g"].includes(connection.effectiveType))) {
+        banner.hidden = false
+    }
+}
+
+showLiteBanner()
+
+// slideshow moves to the next picture every few seconds, playing the album's music if
+// it has any. Music starts muted, browsers only let visitors turn it on themselves.
+const slideshowInterval = 5000
+var slideshowTimer = null
+
+const setControlIcon = (id, icon) => {
+    const control = document.getElementById(id)
+    if (control) {
+        control.innerHTML = '<i data-feather="' + icon + '"></i>'
+        feather.replace()
+    }
+}
+
+const startSlideshow = () => {
+    if (pictures.length === 0) {
+        return
+    }
+    if (document.getElementById("modal").hidden) {
+        changePicture(0)
+        displayModal(true)
+    }
+    clearInterval(slideshowTimer)
+    slideshowTimer = setInterval(nextPicture, slideshowInterval)
+    setControlIcon("slideshowControl", "pause")
+
+    const music = document.getElementById("music")
+    if (music) {
+        music.play().catch((error) => console.error("couldn't play music:", error))
+    }
+}
+
+const stopSlideshow = () => {
+    if (slideshowTimer === null) {
+        return
+    }
+    clearInterval(slideshowTimer)
+    slideshowTimer = null
+    setControlIcon("slideshowControl", "play")
+
+    const music = document.getElementById("music")
+    if (music) {
+        music.pause()
+    }
+}
+
+const toggleSlideshow = () => {
+    if (slideshowTimer === null) {
+        startSlideshow()
+    } else {
+        stopSlideshow()
+    }
+}
+
+const toggleMusic = () => {
+    const music = document.getElementById("music")
+    music.muted = !music.muted
+    setControlIcon("musicControl", music.muted ? "volume-x" : "volume-2")
+}
+
+// if URL links directly to thumbnail via hash link, open modal for that pic on page load
+const hashNavigate = () => {
+    if (window.location.hash) {
+        const filename = decodeURI(window.location.hash.substring(1))
+        id = pictures.findIndex(item => item.filename == filename)
+        if (id != -1 && id >= 0 && id < pictures.length) {
+            changePicture(id)
+            displayModal(true)
+        } else {
+            displayModal(false)
+            console.error("Invalid thumbnail link provided after # in URI")
+        }
+    } else {
+        displayModal(false)
+    }
+}
+
+// keyboard navigation between the album and picture tiles of the index page
+var selectedTile = -1
+
+const getVisibleTiles = () => {
+    return Array.from(document.getElementsByClassName("tile")).filter((tile) => !tile.hidden)
+}
+
+const selectTile = (number) => {
+    const tiles = getVisibleTiles()
+    for (const tile of tiles) {
+        tile.classList.remove("selected")
+    }
+    if (tiles.length === 0) {
+        selectedTile = -1
+        return
+    }
+    selectedTile = Math.min(Math.max(number, 0), tiles.length - 1)
+    tiles[selectedTile].classList.add("selected")
+    tiles[selectedTile].scrollIntoView({ block: "nearest" })
+}
+
+// number of tiles on one row, for moving up and down the grid
+const getTilesPerRow = () => {
+    const tiles = getVisibleTiles()
+    let count = 0
+    while (count < tiles.length && tiles[count].offsetTop === tiles[0].offsetTop) {
+        count++
+    }
+    return Math.max(count, 1)
+}
+
+// opens the selected album, or the selected picture in the modal
+const openTile = () => {
+    const tiles = getVisibleTiles()
+    if (selectedTile >= 0 && selectedTile < tiles.length) {
+        tiles[selectedTile].querySelector("a, img").click()
+    }
+}
+
+// type-ahead filter shows only the tiles whose name contains the typed text
+const filterTiles = () => {
+    const text = document.getElementById("filter").value.toLowerCase()
+    for (const tile of document.getElementsByClassName("tile")) {
+        tile.hidden = !tile.dataset.name.toLowerCase().includes(text)
+    }
+    // day headings would be left with no photos below them
+    for (const heading of document.getElementsByClassName("day-heading")) {
+        heading.hidden = text !== ""
+    }
+    selectTile(0)
+}
+
+const showFilter = (display) => {
+    const filter = document.getElementById("filter")
+    filter.hidden = !display
+    if (display) {
+        filter.focus()
+    } else {
+        filter.value = ""
+        filter.blur()
+        filterTiles()
+    }
+}
+
+const checkIndexKey = (event) => {
+    if (event.target.id === "filter") {
+        if (event.key === "Escape") {
+            showFilter(false)
+        } else if (event.key === "Enter" || event.key === "ArrowDown") {
+            event.target.blur()
+            selectTile(0)
+        }
+        return
+    }
+    if (event.ctrlKey || event.metaKey || event.altKey) {
+        return
+    }
+    if (event.key === "ArrowRight" || event.key === "j") {
+        selectTile(selectedTile + 1)
+    } else if (event.key === "ArrowLeft" || event.key === "k") {
+        selectTile(selectedTile - 1)
+    } else if (event.key === "ArrowDown") {
+        selectTile(selectedTile + getTilesPerRow())
+    } else if (event.key === "ArrowUp") {
+        selectTile(selectedTile - getTilesPerRow())
+    } else if (event.key === "Enter") {
+        openTile()
+    } else if (event.key === "/") {
+        showFilter(true)
+    } else if (event.key === "Escape") {
+        showFilter(false)
+    } else {
+        return
+    }
+    event.preventDefault()
+}
+
+const checkKey = (event) => {
+    if (document.getElementById("modal").hidden) {
+        checkIndexKey(event)
+    } else if (event.key === "ArrowLeft") {
+        prevPicture()
+    } else if (event.key === "ArrowRight") {
+        nextPicture()
+    } else if (event.key === "Escape") {
+        displayModal(false)
+    }
+}
+
+document.onkeydown = checkKey
+document.getElementById("filter").oninput = filterTiles
+window.onpopstate = hashNavigate
\ No newline at end of file
@@ -0,0 +1,67 @@
+// Album pages are cached and served from the cache while their hash in the gallery's
+// page list is the same as in their fastgallery-hash meta tag
+const pageCacheName = "fastgallery-pages"
+const pageHashesFile = "pages.json"
+const pageHashPattern = /<meta name="fastgallery-hash" content="([0-9a-f]+)">/
+
+self.addEventListener("install", (event) => {
+    console.log("Service worker installed");
+});
+
+self.addEventListener("activate", (event) => {
+    console.log("Service worker activated");
+});
+
+// getAlbumPath returns the album path of a page URL, the way it's listed in the page
+// hashes: relative to the gallery root, without the page's filename or trailing slashes
+function getAlbumPath(url) {
+    const scopePath = new URL(self.registration.scope).pathname
+    let albumPath = decodeURIComponent(new URL(url).pathname)
+    if (albumPath.startsWith(scopePath)) {
+        albumPath = albumPath.substring(scopePath.length)
+    }
+    return albumPath.replace(/[^/]+\.html?$/, "").replace(/\/+$/, "")
+}
+
+// isPageCurrent checks whether a cached page has the album's current hash
+async function isPageCurrent(url, cachedPage) {
+    const hashes = await fetch(new URL(pageHashesFile, self.registration.scope), { cache: "no-store" })
+        .then((response) => response.json())
+    const match = (await cachedPage.text()).match(pageHashPattern)
+    return match !== null && hashes[getAlbumPath(url)] === match[1]
+}
+
+self.addEventListener("fetch", (event) => {
+    if (event.request.mode === "navigate") {
+        event.respondWith(
+            (async () => {
+                const cache = await caches.open(pageCacheName)
+                const cachedPage = await cache.match(event.request)
+                if (cachedPage) {
+                    try {
+                        if (await isPageCurrent(event.request.url, cachedPage.clone())) {
+                            return cachedPage
+                        }
+                    } catch (error) {
+                        // Without a network connection, the cached page is better than nothing
+                        return cachedPage
+                    }
+                }
+
+                try {
+                    const response = await fetch(event.request)
+                    if (response.ok) {
+                        cache.put(event.request, response.clone())
+                    }
+                    return response
+                } catch (error) {
+                    if (cachedPage) {
+                        return cachedPage
+                    }
+                    return new Response("<h1>No network connection</h1>Retrying...<script>setTimeout(() => { window.location.reload(1); }, 5000);</script>",
+                        { status: 200, headers: { 'Content-type': 'text/html' } })
+                }
+            })()
+        );
+    }
+});
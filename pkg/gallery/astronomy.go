@@ -0,0 +1,142 @@
+package gallery
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Albums spanning more days than this, like a year's photos, get no sun and moon lines
+const astronomyMaxDays = 14
+
+// Layouts of the day and times in the album header's sun and moon lines
+const (
+	astronomyDayLayout  = "Mon 2 Jan 2006"
+	astronomyTimeLayout = "15:04"
+)
+
+// Julian date of the J2000 epoch, and the mean length of the lunar month in days
+const (
+	julianEpoch  = 2451545.0
+	synodicMonth = 29.530588853
+)
+
+// The eight moon phases, starting from the new moon
+var moonPhases = []string{
+	"New moon",
+	"Waxing crescent moon",
+	"First quarter moon",
+	"Waxing gibbous moon",
+	"Full moon",
+	"Waning gibbous moon",
+	"Last quarter moon",
+	"Waning crescent moon",
+}
+
+// getJulianDate returns the Julian date of a point in time
+func getJulianDate(moment time.Time) float64 {
+	return float64(moment.Unix())/86400 + 2440587.5
+}
+
+// fromJulianDate returns the point in time of a Julian date
+func fromJulianDate(julianDate float64) time.Time {
+	return time.Unix(int64(math.Round((julianDate-2440587.5)*86400)), 0)
+}
+
+// getSunriseSunset calculates when the sun rises and sets on a day at a location, using
+// the sunrise equation. The day is taken from the date of day, whatever its time is.
+// polarDay and polarNight are set instead when the sun doesn't rise or set at all.
+func getSunriseSunset(day time.Time, location geoPoint) (sunrise time.Time, sunset time.Time, polarDay bool, polarNight bool) {
+	radians := math.Pi / 180
+	noon := time.Date(day.Year(), day.Month(), day.Day(), 12, 0, 0, 0, time.UTC)
+
+	// Mean solar noon, solar mean anomaly, equation of the center and ecliptic longitude
+	meanNoon := getJulianDate(noon) - julianEpoch + 0.0008 - location.longitude/360
+	anomaly := math.Mod(357.5291+0.98560028*meanNoon, 360)
+	center := 1.9148*math.Sin(anomaly*radians) + 0.02*math.Sin(2*anomaly*radians) + 0.0003*math.Sin(3*anomaly*radians)
+	longitude := math.Mod(anomaly+center+180+102.9372, 360)
+	transit := julianEpoch + meanNoon + 0.0053*math.Sin(anomaly*radians) - 0.0069*math.Sin(2*longitude*radians)
+
+	// Declination of the sun and the hour angle of sunrise, allowing for refraction and
+	// the size of the sun's disc
+	declination := math.Asin(math.Sin(longitude*radians) * math.Sin(23.4397*radians))
+	latitude := location.latitude * radians
+	cosHourAngle := (math.Sin(-0.833*radians) - math.Sin(latitude)*math.Sin(declination)) / (math.Cos(latitude) * math.Cos(declination))
+	if cosHourAngle < -1 {
+		return time.Time{}, time.Time{}, true, false
+	}
+	if cosHourAngle > 1 {
+		return time.Time{}, time.Time{}, false, true
+	}
+	hourAngle := math.Acos(cosHourAngle) / radians
+
+	return fromJulianDate(transit - hourAngle/360), fromJulianDate(transit + hourAngle/360), false, false
+}
+
+// getMoonPhase returns the name of the moon's phase at a point in time, counting the
+// days since a known new moon
+func getMoonPhase(moment time.Time) string {
+	age := math.Mod((getJulianDate(moment)-2451550.1)/synodicMonth, 1)
+	if age < 0 {
+		age++
+	}
+	return moonPhases[int(age*8+0.5)%8]
+}
+
+// createAstronomyLines describes the sunrise, sunset and moon phase of each day in an
+// album, at the average location of the day's geotagged photos, e.g. "Sat 5 Jul 2025 ·
+// Sunrise 04:02 · Sunset 22:41 · Waning crescent moon". Days are in the configured time
+// zone and sorted. Returns nil if the album has no geotagged photos with dates, or spans
+// too many days.
+func createAstronomyLines(source directory, config configuration) (lines []string) {
+	type dayLocation struct {
+		day       time.Time
+		latitude  float64
+		longitude float64
+		count     int
+	}
+	days := make(map[string]*dayLocation)
+	for _, sourceFile := range source.files {
+		if !sourceFile.geotagged || sourceFile.takenTime.IsZero() {
+			continue
+		}
+		taken := sourceFile.takenTime.In(config.media.timezone)
+		key := taken.Format(timelineDayLayout)
+		if days[key] == nil {
+			days[key] = &dayLocation{day: time.Date(taken.Year(), taken.Month(), taken.Day(), 12, 0, 0, 0, config.media.timezone)}
+		}
+		days[key].latitude += sourceFile.latitude
+		days[key].longitude += sourceFile.longitude
+		days[key].count++
+	}
+	if len(days) == 0 || len(days) > astronomyMaxDays {
+		return nil
+	}
+
+	var keys []string
+	for key := range days {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		day := days[key]
+		location := geoPoint{latitude: day.latitude / float64(day.count), longitude: day.longitude / float64(day.count)}
+		parts := []string{day.day.Format(astronomyDayLayout)}
+		sunrise, sunset, polarDay, polarNight := getSunriseSunset(day.day, location)
+		switch {
+		case polarDay:
+			parts = append(parts, "Midnight sun")
+		case polarNight:
+			parts = append(parts, "Polar night")
+		default:
+			parts = append(parts,
+				"Sunrise "+sunrise.In(config.media.timezone).Format(astronomyTimeLayout),
+				"Sunset "+sunset.In(config.media.timezone).Format(astronomyTimeLayout))
+		}
+		parts = append(parts, getMoonPhase(day.day))
+		lines = append(lines, strings.Join(parts, " · "))
+	}
+	return lines
+}
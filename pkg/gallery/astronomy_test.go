@@ -0,0 +1,55 @@
+package gallery
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetSunriseSunset(t *testing.T) {
+	// Helsinki at midsummer: sunrise 03:54 and sunset 22:50 local time
+	helsinki := geoPoint{latitude: 60.17, longitude: 24.94}
+	sunrise, sunset, polarDay, polarNight := getSunriseSunset(time.Date(2024, 6, 21, 0, 0, 0, 0, time.UTC), helsinki)
+	assert.False(t, polarDay)
+	assert.False(t, polarNight)
+	assert.WithinDuration(t, time.Date(2024, 6, 21, 0, 54, 0, 0, time.UTC), sunrise, 3*time.Minute)
+	assert.WithinDuration(t, time.Date(2024, 6, 21, 19, 50, 0, 0, time.UTC), sunset, 3*time.Minute)
+
+	// Tromsø has midnight sun in summer and polar night in winter
+	tromso := geoPoint{latitude: 69.65, longitude: 18.96}
+	_, _, polarDay, _ = getSunriseSunset(time.Date(2024, 6, 21, 0, 0, 0, 0, time.UTC), tromso)
+	assert.True(t, polarDay)
+	_, _, _, polarNight = getSunriseSunset(time.Date(2024, 12, 21, 0, 0, 0, 0, time.UTC), tromso)
+	assert.True(t, polarNight)
+}
+
+func TestGetMoonPhase(t *testing.T) {
+	assert.Equal(t, "Full moon", getMoonPhase(time.Date(2024, 6, 22, 1, 0, 0, 0, time.UTC)))
+	assert.Equal(t, "New moon", getMoonPhase(time.Date(2024, 7, 5, 23, 0, 0, 0, time.UTC)))
+	assert.Equal(t, "First quarter moon", getMoonPhase(time.Date(2024, 7, 13, 22, 0, 0, 0, time.UTC)))
+	assert.Equal(t, "Waning crescent moon", getMoonPhase(time.Date(2024, 7, 2, 12, 0, 0, 0, time.UTC)))
+}
+
+func TestCreateAstronomyLines(t *testing.T) {
+	config := initializeConfig()
+	config.media.timezone = time.UTC
+
+	assert.Nil(t, createAstronomyLines(directory{files: []file{{name: "a.jpg", takenTime: time.Date(2024, 6, 21, 12, 0, 0, 0, time.UTC)}}}, config))
+
+	source := directory{files: []file{
+		{name: "b.jpg", takenTime: time.Date(2024, 12, 21, 12, 0, 0, 0, time.UTC), geotagged: true, latitude: 69.65, longitude: 18.96},
+		{name: "a.jpg", takenTime: time.Date(2024, 6, 22, 8, 0, 0, 0, time.UTC), geotagged: true, latitude: 60.17, longitude: 24.94},
+		{name: "c.jpg", takenTime: time.Date(2024, 6, 22, 18, 0, 0, 0, time.UTC), geotagged: true, latitude: 60.17, longitude: 24.94},
+	}}
+	lines := createAstronomyLines(source, config)
+	assert.Len(t, lines, 2)
+	assert.Regexp(t, `^Sat 22 Jun 2024 · Sunrise 00:5\d · Sunset 19:5\d · Full moon$`, lines[0])
+	assert.Regexp(t, `^Sat 21 Dec 2024 · Polar night · .* moon$`, lines[1])
+
+	var long []file
+	for day := 1; day <= astronomyMaxDays+1; day++ {
+		long = append(long, file{takenTime: time.Date(2024, 6, day, 12, 0, 0, 0, time.UTC), geotagged: true, latitude: 60, longitude: 24})
+	}
+	assert.Nil(t, createAstronomyLines(directory{files: long}, config))
+}
@@ -0,0 +1,169 @@
+package gallery
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// htmlAttachment struct is one downloadable attachment listed on the album page
+type htmlAttachment struct {
+	Name string
+	URL  string
+	Size string
+}
+
+// parseAttachmentExtensions normalizes --attachment-ext values to lowercase extensions
+// with a leading dot, so both gpx and .GPX match track.gpx
+func parseAttachmentExtensions(values []string) (extensions []string) {
+	for _, value := range values {
+		extension := strings.ToLower(strings.TrimSpace(value))
+		if extension == "" {
+			continue
+		}
+		if !strings.HasPrefix(extension, ".") {
+			extension = "." + extension
+		}
+		extensions = append(extensions, extension)
+	}
+	return extensions
+}
+
+// isAttachmentFile checks whether a file has one of the attachment extensions
+func isAttachmentFile(filename string, config configuration) bool {
+	extension := strings.ToLower(filepath.Ext(filename))
+	for _, attachmentExtension := range config.files.attachmentExts {
+		if extension == attachmentExtension {
+			return true
+		}
+	}
+	return false
+}
+
+// readDirectoryAttachments finds the attachments of a source directory, leaving out the
+// ones marked private. Needs the album.yaml to be read already.
+func readDirectoryAttachments(source *directory, config configuration) {
+	if len(config.files.attachmentExts) == 0 || source.album.Private {
+		return
+	}
+
+	entries, err := os.ReadDir(source.absPath)
+	if err != nil {
+		log.Println("couldn't read attachments of directory:", source.absPath, err.Error())
+		return
+	}
+
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !isAttachmentFile(entry.Name(), config) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			log.Println("couldn't read attachment:", filepath.Join(source.absPath, entry.Name()), err.Error())
+			continue
+		}
+		attachment := file{
+			name:    entry.Name(),
+			relPath: filepath.Join(source.relPath, entry.Name()),
+			absPath: filepath.Join(source.absPath, entry.Name()),
+			modTime: info.ModTime(),
+			size:    info.Size(),
+		}
+		if !isPrivateFile(attachment) {
+			source.attachments = append(source.attachments, attachment)
+		}
+	}
+}
+
+// updateAttachments copies the new and changed attachments of a source directory into
+// the album's attachment directory in the gallery, marking the ones already there as
+// existing
+func updateAttachments(source *directory, galleryDirectory string, dryRun bool, config configuration) {
+	attachmentDirectory := filepath.Join(galleryDirectory, config.files.attachmentDir)
+	if len(source.attachments) > 0 {
+		err := createDirectory(attachmentDirectory, dryRun, config)
+		if err != nil {
+			log.Println(err.Error())
+			return
+		}
+	}
+
+	for i, attachment := range source.attachments {
+		destination := filepath.Join(attachmentDirectory, attachment.name)
+		if galleryInfo, err := os.Stat(destination); err == nil && galleryInfo.Size() == attachment.size && !galleryInfo.ModTime().Before(attachment.modTime) {
+			source.attachments[i].exists = true
+			continue
+		}
+
+		if dryRun {
+			log.Println("Would copy attachment:", attachment.absPath, destination)
+			continue
+		}
+		err := copyIntoGallery(attachment.absPath, destination, config)
+		if err != nil {
+			log.Println("couldn't copy attachment:", attachment.absPath, err.Error())
+			continue
+		}
+		logProgress(config, "Copied attachment:", destination)
+	}
+}
+
+// findStaleAttachments returns the paths of the attachments in an album's gallery
+// directory which are no longer in the source directory
+func findStaleAttachments(source directory, galleryDirectory string, config configuration) (stale []string) {
+	attachmentDirectory := filepath.Join(galleryDirectory, config.files.attachmentDir)
+	entries, err := os.ReadDir(attachmentDirectory)
+	if err != nil {
+		return nil
+	}
+
+	current := make(map[string]bool)
+	for _, attachment := range source.attachments {
+		current[attachment.name] = true
+	}
+	for _, entry := range entries {
+		if !current[entry.Name()] {
+			stale = append(stale, filepath.Join(attachmentDirectory, entry.Name()))
+		}
+	}
+	return stale
+}
+
+// cleanAttachments recursively removes the attachments no longer in the source from
+// the gallery
+func cleanAttachments(source directory, galleryRoot string, dryRun bool, config configuration) {
+	// Albums outside the subtree of a partial run weren't read
+	if source.keptStats != nil {
+		return
+	}
+
+	for _, stalePath := range findStaleAttachments(source, filepath.Join(galleryRoot, source.relPath), config) {
+		if dryRun {
+			log.Println("would clean up attachment:", stalePath)
+			continue
+		}
+		err := getStorage(config).RemoveAll(stalePath)
+		if err != nil {
+			log.Println("couldn't delete stale attachment", stalePath, ":", err.Error())
+			continue
+		}
+		logProgress(config, "Cleaned up attachment:", stalePath)
+	}
+
+	for _, subdir := range source.subdirectories {
+		cleanAttachments(subdir, galleryRoot, dryRun, config)
+	}
+}
+
+// getHTMLAttachments returns the attachments of an album for its page
+func getHTMLAttachments(source directory, config configuration) (attachments []htmlAttachment) {
+	for _, attachment := range source.attachments {
+		attachments = append(attachments, htmlAttachment{
+			Name: attachment.name,
+			URL:  filepath.ToSlash(filepath.Join(config.files.attachmentDir, attachment.name)),
+			Size: formatFileSize(attachment.size),
+		})
+	}
+	return attachments
+}
@@ -0,0 +1,62 @@
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAttachmentExtensions(t *testing.T) {
+	assert.EqualValues(t, []string{".gpx", ".pdf"}, parseAttachmentExtensions([]string{"gpx", " .PDF", ""}))
+
+	config := initializeConfig()
+	config.files.attachmentExts = []string{".gpx"}
+	assert.True(t, isAttachmentFile("Track.GPX", config))
+	assert.False(t, isAttachmentFile("notes.txt", config))
+}
+
+func TestAttachments(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	config.files.attachmentExts = []string{".gpx", ".pdf"}
+	sourceDirectory := filepath.Join(tempDir, "source")
+	galleryDirectory := filepath.Join(tempDir, "gallery")
+	for _, path := range []string{sourceDirectory, galleryDirectory} {
+		err = os.Mkdir(path, 0755)
+		assert.NoError(t, err)
+	}
+	for _, filename := range []string{"a.jpg", "track.gpx", "rules.pdf", "secret.private.pdf", "notes.txt"} {
+		err = os.WriteFile(filepath.Join(sourceDirectory, filename), []byte("data"), 0644)
+		assert.NoError(t, err)
+	}
+
+	source := directory{absPath: sourceDirectory}
+	readDirectoryAttachments(&source, config)
+	assert.Len(t, source.attachments, 2)
+	assert.EqualValues(t, "rules.pdf", source.attachments[0].name)
+	assert.EqualValues(t, "track.gpx", source.attachments[1].name)
+
+	updateAttachments(&source, galleryDirectory, false, config)
+	assert.FileExists(t, filepath.Join(galleryDirectory, "_attachments", "track.gpx"))
+	assert.False(t, source.attachments[0].exists)
+	updateAttachments(&source, galleryDirectory, false, config)
+	assert.True(t, source.attachments[0].exists)
+
+	createHTML(0, source, galleryDirectory, testTemplates(t, config).html, false, config)
+	html, err := os.ReadFile(filepath.Join(galleryDirectory, config.assets.htmlFile))
+	assert.NoError(t, err)
+	assert.Contains(t, string(html), `<a href="_attachments/track.gpx" download>track.gpx</a> <span class="text-gray">4 B</span>`)
+
+	source.attachments = source.attachments[1:]
+	assert.EqualValues(t, []string{filepath.Join(galleryDirectory, "_attachments", "rules.pdf")}, findStaleAttachments(source, galleryDirectory, config))
+	cleanAttachments(source, galleryDirectory, false, config)
+	assert.NoFileExists(t, filepath.Join(galleryDirectory, "_attachments", "rules.pdf"))
+	assert.FileExists(t, filepath.Join(galleryDirectory, "_attachments", "track.gpx"))
+}
@@ -0,0 +1,130 @@
+package gallery
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"path/filepath"
+	"sort"
+)
+
+// brokenLink is a link in a gallery page to a file which doesn't exist
+type brokenLink struct {
+	page      string
+	reference string
+}
+
+// auditGallery cross-checks the links of all pages in a gallery against the files in its
+// media directories. Returns the broken links, and the orphans: thumbnails, full-size
+// files and originals which no page links to. Paths are relative to the gallery. Only
+// relies on the layout of the gallery, so galleries made by older versions can be audited.
+// A lite version of the gallery is audited too.
+func auditGallery(galleryDirectory string, config configuration) (broken []brokenLink, orphans []string, err error) {
+	referenced := make(map[string]bool)
+	err = walkGalleryPages(galleryDirectory, config, func(pagePath string, page string) {
+		pageDirectory := filepath.Dir(pagePath)
+		for _, reference := range findReferences(page) {
+			if !referenceExists(pageDirectory, reference) {
+				relativePage, _ := filepath.Rel(galleryDirectory, pagePath)
+				broken = append(broken, brokenLink{page: relativePage, reference: reference})
+				continue
+			}
+			referenced[filepath.Join(pageDirectory, filepath.FromSlash(reference))] = true
+			if unescaped, err := url.PathUnescape(reference); err == nil {
+				referenced[filepath.Join(pageDirectory, filepath.FromSlash(unescaped))] = true
+			}
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = filepath.WalkDir(galleryDirectory, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && path == filepath.Join(galleryDirectory, config.files.liteDir) {
+			return filepath.SkipDir
+		}
+		if entry.IsDir() || filepath.Dir(path) == galleryDirectory || !reservedDirectory(filepath.Base(filepath.Dir(path)), config) {
+			return nil
+		}
+		// Panorama tiles don't link to the WebP version of their thumbnail, it goes with the JPEG
+		if filepath.Ext(path) == webpExtension && referenced[stripExtension(path)+config.files.imageExtension] {
+			return nil
+		}
+		if !referenced[path] {
+			relativePath, _ := filepath.Rel(galleryDirectory, path)
+			orphans = append(orphans, relativePath)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The lite version of the gallery is a gallery of its own
+	liteDirectory := filepath.Join(galleryDirectory, config.files.liteDir)
+	if isDirectory(liteDirectory) {
+		liteBroken, liteOrphans, err := auditGallery(liteDirectory, config)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, link := range liteBroken {
+			broken = append(broken, brokenLink{page: filepath.Join(config.files.liteDir, link.page), reference: link.reference})
+		}
+		for _, orphan := range liteOrphans {
+			orphans = append(orphans, filepath.Join(config.files.liteDir, orphan))
+		}
+	}
+
+	sort.Strings(orphans)
+	return broken, orphans, nil
+}
+
+// errAuditFailed is returned by the audit command for a gallery with broken links or orphans
+var errAuditFailed = errors.New("gallery has broken links or orphan files")
+
+// AuditOptions struct holds the options of the audit command, documented by their
+// go-arg tags. Messages gets the broken links and orphans found, which are left out if
+// it's nil.
+type AuditOptions struct {
+	Gallery  string    `arg:"positional,required" help:"Gallery directory to audit"`
+	Config   string    `arg:"--config" help:"configuration file the gallery was built with (default: ~/.config/fastgallery/config.yaml, if it exists)"`
+	Messages io.Writer `arg:"-"`
+}
+
+// Audit lists the broken links and orphan files of a gallery. Returns an error if there
+// are any.
+func Audit(args AuditOptions) error {
+	config, err := loadConfiguration(args.Config)
+	if err != nil {
+		return err
+	}
+	galleryDirectory, _ := filepath.Abs(args.Gallery)
+	if !isDirectory(galleryDirectory) {
+		return errors.New("gallery directory doesn't exist: " + args.Gallery)
+	}
+	applyGalleryOutputProfile(galleryDirectory, &config)
+
+	broken, orphans, err := auditGallery(galleryDirectory, config)
+	if err != nil {
+		return fmt.Errorf("couldn't audit gallery %s: %w", galleryDirectory, err)
+	}
+
+	output := getOutput(args.Messages)
+	for _, link := range broken {
+		fmt.Fprintln(output, "broken link in", link.page, ":", link.reference)
+	}
+	for _, orphan := range orphans {
+		fmt.Fprintln(output, "orphan:", orphan)
+	}
+	fmt.Fprintln(output, "Found", len(broken), "broken links and", len(orphans), "orphans.")
+
+	if len(broken) > 0 || len(orphans) > 0 {
+		return errAuditFailed
+	}
+	return nil
+}
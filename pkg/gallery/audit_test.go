@@ -0,0 +1,63 @@
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditGallery(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	for _, path := range []string{filepath.Join("album", "_thumbnail"), filepath.Join("album", "_fullsize")} {
+		err = os.MkdirAll(filepath.Join(tempDir, path), 0755)
+		assert.NoError(t, err)
+	}
+	for _, path := range []string{
+		"primer.css",
+		filepath.Join("album", "_thumbnail", "a b.jpg"),
+		filepath.Join("album", "_fullsize", "a b.jpg"),
+		filepath.Join("album", "_fullsize", "old.jpg"),
+	} {
+		err = os.WriteFile(filepath.Join(tempDir, path), []byte{}, 0644)
+		assert.NoError(t, err)
+	}
+	page := `<link href="../primer.css"><img src="_thumbnail/a b.jpg"> fullsize: "_fullsize/a%20b.jpg",`
+	err = os.WriteFile(filepath.Join(tempDir, "album", "index.html"), []byte(page+` thumbnail: "_thumbnail/gone.jpg",`), 0644)
+	assert.NoError(t, err)
+
+	broken, orphans, err := auditGallery(tempDir, config)
+	assert.NoError(t, err)
+	assert.EqualValues(t, []brokenLink{{page: filepath.Join("album", "index.html"), reference: "_thumbnail/gone.jpg"}}, broken)
+	assert.EqualValues(t, []string{filepath.Join("album", "_fullsize", "old.jpg")}, orphans)
+
+	err = Audit(AuditOptions{Gallery: tempDir})
+	assert.Equal(t, errAuditFailed, err)
+
+	err = os.Remove(filepath.Join(tempDir, "album", "_fullsize", "old.jpg"))
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(tempDir, "album", "index.html"), []byte(page), 0644)
+	assert.NoError(t, err)
+	err = Audit(AuditOptions{Gallery: tempDir})
+	assert.NoError(t, err)
+
+	// The lite version is audited as a gallery of its own
+	liteDirectory := filepath.Join(tempDir, config.files.liteDir)
+	err = os.MkdirAll(filepath.Join(liteDirectory, "_thumbnail"), 0755)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(liteDirectory, "index.html"), []byte(`<img src="_thumbnail/b.jpg">`), 0644)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(liteDirectory, "_thumbnail", "c.jpg"), []byte{}, 0644)
+	assert.NoError(t, err)
+	broken, orphans, err = auditGallery(tempDir, config)
+	assert.NoError(t, err)
+	assert.EqualValues(t, []brokenLink{{page: filepath.Join("_lite", "index.html"), reference: "_thumbnail/b.jpg"}}, broken)
+	assert.EqualValues(t, []string{filepath.Join("_lite", "_thumbnail", "c.jpg")}, orphans)
+}
@@ -0,0 +1,228 @@
+package gallery
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cheggaaa/pb/v3"
+	"github.com/davidbyttow/govips/v2/vips"
+	"gopkg.in/yaml.v3"
+)
+
+// BatchFile struct holds the galleries built with fastgallery batch. Each job is a source
+// and a gallery directory, and the command-line options to build it with, e.g.
+// ["--cleanup", "--webp"]. Relative directories are relative to the batch file.
+// Concurrency is the number of transformation workers shared by all the galleries.
+type BatchFile struct {
+	Concurrency int        `yaml:"concurrency"`
+	Jobs        []BatchJob `yaml:"jobs"`
+}
+
+// BatchJob struct is one gallery of a batch file
+type BatchJob struct {
+	Source  string   `yaml:"source"`
+	Gallery string   `yaml:"gallery"`
+	Options []string `yaml:"options"`
+}
+
+// Batch struct holds the galleries built by BuildBatch, and the number of transformation
+// workers shared by them, the default concurrency if zero. Verbose turns on the debug
+// messages of libvips. Messages gets the messages of the batch, which are left out if
+// it's nil; the galleries' own messages go where their options say.
+type Batch struct {
+	Galleries   []Options
+	Concurrency int
+	Verbose     bool
+	Messages    io.Writer
+}
+
+// workerPool struct is a pool of transformation workers shared by the galleries of a
+// batch, so a server building many galleries transforms a fixed number of files at a time
+type workerPool struct {
+	jobs chan pooledJob
+	wg   sync.WaitGroup
+}
+
+// pooledJob struct is a transformation job of one of the galleries of a batch, with the
+// progress bar and settings of its gallery. done is marked done once it's transformed.
+type pooledJob struct {
+	job         transformationJob
+	progressBar *pb.ProgressBar
+	config      configuration
+	done        *sync.WaitGroup
+}
+
+// parseBatchFile parses a batch file. Unknown settings are errors like in configuration
+// files, and a batch needs at least one gallery.
+func parseBatchFile(buffer []byte) (batch BatchFile, err error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(buffer))
+	decoder.KnownFields(true)
+	err = decoder.Decode(&batch)
+	if errors.Is(err, io.EOF) {
+		err = nil
+	}
+	if err != nil {
+		return batch, err
+	}
+
+	if batch.Concurrency < 0 {
+		return batch, fmt.Errorf("invalid concurrency, must be positive: %d", batch.Concurrency)
+	}
+	if len(batch.Jobs) == 0 {
+		return batch, errors.New("no jobs, list the galleries to build under jobs")
+	}
+	for i, job := range batch.Jobs {
+		if job.Source == "" || job.Gallery == "" {
+			return batch, errors.New("job " + strconv.Itoa(i+1) + " needs both source and gallery")
+		}
+	}
+	return batch, nil
+}
+
+// ReadBatchFile reads a batch file for fastgallery batch. Relative source and gallery
+// directories of its jobs are made relative to the directory of the batch file. The
+// command-line options of the jobs are left for the command to parse.
+func ReadBatchFile(path string) (BatchFile, error) {
+	buffer, err := os.ReadFile(path)
+	if err != nil {
+		return BatchFile{}, err
+	}
+	batch, err := parseBatchFile(buffer)
+	if err != nil {
+		return batch, err
+	}
+
+	batchPath, _ := filepath.Abs(path)
+	batchDirectory := filepath.Dir(batchPath)
+	for i, job := range batch.Jobs {
+		if !filepath.IsAbs(job.Source) && !isRemoteSource(job.Source) {
+			batch.Jobs[i].Source = filepath.Join(batchDirectory, job.Source)
+		}
+		if !filepath.IsAbs(job.Gallery) {
+			batch.Jobs[i].Gallery = filepath.Join(batchDirectory, job.Gallery)
+		}
+	}
+	return batch, nil
+}
+
+// checkBatch checks the galleries of a batch before any of them is built. Watching the
+// source would never finish, so it's left for single galleries, and no two galleries
+// may be built into the same directory.
+func checkBatch(batch Batch) error {
+	if batch.Concurrency < 0 {
+		return fmt.Errorf("invalid concurrency, must be positive: %d", batch.Concurrency)
+	}
+	galleries := make(map[string]bool)
+	for i, options := range batch.Galleries {
+		if options.Watch {
+			return fmt.Errorf("invalid gallery %d of batch: --watch can't be used in a batch, it never finishes", i+1)
+		}
+		gallery := filepath.Clean(options.Gallery)
+		if galleries[gallery] {
+			return fmt.Errorf("invalid gallery %d of batch: gallery is built by another one already: %s", i+1, options.Gallery)
+		}
+		galleries[gallery] = true
+	}
+	return nil
+}
+
+// startWorkerPool starts a pool of given number of transformation workers
+func startWorkerPool(concurrency int) *workerPool {
+	pool := &workerPool{jobs: make(chan pooledJob)}
+	for i := 0; i < concurrency; i++ {
+		pool.wg.Add(1)
+		go pool.work()
+	}
+	return pool
+}
+
+// work transforms the jobs of the pool until it's stopped
+func (pool *workerPool) work() {
+	defer pool.wg.Done()
+	for thisJob := range pool.jobs {
+		pool.transform(thisJob)
+	}
+}
+
+// transform transforms one job of the pool and marks it done
+func (pool *workerPool) transform(thisJob pooledJob) {
+	defer thisJob.done.Done()
+	transformFile(thisJob.job, thisJob.progressBar, thisJob.config)
+	runtime.GC()
+}
+
+// forward hands the transformation jobs of one gallery to the pool, in place of the
+// gallery's own workers. Marks workerWG done once they're all transformed.
+func (pool *workerPool) forward(workerWG *sync.WaitGroup, jobs chan transformationJob, progressBar *pb.ProgressBar, config configuration) {
+	defer workerWG.Done()
+	var done sync.WaitGroup
+	for thisJob := range jobs {
+		done.Add(1)
+		pool.jobs <- pooledJob{job: thisJob, progressBar: progressBar, config: config, done: &done}
+	}
+	done.Wait()
+}
+
+// stop stops the workers of the pool, once the jobs given to it are transformed
+func (pool *workerPool) stop() {
+	close(pool.jobs)
+	pool.wg.Wait()
+}
+
+// BuildBatch builds the galleries of a batch one after another, sharing libvips and a
+// pool of transformation workers. Every gallery is checked before the first one is built.
+// A gallery which fails doesn't stop the others, the failed ones are listed at the end.
+// Cancelling ctx aborts the gallery being built and the rest of the batch.
+func BuildBatch(ctx context.Context, batch Batch) error {
+	err := checkBatch(batch)
+	if err != nil {
+		return err
+	}
+	output := getOutput(batch.Messages)
+
+	// The batch's workers transform the files of every gallery, the galleries' own
+	// concurrency settings don't apply
+	concurrency := batch.Concurrency
+	if concurrency == 0 {
+		concurrency = initializeConfig().concurrency
+	}
+
+	var vipsConfig *vips.Config
+	if batch.Verbose {
+		vips.LoggingSettings(nil, vips.LogLevelDebug)
+		vipsConfig = &vips.Config{ReportLeaks: true}
+	} else {
+		vips.LoggingSettings(nil, vips.LogLevelError)
+	}
+	vips.Startup(vipsConfig)
+	sharedWorkers := startWorkerPool(concurrency)
+	defer sharedWorkers.stop()
+
+	var failed []string
+	for i, options := range batch.Galleries {
+		fmt.Fprintln(output, "Building gallery", i+1, "of", strconv.Itoa(len(batch.Galleries))+":", options.Gallery)
+		err = build(ctx, options, sharedWorkers)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			fmt.Fprintln(output, "couldn't build gallery", options.Gallery, ":", err.Error())
+			failed = append(failed, options.Gallery)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("couldn't build %d of %d galleries: %s", len(failed), len(batch.Galleries), strings.Join(failed, ", "))
+	}
+	fmt.Fprintln(output, "Built", len(batch.Galleries), "galleries!")
+	return nil
+}
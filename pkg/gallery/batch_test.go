@@ -0,0 +1,118 @@
+package gallery
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBatchFile(t *testing.T) {
+	batch, err := parseBatchFile([]byte(`
+concurrency: 8
+jobs:
+  - source: /photos/family
+    gallery: /var/www/family
+    options: ["--cleanup", "--webp"]
+  - source: photos/work
+    gallery: www/work
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, 8, batch.Concurrency)
+	assert.Len(t, batch.Jobs, 2)
+	assert.Equal(t, []string{"--cleanup", "--webp"}, batch.Jobs[0].Options)
+
+	for _, invalid := range []string{
+		"",
+		"jobs: []",
+		"concurrency: -1\njobs:\n  - source: a\n    gallery: b\n",
+		"jobs:\n  - source: a\n",
+		"jobs:\n  - source: a\n    gallery: b\n    cleanup: true\n",
+	} {
+		_, err = parseBatchFile([]byte(invalid))
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestReadBatchFile(t *testing.T) {
+	tempDir := t.TempDir()
+	batchPath := filepath.Join(tempDir, "batch.yaml")
+	err := os.WriteFile(batchPath, []byte(`
+jobs:
+  - source: photos
+    gallery: /var/www/family
+    options: ["--cleanup"]
+  - source: s3://bucket/photos
+    gallery: www/work
+`), 0644)
+	assert.NoError(t, err)
+
+	// Relative directories are relative to the batch file
+	batch, err := ReadBatchFile(batchPath)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(tempDir, "photos"), batch.Jobs[0].Source)
+	assert.Equal(t, "/var/www/family", batch.Jobs[0].Gallery)
+	assert.Equal(t, []string{"--cleanup"}, batch.Jobs[0].Options)
+	assert.Equal(t, "s3://bucket/photos", batch.Jobs[1].Source)
+	assert.Equal(t, filepath.Join(tempDir, "www", "work"), batch.Jobs[1].Gallery)
+
+	_, err = ReadBatchFile(filepath.Join(tempDir, "missing.yaml"))
+	assert.Error(t, err)
+}
+
+func TestCheckBatch(t *testing.T) {
+	family, work := NewOptions("photos/family", "www/family"), NewOptions("photos/work", "www/work")
+	assert.NoError(t, checkBatch(Batch{Galleries: []Options{family, work}}))
+
+	// Two galleries can't be built into the same directory
+	work.Gallery = "www/family/"
+	assert.Error(t, checkBatch(Batch{Galleries: []Options{family, work}}))
+
+	work = NewOptions("photos/work", "www/work")
+	work.Watch = true
+	assert.Error(t, checkBatch(Batch{Galleries: []Options{family, work}}))
+	assert.Error(t, checkBatch(Batch{Galleries: []Options{family}, Concurrency: -1}))
+}
+
+func TestWorkerPool(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Files which aren't media fail, the worker carries on with the next ones
+	notes := filepath.Join(tempDir, "notes")
+	os.WriteFile(notes, []byte("shopping list"), 0644)
+	jobs := make(chan transformationJob, 3)
+	for i := 0; i < 3; i++ {
+		jobs <- transformationJob{filename: "notes", sourceFilepath: notes, thumbnailFilepath: filepath.Join(tempDir, "notes.jpg")}
+	}
+	close(jobs)
+
+	config := initializeConfig()
+	pool := startWorkerPool(1)
+	var workerWG sync.WaitGroup
+	workerWG.Add(1)
+	go pool.forward(&workerWG, jobs, nil, config)
+	workerWG.Wait()
+	pool.stop()
+	assert.Len(t, config.run.failures, 3)
+}
+
+func TestBuildBatch(t *testing.T) {
+	tempDir := t.TempDir()
+	var output bytes.Buffer
+
+	// A gallery which fails doesn't stop the others
+	missing := NewOptions(filepath.Join(tempDir, "missing"), filepath.Join(tempDir, "gallery1"))
+	alsoMissing := NewOptions(filepath.Join(tempDir, "also-missing"), filepath.Join(tempDir, "gallery2"))
+	err := BuildBatch(context.Background(), Batch{Galleries: []Options{missing, alsoMissing}, Concurrency: 1, Messages: &output})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "couldn't build 2 of 2 galleries")
+	assert.Contains(t, output.String(), "Building gallery 2 of 2")
+}
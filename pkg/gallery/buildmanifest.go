@@ -0,0 +1,174 @@
+package gallery
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Name of the build manifest in the gallery root
+const buildManifestFile = ".fastgallery.json"
+
+// buildSettings struct holds the settings which affect the transformed media files
+type buildSettings struct {
+	ThumbnailWidth     int    `json:"thumbnailWidth"`
+	ThumbnailHeight    int    `json:"thumbnailHeight"`
+	ThumbnailDensities string `json:"thumbnailDensities,omitempty"`
+	FullsizeMaxWidth   int    `json:"fullsizeMaxWidth"`
+	FullsizeMaxHeight  int    `json:"fullsizeMaxHeight"`
+	VideoMaxSize       int    `json:"videoMaxSize"`
+	VideoProfile       string `json:"videoProfile,omitempty"`
+	ImageExtension     string `json:"imageExtension"`
+	VideoExtension     string `json:"videoExtension"`
+	WebP               bool   `json:"webp,omitempty"`
+	OutputProfile      string `json:"outputProfile,omitempty"`
+}
+
+// artifactSettings struct holds the settings one source file's thumbnail and full-size
+// files in the gallery were built with, e.g. "280x210" and "1920x1080"
+type artifactSettings struct {
+	Thumbnail string `json:"thumbnail"`
+	Fullsize  string `json:"fullsize"`
+}
+
+// buildManifest struct is the build manifest written into the gallery root. Version and
+// Commit are the ones of the fastgallery which last ran. Settings are the ones of the last run. Files has the settings each source file's gallery files
+// were built with, by path relative to the gallery root. Gallery files aren't rebuilt
+// without --rebuild-outdated, so they may be older than the last run. Pages and LitePages
+// have the hash of everything each album page of the gallery and its lite version was
+// rendered from, by album path, so only changed pages are rendered again. Inventory has
+// the state of every gallery file after the last run with --changes. Albums has the
+// statistics of each album by album path, for the tiles of the albums a partial run
+// with --root doesn't scan.
+type buildManifest struct {
+	Version   string                      `json:"version"`
+	Commit    string                      `json:"commit,omitempty"`
+	Built     time.Time                   `json:"built"`
+	Settings  buildSettings               `json:"settings"`
+	Files     map[string]artifactSettings `json:"files"`
+	Pages     map[string]string           `json:"pages,omitempty"`
+	LitePages map[string]string           `json:"litePages,omitempty"`
+	Inventory map[string]fileState        `json:"inventory,omitempty"`
+	Albums    map[string]albumStatsRecord `json:"albums,omitempty"`
+}
+
+// createBuildSettings collects the settings affecting the media files from the configuration
+func createBuildSettings(config configuration) buildSettings {
+	return buildSettings{
+		ThumbnailWidth:     config.media.thumbnailWidth,
+		ThumbnailHeight:    config.media.thumbnailHeight,
+		ThumbnailDensities: formatThumbnailDensities(config.media.densities),
+		FullsizeMaxWidth:   config.media.fullsizeMaxWidth,
+		FullsizeMaxHeight:  config.media.fullsizeMaxHeight,
+		VideoMaxSize:       config.media.videoMaxSize,
+		VideoProfile:       config.media.videoProfile,
+		ImageExtension:     config.files.imageExtension,
+		VideoExtension:     config.files.videoExtension,
+		WebP:               config.files.webp,
+		OutputProfile:      config.files.outputProfile,
+	}
+}
+
+// readBuildManifest reads the build manifest from the gallery root. Returns false if the
+// gallery doesn't have one, e.g. because it's new or built by an older fastgallery.
+func readBuildManifest(galleryDirectory string) (manifest buildManifest, ok bool) {
+	manifestPath := filepath.Join(galleryDirectory, buildManifestFile)
+	buffer, err := os.ReadFile(manifestPath)
+	if os.IsNotExist(err) {
+		return manifest, false
+	}
+	if err == nil {
+		err = json.Unmarshal(buffer, &manifest)
+	}
+	if err != nil {
+		log.Println("couldn't read build manifest", manifestPath, ":", err.Error())
+		return manifest, false
+	}
+	return manifest, true
+}
+
+// getArtifactSettings returns the settings given file's thumbnail and full-size files are
+// built with. File formats aren't included, changing them changes the gallery filenames
+// and the files are created anyway. Efficient videos are marked by their codec, videos
+// of manifests without a profile are compatible ones. Images with WebP versions are
+// marked too, and so are images with thumbnails of higher pixel densities, so existing
+// galleries can get them with --rebuild-outdated.
+func getArtifactSettings(filename string, settings buildSettings, config configuration) artifactSettings {
+	artifact := artifactSettings{Thumbnail: fmt.Sprintf("%dx%d", settings.ThumbnailWidth, settings.ThumbnailHeight)}
+	if isVideoFile(filename, config) {
+		artifact.Fullsize = strconv.Itoa(settings.VideoMaxSize)
+		if settings.VideoProfile == videoProfileEfficiency {
+			artifact.Fullsize = artifact.Fullsize + " hevc"
+		}
+	} else {
+		artifact.Fullsize = fmt.Sprintf("%dx%d", settings.FullsizeMaxWidth, settings.FullsizeMaxHeight)
+		if settings.WebP {
+			artifact.Thumbnail = artifact.Thumbnail + " webp"
+			artifact.Fullsize = artifact.Fullsize + " webp"
+		}
+		if settings.ThumbnailDensities != "" {
+			artifact.Thumbnail = artifact.Thumbnail + " @" + settings.ThumbnailDensities
+		}
+	}
+	return artifact
+}
+
+// checkOutdatedFiles compares the settings the gallery files of a source directory were
+// built with, according to the previous build manifest, to the current ones. Files
+// missing from the manifest are taken to be built with its settings, and without a
+// previous manifest all gallery files are taken to be up to date. With rebuild, the
+// outdated thumbnail and full-size files are marked to be built again, otherwise they
+// keep their old settings. The settings of each file are recorded in files.
+// Returns the number of source files with outdated gallery files.
+func checkOutdatedFiles(source *directory, previous *buildManifest, files map[string]artifactSettings, rebuild bool, config configuration) (outdated int) {
+	current := createBuildSettings(config)
+	for i, file := range source.files {
+		manifestPath := filepath.ToSlash(file.relPath)
+		files[manifestPath] = getArtifactSettings(file.absPath, current, config)
+		if !file.exists || previous == nil {
+			continue
+		}
+
+		previousArtifact, ok := previous.Files[manifestPath]
+		if !ok {
+			previousArtifact = getArtifactSettings(file.absPath, previous.Settings, config)
+		}
+		currentArtifact := files[manifestPath]
+		if previousArtifact == currentArtifact {
+			continue
+		}
+
+		outdated++
+		if !rebuild {
+			files[manifestPath] = previousArtifact
+			continue
+		}
+		source.files[i].outdatedThumbnail = previousArtifact.Thumbnail != currentArtifact.Thumbnail
+		source.files[i].outdatedFullsize = previousArtifact.Fullsize != currentArtifact.Fullsize
+	}
+	return outdated
+}
+
+// writeBuildManifest writes the build manifest into the gallery root
+func writeBuildManifest(galleryDirectory string, manifest buildManifest, dryRun bool, config configuration) {
+	manifestPath := filepath.Join(galleryDirectory, buildManifestFile)
+	if dryRun {
+		log.Println("Would write build manifest:", manifestPath)
+		return
+	}
+
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		log.Println("couldn't encode build manifest:", err.Error())
+		return
+	}
+
+	err = writeFile(manifestPath, append(manifestJSON, '\n'), config)
+	if err != nil {
+		log.Println("couldn't write build manifest", manifestPath, ":", err.Error())
+	}
+}
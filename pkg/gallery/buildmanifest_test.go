@@ -0,0 +1,97 @@
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildManifest(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+
+	_, ok := readBuildManifest(tempDir)
+	assert.False(t, ok)
+
+	manifest := buildManifest{Version: "1.2.3", Built: time.Date(2021, 3, 14, 12, 0, 0, 0, time.UTC), Settings: createBuildSettings(config)}
+	writeBuildManifest(tempDir, manifest, true, config)
+	assert.NoFileExists(t, filepath.Join(tempDir, buildManifestFile))
+
+	writeBuildManifest(tempDir, manifest, false, config)
+	readManifest, ok := readBuildManifest(tempDir)
+	assert.True(t, ok)
+	assert.EqualValues(t, manifest, readManifest)
+
+	err = os.WriteFile(filepath.Join(tempDir, buildManifestFile), []byte("{"), 0644)
+	assert.NoError(t, err)
+	_, ok = readBuildManifest(tempDir)
+	assert.False(t, ok)
+}
+
+func TestGetArtifactSettings(t *testing.T) {
+	config := initializeConfig()
+	settings := createBuildSettings(config)
+	assert.EqualValues(t, artifactSettings{Thumbnail: "280x210", Fullsize: "1920x1080"}, getArtifactSettings("a.jpg", settings, config))
+	assert.EqualValues(t, artifactSettings{Thumbnail: "280x210", Fullsize: "640"}, getArtifactSettings("a.mp4", settings, config))
+
+	settings.VideoProfile = videoProfileEfficiency
+	assert.EqualValues(t, artifactSettings{Thumbnail: "280x210", Fullsize: "640 hevc"}, getArtifactSettings("a.mp4", settings, config))
+	assert.EqualValues(t, artifactSettings{Thumbnail: "280x210", Fullsize: "1920x1080"}, getArtifactSettings("a.jpg", settings, config))
+
+	settings.WebP = true
+	assert.EqualValues(t, artifactSettings{Thumbnail: "280x210 webp", Fullsize: "1920x1080 webp"}, getArtifactSettings("a.jpg", settings, config))
+	assert.EqualValues(t, artifactSettings{Thumbnail: "280x210", Fullsize: "640 hevc"}, getArtifactSettings("a.mp4", settings, config))
+}
+
+func TestCheckOutdatedFiles(t *testing.T) {
+	config := initializeConfig()
+	previous := buildManifest{
+		Settings: createBuildSettings(config),
+		Files: map[string]artifactSettings{
+			"album/b.jpg": {Thumbnail: "280x210", Fullsize: "1280x720"},
+		},
+	}
+	newSource := func() directory {
+		return directory{files: []file{
+			{name: "a.jpg", absPath: "/photos/a.jpg", relPath: filepath.Join("album", "a.jpg"), exists: true},
+			{name: "b.jpg", absPath: "/photos/b.jpg", relPath: filepath.Join("album", "b.jpg"), exists: true},
+			{name: "c.mp4", absPath: "/photos/c.mp4", relPath: filepath.Join("album", "c.mp4"), exists: true},
+			{name: "d.jpg", absPath: "/photos/d.jpg", relPath: filepath.Join("album", "d.jpg")},
+		}}
+	}
+
+	// Without a previous manifest, everything's up to date
+	files := make(map[string]artifactSettings)
+	source := newSource()
+	assert.EqualValues(t, 0, checkOutdatedFiles(&source, nil, files, true, config))
+	assert.Len(t, files, 4)
+
+	// Files missing from the manifest were built with its settings
+	config.media.videoMaxSize = 1280
+	files = make(map[string]artifactSettings)
+	source = newSource()
+	assert.EqualValues(t, 2, checkOutdatedFiles(&source, &previous, files, true, config))
+	assert.False(t, source.files[0].outdatedThumbnail || source.files[0].outdatedFullsize)
+	assert.False(t, source.files[1].outdatedThumbnail)
+	assert.True(t, source.files[1].outdatedFullsize)
+	assert.True(t, source.files[2].outdatedFullsize)
+	assert.False(t, source.files[3].outdatedFullsize)
+	assert.EqualValues(t, "1920x1080", files["album/b.jpg"].Fullsize)
+	assert.EqualValues(t, "1280", files["album/c.mp4"].Fullsize)
+
+	// Without rebuilding, outdated files keep their settings
+	files = make(map[string]artifactSettings)
+	source = newSource()
+	assert.EqualValues(t, 2, checkOutdatedFiles(&source, &previous, files, false, config))
+	assert.False(t, source.files[1].outdatedFullsize)
+	assert.EqualValues(t, "1280x720", files["album/b.jpg"].Fullsize)
+	assert.EqualValues(t, "640", files["album/c.mp4"].Fullsize)
+}
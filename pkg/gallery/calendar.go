@@ -0,0 +1,147 @@
+package gallery
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"text/template"
+	"time"
+)
+
+// Name of the calendar page in the gallery root
+const calendarFile = "calendar.html"
+
+// Number of shades of the calendar heatmap for days with photos
+const calendarLevels = 4
+
+// calendarDay is one day in the calendar heatmap. Date is empty for the days of the
+// first and last week which belong to another year. Level is the shade of the day, from
+// 0 for no photos to calendarLevels for the days with the most photos.
+type calendarDay struct {
+	Date  string
+	Label string
+	Count int
+	Level int
+}
+
+// calendarYear is one year of the calendar heatmap, in weeks from Sunday to Saturday
+type calendarYear struct {
+	Year  int
+	Count int
+	Weeks [][]calendarDay
+}
+
+// calendarPage struct is loaded with the information to fill in the calendar template.
+// Timeline is the page the days link to and HTMLFile the album page.
+type calendarPage struct {
+	Title    string
+	CSS      []string
+	Timeline string
+	HTMLFile string
+	Years    []calendarYear
+}
+
+// getCalendarLevel returns the shade of a day with count photos, relative to the day
+// with the most photos
+func getCalendarLevel(count int, maxCount int) int {
+	if count == 0 || maxCount == 0 {
+		return 0
+	}
+	return (count*calendarLevels + maxCount - 1) / maxCount
+}
+
+// createCalendarYears counts the timeline's photos on each day and returns the years with
+// photos, newest first, the same order as the timeline
+func createCalendarYears(entries []timelineEntry) (years []calendarYear) {
+	counts := make(map[string]int)
+	maxCount := 0
+	yearCounts := make(map[int]int)
+	for _, entry := range entries {
+		day, err := time.Parse(timelineDayLayout, entry.Day)
+		if err != nil {
+			continue
+		}
+		counts[entry.Day]++
+		if counts[entry.Day] > maxCount {
+			maxCount = counts[entry.Day]
+		}
+		yearCounts[day.Year()]++
+	}
+
+	var yearNumbers []int
+	for year := range yearCounts {
+		yearNumbers = append(yearNumbers, year)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(yearNumbers)))
+
+	for _, year := range yearNumbers {
+		thisYear := calendarYear{Year: year, Count: yearCounts[year]}
+
+		// Weeks start on Sunday, so the first one may start in the previous year
+		first := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+		last := time.Date(year, time.December, 31, 0, 0, 0, 0, time.UTC)
+		for weekStart := first.AddDate(0, 0, -int(first.Weekday())); !weekStart.After(last); weekStart = weekStart.AddDate(0, 0, 7) {
+			var week []calendarDay
+			for weekday := 0; weekday < 7; weekday++ {
+				day := weekStart.AddDate(0, 0, weekday)
+				if day.Year() != year {
+					week = append(week, calendarDay{})
+					continue
+				}
+
+				date := day.Format(timelineDayLayout)
+				count := counts[date]
+				label := "No photos on " + day.Format("January 2, 2006")
+				if count == 1 {
+					label = "1 photo on " + day.Format("January 2, 2006")
+				} else if count > 1 {
+					label = fmt.Sprint(count, " photos on ", day.Format("January 2, 2006"))
+				}
+				week = append(week, calendarDay{Date: date, Label: label, Count: count, Level: getCalendarLevel(count, maxCount)})
+			}
+			thisYear.Weeks = append(thisYear.Weeks, week)
+		}
+		years = append(years, thisYear)
+	}
+
+	return years
+}
+
+// writeCalendar writes a GitHub-style calendar heatmap of the days photos were taken into
+// the gallery root. Each day with photos links to them on the timeline page.
+func writeCalendar(source directory, gallery directory, cookedTemplate *template.Template, dryRun bool, config configuration) {
+	pagePath := filepath.Join(gallery.absPath, calendarFile)
+	if dryRun {
+		log.Println("Would write calendar:", pagePath)
+		return
+	}
+
+	stylesheets, err := listStylesheets("", config)
+	if err != nil {
+		log.Println("couldn't write calendar", pagePath, ":", err.Error())
+		return
+	}
+	page := calendarPage{
+		Title:    albumTitle(source),
+		CSS:      stylesheets,
+		Timeline: timelineFile,
+		HTMLFile: config.assets.htmlFile,
+		Years:    createCalendarYears(createTimelineEntries(source, config)),
+	}
+
+	pageHandle, err := createFile(pagePath, config)
+	if err != nil {
+		log.Println("couldn't create calendar", pagePath, ":", err.Error())
+		return
+	}
+	defer pageHandle.Close()
+
+	err = cookedTemplate.Execute(pageHandle, page)
+	if err != nil {
+		log.Println("couldn't execute calendar template", pagePath, ":", err.Error())
+		return
+	}
+
+	logProgress(config, "Wrote calendar:", pagePath)
+}
@@ -0,0 +1,77 @@
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetCalendarLevel(t *testing.T) {
+	assert.EqualValues(t, 0, getCalendarLevel(0, 10))
+	assert.EqualValues(t, 1, getCalendarLevel(1, 10))
+	assert.EqualValues(t, 2, getCalendarLevel(5, 10))
+	assert.EqualValues(t, 4, getCalendarLevel(10, 10))
+}
+
+func TestCreateCalendarYears(t *testing.T) {
+	entries := []timelineEntry{
+		{Day: "2021-03-14"},
+		{Day: "2021-03-14"},
+		{Day: "2021-01-01"},
+		{Day: "2019-12-31"},
+	}
+
+	years := createCalendarYears(entries)
+	assert.Len(t, years, 2)
+	assert.EqualValues(t, 2021, years[0].Year)
+	assert.EqualValues(t, 3, years[0].Count)
+	assert.EqualValues(t, 2019, years[1].Year)
+
+	// January 1st, 2021 was a Friday, the days of the first week before it belong to 2020
+	firstWeek := years[0].Weeks[0]
+	assert.Len(t, firstWeek, 7)
+	assert.EqualValues(t, "", firstWeek[4].Date)
+	assert.EqualValues(t, "2021-01-01", firstWeek[5].Date)
+	assert.EqualValues(t, "1 photo on January 1, 2021", firstWeek[5].Label)
+	assert.EqualValues(t, 2, firstWeek[5].Level)
+	assert.EqualValues(t, "No photos on January 2, 2021", firstWeek[6].Label)
+	assert.EqualValues(t, "2021-12-31", years[0].Weeks[len(years[0].Weeks)-1][5].Date)
+
+	var march14 calendarDay
+	for _, week := range years[0].Weeks {
+		for _, day := range week {
+			if day.Date == "2021-03-14" {
+				march14 = day
+			}
+		}
+	}
+	assert.EqualValues(t, 2, march14.Count)
+	assert.EqualValues(t, calendarLevels, march14.Level)
+	assert.EqualValues(t, "2 photos on March 14, 2021", march14.Label)
+}
+
+func TestWriteCalendar(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	config.media.timezone = time.UTC
+	cookedTemplates := testTemplates(t, config)
+	source := directory{name: "Photos", files: []file{{name: "a.jpg", takenTime: time.Date(2021, 3, 14, 12, 0, 0, 0, time.UTC)}}}
+	gallery := directory{absPath: tempDir}
+
+	writeCalendar(source, gallery, cookedTemplates.calendar, true, config)
+	assert.NoFileExists(t, filepath.Join(tempDir, calendarFile))
+
+	writeCalendar(source, gallery, cookedTemplates.calendar, false, config)
+	html, err := os.ReadFile(filepath.Join(tempDir, calendarFile))
+	assert.NoError(t, err)
+	assert.Contains(t, string(html), "<title>Photos</title>")
+	assert.Contains(t, string(html), `href="timeline.html#2021-03-14" title="1 photo on March 14, 2021"`)
+}
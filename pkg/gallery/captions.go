@@ -0,0 +1,85 @@
+package gallery
+
+import (
+	"bufio"
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Names of the optional per-directory caption files in the source tree.
+// captions.yaml is a mapping from filename to caption, captions.txt has one
+// "filename: caption" per line.
+const (
+	captionsYAMLFile = "captions.yaml"
+	captionsTextFile = "captions.txt"
+)
+
+// readCaptionsFile reads the captions of given directory, if it has a caption file.
+// Returns a map from filename to caption.
+func readCaptionsFile(directoryPath string) (map[string]string, error) {
+	captions := make(map[string]string)
+
+	buffer, err := os.ReadFile(filepath.Join(directoryPath, captionsYAMLFile))
+	if err == nil {
+		err = yaml.Unmarshal(buffer, &captions)
+		return captions, err
+	}
+	if !os.IsNotExist(err) {
+		return captions, err
+	}
+
+	buffer, err = os.ReadFile(filepath.Join(directoryPath, captionsTextFile))
+	if os.IsNotExist(err) {
+		return captions, nil
+	}
+	if err != nil {
+		return captions, err
+	}
+
+	// Empty lines and lines starting with # are ignored
+	scanner := bufio.NewScanner(bytes.NewReader(buffer))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		separator := strings.Index(line, ": ")
+		if separator == -1 {
+			log.Println("ignoring caption line without \"filename: caption\":", filepath.Join(directoryPath, captionsTextFile), line)
+			continue
+		}
+		captions[strings.TrimSpace(line[:separator])] = strings.TrimSpace(line[separator+2:])
+	}
+
+	return captions, scanner.Err()
+}
+
+// readCaptionFiles recursively applies captions.yaml and captions.txt files to the
+// source tree. Captions from these files take precedence over XMP sidecars.
+func readCaptionFiles(source *directory) {
+	readDirectoryCaptions(source)
+
+	for i := range source.subdirectories {
+		readCaptionFiles(&source.subdirectories[i])
+	}
+}
+
+// readDirectoryCaptions applies the caption file of one source directory to its files
+func readDirectoryCaptions(source *directory) {
+	captions, err := readCaptionsFile(source.absPath)
+	if err != nil {
+		log.Println("couldn't parse captions file in:", source.absPath, err.Error())
+	}
+
+	for i := range source.files {
+		if caption, ok := captions[source.files[i].name]; ok {
+			source.files[i].sidecar.caption = caption
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadCaptionFiles(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	err = os.Mkdir(filepath.Join(tempDir, "subdir"), 0755)
+	assert.NoError(t, err)
+
+	testFiles := map[string]string{
+		"a.jpg":                          "",
+		"b.jpg":                          "",
+		"c.jpg":                          "",
+		captionsTextFile:                 "# captions for the root\n\na.jpg: Sunset: the best one\nb.jpg no separator\n",
+		filepath.Join("subdir", "d.jpg"): "",
+		filepath.Join("subdir", captionsYAMLFile): "d.jpg: Harbour \"at night\"\n",
+		filepath.Join("subdir", captionsTextFile): "d.jpg: ignored, YAML file wins\n",
+	}
+	for filename, contents := range testFiles {
+		err = os.WriteFile(filepath.Join(tempDir, filename), []byte(contents), 0644)
+		assert.NoError(t, err)
+	}
+
+	source, _ := createDirectoryTree(tempDir, "", false, initializeConfig())
+	source.files[2].sidecar.caption = "From XMP"
+	readCaptionFiles(&source)
+
+	assert.EqualValues(t, "Sunset: the best one", source.files[0].sidecar.caption)
+	assert.EqualValues(t, "", source.files[1].sidecar.caption)
+	assert.EqualValues(t, "From XMP", source.files[2].sidecar.caption)
+	assert.EqualValues(t, "Harbour \"at night\"", source.subdirectories[0].files[0].sidecar.caption)
+}
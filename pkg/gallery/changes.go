@@ -0,0 +1,82 @@
+package gallery
+
+import (
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// fileState struct is the size and modification time of a gallery file, in nanoseconds
+// since the epoch, as recorded in the build manifest for listing changes
+type fileState struct {
+	Size     int64 `json:"size"`
+	Modified int64 `json:"modified"`
+}
+
+// createGalleryInventory records the state of every file in the gallery, by path
+// relative to the gallery root. The build manifest and skipPaths are left out.
+// Symlinks are recorded as themselves, not by the files they point to.
+func createGalleryInventory(galleryDirectory string, skipPaths []string) (inventory map[string]fileState, err error) {
+	inventory = make(map[string]fileState)
+	err = filepath.WalkDir(galleryDirectory, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || path == filepath.Join(galleryDirectory, buildManifestFile) {
+			return nil
+		}
+		for _, skipPath := range skipPaths {
+			if path == skipPath {
+				return nil
+			}
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		relPath, _ := filepath.Rel(galleryDirectory, path)
+		inventory[filepath.ToSlash(relPath)] = fileState{Size: info.Size(), Modified: info.ModTime().UnixNano()}
+		return nil
+	})
+	return inventory, err
+}
+
+// compareInventories returns the sorted paths of the files added, changed and removed
+// between two gallery inventories
+func compareInventories(previous map[string]fileState, current map[string]fileState) (added []string, changed []string, removed []string) {
+	for path, state := range current {
+		previousState, ok := previous[path]
+		if !ok {
+			added = append(added, path)
+		} else if previousState != state {
+			changed = append(changed, path)
+		}
+	}
+	for path := range previous {
+		if _, ok := current[path]; !ok {
+			removed = append(removed, path)
+		}
+	}
+
+	sort.Strings(added)
+	sort.Strings(changed)
+	sort.Strings(removed)
+	return added, changed, removed
+}
+
+// formatChangeList lists changed gallery files one per line, each prefixed with A for
+// added, M for modified or D for deleted like git does, e.g. "A album/index.html"
+func formatChangeList(added []string, changed []string, removed []string) string {
+	var list strings.Builder
+	for _, change := range []struct {
+		status string
+		paths  []string
+	}{{"A", added}, {"M", changed}, {"D", removed}} {
+		for _, path := range change.paths {
+			list.WriteString(change.status + " " + path + "\n")
+		}
+	}
+	return list.String()
+}
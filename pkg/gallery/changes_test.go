@@ -0,0 +1,61 @@
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateGalleryInventory(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	err = os.MkdirAll(filepath.Join(tempDir, "album"), 0755)
+	assert.NoError(t, err)
+	for _, name := range []string{"index.html", filepath.Join("album", "index.html"), buildManifestFile, "changes.txt"} {
+		err = os.WriteFile(filepath.Join(tempDir, name), []byte("content"), 0644)
+		assert.NoError(t, err)
+	}
+	modified := time.Date(2021, 3, 4, 12, 0, 0, 0, time.UTC)
+	err = os.Chtimes(filepath.Join(tempDir, "index.html"), modified, modified)
+	assert.NoError(t, err)
+
+	inventory, err := createGalleryInventory(tempDir, []string{filepath.Join(tempDir, "changes.txt")})
+	assert.NoError(t, err)
+	assert.Len(t, inventory, 2)
+	assert.Equal(t, fileState{Size: 7, Modified: modified.UnixNano()}, inventory["index.html"])
+	assert.Contains(t, inventory, "album/index.html")
+}
+
+func TestCompareInventories(t *testing.T) {
+	previous := map[string]fileState{
+		"index.html":         {Size: 10, Modified: 1},
+		"_thumbnail/a.jpg":   {Size: 20, Modified: 1},
+		"_thumbnail/old.jpg": {Size: 30, Modified: 1},
+	}
+	current := map[string]fileState{
+		"index.html":       {Size: 11, Modified: 2},
+		"_thumbnail/a.jpg": {Size: 20, Modified: 1},
+		"_thumbnail/b.jpg": {Size: 40, Modified: 2},
+		"album/index.html": {Size: 50, Modified: 2},
+	}
+	added, changed, removed := compareInventories(previous, current)
+	assert.Equal(t, []string{"_thumbnail/b.jpg", "album/index.html"}, added)
+	assert.Equal(t, []string{"index.html"}, changed)
+	assert.Equal(t, []string{"_thumbnail/old.jpg"}, removed)
+
+	// Without a previous inventory, everything is new
+	added, changed, removed = compareInventories(nil, current)
+	assert.Len(t, added, 4)
+	assert.Empty(t, changed)
+	assert.Empty(t, removed)
+
+	assert.Equal(t, "A _thumbnail/b.jpg\nA album/index.html\nM index.html\nD _thumbnail/old.jpg\n",
+		formatChangeList([]string{"_thumbnail/b.jpg", "album/index.html"}, []string{"index.html"}, []string{"_thumbnail/old.jpg"}))
+}
@@ -0,0 +1,185 @@
+package gallery
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stubTransformer is a mock engine standing in for libvips and ffmpeg. It writes a small
+// file to each destination, counts how many times each source file was transformed and
+// fails the source files with "broken" in their name.
+type stubTransformer struct {
+	calls        int64
+	transformed  sync.Map
+	duplicateErr atomic.Value
+}
+
+func (s *stubTransformer) transform(source string, fullsizeDestination string, thumbnailDestination string) error {
+	atomic.AddInt64(&s.calls, 1)
+	if _, duplicate := s.transformed.LoadOrStore(source, true); duplicate {
+		s.duplicateErr.Store(source)
+	}
+	if strings.Contains(filepath.Base(source), "broken") {
+		return errors.New("stub transformer failed")
+	}
+	for _, destination := range []string{fullsizeDestination, thumbnailDestination} {
+		if destination == "" {
+			continue
+		}
+		err := os.WriteFile(destination, []byte(source), 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *stubTransformer) TransformImage(source string, fullsizeDestination string, thumbnailDestination string, config configuration) error {
+	return s.transform(source, fullsizeDestination, thumbnailDestination)
+}
+
+func (s *stubTransformer) TransformVideo(source string, fullsizeDestination string, thumbnailDestination string, config configuration) error {
+	return s.transform(source, fullsizeDestination, thumbnailDestination)
+}
+
+// useStubTransformers registers the stub transformer as the image and video engine of
+// given configuration until the test is done
+func useStubTransformers(t *testing.T, config *configuration) *stubTransformer {
+	stub := &stubTransformer{}
+	imageEngines["stub"], videoEngines["stub"] = stub, stub
+	config.media.imageEngine, config.media.videoEngine = "stub", "stub"
+	t.Cleanup(func() {
+		delete(imageEngines, "stub")
+		delete(videoEngines, "stub")
+	})
+	return stub
+}
+
+// createFakeMedia writes empty media files into albums under the source directory,
+// every brokenEvery'th of them named to fail in the stub transformer. Returns the
+// relative paths of the files.
+func createFakeMedia(t *testing.T, sourceDirectory string, albums int, filesPerAlbum int, brokenEvery int) (relPaths []string) {
+	for album := 0; album < albums; album++ {
+		albumName := fmt.Sprintf("album%03d", album)
+		err := os.MkdirAll(filepath.Join(sourceDirectory, albumName), 0755)
+		assert.NoError(t, err)
+		for i := 0; i < filesPerAlbum; i++ {
+			filename := fmt.Sprintf("photo%04d.jpg", i)
+			if i%10 == 9 {
+				filename = fmt.Sprintf("video%04d.mp4", i)
+			}
+			if brokenEvery > 0 && (album*filesPerAlbum+i)%brokenEvery == 0 {
+				filename = "broken-" + filename
+			}
+			relPath := filepath.Join(albumName, filename)
+			err = os.WriteFile(filepath.Join(sourceDirectory, relPath), []byte{}, 0644)
+			assert.NoError(t, err)
+			relPaths = append(relPaths, relPath)
+		}
+	}
+	return relPaths
+}
+
+func TestConcurrentTransformationWorkers(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	memory := useMemoryStorage(t)
+	config := initializeConfig()
+	stub := useStubTransformers(t, &config)
+	config.files.workspaceDir = tempDir
+	config.concurrency = 16
+
+	relPaths := createFakeMedia(t, filepath.Join(tempDir, "source"), 10, 300, 100)
+	galleryDirectory := filepath.Join(tempDir, "gallery")
+
+	jobs := make(chan transformationJob, pipelineQueueSize)
+	var workerWG sync.WaitGroup
+	for i := 0; i < config.concurrency; i++ {
+		workerWG.Add(1)
+		go transformationWorker(&workerWG, jobs, nil, config)
+	}
+	for _, relPath := range relPaths {
+		thumbnailFilename, fullsizeFilename := getGalleryFilenames(filepath.Base(relPath), config)
+		album := filepath.Join(galleryDirectory, filepath.Dir(relPath))
+		jobs <- transformationJob{
+			filename:          filepath.Base(relPath),
+			relPath:           relPath,
+			sourceFilepath:    filepath.Join(tempDir, "source", relPath),
+			thumbnailFilepath: filepath.Join(album, config.files.thumbnailDir, thumbnailFilename),
+			fullsizeFilepath:  filepath.Join(album, config.files.fullsizeDir, fullsizeFilename),
+			originalFilepath:  filepath.Join(album, config.files.originalDir, filepath.Base(relPath)),
+		}
+	}
+	close(jobs)
+	workerWG.Wait()
+
+	// Each file is transformed exactly once, and only the broken ones failed
+	assert.EqualValues(t, len(relPaths), atomic.LoadInt64(&stub.calls))
+	assert.Nil(t, stub.duplicateErr.Load())
+	assert.Len(t, config.run.failures, len(relPaths)/100)
+	assert.Len(t, memory.files, 2*(len(relPaths)-len(relPaths)/100))
+	assert.Len(t, memory.symlinks, len(relPaths)-len(relPaths)/100)
+	for _, thisFailure := range config.run.failures {
+		assert.Contains(t, filepath.Base(thisFailure.file), "broken")
+	}
+
+	// The job workspaces are all cleaned up
+	entries, err := os.ReadDir(tempDir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestConcurrentProcessGallery(t *testing.T) {
+	for _, prefetch := range []int{0, 64} {
+		t.Run(fmt.Sprint("prefetch", prefetch), func(t *testing.T) {
+			tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+			if err != nil {
+				t.Error("couldn't create temporary directory")
+			}
+			defer os.RemoveAll(tempDir)
+
+			memory := useMemoryStorage(t)
+			config := initializeConfig()
+			stub := useStubTransformers(t, &config)
+			config.concurrency = 8
+			config.prefetch = prefetch
+			config.files.workspaceDir = filepath.Join(tempDir, "workspace")
+			err = os.MkdirAll(config.files.workspaceDir, 0755)
+			assert.NoError(t, err)
+
+			sourceDirectory := filepath.Join(tempDir, "source")
+			galleryDirectory := filepath.Join(tempDir, "gallery")
+			relPaths := createFakeMedia(t, sourceDirectory, 20, 100, 0)
+			err = os.Mkdir(galleryDirectory, 0755)
+			assert.NoError(t, err)
+
+			source, _, _ := processGallery(sourceDirectory, galleryDirectory, &pipeline{config: config})
+
+			// The pipeline only returns once all the queued files are done
+			assert.Len(t, source.subdirectories, 20)
+			assert.EqualValues(t, len(relPaths), atomic.LoadInt64(&stub.calls))
+			assert.Nil(t, stub.duplicateErr.Load())
+			assert.Empty(t, config.run.failures)
+			for _, relPath := range relPaths {
+				thumbnailFilename, _ := getGalleryFilenames(filepath.Base(relPath), config)
+				thumbnailPath := filepath.Join(galleryDirectory, filepath.Dir(relPath), config.files.thumbnailDir, thumbnailFilename)
+				assert.Equal(t, filepath.Join(sourceDirectory, relPath), string(memory.files[thumbnailPath]))
+			}
+
+			// Nothing is written to the gallery on disk
+			assert.True(t, isEmptyDirectory(galleryDirectory))
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package gallery
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configFileSettings struct holds the settings of a configuration file, which override
+// the defaults of initializeConfig. Settings left out keep their defaults. Command-line
+// flags override the configuration file. Directory names are the names of the thumbnail,
+// full-size and original directories in each album of the gallery. Modes are octal
+// permissions like the ones of --dir-mode and --file-mode. Originals is symlink, copy or
+// hardlink like --originals. Video extensions are added to the known ones like the ones
+// of --video-extension.
+type configFileSettings struct {
+	ThumbnailWidth    int      `yaml:"thumbnail_width"`
+	ThumbnailHeight   int      `yaml:"thumbnail_height"`
+	FullsizeMaxWidth  int      `yaml:"fullsize_max_width"`
+	FullsizeMaxHeight int      `yaml:"fullsize_max_height"`
+	VideoMaxSize      int      `yaml:"video_max_size"`
+	JPEGQuality       int      `yaml:"jpeg_quality"`
+	ThumbnailDir      string   `yaml:"thumbnail_dir"`
+	FullsizeDir       string   `yaml:"fullsize_dir"`
+	OriginalDir       string   `yaml:"original_dir"`
+	DirMode           string   `yaml:"dir_mode"`
+	FileMode          string   `yaml:"file_mode"`
+	Originals         string   `yaml:"originals"`
+	VideoExtensions   []string `yaml:"video_extensions"`
+	Concurrency       int      `yaml:"concurrency"`
+}
+
+// getDefaultConfigFile returns the path of the configuration file read without --config,
+// e.g. ~/.config/fastgallery/config.yaml on Linux
+func getDefaultConfigFile() string {
+	configDirectory, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(configDirectory, "fastgallery", "config.yaml")
+}
+
+// parseConfigFile parses a configuration file. Unknown settings are errors, so typos
+// don't go unnoticed.
+func parseConfigFile(buffer []byte) (settings configFileSettings, err error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(buffer))
+	decoder.KnownFields(true)
+	err = decoder.Decode(&settings)
+	if errors.Is(err, io.EOF) {
+		err = nil
+	}
+	return settings, err
+}
+
+// isValidGalleryDirName checks whether given name can be used for the thumbnail,
+// full-size or original directories in the albums of the gallery
+func isValidGalleryDirName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+// applyConfigFile applies the settings of a configuration file to the configuration
+func applyConfigFile(config *configuration, settings configFileSettings) error {
+	for _, dimension := range []struct {
+		name  string
+		value int
+		field *int
+	}{
+		{"thumbnail_width", settings.ThumbnailWidth, &config.media.thumbnailWidth},
+		{"thumbnail_height", settings.ThumbnailHeight, &config.media.thumbnailHeight},
+		{"fullsize_max_width", settings.FullsizeMaxWidth, &config.media.fullsizeMaxWidth},
+		{"fullsize_max_height", settings.FullsizeMaxHeight, &config.media.fullsizeMaxHeight},
+		{"video_max_size", settings.VideoMaxSize, &config.media.videoMaxSize},
+		{"concurrency", settings.Concurrency, &config.concurrency},
+	} {
+		if dimension.value < 0 {
+			return fmt.Errorf("invalid %s, must be positive: %d", dimension.name, dimension.value)
+		}
+		if dimension.value > 0 {
+			*dimension.field = dimension.value
+		}
+	}
+
+	if settings.JPEGQuality < 0 || settings.JPEGQuality > 100 {
+		return fmt.Errorf("invalid jpeg_quality, must be between 1 and 100: %d", settings.JPEGQuality)
+	}
+	if settings.JPEGQuality > 0 {
+		config.media.jpegQuality = settings.JPEGQuality
+	}
+
+	for _, dir := range []struct {
+		name  string
+		value string
+		field *string
+	}{
+		{"thumbnail_dir", settings.ThumbnailDir, &config.files.thumbnailDir},
+		{"fullsize_dir", settings.FullsizeDir, &config.files.fullsizeDir},
+		{"original_dir", settings.OriginalDir, &config.files.originalDir},
+	} {
+		if dir.value == "" {
+			continue
+		}
+		if !isValidGalleryDirName(dir.value) {
+			return fmt.Errorf("invalid %s, must be a directory name: %s", dir.name, dir.value)
+		}
+		*dir.field = dir.value
+	}
+	if config.files.thumbnailDir == config.files.fullsizeDir || config.files.thumbnailDir == config.files.originalDir || config.files.fullsizeDir == config.files.originalDir {
+		return errors.New("thumbnail_dir, fullsize_dir and original_dir must be different")
+	}
+
+	var err error
+	if settings.DirMode != "" {
+		config.files.directoryMode, err = parseFileMode(settings.DirMode)
+		if err != nil {
+			return err
+		}
+	}
+	if settings.FileMode != "" {
+		config.files.fileMode, err = parseFileMode(settings.FileMode)
+		if err != nil {
+			return err
+		}
+	}
+	if settings.Originals != "" {
+		if !isOriginalsMode(settings.Originals) {
+			return errors.New("invalid originals, must be symlink, copy or hardlink: " + settings.Originals)
+		}
+		config.files.originals = settings.Originals
+	}
+	config.media.videoExtensions = settings.VideoExtensions
+	return nil
+}
+
+// loadConfiguration returns the default configuration with the settings of the
+// configuration file applied. Without a path, the default configuration file is read
+// if there is one.
+func loadConfiguration(configPath string) (configuration, error) {
+	config := initializeConfig()
+
+	required := configPath != ""
+	if !required {
+		configPath = getDefaultConfigFile()
+	}
+	if configPath == "" {
+		return config, nil
+	}
+
+	buffer, err := os.ReadFile(configPath)
+	if os.IsNotExist(err) && !required {
+		return config, nil
+	}
+	var settings configFileSettings
+	if err == nil {
+		settings, err = parseConfigFile(buffer)
+	}
+	if err == nil {
+		err = applyConfigFile(&config, settings)
+	}
+	if err != nil {
+		return config, fmt.Errorf("couldn't read configuration file %s: %w", configPath, err)
+	}
+	return config, nil
+}
@@ -0,0 +1,80 @@
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseConfigFile(t *testing.T) {
+	settings, err := parseConfigFile([]byte("thumbnail_width: 400\nthumbnail_dir: thumbs\nfile_mode: \"0640\"\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, 400, settings.ThumbnailWidth)
+	assert.Equal(t, "thumbs", settings.ThumbnailDir)
+	assert.Equal(t, "0640", settings.FileMode)
+
+	_, err = parseConfigFile([]byte{})
+	assert.NoError(t, err)
+
+	// Typos are caught
+	_, err = parseConfigFile([]byte("thumbnail_widht: 400\n"))
+	assert.Error(t, err)
+}
+
+func TestApplyConfigFile(t *testing.T) {
+	config := initializeConfig()
+	err := applyConfigFile(&config, configFileSettings{ThumbnailWidth: 400, ThumbnailHeight: 300, VideoMaxSize: 1280, JPEGQuality: 85, FullsizeDir: "large", DirMode: "0750", Concurrency: 8, Originals: "copy", VideoExtensions: []string{".dav"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 400, config.media.thumbnailWidth)
+	assert.Equal(t, 300, config.media.thumbnailHeight)
+	assert.Equal(t, 1920, config.media.fullsizeMaxWidth)
+	assert.Equal(t, 1280, config.media.videoMaxSize)
+	assert.Equal(t, 85, config.media.jpegQuality)
+	assert.Equal(t, "large", config.files.fullsizeDir)
+	assert.Equal(t, "_thumbnail", config.files.thumbnailDir)
+	assert.Equal(t, os.FileMode(0750), config.files.directoryMode)
+	assert.Equal(t, os.FileMode(0644), config.files.fileMode)
+	assert.Equal(t, 8, config.concurrency)
+	assert.Equal(t, originalsCopy, config.files.originals)
+	assert.Equal(t, []string{".dav"}, config.media.videoExtensions)
+
+	for _, settings := range []configFileSettings{
+		{ThumbnailWidth: -1},
+		{JPEGQuality: 101},
+		{OriginalDir: filepath.Join("a", "b")},
+		{OriginalDir: ".."},
+		{FullsizeDir: "_thumbnail"},
+		{FileMode: "rw-r--r--"},
+		{Originals: "move"},
+	} {
+		config := initializeConfig()
+		assert.Error(t, applyConfigFile(&config, settings))
+	}
+}
+
+func TestLoadConfiguration(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	configPath := filepath.Join(tempDir, "config.yaml")
+	err = os.WriteFile(configPath, []byte("fullsize_max_width: 2560\nfullsize_max_height: 1440\n"), 0644)
+	assert.NoError(t, err)
+	config, err := loadConfiguration(configPath)
+	assert.NoError(t, err)
+	assert.Equal(t, 2560, config.media.fullsizeMaxWidth)
+	assert.Equal(t, 1440, config.media.fullsizeMaxHeight)
+
+	// Configuration files given with --config have to exist
+	_, err = loadConfiguration(filepath.Join(tempDir, "missing.yaml"))
+	assert.Error(t, err)
+
+	err = os.WriteFile(configPath, []byte("concurrency: many\n"), 0644)
+	assert.NoError(t, err)
+	_, err = loadConfiguration(configPath)
+	assert.Error(t, err)
+}
@@ -0,0 +1,88 @@
+package gallery
+
+import (
+	"log"
+	"path"
+	"path/filepath"
+	"text/template"
+)
+
+// Name of the contact sheet page in each album directory of the gallery
+const contactSheetFile = "contactsheet.html"
+
+// contactSheetEntry is one numbered photo or video on a contact sheet. The thumbnail
+// URL is relative to the album directory.
+type contactSheetEntry struct {
+	Number    int
+	Thumbnail string
+	Filename  string
+	Caption   string
+}
+
+// contactSheetPage struct is loaded with the information to fill in the contact sheet
+// template of one album. HTMLFile is the album page.
+type contactSheetPage struct {
+	Title    string
+	Count    string
+	HTMLFile string
+	Entries  []contactSheetEntry
+}
+
+// createContactSheetEntries numbers the files of an album in gallery order, so clients
+// can refer to photos by their number when proofing on paper
+func createContactSheetEntries(source directory, config configuration) (entries []contactSheetEntry) {
+	for i, sourceFile := range source.files {
+		thumbnailFilename, _ := getGalleryFilenames(sourceFile.absPath, config)
+		entries = append(entries, contactSheetEntry{
+			Number:    i + 1,
+			Thumbnail: escapeURLPath(path.Join(config.files.thumbnailDir, thumbnailFilename)),
+			Filename:  sourceFile.name,
+			Caption:   sourceFile.sidecar.caption,
+		})
+	}
+	return entries
+}
+
+// writeContactSheets recursively writes a printable contact sheet into every album
+// directory of the gallery which has photos or videos of its own
+func writeContactSheets(source directory, gallery directory, cookedTemplate *template.Template, dryRun bool, config configuration) {
+	if len(source.files) > 0 {
+		writeContactSheet(source, filepath.Join(gallery.absPath, source.relPath), cookedTemplate, dryRun, config)
+	}
+
+	for _, subdir := range source.subdirectories {
+		writeContactSheets(subdir, gallery, cookedTemplate, dryRun, config)
+	}
+}
+
+// writeContactSheet writes the contact sheet of one album into its gallery directory
+func writeContactSheet(source directory, galleryDirectory string, cookedTemplate *template.Template, dryRun bool, config configuration) {
+	pagePath := filepath.Join(galleryDirectory, contactSheetFile)
+	if dryRun {
+		log.Println("Would write contact sheet:", pagePath)
+		return
+	}
+
+	stats := collectAlbumStats(directory{files: source.files}, config)
+	page := contactSheetPage{
+		Title:    albumTitle(source),
+		Count:    formatAlbumStats(stats, config).Counts,
+		HTMLFile: config.assets.htmlFile,
+		Entries:  createContactSheetEntries(source, config),
+	}
+
+	pageHandle, err := createFile(pagePath, config)
+	if err != nil {
+		log.Println("couldn't create contact sheet", pagePath, ":", err.Error())
+		return
+	}
+	defer pageHandle.Close()
+
+	err = cookedTemplate.Execute(pageHandle, page)
+	if err != nil {
+		log.Println("couldn't execute contact sheet template", pagePath, ":", err.Error())
+		return
+	}
+
+	logProgress(config, "Wrote contact sheet:", pagePath)
+}
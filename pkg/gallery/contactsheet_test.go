@@ -0,0 +1,57 @@
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateContactSheetEntries(t *testing.T) {
+	config := initializeConfig()
+	source := directory{files: []file{{name: "a b.jpg", absPath: "/photos/a b.jpg"}, {name: "c.mp4", absPath: "/photos/c.mp4", sidecar: sidecarMetadata{caption: "Beach"}}}}
+
+	entries := createContactSheetEntries(source, config)
+	assert.Len(t, entries, 2)
+	assert.EqualValues(t, 1, entries[0].Number)
+	assert.EqualValues(t, "_thumbnail/a%20b.jpg", entries[0].Thumbnail)
+	assert.EqualValues(t, 2, entries[1].Number)
+	assert.EqualValues(t, "c.mp4", entries[1].Filename)
+	assert.EqualValues(t, "Beach", entries[1].Caption)
+}
+
+func TestWriteContactSheets(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	err = os.Mkdir(filepath.Join(tempDir, "trip"), 0755)
+	assert.NoError(t, err)
+	source := directory{
+		name:           "Photos",
+		subdirectories: []directory{{name: "trip", relPath: "trip", files: []file{{name: "a.jpg", absPath: "/photos/a.jpg"}, {name: "b.jpg", absPath: "/photos/b.jpg"}}}},
+	}
+	gallery := directory{absPath: tempDir}
+	cookedTemplates := testTemplates(t, config)
+
+	writeContactSheets(source, gallery, cookedTemplates.contact, true, config)
+	assert.NoFileExists(t, filepath.Join(tempDir, "trip", contactSheetFile))
+
+	writeContactSheets(source, gallery, cookedTemplates.contact, false, config)
+	assert.NoFileExists(t, filepath.Join(tempDir, contactSheetFile))
+	html, err := os.ReadFile(filepath.Join(tempDir, "trip", contactSheetFile))
+	assert.NoError(t, err)
+	assert.Contains(t, string(html), "<h1>trip</h1>")
+	assert.Contains(t, string(html), "2 photos")
+	assert.Contains(t, string(html), `<span class="number">2</span>b.jpg`)
+
+	config.assets.contactSheet = true
+	createHTML(1, source.subdirectories[0], filepath.Join(tempDir, "trip"), cookedTemplates.html, false, config)
+	html, err = os.ReadFile(filepath.Join(tempDir, "trip", config.assets.htmlFile))
+	assert.NoError(t, err)
+	assert.Contains(t, string(html), `<a href="contactsheet.html">Contact sheet</a>`)
+}
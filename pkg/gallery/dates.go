@@ -0,0 +1,136 @@
+package gallery
+
+import (
+	"errors"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Layout used to display capture dates in the gallery
+const displayTimeLayout = "2006-01-02 15:04"
+
+// Layout of the day headings between photos of albums spanning several days
+const dayHeadingLayout = "Monday 2 January 2006"
+
+// parseTimeOffsets parses --time-offset values of the form [subdirectory=]duration,
+// e.g. "+2h" for the whole source or "2019/Japan=-9h30m" for a subtree.
+// Returns a map from relative source path ("" for the root) to offset.
+func parseTimeOffsets(values []string) (map[string]time.Duration, error) {
+	offsets := make(map[string]time.Duration)
+	for _, value := range values {
+		subdirectory := ""
+		duration := value
+		if separator := strings.LastIndex(value, "="); separator != -1 {
+			subdirectory = value[:separator]
+			duration = value[separator+1:]
+		}
+
+		offset, err := time.ParseDuration(duration)
+		if err != nil {
+			return nil, errors.New("invalid time offset " + value + ": " + err.Error())
+		}
+
+		subdirectory = filepath.Clean(subdirectory)
+		if subdirectory == "." {
+			subdirectory = ""
+		}
+		offsets[subdirectory] = offset
+	}
+	return offsets, nil
+}
+
+// readExifMetadata recursively reads camera models, image dimensions and capture times
+// from EXIF for the source files, keeping capture times already known from other
+// metadata. Dimensions of images without EXIF are read from the image header. Clock
+// corrections from --time-offset and album.yaml time_offset are applied to the whole
+// subtree they're defined for, album.yaml winning over the command line. If sorting
+// by date, files are ordered chronologically afterwards.
+func readExifMetadata(source *directory, inheritedOffset time.Duration, config configuration) {
+	offset := readDirectoryExifMetadata(source, inheritedOffset, config)
+
+	for i := range source.subdirectories {
+		readExifMetadata(&source.subdirectories[i], offset, config)
+	}
+}
+
+// readDirectoryExifMetadata reads the EXIF metadata of the files in one source directory.
+// Returns the clock correction for its subdirectories to inherit.
+func readDirectoryExifMetadata(source *directory, inheritedOffset time.Duration, config configuration) time.Duration {
+	offset := inheritedOffset
+	if flagOffset, ok := config.media.timeOffsets[source.relPath]; ok {
+		offset = flagOffset
+	}
+	if source.album.TimeOffset != "" {
+		albumOffset, err := time.ParseDuration(source.album.TimeOffset)
+		if err != nil {
+			log.Println("invalid time_offset in album configuration:", source.absPath, err.Error())
+		} else {
+			offset = albumOffset
+		}
+	}
+
+	for i := range source.files {
+		tags, err := readExifTags(source.files[i].absPath)
+		if err != nil {
+			if isImageFile(source.files[i].absPath, config) {
+				source.files[i].width, source.files[i].height, _ = readImageDimensions(source.files[i].absPath)
+			}
+			continue
+		}
+
+		source.files[i].camera = tags.camera()
+		source.files[i].exposure = tags.exposure()
+		if width, height, ok := tags.dimensions(); ok {
+			source.files[i].width, source.files[i].height = width, height
+		} else if isImageFile(source.files[i].absPath, config) {
+			source.files[i].width, source.files[i].height, _ = readImageDimensions(source.files[i].absPath)
+		}
+		source.files[i].latitude, source.files[i].longitude, source.files[i].geotagged = tags.location()
+		if !source.files[i].takenTime.IsZero() {
+			continue
+		}
+		if takenTime, ok := tags.takenTime(config.media.timezone); ok {
+			source.files[i].takenTime = takenTime.Add(offset)
+		}
+	}
+
+	if config.media.sortOrder == "date" {
+		sortFilesByTakenTime(source.files)
+	}
+
+	return offset
+}
+
+// formatTakenTime returns the capture time for display in the configured timezone
+func formatTakenTime(takenTime time.Time, config configuration) string {
+	if takenTime.IsZero() {
+		return ""
+	}
+	return takenTime.In(config.media.timezone).Format(displayTimeLayout)
+}
+
+// getDayHeadings returns a heading for each file which starts a new day, for breaking up
+// albums spanning several days. Files of unknown date don't start a day, and albums of a
+// single day get no headings at all.
+func getDayHeadings(files []file, config configuration) []string {
+	headings := make([]string, len(files))
+	days := make(map[string]bool)
+	lastDay := ""
+	for i, sourceFile := range files {
+		if sourceFile.takenTime.IsZero() {
+			continue
+		}
+		day := sourceFile.takenTime.In(config.media.timezone).Format(dayHeadingLayout)
+		days[day] = true
+		if day != lastDay {
+			headings[i] = day
+			lastDay = day
+		}
+	}
+	if len(days) < 2 {
+		return make([]string, len(files))
+	}
+	return headings
+}
@@ -0,0 +1,76 @@
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTimeOffsets(t *testing.T) {
+	offsets, err := parseTimeOffsets([]string{"+2h", "2019/Japan/=-9h30m"})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2*time.Hour, offsets[""])
+	assert.EqualValues(t, -(9*time.Hour + 30*time.Minute), offsets[filepath.Join("2019", "Japan")])
+
+	_, err = parseTimeOffsets([]string{"subdir=two hours"})
+	assert.Error(t, err)
+}
+
+func TestReadTakenTimes(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	err = os.Mkdir(filepath.Join(tempDir, "subdir"), 0755)
+	assert.NoError(t, err)
+
+	testFiles := map[string][]byte{
+		"late.jpg":                               buildTestJPEG(buildTestTIFF("2021:06:12 18:30:00", "")),
+		"early.jpg":                              buildTestJPEG(buildTestTIFF("2021:06:12 08:00:00", "")),
+		"undated.jpg":                            []byte{},
+		filepath.Join("subdir", "a.jpg"):         buildTestJPEG(buildTestTIFF("2021:06:12 08:00:00", "")),
+		filepath.Join("subdir", albumConfigFile): []byte("time_offset: -30m\n"),
+	}
+	for filename, contents := range testFiles {
+		err = os.WriteFile(filepath.Join(tempDir, filename), contents, 0644)
+		assert.NoError(t, err)
+	}
+
+	config := initializeConfig()
+	config.media.timezone = time.UTC
+	config.media.sortOrder = "date"
+	config.media.timeOffsets, err = parseTimeOffsets([]string{"+1h"})
+	assert.NoError(t, err)
+
+	source, _ := createDirectoryTree(tempDir, "", false, config)
+	readAlbumConfigs(&source)
+	readExifMetadata(&source, 0, config)
+
+	assert.EqualValues(t, "early.jpg", source.files[0].name)
+	assert.EqualValues(t, "2021-06-12 09:00", formatTakenTime(source.files[0].takenTime, config))
+	assert.EqualValues(t, "late.jpg", source.files[1].name)
+	assert.EqualValues(t, "undated.jpg", source.files[2].name)
+	assert.EqualValues(t, "", formatTakenTime(source.files[2].takenTime, config))
+
+	// album.yaml offset overrides the one given on the command line
+	assert.EqualValues(t, "2021-06-12 07:30", formatTakenTime(source.subdirectories[0].files[0].takenTime, config))
+}
+
+func TestGetDayHeadings(t *testing.T) {
+	config := initializeConfig()
+	config.media.timezone = time.UTC
+	day := func(date int, hour int) time.Time {
+		return time.Date(2021, 3, date, hour, 0, 0, 0, time.UTC)
+	}
+
+	files := []file{{takenTime: day(4, 9)}, {}, {takenTime: day(4, 18)}, {takenTime: day(5, 8)}, {takenTime: day(5, 9)}}
+	assert.Equal(t, []string{"Thursday 4 March 2021", "", "", "Friday 5 March 2021", ""}, getDayHeadings(files, config))
+
+	// A single day needs no headings
+	assert.Equal(t, []string{"", "", ""}, getDayHeadings([]file{{takenTime: day(4, 9)}, {}, {takenTime: day(4, 10)}}, config))
+}
@@ -0,0 +1,68 @@
+package gallery
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+
+	// Register decoders for reading image headers
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/webp"
+)
+
+// Images at least this many times wider than they're tall are shown as panoramas
+const panoramaRatio = 2
+
+// readImageDimensions reads the width and height of a JPEG, PNG, GIF, WebP or AVIF image
+// from its header
+func readImageDimensions(imagePath string) (width int, height int, err error) {
+	imageHandle, err := os.Open(imagePath)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer imageHandle.Close()
+
+	if strings.EqualFold(filepath.Ext(imagePath), avifExtension) {
+		return readAVIFDimensions(imageHandle)
+	}
+	imageConfig, _, err := image.DecodeConfig(imageHandle)
+	if err != nil {
+		return 0, 0, err
+	}
+	return imageConfig.Width, imageConfig.Height, nil
+}
+
+// formatFileSize returns a file size for humans, e.g. "3.2 MB"
+func formatFileSize(size int64) string {
+	const unit = 1000
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	divisor, exponent := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		divisor *= unit
+		exponent++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(divisor), "kMGTPE"[exponent])
+}
+
+// getOrientation returns "portrait", "landscape" or "panorama" for the album grid to lay
+// out the tile of an image, or an empty string if its dimensions aren't known
+func getOrientation(width int, height int) string {
+	switch {
+	case width <= 0 || height <= 0:
+		return ""
+	case width >= panoramaRatio*height:
+		return "panorama"
+	case width >= height:
+		return "landscape"
+	default:
+		return "portrait"
+	}
+}
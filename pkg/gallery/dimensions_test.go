@@ -0,0 +1,50 @@
+package gallery
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadImageDimensions(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	pngPath := filepath.Join(tempDir, "image.png")
+	pngHandle, err := os.Create(pngPath)
+	assert.NoError(t, err)
+	err = png.Encode(pngHandle, image.NewGray(image.Rect(0, 0, 30, 20)))
+	assert.NoError(t, err)
+	pngHandle.Close()
+
+	width, height, err := readImageDimensions(pngPath)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 30, width)
+	assert.EqualValues(t, 20, height)
+
+	_, _, err = readImageDimensions("../../testing/source/video.mp4")
+	assert.Error(t, err)
+}
+
+func TestFormatFileSize(t *testing.T) {
+	assert.EqualValues(t, "0 B", formatFileSize(0))
+	assert.EqualValues(t, "999 B", formatFileSize(999))
+	assert.EqualValues(t, "1.5 kB", formatFileSize(1500))
+	assert.EqualValues(t, "3.2 MB", formatFileSize(3200000))
+	assert.EqualValues(t, "1.0 GB", formatFileSize(1000000000))
+}
+
+func TestGetOrientation(t *testing.T) {
+	assert.Equal(t, "", getOrientation(0, 0))
+	assert.Equal(t, "portrait", getOrientation(3000, 4000))
+	assert.Equal(t, "landscape", getOrientation(4000, 3000))
+	assert.Equal(t, "landscape", getOrientation(1000, 1000))
+	assert.Equal(t, "panorama", getOrientation(8000, 2000))
+}
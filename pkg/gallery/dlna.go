@@ -0,0 +1,96 @@
+package gallery
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// Output profiles of the gallery tree. web is for browsers only. dlna also makes the tree
+// browsable with DLNA/UPnP media servers like MiniDLNA or Jellyfin, e.g. on a TV: the
+// media directories get plain names instead of underscore ones listed as odd albums,
+// gallery files get slug names, and only codecs every TV plays are allowed.
+const (
+	outputProfileWeb  = "web"
+	outputProfileDLNA = "dlna"
+)
+
+// Names of the media directories of the dlna profile, by their default names. Directories
+// renamed in the configuration file keep their names.
+var dlnaDirectoryNames = map[string]string{
+	"_thumbnail":   "thumbnails",
+	"_fullsize":    "photos",
+	"_original":    "originals",
+	"_attachments": "attachments",
+	"_lite":        "lite",
+}
+
+// isOutputProfile checks whether given string is a known output profile
+func isOutputProfile(profile string) bool {
+	return profile == outputProfileWeb || profile == outputProfileDLNA
+}
+
+// applyDLNAProfile applies the dlna output profile to the configuration. Without other
+// output names, gallery files get slug names. Formats media servers and TVs can't play
+// are errors: full-size videos have to be H.264 and images JPEGs.
+func applyDLNAProfile(config *configuration) error {
+	if config.media.videoProfile != videoProfileCompatibility {
+		return errors.New("--output-profile dlna needs the compatibility video profile, TVs can't play " + config.media.videoProfile + " videos")
+	}
+	if config.files.imageExtension != getImageFormatExtension("jpeg") || config.files.webp {
+		return errors.New("--output-profile dlna needs JPEG images, media servers don't list WebP or AVIF images as photos")
+	}
+
+	useDLNADirectoryNames(config)
+	if config.files.namePolicy == namePolicyPreserve {
+		config.files.namePolicy = namePolicySlug
+	}
+	return nil
+}
+
+// useDLNADirectoryNames renames the media directories of the configuration which have
+// their default names to the ones of the dlna profile
+func useDLNADirectoryNames(config *configuration) {
+	config.files.outputProfile = outputProfileDLNA
+	for _, directoryName := range []*string{&config.files.thumbnailDir, &config.files.fullsizeDir, &config.files.originalDir, &config.files.attachmentDir, &config.files.liteDir} {
+		if dlnaName, ok := dlnaDirectoryNames[*directoryName]; ok {
+			*directoryName = dlnaName
+		}
+	}
+}
+
+// checkDLNADirectoryNames checks that no album of the source is named like one of the
+// media directories of the dlna profile. Such an album would be mistaken for the media
+// directory of its parent album, or the other way around, as the names are plain words.
+// Names differing only in case clash on case-insensitive file systems. The gallery is
+// skipped if it's inside the source.
+func checkDLNADirectoryNames(sourceDirectory string, galleryDirectory string, config configuration) error {
+	resolvedGallery := resolvePath(galleryDirectory)
+	mediaDirectories := []string{config.files.thumbnailDir, config.files.fullsizeDir, config.files.originalDir, config.files.attachmentDir, config.files.liteDir}
+	return filepath.WalkDir(sourceDirectory, func(path string, entry fs.DirEntry, err error) error {
+		// Unreadable directories are left for the scan to report
+		if err != nil || !entry.IsDir() || path == sourceDirectory {
+			return nil
+		}
+		if resolvePath(path) == resolvedGallery {
+			return filepath.SkipDir
+		}
+		for _, mediaDirectory := range mediaDirectories {
+			if strings.EqualFold(entry.Name(), mediaDirectory) {
+				return errors.New("--output-profile dlna names media directories " + mediaDirectory + ", rename the source album with the same name: " + path)
+			}
+		}
+		return nil
+	})
+}
+
+// applyGalleryOutputProfile applies the media directory names of the output profile an
+// existing gallery was built with, as recorded in its build manifest, for the commands
+// working on finished galleries
+func applyGalleryOutputProfile(galleryDirectory string, config *configuration) {
+	manifest, ok := readBuildManifest(galleryDirectory)
+	if ok && manifest.Settings.OutputProfile == outputProfileDLNA {
+		useDLNADirectoryNames(config)
+	}
+}
@@ -0,0 +1,100 @@
+package gallery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyDLNAProfile(t *testing.T) {
+	assert.True(t, isOutputProfile(outputProfileWeb))
+	assert.False(t, isOutputProfile("tv"))
+
+	config := initializeConfig()
+	config.files.originalDir = "Original"
+	assert.NoError(t, applyDLNAProfile(&config))
+	assert.Equal(t, "thumbnails", config.files.thumbnailDir)
+	assert.Equal(t, "photos", config.files.fullsizeDir)
+	assert.Equal(t, "Original", config.files.originalDir)
+	assert.Equal(t, "attachments", config.files.attachmentDir)
+	assert.Equal(t, namePolicySlug, config.files.namePolicy)
+	assert.Equal(t, outputProfileDLNA, createBuildSettings(config).OutputProfile)
+
+	// Lowercase names are sane enough
+	config = initializeConfig()
+	config.files.namePolicy = namePolicyLowercase
+	assert.NoError(t, applyDLNAProfile(&config))
+	assert.Equal(t, namePolicyLowercase, config.files.namePolicy)
+
+	config = initializeConfig()
+	config.media.videoProfile = videoProfileEfficiency
+	assert.Error(t, applyDLNAProfile(&config))
+
+	config = initializeConfig()
+	config.files.webp = true
+	assert.Error(t, applyDLNAProfile(&config))
+
+	config = initializeConfig()
+	config.files.imageExtension = avifExtension
+	assert.Error(t, applyDLNAProfile(&config))
+}
+
+func TestCheckDLNADirectoryNames(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceDirectory := filepath.Join(tempDir, "source")
+	galleryDirectory := filepath.Join(sourceDirectory, "gallery")
+	config := initializeConfig()
+	assert.NoError(t, applyDLNAProfile(&config))
+
+	// The gallery's own media directories are fine if it's inside the source
+	assert.NoError(t, os.MkdirAll(filepath.Join(sourceDirectory, "holiday"), 0755))
+	assert.NoError(t, os.MkdirAll(filepath.Join(galleryDirectory, "holiday", config.files.fullsizeDir), 0755))
+	assert.NoError(t, checkDLNADirectoryNames(sourceDirectory, galleryDirectory, config))
+
+	// An album named photos would be taken for the full-size photos of its parent
+	photosAlbum := filepath.Join(sourceDirectory, "holiday", "photos")
+	assert.NoError(t, os.Mkdir(photosAlbum, 0755))
+	err := checkDLNADirectoryNames(sourceDirectory, galleryDirectory, config)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), photosAlbum)
+
+	// Names only differing in case clash on case-insensitive file systems
+	assert.NoError(t, os.Rename(photosAlbum, filepath.Join(sourceDirectory, "holiday", "Photos")))
+	assert.Error(t, checkDLNADirectoryNames(sourceDirectory, galleryDirectory, config))
+
+	// The web profile's underscore names aren't checked
+	webConfig := initializeConfig()
+	assert.NoError(t, checkDLNADirectoryNames(sourceDirectory, galleryDirectory, webConfig))
+}
+
+func TestDLNAProfileAlbumNamedPhotos(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceDirectory := filepath.Join(tempDir, "source")
+	galleryDirectory := filepath.Join(tempDir, "gallery")
+	assert.NoError(t, os.MkdirAll(filepath.Join(sourceDirectory, "photos"), 0755))
+	assert.NoError(t, os.Mkdir(galleryDirectory, 0755))
+
+	options := NewOptions(sourceDirectory, galleryDirectory)
+	options.OutputProfile = outputProfileDLNA
+	err := Build(context.Background(), options)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "--output-profile dlna")
+	assert.NoFileExists(t, filepath.Join(galleryDirectory, defaultHTMLFile))
+}
+
+func TestApplyGalleryOutputProfile(t *testing.T) {
+	tempDir := t.TempDir()
+	config := initializeConfig()
+	applyGalleryOutputProfile(tempDir, &config)
+	assert.Equal(t, "_thumbnail", config.files.thumbnailDir)
+
+	dlnaConfig := initializeConfig()
+	assert.NoError(t, applyDLNAProfile(&dlnaConfig))
+	writeBuildManifest(tempDir, buildManifest{Settings: createBuildSettings(dlnaConfig)}, false, dlnaConfig)
+	applyGalleryOutputProfile(tempDir, &config)
+	assert.Equal(t, "thumbnails", config.files.thumbnailDir)
+	assert.Equal(t, "lite", config.files.liteDir)
+}
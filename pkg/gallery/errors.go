@@ -0,0 +1,157 @@
+package gallery
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"syscall"
+)
+
+// Maximum number of lines of external program output kept in a failure record.
+// The last lines are kept, as that's where ffmpeg explains why it gave up.
+const failureOutputMaxLines = 20
+
+// Maximum length of one line of external program output kept in a failure record
+const failureOutputMaxLineLength = 300
+
+// errUnsupportedFormat is returned for media files libvips can't read or which can't
+// be converted to the gallery's formats
+var errUnsupportedFormat = errors.New("unsupported format")
+
+// errDiskFull is returned when the gallery's disk has run out of space
+var errDiskFull = errors.New("disk full")
+
+// transcodeError is returned when ffmpeg fails to transcode a video. stderr is
+// ffmpeg's output for the failed operation, truncated with truncateOutput().
+type transcodeError struct {
+	file   string
+	stderr string
+	err    error
+}
+
+func (thisError *transcodeError) Error() string {
+	return "couldn't transcode " + thisError.file + ": " + thisError.err.Error()
+}
+
+func (thisError *transcodeError) Unwrap() error {
+	return thisError.err
+}
+
+// failure struct is one source file which couldn't be transformed
+type failure struct {
+	file string
+	err  error
+}
+
+// wrapWriteError marks errors writing gallery files due to a full disk with errDiskFull
+func wrapWriteError(err error) error {
+	if errors.Is(err, syscall.ENOSPC) {
+		return fmt.Errorf("%w: %v", errDiskFull, err)
+	}
+	return err
+}
+
+// truncateOutput shortens the output of an external program to its last lines for
+// a failure record, cutting overly long lines
+func truncateOutput(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) > failureOutputMaxLines {
+		lines = append([]string{"..."}, lines[len(lines)-failureOutputMaxLines:]...)
+	}
+	for i, line := range lines {
+		if len(line) > failureOutputMaxLineLength {
+			lines[i] = line[:failureOutputMaxLineLength] + "..."
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// failureCause returns the class of a transformation error, to group failures by
+func failureCause(err error) string {
+	var thisTranscodeError *transcodeError
+	switch {
+	case errors.Is(err, errDiskFull):
+		return "disk full"
+	case errors.Is(err, os.ErrPermission):
+		return "permission denied"
+	case errors.Is(err, errUnsupportedFormat):
+		return "unsupported format"
+	case errors.As(err, &thisTranscodeError):
+		return "video transcoding failed"
+	default:
+		return "other error"
+	}
+}
+
+// addFailure records a source file of the run which couldn't be transformed
+func (run *runState) addFailure(file string, err error) {
+	run.failureMutex.Lock()
+	run.failures = append(run.failures, failure{file: file, err: err})
+	run.failureMutex.Unlock()
+}
+
+// countFailures returns the number of files of the run which couldn't be transformed
+func (run *runState) countFailures() int {
+	run.failureMutex.Lock()
+	defer run.failureMutex.Unlock()
+	return len(run.failures)
+}
+
+// setDiskFull records that the gallery's disk is full. Returns whether it wasn't before.
+func (run *runState) setDiskFull() bool {
+	return atomic.CompareAndSwapInt32(&run.diskFull, 0, 1)
+}
+
+// isDiskFull checks whether the gallery's disk has been found full during this run
+func (run *runState) isDiskFull() bool {
+	return atomic.LoadInt32(&run.diskFull) == 1
+}
+
+// sortedFailures returns the failures ordered by filename, as the workers finish files
+// in no particular order. failureMutex must be held.
+func (run *runState) sortedFailures() []failure {
+	sorted := append([]failure(nil), run.failures...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].file < sorted[j].file
+	})
+	return sorted
+}
+
+// reportFailures logs the files which couldn't be transformed, grouped by cause.
+// Returns the number of failed files.
+func (run *runState) reportFailures() int {
+	run.failureMutex.Lock()
+	defer run.failureMutex.Unlock()
+
+	causes := make(map[string][]failure)
+	for _, thisFailure := range run.sortedFailures() {
+		cause := failureCause(thisFailure.err)
+		causes[cause] = append(causes[cause], thisFailure)
+	}
+
+	var causeNames []string
+	for cause := range causes {
+		causeNames = append(causeNames, cause)
+	}
+	sort.Strings(causeNames)
+
+	for _, cause := range causeNames {
+		log.Println("Failed to transform", len(causes[cause]), "files,", cause+":")
+		for _, thisFailure := range causes[cause] {
+			log.Println("  ", thisFailure.file, thisFailure.err.Error())
+
+			var thisTranscodeError *transcodeError
+			if errors.As(thisFailure.err, &thisTranscodeError) && thisTranscodeError.stderr != "" {
+				for _, line := range strings.Split(thisTranscodeError.stderr, "\n") {
+					log.Println("     ", line)
+				}
+			}
+		}
+	}
+
+	return len(run.failures)
+}
@@ -0,0 +1,70 @@
+package gallery
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailureCause(t *testing.T) {
+	diskFull := wrapWriteError(&os.PathError{Op: "write", Path: "a.jpg", Err: syscall.ENOSPC})
+	assert.True(t, errors.Is(diskFull, errDiskFull))
+	assert.EqualValues(t, "disk full", failureCause(diskFull))
+
+	notDiskFull := wrapWriteError(os.ErrClosed)
+	assert.False(t, errors.Is(notDiskFull, errDiskFull))
+	assert.EqualValues(t, "other error", failureCause(notDiskFull))
+
+	assert.EqualValues(t, "unsupported format", failureCause(fmt.Errorf("%w: no decoder", errUnsupportedFormat)))
+	assert.EqualValues(t, "permission denied", failureCause(&os.PathError{Op: "open", Path: "a.jpg", Err: syscall.EACCES}))
+
+	transcodeFailure := &transcodeError{file: "a.mov", stderr: "moov atom not found", err: errors.New("exit status 1")}
+	assert.EqualValues(t, "video transcoding failed", failureCause(transcodeFailure))
+	assert.EqualValues(t, "couldn't transcode a.mov: exit status 1", transcodeFailure.Error())
+}
+
+func TestTruncateOutput(t *testing.T) {
+	assert.EqualValues(t, "", truncateOutput(""))
+	assert.EqualValues(t, "moov atom not found", truncateOutput("moov atom not found\n"))
+
+	var lines []string
+	for i := 0; i < failureOutputMaxLines+5; i++ {
+		lines = append(lines, fmt.Sprint("line ", i))
+	}
+	truncated := strings.Split(truncateOutput(strings.Join(lines, "\n")), "\n")
+	assert.Len(t, truncated, failureOutputMaxLines+1)
+	assert.EqualValues(t, "...", truncated[0])
+	assert.EqualValues(t, lines[len(lines)-1], truncated[len(truncated)-1])
+
+	truncated = strings.Split(truncateOutput(strings.Repeat("x", failureOutputMaxLineLength+1)), "\n")
+	assert.Len(t, truncated[0], failureOutputMaxLineLength+3)
+}
+
+func TestReportFailures(t *testing.T) {
+	run := newRunState()
+	assert.EqualValues(t, 0, run.reportFailures())
+
+	run.addFailure("a.jpg", errUnsupportedFormat)
+	run.addFailure("b.mov", &transcodeError{file: "b.mov", err: errors.New("exit status 1")})
+	assert.EqualValues(t, 2, run.reportFailures())
+
+	// Other runs have failures of their own
+	assert.EqualValues(t, 0, newRunState().reportFailures())
+}
+
+func TestSortedFailures(t *testing.T) {
+	run := newRunState()
+	run.addFailure("b.jpg", errUnsupportedFormat)
+	run.addFailure("a.jpg", errUnsupportedFormat)
+	sorted := run.sortedFailures()
+	assert.EqualValues(t, "a.jpg", sorted[0].file)
+	assert.EqualValues(t, "b.jpg", sorted[1].file)
+
+	// The recorded failures stay as they were
+	assert.EqualValues(t, "b.jpg", run.failures[0].file)
+}
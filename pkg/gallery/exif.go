@@ -0,0 +1,601 @@
+package gallery
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// EXIF tags we're interested in, both from IFD0 and the EXIF sub-IFD
+const (
+	exifTagMake               = 0x010f
+	exifTagModel              = 0x0110
+	exifTagOrientation        = 0x0112
+	exifTagDateTime           = 0x0132
+	exifTagExifIFDPointer     = 0x8769
+	exifTagExposureTime       = 0x829a
+	exifTagFNumber            = 0x829d
+	exifTagGPSIFDPointer      = 0x8825
+	exifTagISOSpeed           = 0x8827
+	exifTagDateTimeOriginal   = 0x9003
+	exifTagOffsetTimeOriginal = 0x9011
+	exifTagFocalLength        = 0x920a
+	exifTagPixelXDimension    = 0xa002
+	exifTagPixelYDimension    = 0xa003
+)
+
+// GPS tags we're interested in, from the GPS sub-IFD
+const (
+	gpsTagLatitudeRef  = 0x0001
+	gpsTagLatitude     = 0x0002
+	gpsTagLongitudeRef = 0x0003
+	gpsTagLongitude    = 0x0004
+)
+
+// EXIF date format, without any timezone information
+const exifTimeLayout = "2006:01:02 15:04:05"
+
+// How much of the beginning of a file we read when looking for EXIF data. JPEG
+// APP1 segments are limited to 64 KiB and RAW files have their IFDs at the start.
+const exifHeaderSize = 128 << 10
+
+// Maximum size of a HEIF Exif item we're willing to read
+const exifMaxItemSize = 1 << 20
+
+var errNoExif = errors.New("no EXIF data found")
+
+// exifValue is a single raw EXIF field, decoded lazily with the helper methods
+type exifValue struct {
+	dataType  uint16
+	count     uint32
+	data      []byte
+	byteOrder binary.ByteOrder
+}
+
+// exifTags holds the raw fields of IFD0, the EXIF sub-IFD and the GPS sub-IFD
+type exifTags struct {
+	ifd0 map[uint16]exifValue
+	exif map[uint16]exifValue
+	gps  map[uint16]exifValue
+}
+
+// exifTypeSizes maps EXIF data types to their size in bytes
+var exifTypeSizes = map[uint16]uint32{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8,
+}
+
+// asString returns an ASCII field without trailing NULs and whitespace
+func (value exifValue) asString() string {
+	return strings.TrimSpace(strings.TrimRight(string(value.data), "\x00"))
+}
+
+// asInts returns a field of unsigned integers (BYTE, SHORT or LONG) as ints
+func (value exifValue) asInts() (ints []int) {
+	for i := uint32(0); i < value.count; i++ {
+		switch value.dataType {
+		case 1, 7:
+			ints = append(ints, int(value.data[i]))
+		case 3:
+			ints = append(ints, int(value.byteOrder.Uint16(value.data[i*2:])))
+		case 4, 9:
+			ints = append(ints, int(value.byteOrder.Uint32(value.data[i*4:])))
+		}
+	}
+	return ints
+}
+
+// asRationals returns a RATIONAL or SRATIONAL field as floats
+func (value exifValue) asRationals() (rationals []float64) {
+	if value.dataType != 5 && value.dataType != 10 {
+		return nil
+	}
+	for i := uint32(0); i < value.count; i++ {
+		numerator := value.byteOrder.Uint32(value.data[i*8:])
+		denominator := value.byteOrder.Uint32(value.data[i*8+4:])
+		if denominator == 0 {
+			rationals = append(rationals, 0)
+		} else if value.dataType == 10 {
+			rationals = append(rationals, float64(int32(numerator))/float64(int32(denominator)))
+		} else {
+			rationals = append(rationals, float64(numerator)/float64(denominator))
+		}
+	}
+	return rationals
+}
+
+// readExifTags reads and parses the EXIF data of a JPEG, TIFF based RAW or HEIC file
+func readExifTags(mediaPath string) (tags exifTags, err error) {
+	fileHandle, err := os.Open(mediaPath)
+	if err != nil {
+		return tags, err
+	}
+	defer fileHandle.Close()
+
+	header := make([]byte, exifHeaderSize)
+	headerLength, err := io.ReadFull(fileHandle, header)
+	if err == io.ErrUnexpectedEOF {
+		// File is smaller than the header size, which is fine
+		err = nil
+	}
+	if err != nil {
+		return tags, err
+	}
+	header = header[:headerLength]
+
+	var tiff []byte
+	switch {
+	case bytes.HasPrefix(header, []byte{0xff, 0xd8}):
+		tiff, err = findJPEGExif(header)
+	case bytes.HasPrefix(header, []byte("II*\x00")), bytes.HasPrefix(header, []byte("MM\x00*")):
+		tiff = header
+	case len(header) >= 12 && string(header[4:8]) == "ftyp":
+		tiff, err = findHEIFExif(fileHandle, header)
+	default:
+		err = errNoExif
+	}
+	if err != nil {
+		return tags, err
+	}
+
+	return parseTIFF(tiff)
+}
+
+// findJPEGExif returns the TIFF structure inside the APP1 Exif segment of a JPEG
+func findJPEGExif(jpeg []byte) ([]byte, error) {
+	position := 2
+	for position+4 <= len(jpeg) {
+		if jpeg[position] != 0xff {
+			return nil, errNoExif
+		}
+		marker := jpeg[position+1]
+		// Start of scan, image data follows and there are no more metadata segments
+		if marker == 0xda || marker == 0xd9 {
+			return nil, errNoExif
+		}
+		// The length includes its own two bytes
+		length := int(binary.BigEndian.Uint16(jpeg[position+2:]))
+		if length < 2 {
+			return nil, errNoExif
+		}
+		segmentEnd := position + 2 + length
+		if segmentEnd > len(jpeg) {
+			return nil, errNoExif
+		}
+		segment := jpeg[position+4 : segmentEnd]
+		if marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:], nil
+		}
+		position = segmentEnd
+	}
+	return nil, errNoExif
+}
+
+// findHEIFExif finds the Exif item of a HEIF/HEIC file from the item information
+// and location boxes inside the meta box, then reads the item from the file
+func findHEIFExif(fileHandle io.ReaderAt, header []byte) ([]byte, error) {
+	meta := findBox(header, "meta")
+	if len(meta) < 4 {
+		return nil, errNoExif
+	}
+	// meta is a full box, skip version and flags
+	meta = meta[4:]
+
+	exifItemID, ok := findHEIFExifItemID(meta)
+	if !ok {
+		return nil, errNoExif
+	}
+
+	offset, length, ok := findHEIFItemLocation(findBox(meta, "iloc"), exifItemID)
+	if !ok || length < 8 || length > exifMaxItemSize {
+		return nil, errNoExif
+	}
+
+	item := make([]byte, length)
+	_, err := fileHandle.ReadAt(item, int64(offset))
+	if err != nil {
+		return nil, err
+	}
+
+	// Exif item starts with the offset to the TIFF header, after which there's
+	// usually an "Exif\0\0" marker like in JPEG files
+	tiffOffset := 4 + int(binary.BigEndian.Uint32(item))
+	if tiffOffset >= len(item) {
+		return nil, errNoExif
+	}
+	return item[tiffOffset:], nil
+}
+
+// findBox returns the payload of the first ISO base media file format box of given
+// type in the buffer, or nil if not found
+func findBox(buffer []byte, boxType string) []byte {
+	position := 0
+	for position+8 <= len(buffer) {
+		size := uint64(binary.BigEndian.Uint32(buffer[position:]))
+		headerSize := uint64(8)
+		if size == 1 {
+			if position+16 > len(buffer) {
+				return nil
+			}
+			size = binary.BigEndian.Uint64(buffer[position+8:])
+			headerSize = 16
+		} else if size == 0 {
+			size = uint64(len(buffer) - position)
+		}
+		// Boxes reaching past the buffer are damaged, sizes near the 64-bit limit would
+		// overflow the position
+		if size < headerSize || size > uint64(len(buffer)-position) {
+			return nil
+		}
+
+		if string(buffer[position+4:position+8]) == boxType {
+			return buffer[position+int(headerSize) : position+int(size)]
+		}
+		position = position + int(size)
+	}
+	return nil
+}
+
+// heifItem struct is one entry of the item information box of a HEIF file
+type heifItem struct {
+	id       uint32
+	itemType string
+}
+
+// readHEIFItems goes through the item info entries and returns the items
+func readHEIFItems(iinf []byte) (items []heifItem) {
+	if len(iinf) < 6 {
+		return nil
+	}
+	entries := iinf[6:]
+	if iinf[0] != 0 {
+		if len(iinf) < 8 {
+			return nil
+		}
+		entries = iinf[8:]
+	}
+
+	for len(entries) >= 8 {
+		size := int(binary.BigEndian.Uint32(entries))
+		if size < 8 || size > len(entries) {
+			return items
+		}
+		if string(entries[4:8]) == "infe" && size >= 12 {
+			infe := entries[8:size]
+			version := infe[0]
+			if version == 2 && len(infe) >= 12 {
+				items = append(items, heifItem{id: uint32(binary.BigEndian.Uint16(infe[4:])), itemType: string(infe[8:12])})
+			} else if version == 3 && len(infe) >= 14 {
+				items = append(items, heifItem{id: binary.BigEndian.Uint32(infe[4:]), itemType: string(infe[10:14])})
+			}
+		}
+		entries = entries[size:]
+	}
+	return items
+}
+
+// findHEIFPrimaryItemID returns the ID of the primary image from the primary item box
+func findHEIFPrimaryItemID(pitm []byte) (uint32, bool) {
+	if len(pitm) >= 6 && pitm[0] == 0 {
+		return uint32(binary.BigEndian.Uint16(pitm[4:])), true
+	}
+	if len(pitm) >= 8 && pitm[0] != 0 {
+		return binary.BigEndian.Uint32(pitm[4:]), true
+	}
+	return 0, false
+}
+
+// readHEIFItemReferences returns the references of given type from the item reference
+// box, as the referenced item IDs by the referencing item ID
+func readHEIFItemReferences(iref []byte, referenceType string) map[uint32][]uint32 {
+	references := make(map[uint32][]uint32)
+	if len(iref) < 4 {
+		return references
+	}
+	idSize := 2
+	if iref[0] != 0 {
+		idSize = 4
+	}
+	readID := func(buffer []byte) uint32 {
+		if idSize == 2 {
+			return uint32(binary.BigEndian.Uint16(buffer))
+		}
+		return binary.BigEndian.Uint32(buffer)
+	}
+
+	boxes := iref[4:]
+	for len(boxes) >= 8 {
+		size := int(binary.BigEndian.Uint32(boxes))
+		if size < 8 || size > len(boxes) {
+			return references
+		}
+		payload := boxes[8:size]
+		if string(boxes[4:8]) == referenceType && len(payload) >= idSize+2 {
+			fromID := readID(payload)
+			count := int(binary.BigEndian.Uint16(payload[idSize:]))
+			payload = payload[idSize+2:]
+			for i := 0; i < count && len(payload) >= idSize; i++ {
+				references[fromID] = append(references[fromID], readID(payload))
+				payload = payload[idSize:]
+			}
+		}
+		boxes = boxes[size:]
+	}
+	return references
+}
+
+// findHEIFExifItemID returns the ID of the Exif item of the primary image. Bursts and
+// other multi-image files have an Exif item for each image, linked to it with a content
+// description reference. Falls back to the first Exif item.
+func findHEIFExifItemID(meta []byte) (uint32, bool) {
+	primaryID, hasPrimary := findHEIFPrimaryItemID(findBox(meta, "pitm"))
+	descriptions := readHEIFItemReferences(findBox(meta, "iref"), "cdsc")
+
+	var firstExifID uint32
+	found := false
+	for _, item := range readHEIFItems(findBox(meta, "iinf")) {
+		if item.itemType != "Exif" {
+			continue
+		}
+		if !found {
+			firstExifID, found = item.id, true
+		}
+		for _, describedID := range descriptions[item.id] {
+			if hasPrimary && describedID == primaryID {
+				return item.id, true
+			}
+		}
+	}
+	return firstExifID, found
+}
+
+// findHEIFItemLocation parses the item location box and returns the file offset and
+// length of the first extent of given item
+func findHEIFItemLocation(iloc []byte, wantedID uint32) (offset uint64, length uint64, ok bool) {
+	if len(iloc) < 8 {
+		return 0, 0, false
+	}
+	version := iloc[0]
+	offsetSize := int(iloc[4] >> 4)
+	lengthSize := int(iloc[4] & 0x0f)
+	baseOffsetSize := int(iloc[5] >> 4)
+	indexSize := 0
+	if version == 1 || version == 2 {
+		indexSize = int(iloc[5] & 0x0f)
+	}
+
+	reader := bytes.NewReader(iloc[6:])
+	readUint := func(size int) (uint64, bool) {
+		var value uint64
+		for i := 0; i < size; i++ {
+			b, err := reader.ReadByte()
+			if err != nil {
+				return 0, false
+			}
+			value = value<<8 | uint64(b)
+		}
+		return value, true
+	}
+
+	itemIDSize := 2
+	if version == 2 {
+		itemIDSize = 4
+	}
+	itemCount, valid := readUint(itemIDSize)
+	if !valid {
+		return 0, 0, false
+	}
+
+	for i := uint64(0); i < itemCount; i++ {
+		itemID, valid := readUint(itemIDSize)
+		if !valid {
+			return 0, 0, false
+		}
+		if version == 1 || version == 2 {
+			// Reserved bits and construction method
+			if _, valid = readUint(2); !valid {
+				return 0, 0, false
+			}
+		}
+		// Data reference index
+		if _, valid = readUint(2); !valid {
+			return 0, 0, false
+		}
+		baseOffset, valid := readUint(baseOffsetSize)
+		if !valid {
+			return 0, 0, false
+		}
+		extentCount, valid := readUint(2)
+		if !valid {
+			return 0, 0, false
+		}
+		for j := uint64(0); j < extentCount; j++ {
+			if _, valid = readUint(indexSize); !valid {
+				return 0, 0, false
+			}
+			extentOffset, valid := readUint(offsetSize)
+			if !valid {
+				return 0, 0, false
+			}
+			extentLength, valid := readUint(lengthSize)
+			if !valid {
+				return 0, 0, false
+			}
+			if uint32(itemID) == wantedID && j == 0 {
+				return baseOffset + extentOffset, extentLength, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// parseTIFF parses the TIFF structure of EXIF data into IFD0, EXIF and GPS tags
+func parseTIFF(tiff []byte) (tags exifTags, err error) {
+	if len(tiff) < 8 {
+		return tags, errNoExif
+	}
+
+	var byteOrder binary.ByteOrder
+	switch string(tiff[0:2]) {
+	case "II":
+		byteOrder = binary.LittleEndian
+	case "MM":
+		byteOrder = binary.BigEndian
+	default:
+		return tags, errNoExif
+	}
+
+	tags.ifd0 = parseIFD(tiff, byteOrder.Uint32(tiff[4:]), byteOrder)
+	if pointer, ok := tags.ifd0[exifTagExifIFDPointer]; ok && len(pointer.asInts()) > 0 {
+		tags.exif = parseIFD(tiff, uint32(pointer.asInts()[0]), byteOrder)
+	}
+	if pointer, ok := tags.ifd0[exifTagGPSIFDPointer]; ok && len(pointer.asInts()) > 0 {
+		tags.gps = parseIFD(tiff, uint32(pointer.asInts()[0]), byteOrder)
+	}
+
+	return tags, nil
+}
+
+// parseIFD parses a single image file directory, skipping any malformed entries
+func parseIFD(tiff []byte, offset uint32, byteOrder binary.ByteOrder) map[uint16]exifValue {
+	fields := make(map[uint16]exifValue)
+	if uint64(offset)+2 > uint64(len(tiff)) {
+		return fields
+	}
+
+	entryCount := int(byteOrder.Uint16(tiff[offset:]))
+	for i := 0; i < entryCount; i++ {
+		entryOffset := uint64(offset) + 2 + uint64(i)*12
+		if entryOffset+12 > uint64(len(tiff)) {
+			break
+		}
+		entry := tiff[entryOffset : entryOffset+12]
+
+		tag := byteOrder.Uint16(entry[0:])
+		dataType := byteOrder.Uint16(entry[2:])
+		count := byteOrder.Uint32(entry[4:])
+		typeSize, ok := exifTypeSizes[dataType]
+		if !ok {
+			continue
+		}
+
+		dataSize := uint64(typeSize) * uint64(count)
+		var data []byte
+		if dataSize <= 4 {
+			data = entry[8 : 8+dataSize]
+		} else {
+			dataOffset := uint64(byteOrder.Uint32(entry[8:]))
+			if dataOffset+dataSize > uint64(len(tiff)) {
+				continue
+			}
+			data = tiff[dataOffset : dataOffset+dataSize]
+		}
+
+		fields[tag] = exifValue{
+			dataType:  dataType,
+			count:     count,
+			data:      data,
+			byteOrder: byteOrder,
+		}
+	}
+
+	return fields
+}
+
+// camera returns the camera make and model, without repeating the make if the
+// model already starts with it as many manufacturers do
+func (tags exifTags) camera() string {
+	manufacturer := tags.ifd0[exifTagMake].asString()
+	model := tags.ifd0[exifTagModel].asString()
+	if manufacturer == "" || strings.HasPrefix(strings.ToLower(model), strings.ToLower(manufacturer)) {
+		return model
+	}
+	if model == "" {
+		return manufacturer
+	}
+	return manufacturer + " " + model
+}
+
+// exposure returns the exposure time, aperture, ISO speed and focal length, each zero if
+// the camera didn't record it
+func (tags exifTags) exposure() (settings exposureSettings) {
+	if exposureTimes := tags.exif[exifTagExposureTime].asRationals(); len(exposureTimes) > 0 {
+		settings.exposureTime = exposureTimes[0]
+	}
+	if fNumbers := tags.exif[exifTagFNumber].asRationals(); len(fNumbers) > 0 {
+		settings.fNumber = fNumbers[0]
+	}
+	if isoSpeeds := tags.exif[exifTagISOSpeed].asInts(); len(isoSpeeds) > 0 {
+		settings.iso = isoSpeeds[0]
+	}
+	if focalLengths := tags.exif[exifTagFocalLength].asRationals(); len(focalLengths) > 0 {
+		settings.focalLength = focalLengths[0]
+	}
+	return settings
+}
+
+// dimensions returns the image width and height as displayed, i.e. swapped if the
+// image is rotated by 90 degrees according to its orientation
+func (tags exifTags) dimensions() (width int, height int, ok bool) {
+	widths := tags.exif[exifTagPixelXDimension].asInts()
+	heights := tags.exif[exifTagPixelYDimension].asInts()
+	if len(widths) == 0 || len(heights) == 0 || widths[0] == 0 || heights[0] == 0 {
+		return 0, 0, false
+	}
+
+	width, height = widths[0], heights[0]
+	if orientation := tags.ifd0[exifTagOrientation].asInts(); len(orientation) > 0 && orientation[0] >= 5 && orientation[0] <= 8 {
+		width, height = height, width
+	}
+	return width, height, true
+}
+
+// takenTime returns the capture time from EXIF data. If the camera recorded its
+// UTC offset we use that, otherwise the time is interpreted in given location.
+func (tags exifTags) takenTime(location *time.Location) (time.Time, bool) {
+	dateTime, ok := tags.exif[exifTagDateTimeOriginal]
+	if !ok {
+		dateTime, ok = tags.ifd0[exifTagDateTime]
+	}
+	if !ok {
+		return time.Time{}, false
+	}
+
+	if offset, ok := tags.exif[exifTagOffsetTimeOriginal]; ok {
+		takenTime, err := time.Parse(exifTimeLayout+"-07:00", dateTime.asString()+offset.asString())
+		if err == nil {
+			return takenTime, true
+		}
+	}
+
+	takenTime, err := time.ParseInLocation(exifTimeLayout, dateTime.asString(), location)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return takenTime, true
+}
+
+// location returns the GPS coordinates in decimal degrees, negative for south and west
+func (tags exifTags) location() (latitude float64, longitude float64, ok bool) {
+	latitudes := tags.gps[gpsTagLatitude].asRationals()
+	longitudes := tags.gps[gpsTagLongitude].asRationals()
+	if len(latitudes) != 3 || len(longitudes) != 3 {
+		return 0, 0, false
+	}
+
+	latitude = latitudes[0] + latitudes[1]/60 + latitudes[2]/3600
+	longitude = longitudes[0] + longitudes[1]/60 + longitudes[2]/3600
+	if tags.gps[gpsTagLatitudeRef].asString() == "S" {
+		latitude = -latitude
+	}
+	if tags.gps[gpsTagLongitudeRef].asString() == "W" {
+		longitude = -longitude
+	}
+	if latitude < -90 || latitude > 90 || longitude < -180 || longitude > 180 {
+		return 0, 0, false
+	}
+	return latitude, longitude, true
+}
@@ -0,0 +1,283 @@
+package gallery
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// buildTestTIFF creates a little-endian TIFF structure with an EXIF sub-IFD holding
+// DateTimeOriginal and, if given, OffsetTimeOriginal
+func buildTestTIFF(dateTime string, offset string) []byte {
+	type entry struct {
+		tag   uint16
+		value string
+	}
+	entries := []entry{{exifTagDateTimeOriginal, dateTime + "\x00"}}
+	if offset != "" {
+		entries = append(entries, entry{exifTagOffsetTimeOriginal, offset + "\x00"})
+	}
+
+	buffer := new(bytes.Buffer)
+	buffer.WriteString("II*\x00")
+	binary.Write(buffer, binary.LittleEndian, uint32(8))
+
+	// IFD0 with just the pointer to the EXIF sub-IFD, which follows right after
+	exifIFDOffset := uint32(8 + 2 + 12 + 4)
+	binary.Write(buffer, binary.LittleEndian, uint16(1))
+	binary.Write(buffer, binary.LittleEndian, []uint16{exifTagExifIFDPointer, 4})
+	binary.Write(buffer, binary.LittleEndian, []uint32{1, exifIFDOffset, 0})
+
+	// EXIF sub-IFD with ASCII values stored after the directory
+	dataOffset := exifIFDOffset + 2 + uint32(len(entries))*12 + 4
+	binary.Write(buffer, binary.LittleEndian, uint16(len(entries)))
+	var data []byte
+	for _, e := range entries {
+		binary.Write(buffer, binary.LittleEndian, []uint16{e.tag, 2})
+		binary.Write(buffer, binary.LittleEndian, []uint32{uint32(len(e.value)), dataOffset + uint32(len(data))})
+		data = append(data, e.value...)
+	}
+	binary.Write(buffer, binary.LittleEndian, uint32(0))
+	buffer.Write(data)
+
+	return buffer.Bytes()
+}
+
+// buildTestJPEG wraps a TIFF structure into an APP1 segment of an otherwise empty JPEG
+func buildTestJPEG(tiff []byte) []byte {
+	buffer := new(bytes.Buffer)
+	buffer.Write([]byte{0xff, 0xd8, 0xff, 0xe0, 0x00, 0x04, 0x00, 0x00, 0xff, 0xe1})
+	binary.Write(buffer, binary.BigEndian, uint16(2+6+len(tiff)))
+	buffer.WriteString("Exif\x00\x00")
+	buffer.Write(tiff)
+	buffer.Write([]byte{0xff, 0xda, 0x00, 0x02, 0xff, 0xd9})
+	return buffer.Bytes()
+}
+
+func TestReadExifTags(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	helsinki, err := time.LoadLocation("Europe/Helsinki")
+	assert.NoError(t, err)
+
+	jpegPath := filepath.Join(tempDir, "photo.jpg")
+	err = os.WriteFile(jpegPath, buildTestJPEG(buildTestTIFF("2021:06:12 18:30:00", "")), 0644)
+	assert.NoError(t, err)
+
+	tags, err := readExifTags(jpegPath)
+	assert.NoError(t, err)
+	takenTime, ok := tags.takenTime(helsinki)
+	assert.True(t, ok)
+	assert.EqualValues(t, time.Date(2021, 6, 12, 18, 30, 0, 0, helsinki).Unix(), takenTime.Unix())
+
+	rawPath := filepath.Join(tempDir, "photo.arw")
+	err = os.WriteFile(rawPath, buildTestTIFF("2021:06:12 18:30:00", "+09:00"), 0644)
+	assert.NoError(t, err)
+
+	tags, err = readExifTags(rawPath)
+	assert.NoError(t, err)
+	takenTime, ok = tags.takenTime(helsinki)
+	assert.True(t, ok)
+	assert.EqualValues(t, time.Date(2021, 6, 12, 9, 30, 0, 0, time.UTC).Unix(), takenTime.Unix())
+
+	textPath := filepath.Join(tempDir, "notes.jpg")
+	err = os.WriteFile(textPath, []byte("not really a photo"), 0644)
+	assert.NoError(t, err)
+
+	_, err = readExifTags(textPath)
+	assert.Error(t, err)
+}
+
+func TestFindJPEGExif(t *testing.T) {
+	tiff, err := findJPEGExif(buildTestJPEG(buildTestTIFF("2021:06:12 18:30:00", "")))
+	assert.NoError(t, err)
+	assert.EqualValues(t, buildTestTIFF("2021:06:12 18:30:00", ""), tiff)
+
+	// Damaged segment lengths, shorter than the length itself or past the end of the file
+	for _, jpeg := range [][]byte{
+		{0xff, 0xd8, 0xff, 0xe1, 0x00, 0x00, 0x45, 0x78, 0x69, 0x66},
+		{0xff, 0xd8, 0xff, 0xe1, 0x00, 0x01, 0x45, 0x78, 0x69, 0x66},
+		{0xff, 0xd8, 0xff, 0xe1, 0xff, 0xff, 0x45, 0x78, 0x69, 0x66},
+	} {
+		_, err = findJPEGExif(jpeg)
+		assert.Equal(t, errNoExif, err)
+	}
+}
+
+func TestReadExifTagsSampleFiles(t *testing.T) {
+	tags, err := readExifTags("../../testing/source/street.jpg")
+	assert.NoError(t, err)
+	takenTime, ok := tags.takenTime(time.UTC)
+	assert.True(t, ok)
+	assert.EqualValues(t, "2021-01-03 17:32:34", takenTime.Format("2006-01-02 15:04:05"))
+	width, height, ok := tags.dimensions()
+	assert.True(t, ok)
+	assert.EqualValues(t, "3149x3108", fmt.Sprintf("%dx%d", width, height))
+
+	tags, err = readExifTags("../../testing/source/subdir/gate.heic")
+	assert.NoError(t, err)
+	takenTime, ok = tags.takenTime(time.UTC)
+	assert.True(t, ok)
+	assert.EqualValues(t, "2021-01-13 18:19:21 +0200", takenTime.Format("2006-01-02 15:04:05 -0700"))
+	width, height, ok = tags.dimensions()
+	assert.True(t, ok)
+	assert.EqualValues(t, "4032x3024", fmt.Sprintf("%dx%d", width, height))
+
+	_, err = readExifTags("../../testing/source/video.mp4")
+	assert.Error(t, err)
+}
+
+func TestExifCamera(t *testing.T) {
+	ascii := func(value string) exifValue {
+		return exifValue{dataType: 2, count: uint32(len(value) + 1), data: []byte(value + "\x00")}
+	}
+
+	tags := exifTags{ifd0: map[uint16]exifValue{exifTagMake: ascii("Apple"), exifTagModel: ascii("iPhone 12")}}
+	assert.EqualValues(t, "Apple iPhone 12", tags.camera())
+
+	tags = exifTags{ifd0: map[uint16]exifValue{exifTagMake: ascii("Canon"), exifTagModel: ascii("Canon EOS 5D")}}
+	assert.EqualValues(t, "Canon EOS 5D", tags.camera())
+
+	tags = exifTags{ifd0: map[uint16]exifValue{exifTagMake: ascii("SONY")}}
+	assert.EqualValues(t, "SONY", tags.camera())
+
+	assert.EqualValues(t, "", exifTags{}.camera())
+}
+
+// buildTestBox creates an ISO base media file format box
+func buildTestBox(boxType string, payload ...[]byte) []byte {
+	box := bytes.Join(payload, nil)
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header, uint32(8+len(box)))
+	copy(header[4:], boxType)
+	return append(header, box...)
+}
+
+func TestFindBox(t *testing.T) {
+	buffer := append(buildTestBox("ftyp", []byte("heic")), buildTestBox("meta", []byte{1, 2, 3})...)
+	assert.EqualValues(t, []byte{1, 2, 3}, findBox(buffer, "meta"))
+	assert.Nil(t, findBox(buffer, "moov"))
+
+	// A 64-bit size reaching past the buffer, or overflowing the position, is damaged
+	for _, size := range []uint64{32, 1<<64 - 8} {
+		extended := make([]byte, 24)
+		binary.BigEndian.PutUint32(extended, 1)
+		copy(extended[4:], "meta")
+		binary.BigEndian.PutUint64(extended[8:], size)
+		assert.Nil(t, findBox(extended, "meta"))
+		assert.Nil(t, findBox(extended, "moov"))
+	}
+}
+
+// buildTestHEIFMeta creates the contents of a HEIF meta box for a burst of two images,
+// the second one primary with a thumbnail and a depth map, plus a grid image of two
+// tiles. Both images of the burst have an Exif item of their own.
+func buildTestHEIFMeta() []byte {
+	fullBoxHeader := []byte{0, 0, 0, 0}
+	id := func(itemID uint16) []byte {
+		return []byte{byte(itemID >> 8), byte(itemID)}
+	}
+	infe := func(itemID uint16, itemType string) []byte {
+		return buildTestBox("infe", []byte{2, 0, 0, 0}, id(itemID), id(0), []byte(itemType), []byte{0})
+	}
+	reference := func(referenceType string, fromID uint16, toIDs ...uint16) []byte {
+		payload := [][]byte{id(fromID), id(uint16(len(toIDs)))}
+		for _, toID := range toIDs {
+			payload = append(payload, id(toID))
+		}
+		return buildTestBox(referenceType, payload...)
+	}
+
+	return bytes.Join([][]byte{
+		buildTestBox("pitm", fullBoxHeader, id(2)),
+		buildTestBox("iinf", fullBoxHeader, id(9),
+			infe(1, "hvc1"), infe(2, "hvc1"), infe(3, "hvc1"), infe(4, "hvc1"),
+			infe(5, "Exif"), infe(6, "Exif"), infe(7, "grid"), infe(8, "hvc1"), infe(9, "hvc1")),
+		buildTestBox("iref", fullBoxHeader,
+			reference("thmb", 3, 2), reference("auxl", 4, 2),
+			reference("cdsc", 5, 1), reference("cdsc", 6, 2),
+			reference("dimg", 7, 8, 9)),
+	}, nil)
+}
+
+func TestFindHEIFExifItemID(t *testing.T) {
+	meta := buildTestHEIFMeta()
+
+	primaryID, ok := findHEIFPrimaryItemID(findBox(meta, "pitm"))
+	assert.True(t, ok)
+	assert.EqualValues(t, 2, primaryID)
+	assert.Len(t, readHEIFItems(findBox(meta, "iinf")), 9)
+	assert.EqualValues(t, map[uint32][]uint32{7: {8, 9}}, readHEIFItemReferences(findBox(meta, "iref"), "dimg"))
+
+	// The Exif item of the primary image, not the first one
+	exifID, ok := findHEIFExifItemID(meta)
+	assert.True(t, ok)
+	assert.EqualValues(t, 6, exifID)
+
+	_, ok = findHEIFExifItemID(nil)
+	assert.False(t, ok)
+
+	// Without references, the first one
+	exifID, ok = findHEIFExifItemID(buildTestBox("iinf", []byte{0, 0, 0, 0, 0, 2}, findBox(meta, "iinf")[6:]))
+	assert.True(t, ok)
+	assert.EqualValues(t, 5, exifID)
+}
+
+func TestExifLocation(t *testing.T) {
+	rationals := func(values ...uint32) exifValue {
+		data := new(bytes.Buffer)
+		for _, value := range values {
+			binary.Write(data, binary.LittleEndian, []uint32{value, 100})
+		}
+		return exifValue{dataType: 5, count: uint32(len(values)), data: data.Bytes(), byteOrder: binary.LittleEndian}
+	}
+	ascii := func(value string) exifValue {
+		return exifValue{dataType: 2, count: uint32(len(value) + 1), data: []byte(value + "\x00"), byteOrder: binary.LittleEndian}
+	}
+
+	tags := exifTags{gps: map[uint16]exifValue{
+		gpsTagLatitudeRef:  ascii("N"),
+		gpsTagLatitude:     rationals(6000, 3000, 0),
+		gpsTagLongitudeRef: ascii("W"),
+		gpsTagLongitude:    rationals(12200, 1500, 3600),
+	}}
+	latitude, longitude, ok := tags.location()
+	assert.True(t, ok)
+	assert.InDelta(t, 60.5, latitude, 0.0001)
+	assert.InDelta(t, -122.26, longitude, 0.0001)
+
+	_, _, ok = exifTags{}.location()
+	assert.False(t, ok)
+}
+
+func TestExifExposure(t *testing.T) {
+	rational := func(numerator uint32, denominator uint32) exifValue {
+		data := new(bytes.Buffer)
+		binary.Write(data, binary.LittleEndian, []uint32{numerator, denominator})
+		return exifValue{dataType: 5, count: 1, data: data.Bytes(), byteOrder: binary.LittleEndian}
+	}
+	short := func(value uint16) exifValue {
+		data := new(bytes.Buffer)
+		binary.Write(data, binary.LittleEndian, value)
+		return exifValue{dataType: 3, count: 1, data: data.Bytes(), byteOrder: binary.LittleEndian}
+	}
+
+	tags := exifTags{exif: map[uint16]exifValue{
+		exifTagExposureTime: rational(1, 250),
+		exifTagFNumber:      rational(28, 10),
+		exifTagISOSpeed:     short(100),
+		exifTagFocalLength:  rational(35, 1),
+	}}
+	assert.Equal(t, exposureSettings{exposureTime: 0.004, fNumber: 2.8, iso: 100, focalLength: 35}, tags.exposure())
+	assert.Equal(t, exposureSettings{}, exifTags{}.exposure())
+}
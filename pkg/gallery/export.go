@@ -0,0 +1,229 @@
+package gallery
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Archive formats of the export command
+const (
+	exportFormatTarGz = "tar.gz"
+	exportFormatZip   = "zip"
+)
+
+// archiveEntry is a file or directory to add to an exported archive. name is its path
+// in the archive, with forward slashes.
+type archiveEntry struct {
+	name string
+	path string
+	info fs.FileInfo
+}
+
+// listArchiveEntries returns the files and directories of the gallery in lexical order,
+// so archives of the same gallery come out the same. Symlinked originals are followed,
+// for the archive to stand on its own, and left out altogether if asked to. The entries
+// are named under the gallery directory's name. skipPaths are left out, so an archive
+// written into the gallery doesn't include itself.
+func listArchiveEntries(galleryDirectory string, excludeOriginals bool, skipPaths []string, config configuration) (entries []archiveEntry, err error) {
+	root := filepath.Base(galleryDirectory)
+	err = filepath.WalkDir(galleryDirectory, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		for _, skipPath := range skipPaths {
+			if path == skipPath {
+				return nil
+			}
+		}
+		if entry.IsDir() && excludeOriginals && entry.Name() == config.files.originalDir {
+			return filepath.SkipDir
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			log.Println("couldn't add file to archive:", path, err.Error())
+			return nil
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+
+		relPath, _ := filepath.Rel(galleryDirectory, path)
+		entries = append(entries, archiveEntry{name: filepath.ToSlash(filepath.Join(root, relPath)), path: path, info: info})
+		return nil
+	})
+	return entries, err
+}
+
+// writeTarGz writes the entries as a gzipped tarball. Owners and access times are left
+// out, the tarball only depends on the names, permissions, modification times and
+// contents of the files.
+func writeTarGz(writer io.Writer, entries []archiveEntry) error {
+	gzipWriter := gzip.NewWriter(writer)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	for _, entry := range entries {
+		header := &tar.Header{
+			Name:     entry.name,
+			Mode:     int64(entry.info.Mode().Perm()),
+			ModTime:  entry.info.ModTime().Truncate(time.Second),
+			Typeflag: tar.TypeReg,
+			Size:     entry.info.Size(),
+		}
+		if entry.info.IsDir() {
+			header.Name += "/"
+			header.Typeflag = tar.TypeDir
+			header.Size = 0
+		}
+		err := tarWriter.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+		if !entry.info.IsDir() {
+			err = copyArchiveFile(tarWriter, entry.path)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err := tarWriter.Close()
+	if err != nil {
+		return err
+	}
+	return gzipWriter.Close()
+}
+
+// writeZip writes the entries as a zip file
+func writeZip(writer io.Writer, entries []archiveEntry) error {
+	zipWriter := zip.NewWriter(writer)
+
+	for _, entry := range entries {
+		header := &zip.FileHeader{
+			Name:     entry.name,
+			Method:   zip.Deflate,
+			Modified: entry.info.ModTime().Truncate(time.Second),
+		}
+		header.SetMode(entry.info.Mode())
+		if entry.info.IsDir() {
+			header.Name += "/"
+			header.Method = zip.Store
+		}
+		fileWriter, err := zipWriter.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		if !entry.info.IsDir() {
+			err = copyArchiveFile(fileWriter, entry.path)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return zipWriter.Close()
+}
+
+// copyArchiveFile copies the contents of a file into an archive
+func copyArchiveFile(writer io.Writer, path string) error {
+	fileHandle, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fileHandle.Close()
+
+	_, err = io.Copy(writer, fileHandle)
+	return err
+}
+
+// exportGallery writes an archive of the whole gallery in given format
+func exportGallery(galleryDirectory string, writer io.Writer, format string, excludeOriginals bool, skipPaths []string, config configuration) error {
+	entries, err := listArchiveEntries(galleryDirectory, excludeOriginals, skipPaths, config)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case exportFormatTarGz:
+		return writeTarGz(writer, entries)
+	case exportFormatZip:
+		return writeZip(writer, entries)
+	default:
+		return fmt.Errorf("unknown archive format %s", format)
+	}
+}
+
+// ExportOptions struct holds the options of the export command, documented by their
+// go-arg tags; an empty format is tar.gz. Messages gets the messages of the run, which
+// are left out if it's nil.
+type ExportOptions struct {
+	Gallery     string    `arg:"positional,required" help:"Gallery directory to export"`
+	Output      string    `arg:"-o,--output" help:"archive to write (default: gallery directory name with the format's extension)"`
+	Format      string    `arg:"--format" default:"tar.gz" help:"archive format: tar.gz or zip"`
+	NoOriginals bool      `arg:"--no-originals" help:"leave the original files out of the archive"`
+	Config      string    `arg:"--config" help:"configuration file the gallery was built with (default: ~/.config/fastgallery/config.yaml, if it exists)"`
+	Messages    io.Writer `arg:"-"`
+}
+
+// Export archives a finished gallery into a single tar.gz or zip file
+func Export(args ExportOptions) error {
+	format := strings.ToLower(args.Format)
+	if format == "" {
+		format = exportFormatTarGz
+	}
+	if format != exportFormatTarGz && format != exportFormatZip {
+		return errors.New("--format must be tar.gz or zip")
+	}
+
+	config, err := loadConfiguration(args.Config)
+	if err != nil {
+		return err
+	}
+	galleryDirectory, _ := filepath.Abs(args.Gallery)
+	if !isDirectory(galleryDirectory) {
+		return errors.New("gallery directory doesn't exist: " + args.Gallery)
+	}
+	applyGalleryOutputProfile(galleryDirectory, &config)
+
+	if args.Output == "" {
+		args.Output = filepath.Base(galleryDirectory) + "." + format
+	}
+	outputPath, _ := filepath.Abs(args.Output)
+
+	// The archive is written under a temporary name, so an interrupted export doesn't
+	// leave behind what looks like a finished archive
+	outputFile, err := os.CreateTemp(filepath.Dir(outputPath), "."+filepath.Base(outputPath)+"-")
+	if err != nil {
+		return fmt.Errorf("couldn't create archive %s: %w", outputPath, err)
+	}
+	defer os.Remove(outputFile.Name())
+
+	err = exportGallery(galleryDirectory, outputFile, format, args.NoOriginals, []string{outputFile.Name(), outputPath}, config)
+	if err == nil {
+		err = outputFile.Close()
+	} else {
+		outputFile.Close()
+	}
+	if err == nil {
+		err = os.Chmod(outputFile.Name(), config.files.fileMode)
+	}
+	if err == nil {
+		err = os.Rename(outputFile.Name(), outputPath)
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't export gallery %s: %w", galleryDirectory, err)
+	}
+
+	fmt.Fprintln(getOutput(args.Messages), "Exported gallery to", outputPath)
+	return nil
+}
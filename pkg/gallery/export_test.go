@@ -0,0 +1,118 @@
+package gallery
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// createTestExportGallery creates a small gallery with an album and a symlinked original
+func createTestExportGallery(t *testing.T, tempDir string, config configuration) string {
+	galleryDirectory := filepath.Join(tempDir, "event")
+	for _, directory := range []string{config.files.thumbnailDir, config.files.originalDir, filepath.Join("album", config.files.fullsizeDir)} {
+		err := os.MkdirAll(filepath.Join(galleryDirectory, directory), 0755)
+		assert.NoError(t, err)
+	}
+	for _, name := range []string{"index.html", filepath.Join(config.files.thumbnailDir, "a.jpg"), filepath.Join("album", config.files.fullsizeDir, "b.jpg"), "source.jpg"} {
+		path := filepath.Join(galleryDirectory, name)
+		if name == "source.jpg" {
+			path = filepath.Join(tempDir, name)
+		}
+		err := os.WriteFile(path, []byte(name), 0644)
+		assert.NoError(t, err)
+	}
+	err := os.Symlink(filepath.Join(tempDir, "source.jpg"), filepath.Join(galleryDirectory, config.files.originalDir, "a.jpg"))
+	assert.NoError(t, err)
+	return galleryDirectory
+}
+
+func TestExportGalleryTarGz(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	galleryDirectory := createTestExportGallery(t, tempDir, config)
+
+	var archive bytes.Buffer
+	err = exportGallery(galleryDirectory, &archive, exportFormatTarGz, false, nil, config)
+	assert.NoError(t, err)
+	archived := append([]byte(nil), archive.Bytes()...)
+
+	gzipReader, err := gzip.NewReader(&archive)
+	assert.NoError(t, err)
+	tarReader := tar.NewReader(gzipReader)
+	var names []string
+	contents := make(map[string]string)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		names = append(names, header.Name)
+		data, _ := io.ReadAll(tarReader)
+		contents[header.Name] = string(data)
+	}
+	assert.Equal(t, []string{
+		"event/",
+		"event/_original/",
+		"event/_original/a.jpg",
+		"event/_thumbnail/",
+		"event/_thumbnail/a.jpg",
+		"event/album/",
+		"event/album/_fullsize/",
+		"event/album/_fullsize/b.jpg",
+		"event/index.html",
+	}, names)
+
+	// Symlinked originals are archived with their contents
+	assert.Equal(t, "source.jpg", contents["event/_original/a.jpg"])
+
+	// Exports of the same gallery are identical
+	var again bytes.Buffer
+	err = exportGallery(galleryDirectory, &again, exportFormatTarGz, false, nil, config)
+	assert.NoError(t, err)
+	assert.Equal(t, archived, again.Bytes())
+}
+
+func TestExportGalleryZip(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	galleryDirectory := createTestExportGallery(t, tempDir, config)
+
+	var archive bytes.Buffer
+	err = exportGallery(galleryDirectory, &archive, exportFormatZip, true, []string{filepath.Join(galleryDirectory, "index.html")}, config)
+	assert.NoError(t, err)
+
+	zipReader, err := zip.NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	assert.NoError(t, err)
+	var names []string
+	for _, zipFile := range zipReader.File {
+		names = append(names, zipFile.Name)
+	}
+	assert.Equal(t, []string{
+		"event/",
+		"event/_thumbnail/",
+		"event/_thumbnail/a.jpg",
+		"event/album/",
+		"event/album/_fullsize/",
+		"event/album/_fullsize/b.jpg",
+	}, names)
+
+	assert.Error(t, exportGallery(galleryDirectory, &archive, "rar", false, nil, config))
+}
@@ -0,0 +1,48 @@
+package gallery
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// exposureSettings struct holds the exposure of a photo from EXIF: exposure time in
+// seconds, aperture as f-number, ISO speed and focal length in millimetres. Settings the
+// camera didn't record are zero.
+type exposureSettings struct {
+	exposureTime float64
+	fNumber      float64
+	iso          int
+	focalLength  float64
+}
+
+// formatDecimal returns a number rounded to one decimal, without a trailing zero
+func formatDecimal(number float64) string {
+	return strconv.FormatFloat(math.Round(number*10)/10, 'f', -1, 64)
+}
+
+// formatExposure returns the exposure time, aperture and ISO speed for the info panel
+// of a photo, e.g. "1/250 s, f/2.8, ISO 100"
+func formatExposure(settings exposureSettings) string {
+	var parts []string
+	if settings.exposureTime >= 1 {
+		parts = append(parts, formatDecimal(settings.exposureTime)+" s")
+	} else if settings.exposureTime > 0 {
+		parts = append(parts, "1/"+strconv.Itoa(int(math.Round(1/settings.exposureTime)))+" s")
+	}
+	if settings.fNumber > 0 {
+		parts = append(parts, "f/"+formatDecimal(settings.fNumber))
+	}
+	if settings.iso > 0 {
+		parts = append(parts, "ISO "+strconv.Itoa(settings.iso))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatFocalLength returns the focal length for the info panel of a photo, e.g. "35 mm"
+func formatFocalLength(settings exposureSettings) string {
+	if settings.focalLength <= 0 {
+		return ""
+	}
+	return formatDecimal(settings.focalLength) + " mm"
+}
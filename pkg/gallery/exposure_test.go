@@ -0,0 +1,18 @@
+package gallery
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatExposure(t *testing.T) {
+	assert.Equal(t, "1/250 s, f/2.8, ISO 100", formatExposure(exposureSettings{exposureTime: 0.004, fNumber: 2.8, iso: 100}))
+	assert.Equal(t, "1/3 s", formatExposure(exposureSettings{exposureTime: 1.0 / 3}))
+	assert.Equal(t, "2.5 s, f/16", formatExposure(exposureSettings{exposureTime: 2.5, fNumber: 16}))
+	assert.Equal(t, "", formatExposure(exposureSettings{}))
+
+	assert.Equal(t, "35 mm", formatFocalLength(exposureSettings{focalLength: 35}))
+	assert.Equal(t, "4.2 mm", formatFocalLength(exposureSettings{focalLength: 4.24}))
+	assert.Equal(t, "", formatFocalLength(exposureSettings{}))
+}
@@ -0,0 +1,94 @@
+package gallery
+
+import (
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// defaultFlatPattern groups exports named like "Hawaii-0012.jpg" or "Hawaii_12.jpg"
+// into an album called "Hawaii", which is how Lightroom and Capture One name
+// exported files with a custom name and sequence number
+const defaultFlatPattern = `^(.+?)[-_ ]*[0-9]+$`
+
+// flatAlbumName decides which album a file in a flat export directory belongs to.
+// The album (collection) name in the XMP sidecar wins, otherwise the first
+// capture group of the pattern is matched against the filename without extension.
+// Returns an empty string if the file doesn't belong to any album.
+func flatAlbumName(sourceFile file, pattern *regexp.Regexp) string {
+	if sourceFile.sidecar.album != "" {
+		return sanitizeAlbumName(sourceFile.sidecar.album)
+	}
+
+	matches := pattern.FindStringSubmatch(stripExtension(sourceFile.name))
+	if len(matches) < 2 {
+		return ""
+	}
+
+	return sanitizeAlbumName(matches[1])
+}
+
+// sanitizeAlbumName makes an album name safe to use as a gallery directory name
+func sanitizeAlbumName(album string) string {
+	album = strings.TrimSpace(album)
+	album = strings.ReplaceAll(album, string(filepath.Separator), "-")
+	album = strings.Trim(album, ".")
+	return album
+}
+
+// groupFlatDirectory turns the media files in the root of a flat export directory into
+// virtual albums, one subdirectory per album. The files themselves stay where they are,
+// only the source tree is restructured, so the gallery gets one directory per album.
+// Files which don't belong to any album stay in the root. Albums with the same name as
+// an existing subdirectory are merged into it.
+func groupFlatDirectory(source *directory, pattern *regexp.Regexp, config configuration) {
+	albums := make(map[string][]file)
+	var rootFiles []file
+
+	for _, sourceFile := range source.files {
+		album := flatAlbumName(sourceFile, pattern)
+		if album == "" || reservedDirectory(album, config) {
+			rootFiles = append(rootFiles, sourceFile)
+			continue
+		}
+
+		sourceFile.relPath = filepath.Join(source.relPath, album, sourceFile.name)
+		albums[album] = append(albums[album], sourceFile)
+	}
+
+	// Go through albums in a stable order so the gallery looks the same on each run
+	var albumNames []string
+	for album := range albums {
+		albumNames = append(albumNames, album)
+	}
+	sort.Strings(albumNames)
+
+	for _, album := range albumNames {
+		addVirtualAlbum(source, album, albums[album], false)
+	}
+	sortDirectoriesByName(source.subdirectories)
+
+	source.files = rootFiles
+}
+
+// addVirtualAlbum adds a subdirectory which doesn't exist on disk, holding given files of
+// the source directory, to the source tree. An album with the same name as an existing
+// subdirectory is merged into it. split marks albums of a split huge directory.
+func addVirtualAlbum(source *directory, album string, files []file, split bool) {
+	for i := range source.subdirectories {
+		if source.subdirectories[i].name == album {
+			source.subdirectories[i].files = append(source.subdirectories[i].files, files...)
+			return
+		}
+	}
+
+	source.subdirectories = append(source.subdirectories, directory{
+		name:    album,
+		relPath: filepath.Join(source.relPath, album),
+		absPath: filepath.Join(source.absPath, album),
+		modTime: source.modTime,
+		files:   files,
+		split:   split,
+	})
+}
@@ -0,0 +1,59 @@
+package gallery
+
+import (
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlatAlbumName(t *testing.T) {
+	pattern := regexp.MustCompile(defaultFlatPattern)
+
+	assert.EqualValues(t, "Hawaii", flatAlbumName(file{name: "Hawaii-0012.jpg"}, pattern))
+	assert.EqualValues(t, "Hawaii", flatAlbumName(file{name: "Hawaii_12.JPG"}, pattern))
+	assert.EqualValues(t, "Summer party", flatAlbumName(file{name: "Summer party 3.jpg"}, pattern))
+	assert.EqualValues(t, "", flatAlbumName(file{name: "IMG.jpg"}, pattern))
+
+	withCollection := file{name: "Hawaii-0012.jpg"}
+	withCollection.sidecar.album = "Big Island/Day 1"
+	assert.EqualValues(t, "Big Island-Day 1", flatAlbumName(withCollection, pattern))
+
+	datePattern := regexp.MustCompile(`^([0-9]{4}-[0-9]{2})-`)
+	assert.EqualValues(t, "2021-03", flatAlbumName(file{name: "2021-03-14-001.jpg"}, datePattern))
+}
+
+func TestGroupFlatDirectory(t *testing.T) {
+	config := initializeConfig()
+	pattern := regexp.MustCompile(defaultFlatPattern)
+
+	source := directory{
+		name:    "export",
+		absPath: "/export",
+		files: []file{
+			{name: "Hawaii-1.jpg", absPath: "/export/Hawaii-1.jpg"},
+			{name: "Hawaii-2.jpg", absPath: "/export/Hawaii-2.jpg"},
+			{name: "Alps-1.jpg", absPath: "/export/Alps-1.jpg"},
+			{name: "cover.jpg", absPath: "/export/cover.jpg"},
+		},
+		subdirectories: []directory{
+			{name: "Alps", relPath: "Alps", absPath: "/export/Alps", files: []file{{name: "old.jpg"}}},
+		},
+	}
+
+	groupFlatDirectory(&source, pattern, config)
+
+	assert.Len(t, source.files, 1)
+	assert.EqualValues(t, "cover.jpg", source.files[0].name)
+	assert.Len(t, source.subdirectories, 2)
+
+	assert.EqualValues(t, "Alps", source.subdirectories[0].name)
+	assert.Len(t, source.subdirectories[0].files, 2)
+
+	assert.EqualValues(t, "Hawaii", source.subdirectories[1].name)
+	assert.EqualValues(t, "Hawaii", source.subdirectories[1].relPath)
+	assert.Len(t, source.subdirectories[1].files, 2)
+	assert.EqualValues(t, filepath.Join("Hawaii", "Hawaii-1.jpg"), source.subdirectories[1].files[0].relPath)
+	assert.EqualValues(t, "/export/Hawaii-1.jpg", source.subdirectories[1].files[0].absPath)
+}
@@ -0,0 +1,287 @@
+package gallery
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Name of the snapshot of a frozen album's source tree, written into its gallery directory
+const frozenSnapshotFile = ".fastgallery-frozen.json"
+
+// frozenFile struct is a source file with its metadata in a frozen album's snapshot
+type frozenFile struct {
+	Name      string          `json:"name"`
+	RelPath   string          `json:"relPath"`
+	AbsPath   string          `json:"absPath"`
+	ModTime   time.Time       `json:"modTime"`
+	Size      int64           `json:"size"`
+	TakenTime time.Time       `json:"takenTime,omitempty"`
+	Camera    string          `json:"camera,omitempty"`
+	Exposure  *frozenExposure `json:"exposure,omitempty"`
+	Width     int             `json:"width,omitempty"`
+	Height    int             `json:"height,omitempty"`
+	Latitude  float64         `json:"latitude,omitempty"`
+	Longitude float64         `json:"longitude,omitempty"`
+	Geotagged bool            `json:"geotagged,omitempty"`
+	Rating    int             `json:"rating,omitempty"`
+	Label     string          `json:"label,omitempty"`
+	Caption   string          `json:"caption,omitempty"`
+	Keywords  []string        `json:"keywords,omitempty"`
+	Album     string          `json:"album,omitempty"`
+	Faces     []frozenFace    `json:"faces,omitempty"`
+}
+
+// frozenExposure struct is the exposure of a photo in a frozen album's snapshot
+type frozenExposure struct {
+	ExposureTime float64 `json:"exposureTime,omitempty"`
+	FNumber      float64 `json:"fNumber,omitempty"`
+	ISO          int     `json:"iso,omitempty"`
+	FocalLength  float64 `json:"focalLength,omitempty"`
+}
+
+// frozenFace struct is a named face of a photo in a frozen album's snapshot
+type frozenFace struct {
+	Name       string  `json:"name"`
+	RegionType string  `json:"regionType,omitempty"`
+	Unit       string  `json:"unit,omitempty"`
+	X          float64 `json:"x"`
+	Y          float64 `json:"y"`
+	Width      float64 `json:"width"`
+	Height     float64 `json:"height"`
+}
+
+// frozenPoint struct is a point of a GPS track in a frozen album's snapshot
+type frozenPoint struct {
+	Latitude     float64 `json:"lat"`
+	Longitude    float64 `json:"lon"`
+	Elevation    float64 `json:"ele,omitempty"`
+	HasElevation bool    `json:"hasEle,omitempty"`
+}
+
+// frozenDirectory struct is the source tree of a frozen album, as it was read when the
+// album was frozen
+type frozenDirectory struct {
+	Name           string            `json:"name"`
+	RelPath        string            `json:"relPath"`
+	AbsPath        string            `json:"absPath"`
+	ModTime        time.Time         `json:"modTime"`
+	Title          string            `json:"title,omitempty"`
+	Album          albumConfig       `json:"album"`
+	Split          bool              `json:"split,omitempty"`
+	Files          []frozenFile      `json:"files"`
+	Subdirectories []frozenDirectory `json:"subdirectories,omitempty"`
+	Attachments    []frozenFile      `json:"attachments,omitempty"`
+	Tracks         [][]frozenPoint   `json:"tracks,omitempty"`
+	Music          *frozenFile       `json:"music,omitempty"`
+}
+
+// freezeFile converts a source file into its snapshot
+func freezeFile(source file) frozenFile {
+	frozen := frozenFile{
+		Name:      source.name,
+		RelPath:   source.relPath,
+		AbsPath:   source.absPath,
+		ModTime:   source.modTime,
+		Size:      source.size,
+		TakenTime: source.takenTime,
+		Camera:    source.camera,
+		Width:     source.width,
+		Height:    source.height,
+		Latitude:  source.latitude,
+		Longitude: source.longitude,
+		Geotagged: source.geotagged,
+		Rating:    source.sidecar.rating,
+		Label:     source.sidecar.label,
+		Caption:   source.sidecar.caption,
+		Keywords:  source.sidecar.keywords,
+		Album:     source.sidecar.album,
+	}
+	if source.exposure != (exposureSettings{}) {
+		frozen.Exposure = &frozenExposure{ExposureTime: source.exposure.exposureTime, FNumber: source.exposure.fNumber, ISO: source.exposure.iso, FocalLength: source.exposure.focalLength}
+	}
+	for _, face := range source.sidecar.faces {
+		frozen.Faces = append(frozen.Faces, frozenFace{Name: face.name, RegionType: face.regionType, Unit: face.unit, X: face.x, Y: face.y, Width: face.width, Height: face.height})
+	}
+	return frozen
+}
+
+// thawFile converts a file of a snapshot back into a source file, which is in the gallery
+func thawFile(frozen frozenFile) file {
+	thawed := file{
+		name:      frozen.Name,
+		relPath:   frozen.RelPath,
+		absPath:   frozen.AbsPath,
+		modTime:   frozen.ModTime,
+		exists:    true,
+		size:      frozen.Size,
+		takenTime: frozen.TakenTime,
+		camera:    frozen.Camera,
+		width:     frozen.Width,
+		height:    frozen.Height,
+		latitude:  frozen.Latitude,
+		longitude: frozen.Longitude,
+		geotagged: frozen.Geotagged,
+		sidecar: sidecarMetadata{
+			rating:   frozen.Rating,
+			label:    frozen.Label,
+			caption:  frozen.Caption,
+			keywords: frozen.Keywords,
+			album:    frozen.Album,
+		},
+	}
+	if frozen.Exposure != nil {
+		thawed.exposure = exposureSettings{exposureTime: frozen.Exposure.ExposureTime, fNumber: frozen.Exposure.FNumber, iso: frozen.Exposure.ISO, focalLength: frozen.Exposure.FocalLength}
+	}
+	for _, face := range frozen.Faces {
+		thawed.sidecar.faces = append(thawed.sidecar.faces, faceRegion{name: face.Name, regionType: face.RegionType, unit: face.Unit, x: face.X, y: face.Y, width: face.Width, height: face.Height})
+	}
+	return thawed
+}
+
+// freezeDirectory converts a source directory and its subdirectories into a snapshot
+func freezeDirectory(source directory) frozenDirectory {
+	frozen := frozenDirectory{
+		Name:    source.name,
+		RelPath: source.relPath,
+		AbsPath: source.absPath,
+		ModTime: source.modTime,
+		Title:   source.title,
+		Album:   source.album,
+		Split:   source.split,
+	}
+	for _, sourceFile := range source.files {
+		frozen.Files = append(frozen.Files, freezeFile(sourceFile))
+	}
+	for _, subdir := range source.subdirectories {
+		frozen.Subdirectories = append(frozen.Subdirectories, freezeDirectory(subdir))
+	}
+	for _, attachment := range source.attachments {
+		frozen.Attachments = append(frozen.Attachments, freezeFile(attachment))
+	}
+	for _, track := range source.tracks {
+		var frozenTrack []frozenPoint
+		for _, point := range track {
+			frozenTrack = append(frozenTrack, frozenPoint{Latitude: point.latitude, Longitude: point.longitude, Elevation: point.elevation, HasElevation: point.hasElevation})
+		}
+		frozen.Tracks = append(frozen.Tracks, frozenTrack)
+	}
+	if source.music.absPath != "" {
+		music := freezeFile(source.music)
+		frozen.Music = &music
+	}
+	return frozen
+}
+
+// thawDirectory converts a snapshot back into a source directory tree, all of which is
+// in the gallery. The directories are marked frozen.
+func thawDirectory(frozen frozenDirectory) directory {
+	thawed := directory{
+		name:    frozen.Name,
+		relPath: frozen.RelPath,
+		absPath: frozen.AbsPath,
+		modTime: frozen.ModTime,
+		exists:  true,
+		title:   frozen.Title,
+		album:   frozen.Album,
+		split:   frozen.Split,
+		frozen:  true,
+	}
+	for _, frozenFile := range frozen.Files {
+		thawed.files = append(thawed.files, thawFile(frozenFile))
+	}
+	for _, subdir := range frozen.Subdirectories {
+		thawed.subdirectories = append(thawed.subdirectories, thawDirectory(subdir))
+	}
+	for _, attachment := range frozen.Attachments {
+		thawed.attachments = append(thawed.attachments, thawFile(attachment))
+	}
+	for _, frozenTrack := range frozen.Tracks {
+		var track []geoPoint
+		for _, point := range frozenTrack {
+			track = append(track, geoPoint{latitude: point.Latitude, longitude: point.Longitude, elevation: point.Elevation, hasElevation: point.HasElevation})
+		}
+		thawed.tracks = append(thawed.tracks, track)
+	}
+	if frozen.Music != nil {
+		thawed.music = thawFile(*frozen.Music)
+	}
+	return thawed
+}
+
+// loadFrozenAlbum reads a frozen album from the snapshot in its gallery directory, instead
+// of scanning the source directory again. Only album.yaml is read from the source, so the
+// album can be thawed by removing frozen from it. Returns false if the album isn't frozen
+// or has no snapshot yet, e.g. because it was just frozen.
+func loadFrozenAlbum(source *directory, galleryDirectory string) bool {
+	album, err := readAlbumConfig(source.absPath)
+	if err != nil || !album.Frozen {
+		return false
+	}
+
+	snapshotPath := filepath.Join(galleryDirectory, frozenSnapshotFile)
+	buffer, err := os.ReadFile(snapshotPath)
+	if os.IsNotExist(err) {
+		return false
+	}
+	var frozen frozenDirectory
+	if err == nil {
+		err = json.Unmarshal(buffer, &frozen)
+	}
+	if err != nil {
+		log.Println("couldn't read frozen album snapshot", snapshotPath, ":", err.Error())
+		return false
+	}
+
+	*source = thawDirectory(frozen)
+	return true
+}
+
+// updateFrozenSnapshot writes the snapshot of a source directory just read into its
+// gallery directory, if the album is frozen. Otherwise any snapshot of an earlier
+// freeze is removed, it'd be out of date if the album is frozen again.
+func updateFrozenSnapshot(source directory, galleryDirectory string, dryRun bool, config configuration) {
+	snapshotPath := filepath.Join(galleryDirectory, frozenSnapshotFile)
+	if dryRun {
+		if source.album.Frozen {
+			log.Println("Would write frozen album snapshot:", snapshotPath)
+		}
+		return
+	}
+
+	if !source.album.Frozen {
+		if exists(snapshotPath) {
+			err := getStorage(config).Remove(snapshotPath)
+			if err != nil {
+				log.Println("couldn't remove frozen album snapshot", snapshotPath, ":", err.Error())
+			}
+		}
+		return
+	}
+
+	snapshotJSON, err := json.Marshal(freezeDirectory(source))
+	if err == nil {
+		err = writeFile(snapshotPath, snapshotJSON, config)
+	}
+	if err != nil {
+		log.Println("couldn't write frozen album snapshot", snapshotPath, ":", err.Error())
+		return
+	}
+	logProgress(config, "Froze album:", source.absPath)
+}
+
+// keepFrozenPageHashes records the page hashes of a frozen album and its subalbums as
+// they were on the previous run, as their pages aren't rendered again. Returns the
+// album's own page hash, or an empty string if it's not known.
+func keepFrozenPageHashes(relPath string, previousPages map[string]string, pages map[string]string) string {
+	albumPath := filepath.ToSlash(relPath)
+	for pagePath, pageHash := range previousPages {
+		if pagePath == albumPath || strings.HasPrefix(pagePath, albumPath+"/") {
+			pages[pagePath] = pageHash
+		}
+	}
+	return previousPages[albumPath]
+}
@@ -0,0 +1,93 @@
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFrozenSnapshot(t *testing.T) {
+	taken := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	source := directory{name: "trip", relPath: "trip", absPath: "/source/trip", album: albumConfig{Title: "Trip", Frozen: true},
+		files:          []file{{name: "a.jpg", relPath: filepath.Join("trip", "a.jpg"), size: 10, takenTime: taken, exposure: exposureSettings{exposureTime: 0.004, iso: 100}, sidecar: sidecarMetadata{caption: "Harbour", faces: []faceRegion{{name: "Alice", x: 0.5}}}}},
+		subdirectories: []directory{{name: "day1", relPath: filepath.Join("trip", "day1"), files: []file{{name: "b.mp4"}}}},
+		tracks:         [][]geoPoint{{{latitude: 60, longitude: 24, elevation: 10, hasElevation: true}}},
+		music:          file{name: "song.mp3", absPath: "/source/trip/song.mp3"},
+	}
+
+	thawed := thawDirectory(freezeDirectory(source))
+	assert.True(t, thawed.frozen)
+	assert.True(t, thawed.exists)
+	assert.Equal(t, "Trip", thawed.album.Title)
+	assert.True(t, thawed.files[0].exists)
+	assert.Equal(t, "Harbour", thawed.files[0].sidecar.caption)
+	assert.Equal(t, "Alice", thawed.files[0].sidecar.faces[0].name)
+	assert.True(t, taken.Equal(thawed.files[0].takenTime))
+	assert.Equal(t, exposureSettings{exposureTime: 0.004, iso: 100}, thawed.files[0].exposure)
+	assert.Equal(t, exposureSettings{}, thawed.subdirectories[0].files[0].exposure)
+	assert.True(t, thawed.subdirectories[0].frozen)
+	assert.Equal(t, "b.mp4", thawed.subdirectories[0].files[0].name)
+	assert.Equal(t, source.tracks, thawed.tracks)
+	assert.Equal(t, "song.mp3", thawed.music.name)
+
+	// Page hashes of frozen albums stay as they were
+	pages := make(map[string]string)
+	pageHash := keepFrozenPageHashes("trip", map[string]string{"": "root", "trip": "a", "trip/day1": "b", "trips": "c"}, pages)
+	assert.Equal(t, "a", pageHash)
+	assert.Equal(t, map[string]string{"trip": "a", "trip/day1": "b"}, pages)
+}
+
+func TestProcessGalleryFrozen(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	stub := useStubTransformers(t, &config)
+	config.files.workspaceDir = tempDir
+	sourceDirectory := filepath.Join(tempDir, "source")
+	galleryDirectory := filepath.Join(tempDir, "gallery")
+	for _, path := range []string{filepath.Join(sourceDirectory, "trip"), galleryDirectory} {
+		err = os.MkdirAll(path, 0755)
+		assert.NoError(t, err)
+	}
+	for _, path := range []string{"a.jpg", filepath.Join("trip", "b.jpg")} {
+		err = os.WriteFile(filepath.Join(sourceDirectory, path), []byte{}, 0644)
+		assert.NoError(t, err)
+	}
+	albumConfigPath := filepath.Join(sourceDirectory, "trip", albumConfigFile)
+	err = os.WriteFile(albumConfigPath, []byte("title: Trip\nfrozen: true\n"), 0644)
+	assert.NoError(t, err)
+
+	// The album is frozen once it's in the gallery
+	processGallery(sourceDirectory, galleryDirectory, &pipeline{config: config})
+	snapshotPath := filepath.Join(galleryDirectory, "trip", frozenSnapshotFile)
+	assert.FileExists(t, snapshotPath)
+	assert.EqualValues(t, 2, atomic.LoadInt64(&stub.calls))
+
+	// New files in frozen albums are left out, and their gallery files aren't cleaned up
+	err = os.WriteFile(filepath.Join(sourceDirectory, "trip", "c.jpg"), []byte{}, 0644)
+	assert.NoError(t, err)
+	source, gallery, _ := processGallery(sourceDirectory, galleryDirectory, &pipeline{cleanUp: true, config: config})
+	assert.EqualValues(t, 2, atomic.LoadInt64(&stub.calls))
+	assert.True(t, source.subdirectories[0].frozen)
+	assert.Equal(t, "Trip", source.subdirectories[0].album.Title)
+	assert.Len(t, source.subdirectories[0].files, 1)
+	assert.EqualValues(t, 0, countChanges(source, config))
+	cleanUp(gallery, false, config)
+	assert.FileExists(t, filepath.Join(galleryDirectory, "trip", config.files.thumbnailDir, "b.jpg"))
+
+	// Thawed albums are scanned again
+	err = os.WriteFile(albumConfigPath, []byte("title: Trip\n"), 0644)
+	assert.NoError(t, err)
+	source, _, _ = processGallery(sourceDirectory, galleryDirectory, &pipeline{config: config})
+	assert.EqualValues(t, 3, atomic.LoadInt64(&stub.calls))
+	assert.False(t, source.subdirectories[0].frozen)
+	assert.NoFileExists(t, snapshotPath)
+}
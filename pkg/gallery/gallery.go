@@ -0,0 +1,2723 @@
+// Package gallery builds static photo and video galleries: it transforms the media files
+// of a source directory into thumbnails and full-size versions and writes the album
+// pages. The fastgallery command is a thin wrapper around Build and the Run functions of
+// its subcommands.
+package gallery
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/cheggaaa/pb/v3"
+	"github.com/davidbyttow/govips/v2/vips"
+)
+
+// Embed all static assets
+//go:embed assets
+var assets embed.FS
+
+// configuration state is stored in this struct
+type configuration struct {
+	files struct {
+		originalDir    string
+		fullsizeDir    string
+		thumbnailDir   string
+		directoryMode  os.FileMode
+		fileMode       os.FileMode
+		umask          os.FileMode
+		protectedDir   string
+		uid            int
+		gid            int
+		imageExtension string
+		videoExtension string
+		namePolicy     string
+		outputProfile  string
+		workspaceDir   string
+		attachmentDir  string
+		attachmentExts []string
+		liteDir        string
+		noOriginals    bool
+		originals      string
+		webp           bool
+		adoptDir       string
+	}
+	assets struct {
+		assetsDir          string
+		htmlFile           string
+		backIcon           string
+		folderIcon         string
+		playIcon           string
+		htmlTemplate       string
+		manifestFile       string
+		manifestTemplate   string
+		singleFileTemplate string
+		timelineTemplate   string
+		calendarTemplate   string
+		peopleTemplate     string
+		contactTemplate    string
+		timeline           bool
+		calendar           bool
+		albumTree          bool
+		contactSheet       bool
+		proofing           bool
+		proofingEmail      string
+		sharedURL          string
+		liveReload         bool
+		inlineAssets       bool
+		inlineCSSMaxSize   int
+		liteLink           bool
+		liteVersion        bool
+		iconPhoto          string
+	}
+	media struct {
+		thumbnailWidth    int
+		thumbnailHeight   int
+		densities         []int
+		fullsizeMaxWidth  int
+		fullsizeMaxHeight int
+		videoMaxSize      int
+		videoProfile      string
+		imageEngine       string
+		videoEngine       string
+		jpegQuality       int
+		heifConverter     string
+		ffmpegThreads     int
+		minRating         int
+		excludeKeywords   []string
+		excludePeople     []string
+		videoExtensions   []string
+		sniffContents     bool
+		probeVideos       bool
+		timezone          *time.Location
+		timeOffsets       map[string]time.Duration
+		sortOrder         string
+		splitByMonth      bool
+		splitChunkSize    int
+		splitMinFiles     int
+		faces             bool
+		albumMap          bool
+		trackStats        bool
+		astronomy         bool
+	}
+	concurrency int
+	prefetch    int
+	verbose     bool
+	run         *runState
+}
+
+// initialize the configuration with hardcoded defaults
+func initializeConfig() (config configuration) {
+	config.files.originalDir = "_original"
+	config.files.fullsizeDir = "_fullsize"
+	config.files.thumbnailDir = "_thumbnail"
+	config.files.attachmentDir = "_attachments"
+	config.files.liteDir = "_lite"
+	config.files.directoryMode = 0755
+	config.files.fileMode = 0644
+	config.files.umask = getUmask()
+	config.files.uid = -1
+	config.files.gid = -1
+	config.files.imageExtension = ".jpg"
+	config.files.namePolicy = namePolicyPreserve
+
+	config.assets.assetsDir = "assets"
+	config.assets.htmlFile = defaultHTMLFile
+	config.assets.htmlTemplate = "gallery.gohtml"
+	config.assets.backIcon = "back.png"
+	config.assets.folderIcon = "folder.png"
+	config.assets.playIcon = "playbutton.png"
+	config.assets.manifestFile = "manifest.json"
+	config.assets.manifestTemplate = "manifest.json.tmpl"
+	config.assets.singleFileTemplate = "singlefile.gohtml"
+	config.assets.timelineTemplate = "timeline.gohtml"
+	config.assets.calendarTemplate = "calendar.gohtml"
+	config.assets.peopleTemplate = "people.gohtml"
+	config.assets.contactTemplate = "contactsheet.gohtml"
+	config.assets.inlineCSSMaxSize = 16 << 10
+
+	config.media.thumbnailWidth = 280
+	config.media.thumbnailHeight = 210
+	config.media.fullsizeMaxWidth = 1920
+	config.media.fullsizeMaxHeight = 1080
+	config.media.videoMaxSize = 640
+	config.media.videoProfile = videoProfileCompatibility
+	config.files.videoExtension = getVideoExtension(config.media.videoProfile)
+	config.files.originals = originalsSymlink
+	config.media.imageEngine = imageEngineVips
+	config.media.videoEngine = videoEngineFFmpeg
+	config.media.timezone = time.Local
+	config.media.sortOrder = "name"
+	config.media.splitMinFiles = defaultSplitMinFiles
+	config.media.sniffContents = true
+
+	// TODO adjust based on cores
+	config.concurrency = 4
+	config.run = newRunState()
+
+	return config
+}
+
+// file struct represents an individual media file
+// relPath is the relative path to from source/gallery root directory.
+// sidecar holds rating, caption and keywords from an XMP sidecar, only read for source files.
+// takenTime is the capture time if known from metadata, otherwise zero.
+// camera is the camera make and model from EXIF, if known.
+// exposure has the exposure time, aperture, ISO speed and focal length from EXIF, zero if unknown.
+// size is the file size in bytes, used to schedule and track transformations.
+// width and height are the dimensions of the source image as displayed, zero if unknown.
+// latitude and longitude are the GPS coordinates from EXIF, only set if geotagged.
+// For source files, exists marks whether it exists in the gallery and doesn't need to be copied.
+// In this case, gallery has all three transformed files (original, full-size and thumbnail) and
+// the thumbnail's modification date isn't before the original source file's.
+// For gallery files, exists marks whether all three gallery files are in place (original, full-size
+// and thumbnail) and there's a corresponding source file.
+// For source files in the gallery, outdatedThumbnail and outdatedFullsize mark gallery files to rebuild,
+// as they were built with other settings.
+// For gallery files, caseName is the name to rename the file to, if its name only differs in case
+// from the one of its source file.
+type file struct {
+	name              string
+	relPath           string
+	absPath           string
+	modTime           time.Time
+	exists            bool
+	sidecar           sidecarMetadata
+	takenTime         time.Time
+	camera            string
+	exposure          exposureSettings
+	size              int64
+	width             int
+	height            int
+	latitude          float64
+	longitude         float64
+	geotagged         bool
+	outdatedThumbnail bool
+	outdatedFullsize  bool
+	caseName          string
+}
+
+// directory struct is one directory, which contains files and subdirectories
+// relPath is the relative path from source/gallery root directory
+// For source directories, exists reflects whether the directory exists in the gallery
+// For gallery directories, exists reflects whether there's a corresponding source directory
+// title is an album title from metadata, used instead of the directory name if set
+// album holds the settings from the directory's album.yaml, only read for source directories
+// split marks the virtual albums a huge source directory was split into, their files' metadata is already read
+// attachments are the non-media files copied into the album as downloads, only read for source directories
+// tracks are the GPS tracks of the album's GPX files, only read for source directories with maps enabled
+// music is the audio file played in the album's slideshow, with an empty path if there's none
+// pageHash is the hash of everything the album page is rendered from, set when the page is about to be rendered
+// frozen marks the directories of a frozen album, read from its snapshot instead of the source
+// keptStats are the statistics of an album outside the subtree of a partial run, which isn't read at all
+type directory struct {
+	name           string
+	relPath        string
+	absPath        string
+	modTime        time.Time
+	files          []file
+	subdirectories []directory
+	exists         bool
+	title          string
+	album          albumConfig
+	split          bool
+	attachments    []file
+	tracks         [][]geoPoint
+	music          file
+	pageHash       string
+	frozen         bool
+	keptStats      *albumStats
+}
+
+// htmlData struct is loaded with all the information required to generate the html from template
+// TODO refactor structure inside only function where its used
+type htmlData struct {
+	Title          string
+	Hero           string
+	OGImage        string
+	Intro          string
+	Description    string
+	Stats          htmlAlbumStats
+	Attachments    []htmlAttachment
+	Map            *htmlMap
+	TrackStats     string
+	Astronomy      []string
+	Music          string
+	Timeline       string
+	Calendar       string
+	People         string
+	ContactSheet   string
+	Proofing       bool
+	ProofingEmail  string
+	AlbumTree      string
+	AlbumPath      string
+	IndexLink      string
+	LiteLink       string
+	FullLink       string
+	Subdirectories []htmlSubdirectory
+	Files          []htmlFile
+	CSS            []string
+	InlineCSS      []string
+	JS             []string
+	DeferJS        bool
+	FolderIcon     string
+	BackIcon       string
+	AppleTouchIcon string
+	ManifestFile   string
+	LiveReload     string
+	PageHash       string
+	ImageWidth     string
+	ImageHeight    string
+	VideoType      string
+}
+
+// htmlFile struct is one media file shown in the HTML page.
+// Caption, Keywords, Rating and Label come from the XMP sidecar, if any.
+// Taken is the formatted capture time, empty if unknown.
+// Width and Height are the original's dimensions and Size its formatted file size.
+// FullsizeWidth and FullsizeHeight are the dimensions of the full-size image.
+// Dimensions are zero if unknown. Faces are the named faces, only if they're published.
+// ID identifies the file across runs and Number is its position in the album, for proofing.
+// ThumbnailWebP and FullsizeWebP link to the WebP versions, empty if there are none.
+// Srcset has the thumbnails of higher pixel densities, empty if there are none,
+// and ThumbnailWebP is a srcset of the WebP versions of them too then.
+type htmlFile struct {
+	Filename       string
+	Thumbnail      string
+	Fullsize       string
+	Original       string
+	Caption        string
+	Keywords       string
+	Rating         int
+	Label          string
+	Taken          string
+	Camera         string
+	Exposure       string
+	FocalLength    string
+	Width          int
+	Height         int
+	Size           string
+	FullsizeWidth  int
+	FullsizeHeight int
+	Faces          []htmlFace
+	ID             string
+	Number         int
+	DayHeading     string
+	Orientation    string
+	ThumbnailWebP  string
+	FullsizeWebP   string
+	Srcset         string
+}
+
+// transformationJob struct is used to communicate needed image/video transformations to
+// individual concurrent goroutines. size is the source file size, used for scheduling
+// and the progress bar. An empty thumbnail or full-size path leaves that file as it is,
+// when only the other one is rebuilt. relPath is the source file's path relative to the
+// source root. thumbnailSource is the existing full-size file to build the thumbnail
+// from when only the thumbnail is rebuilt.
+type transformationJob struct {
+	filename          string
+	relPath           string
+	size              int64
+	sourceFilepath    string
+	thumbnailFilepath string
+	fullsizeFilepath  string
+	originalFilepath  string
+	thumbnailSource   string
+}
+
+// logProgress logs a message about one file or directory being done. These only go
+// to the log file, or with --verbose to the terminal where they'd fight with the
+// progress bar otherwise.
+func logProgress(config configuration, v ...interface{}) {
+	if config.verbose {
+		log.Println(v...)
+	}
+}
+
+// exists checks whether given file, directory or symlink exists
+func exists(filepath string) bool {
+	if _, err := os.Stat(filepath); os.IsNotExist(err) {
+		return false
+	}
+	return true
+}
+
+// checkReadable checks whether given file can be opened for reading, e.g. it's not
+// owned by another user without read permission for others
+func checkReadable(filepath string) error {
+	fileHandle, err := os.Open(filepath)
+	if err != nil {
+		return err
+	}
+	return fileHandle.Close()
+}
+
+// Number of directory entries read at a time, so huge flat directories don't have to
+// be held in memory all at once
+const readDirectoryBatchSize = 1024
+
+// readDirectoryBatches reads the entries of given directory in batches, in directory
+// order, and calls handleBatch for each batch until it returns false
+func readDirectoryBatches(directory string, handleBatch func(entries []os.DirEntry) bool) error {
+	directoryHandle, err := os.Open(directory)
+	if err != nil {
+		return err
+	}
+	defer directoryHandle.Close()
+
+	for {
+		entries, err := directoryHandle.ReadDir(readDirectoryBatchSize)
+		if len(entries) > 0 && !handleBatch(entries) {
+			return nil
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// isEmptyDirectory checks whether given directory doesn't exist or has nothing in it
+func isEmptyDirectory(directory string) bool {
+	directoryHandle, err := os.Open(directory)
+	if os.IsNotExist(err) {
+		return true
+	} else if err != nil {
+		return false
+	}
+	defer directoryHandle.Close()
+
+	_, err = directoryHandle.Readdirnames(1)
+	return err == io.EOF
+}
+
+// isDirectory checks whether provided path is a directory or symlink to one
+// resolves symlinks only one level deep
+func isDirectory(directory string) bool {
+	filestat, err := os.Stat(directory)
+	if os.IsNotExist(err) {
+		return false
+	}
+
+	if filestat.IsDir() {
+		return true
+	}
+
+	if filestat.Mode()&os.ModeSymlink != 0 {
+		realDirectory, err := filepath.EvalSymlinks(directory)
+		if err != nil {
+			log.Printf("error: %s\n", err.Error())
+			return false
+		}
+
+		realFilestat, err := os.Stat(realDirectory)
+		if err != nil {
+			log.Printf("error: %s\n", err.Error())
+			return false
+		}
+
+		if realFilestat.IsDir() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Validate that source and gallery directories given as parameters
+// are valid directories. Return absolue path of source and gallery
+func validateSourceAndGallery(source string, gallery string) (string, string, error) {
+	var err error
+
+	source, err = filepath.Abs(source)
+	if err != nil {
+		return "", "", err
+	}
+
+	if !isDirectory(source) {
+		return "", "", errors.New("source directory doesn't exist: " + source)
+	}
+
+	gallery, err = filepath.Abs(gallery)
+	if err != nil {
+		return "", "", err
+	}
+
+	if !isDirectory(gallery) {
+		// Ok, gallery isn't a directory but check whether the parent directory is
+		// and we're supposed to create gallery there during runtime
+		galleryParent, err := filepath.Abs(filepath.Join(gallery, "/../"))
+		if err != nil {
+			return "", "", err
+		}
+
+		if !isDirectory(galleryParent) {
+			return "", "", errors.New("neither gallery directory or it's parent directory exist: " + gallery)
+		}
+	}
+
+	// A gallery inside the source is left out when scanning, but the other way around
+	// cleaning up the gallery would delete the source
+	if isInsideDirectory(resolvePath(source), resolvePath(gallery)) {
+		return "", "", errors.New("source directory can't be the gallery directory or inside it: " + source)
+	}
+
+	return source, gallery, nil
+}
+
+// Checks whether directory has media files, or subdirectories with media files.
+// If there's a subdirectory that's empty or that has directories or files which
+// aren't media files, we leave that out of the directory tree.
+func dirHasMediafiles(directory string, noVideos bool, config configuration) (hasMediaFiles bool) {
+	// If we can't read the directory contents, it doesn't have media files in it.
+	// Reading stops at the first media file found.
+	_ = readDirectoryBatches(directory, func(entries []os.DirEntry) bool {
+		for _, entry := range entries {
+			entryAbsPath := filepath.Join(directory, entry.Name())
+			if entry.IsDir() {
+				// Recursion to subdirectories
+				hasMediaFiles = dirHasMediafiles(entryAbsPath, noVideos, config)
+			} else {
+				hasMediaFiles = isMediaFile(entryAbsPath, noVideos, config)
+			}
+			if hasMediaFiles {
+				return false
+			}
+		}
+		return true
+	})
+	return hasMediaFiles
+}
+
+// Check whether given path is an image file
+func isImageFile(filename string, config configuration) bool {
+	switch filepath.Ext(strings.ToLower(filename)) {
+	case ".jpg", ".jpeg", ".heic", ".png", ".gif", ".tif", ".tiff":
+		return true
+	case ".cr2", ".raw", ".arw":
+		return true
+	default:
+		kind := getSniffedKind(filename, config)
+		return kind == mediaKindImage || kind == mediaKindHEIF
+	}
+}
+
+// Check whether given absolute path is a media file
+func isMediaFile(filename string, noVideos bool, config configuration) bool {
+	if isImageFile(filename, config) {
+		return true
+	}
+
+	if !noVideos && isVideoFile(filename, config) {
+		return true
+	}
+
+	return isSniffedMediaFile(filename, noVideos, config)
+}
+
+// isSymlinkDir checks if given directory entry is symbolic link to a directory
+func isSymlinkDir(targetPath string) (is bool) {
+	entry, err := os.Lstat(targetPath)
+	if err != nil {
+		log.Println("Couldn't lstat dir path:", targetPath, err.Error())
+		return false
+	}
+
+	if entry.Mode()&os.ModeSymlink != 0 {
+		realPath, err := filepath.EvalSymlinks(targetPath)
+		if err != nil {
+			return false
+		}
+
+		realEntry, err := os.Lstat(realPath)
+		if err != nil {
+			log.Println("Couldn't lstat file path:", targetPath)
+			return false
+		}
+
+		if realEntry.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+// Create a recursive directory struct by traversing the directory absoluteDirectory.
+// The function calls itself recursively, carrying state in the relativeDirectory parameter.
+func createDirectoryTree(absoluteDirectory string, parentDirectory string, noVideos bool, config configuration) (tree directory, err error) {
+	tree, err = scanDirectory(absoluteDirectory, parentDirectory, noVideos, config)
+	if err != nil {
+		return tree, err
+	}
+	for i, subdir := range tree.subdirectories {
+		tree.subdirectories[i], err = createDirectoryTree(subdir.absPath, subdir.relPath, noVideos, config)
+		if err != nil {
+			return tree, err
+		}
+	}
+	return tree, nil
+}
+
+// scanDirectory creates a directory struct of the directory absoluteDirectory without
+// recursing. Subdirectories with media files somewhere are included with their name and
+// paths only, their contents aren't read. Directories which can't be read are errors,
+// cleaning up would otherwise delete their albums from the gallery.
+func scanDirectory(absoluteDirectory string, parentDirectory string, noVideos bool, config configuration) (tree directory, err error) {
+	// In case the target directory doesn't exist, it's the gallery directory
+	// which hasn't been created yet. We'll just create a dummy tree and return it.
+	if !exists(absoluteDirectory) && parentDirectory == "" {
+		tree.name = filepath.Base(absoluteDirectory)
+		tree.relPath = parentDirectory
+		tree.absPath, _ = filepath.Abs(absoluteDirectory)
+		return tree, nil
+	}
+
+	// Fill in the directory name and other basic info
+	tree.name = filepath.Base(absoluteDirectory)
+	tree.absPath, _ = filepath.Abs(absoluteDirectory)
+	tree.relPath = parentDirectory
+	absoluteDirectoryStat, _ := os.Stat(absoluteDirectory)
+	tree.modTime = absoluteDirectoryStat.ModTime()
+
+	// List directory contents in batches. Only the media files are kept, so a huge
+	// directory with other files in it won't be in memory all at once.
+	err = readDirectoryBatches(absoluteDirectory, func(entries []os.DirEntry) bool {
+		// If it's a directory and it has media files somewhere, add it to directories
+		// If it's a media file, add it to the files
+		for _, entry := range entries {
+			entryAbsPath := filepath.Join(absoluteDirectory, entry.Name())
+			entryRelPath := filepath.Join(parentDirectory, entry.Name())
+			if entry.IsDir() || isSymlinkDir(entryAbsPath) {
+				if dirHasMediafiles(entryAbsPath, noVideos, config) {
+					tree.subdirectories = append(tree.subdirectories, directory{
+						name:    entry.Name(),
+						relPath: entryRelPath,
+						absPath: entryAbsPath,
+					})
+				}
+			} else if isMediaFile(entryAbsPath, noVideos, config) {
+				// Files deleted since listing them are left out
+				entryFileInfo, err := entry.Info()
+				if err != nil {
+					log.Println("Couldn't stat file information for media file:", entry.Name())
+					continue
+				}
+				entryFile := file{
+					name:    entry.Name(),
+					relPath: entryRelPath,
+					absPath: entryAbsPath,
+					modTime: entryFileInfo.ModTime(),
+					size:    entryFileInfo.Size(),
+					exists:  false,
+				}
+				tree.files = append(tree.files, entryFile)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return tree, fmt.Errorf("couldn't read directory contents %s: %w", absoluteDirectory, err)
+	}
+
+	// Keep the entries sorted by filename, as os.ReadDir() would
+	sortFilesByName(tree.files)
+	sortDirectoriesByName(tree.subdirectories)
+	return tree, nil
+}
+
+// sortFilesByName sorts files by filename, so the gallery comes out the same on each run
+func sortFilesByName(files []file) {
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].name < files[j].name
+	})
+}
+
+// sortDirectoriesByName sorts directories by name, so the gallery comes out the same on each run
+func sortDirectoriesByName(directories []directory) {
+	sort.SliceStable(directories, func(i, j int) bool {
+		return directories[i].name < directories[j].name
+	})
+}
+
+// stripExtension strips the filename extension and returns the basename
+func stripExtension(filename string) string {
+	extension := filepath.Ext(filename)
+	return filename[0 : len(filename)-len(extension)]
+}
+
+// reservedDirectory takes a path and checks whether it's a reserved name,
+// i.e. one of the internal directories used by fastgallery
+func reservedDirectory(path string, config configuration) bool {
+	if path == config.files.thumbnailDir {
+		return true
+	}
+
+	if path == config.files.fullsizeDir {
+		return true
+	}
+
+	if path == config.files.originalDir {
+		return true
+	}
+
+	if path == config.files.attachmentDir {
+		return true
+	}
+
+	if path == config.files.liteDir {
+		return true
+	}
+
+	return false
+}
+
+// reservedFile takes a path and checks whether it's a reserved file,
+// such as one of our asset files
+func reservedFile(path string, config configuration) bool {
+	if path == config.assets.backIcon {
+		return true
+	}
+
+	if path == config.assets.folderIcon {
+		return true
+	}
+
+	if path == config.assets.manifestFile {
+		return true
+	}
+
+	if path == ogImageFile {
+		return true
+	}
+
+	if path == musicFile {
+		return true
+	}
+
+	if isIcon(path) {
+		return true
+	}
+
+	return false
+}
+
+// hasDirectoryChanged checks whether the gallery directory has changed and thus
+// its media files need to be updated. Album pages are tracked by their page hashes
+// instead. Could be due to:
+// At least one non-existent source file or directory (will be created in gallery)
+// At least one source file with outdated gallery files (will be rebuilt)
+// We're doing a cleanup, and at least one non-existent gallery file or directory (will be removed from gallery)
+func hasDirectoryChanged(source directory, gallery directory, cleanUp bool, config configuration) bool {
+	for _, sourceFile := range source.files {
+		if !sourceFile.exists || sourceFile.outdatedThumbnail || sourceFile.outdatedFullsize {
+			return true
+		}
+	}
+
+	for _, sourceDir := range source.subdirectories {
+		if !sourceDir.exists {
+			return true
+		}
+	}
+
+	for _, attachment := range source.attachments {
+		if !attachment.exists {
+			return true
+		}
+	}
+
+	if source.music.absPath != "" && !source.music.exists {
+		return true
+	}
+
+	// TODO recurse gallery simultaneously with source, nil if not available
+	if cleanUp {
+		for _, galleryFile := range gallery.files {
+			if !reservedFile(galleryFile.name, config) && !galleryFile.exists {
+				return true
+			}
+		}
+
+		for _, galleryDir := range gallery.subdirectories {
+			if !galleryDir.exists {
+				return true
+			}
+		}
+
+		if len(findStaleAttachments(source, filepath.Join(gallery.absPath, source.relPath), config)) > 0 {
+			return true
+		}
+
+		if source.music.absPath == "" && exists(filepath.Join(gallery.absPath, source.relPath, musicFile)) {
+			return true
+		}
+	}
+
+	htmlPath := filepath.Join(gallery.absPath, source.relPath, config.assets.htmlFile)
+	if _, err := os.Stat(htmlPath); os.IsNotExist(err) {
+		return true
+	}
+
+	return false
+}
+
+// compareDirectoryTrees compares two directory trees (source and gallery) and marks
+// each file that exists in both
+func compareDirectoryTrees(source *directory, gallery *directory, config configuration) {
+	compareDirectory(source, gallery, config)
+
+	// After checking all the files in this directory, recurse into each subdirectory and do the same
+	for k, inputDir := range source.subdirectories {
+		if gallerySubdir := findGallerySubdirectory(inputDir, gallery, config); gallerySubdir != nil {
+			compareDirectoryTrees(&(source.subdirectories[k]), gallerySubdir, config)
+		}
+	}
+}
+
+// findGallerySubdirectory returns the subdirectory of gallery corresponding to the
+// source subdirectory, or nil if there's none
+func findGallerySubdirectory(source directory, gallery *directory, config configuration) *directory {
+	if reservedDirectory(source.name, config) {
+		return nil
+	}
+	return findSubdirectory(*gallery, source.name)
+}
+
+// compareDirectory compares the files of a source directory to the gallery directory
+// and marks each file that exists in both, without recursing
+func compareDirectory(source *directory, gallery *directory, config configuration) {
+	// If we are comparing two directories, we know they both exist so we can set the
+	// directory struct exists boolean
+	source.exists = true
+	gallery.exists = true
+
+	// TODO fix bug where two source files with different extensions clash
+
+	// Iterate over each file in source directory to see whether it exists in gallery.
+	// Names are matched case-insensitively, like case-insensitive file systems would,
+	// except for gallery files with the exact name of another source file.
+	sourceBasenames := make(map[string]bool)
+	for _, sourceFile := range source.files {
+		sourceBasenames[getGalleryBasename(sourceFile.name, config)] = true
+	}
+	for i, sourceFile := range source.files {
+		sourceFileBasename := getGalleryBasename(sourceFile.name, config)
+		var thumbnailFile, fullsizeFile, originalFile *file
+
+		// Go through all subdirectories, and check the ones that match
+		// the thumbnail, full-size or original subdirectories.
+		// Simultaneously, mark any gallery files which exist in source,
+		// so any clean-up doesn't inadvertently delete them.
+		for h, subDir := range gallery.subdirectories {
+			if subDir.name == config.files.thumbnailDir {
+				for i, outputFile := range gallery.subdirectories[h].files {
+					outputFileBasename := stripExtension(outputFile.name)
+					if matchesSourceBasename(outputFileBasename, sourceFileBasename, sourceBasenames) && !isOtherImageFormat(outputFile.name, config) {
+						gallery.subdirectories[h].files[i].exists = true
+						setCaseName(&gallery.subdirectories[h].files[i], getCaseName(outputFile.name, sourceFileBasename))
+						if thumbnailFile == nil || outputFileBasename == sourceFileBasename {
+							thumbnailFile = &gallery.subdirectories[h].files[i]
+						}
+					} else if isDensityThumbnail(outputFileBasename, sourceFileBasename, sourceBasenames, config) && !isOtherImageFormat(outputFile.name, config) {
+						gallery.subdirectories[h].files[i].exists = true
+						setCaseName(&gallery.subdirectories[h].files[i], getCaseName(outputFile.name, sourceFileBasename))
+					}
+				}
+			} else if subDir.name == config.files.fullsizeDir {
+				for j, outputFile := range gallery.subdirectories[h].files {
+					outputFileBasename := stripExtension(outputFile.name)
+					if matchesSourceBasename(outputFileBasename, sourceFileBasename, sourceBasenames) && !isOtherImageFormat(outputFile.name, config) {
+						gallery.subdirectories[h].files[j].exists = true
+						setCaseName(&gallery.subdirectories[h].files[j], getCaseName(outputFile.name, sourceFileBasename))
+						if fullsizeFile == nil || outputFileBasename == sourceFileBasename {
+							fullsizeFile = &gallery.subdirectories[h].files[j]
+						}
+					}
+				}
+			} else if subDir.name == config.files.originalDir {
+				for k, outputFile := range gallery.subdirectories[h].files {
+					outputFileBasename := stripExtension(outputFile.name)
+					if matchesSourceBasename(outputFileBasename, sourceFileBasename, sourceBasenames) {
+						gallery.subdirectories[h].files[k].exists = true
+						setCaseName(&gallery.subdirectories[h].files[k], getOriginalFilename(sourceFile.name, config))
+						if originalFile == nil || outputFileBasename == sourceFileBasename {
+							originalFile = &gallery.subdirectories[h].files[k]
+						}
+					}
+				}
+			}
+		}
+
+		// If all of thumbnail, full-size and original files exist in gallery, and they're
+		// modified after the source file, the source file exists and is up to date.
+		// Otherwise we overwrite gallery files in case source file's been updated since the thumbnail
+		// was created. Galleries without originals don't need them.
+		if thumbnailFile != nil && fullsizeFile != nil && (originalFile != nil || config.files.noOriginals) {
+			if thumbnailFile.modTime.After(sourceFile.modTime) {
+				source.files[i].exists = true
+			}
+		}
+	}
+}
+
+// countChangedBytes returns the total size of the source files which need to be transformed
+func countChangedBytes(source directory, config configuration) (outputBytes int64) {
+	for _, file := range source.files {
+		if (!file.exists || file.outdatedThumbnail || file.outdatedFullsize) && !reservedFile(file.name, config) {
+			outputBytes = outputBytes + file.size
+		}
+	}
+
+	for _, dir := range source.subdirectories {
+		outputBytes = outputBytes + countChangedBytes(dir, config)
+	}
+
+	return outputBytes
+}
+
+func countChanges(source directory, config configuration) (outputChanges int) {
+	outputChanges = 0
+	for _, file := range source.files {
+		if (!file.exists || file.outdatedThumbnail || file.outdatedFullsize) && !reservedFile(file.name, config) {
+			outputChanges++
+		}
+	}
+
+	for _, dir := range source.subdirectories {
+		outputChanges = outputChanges + countChanges(dir, config)
+	}
+
+	return outputChanges
+}
+
+func findMissingHTMLFiles(gallery directory, config configuration) bool {
+	htmlPath := filepath.Join(gallery.absPath, config.assets.htmlFile)
+	if _, err := os.Stat(htmlPath); os.IsNotExist(err) {
+		return true
+	}
+
+	for _, dir := range gallery.subdirectories {
+		if !reservedDirectory(dir.name, config) {
+			if findMissingHTMLFiles(dir, config) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func createDirectory(destination string, dryRun bool, config configuration) error {
+	if _, err := os.Stat(destination); os.IsNotExist(err) {
+		if dryRun {
+			log.Println("Would create directory:", destination)
+		} else {
+			err := getStorage(config).Mkdir(destination, config.files.directoryMode)
+			if err != nil {
+				return fmt.Errorf("couldn't create directory %s: %w", destination, err)
+			}
+			setOwner(destination, config)
+
+			logProgress(config, "Created directory:", destination)
+		}
+	}
+	return nil
+}
+
+func symlinkFile(source string, destination string, config configuration) error {
+	if _, err := os.Stat(destination); err == nil {
+		err := getStorage(config).Remove(destination)
+		if err != nil {
+			log.Println("couldn't remove symlink:", source, destination)
+			return err
+		}
+	}
+	err := getStorage(config).Symlink(source, destination)
+	if err != nil {
+		log.Println("couldn't symlink:", source, destination)
+		return err
+	}
+
+	return nil
+}
+
+// TODO document function
+// TODO icons without transparent backgrounds
+func isIcon(iconPath string) bool {
+	re := regexp.MustCompile(`^icon`)
+	iconPath = filepath.Base(iconPath)
+	return re.MatchString(iconPath)
+}
+
+// getIconSize returns a square size (e.g. 48x48) of an icon based on its filename
+// Icon filename must have a substring starting with a string of numbers followed by a consequential
+// letter x and a string of more numbers
+func getIconSize(iconPath string) (size string, err error) {
+	iconPath = path.Base(iconPath)
+
+	re := regexp.MustCompile(`[0-9]+x[0-9]+`)
+	size = re.FindString(iconPath)
+
+	if size == "" {
+		err = errors.New("size not found in path: " + iconPath)
+		return size, err
+	}
+
+	return size, nil
+}
+
+// getIconType returns icon file format type (e.g. image/png) of an icon based on its filename
+func getIconType(iconPath string) (filetype string, err error) {
+	iconPath = path.Base(iconPath)
+
+	switch filepath.Ext(iconPath) {
+	case ".png":
+		return "image/png", nil
+	}
+
+	err = errors.New("could not decide icon filetype: " + iconPath)
+	return "", err
+}
+
+// createPWAManifest creates a customized manifest.json for a PWA if PWA url is supplied in args
+func createPWAManifest(gallery directory, source directory, cookedTemplate *template.Template, dryRun bool, config configuration) error {
+	// TODO Add manifest link to HTMLs
+	// TODO Add apple-touch-icon to HTML
+	// TODO register service worker in HTML, add manifest and apple-touch-icon links to head
+
+	var PWAData = struct {
+		Shortname string
+		StartPage string
+		Icons     []struct {
+			Src  string
+			Size string
+			Type string
+		}
+	}{
+		Shortname: source.name,
+		StartPage: getIndexLink(config),
+	}
+
+	assetDirectoryListing, err := assets.ReadDir(config.assets.assetsDir)
+	if err != nil {
+		return fmt.Errorf("couldn't open embedded assets: %w", err)
+	}
+
+	for _, entry := range assetDirectoryListing {
+		if !entry.IsDir() {
+			// TODO refactor filename away below, redundant
+			filename := filepath.Base(entry.Name())
+			// check if asset filename starts with the string "icon"
+			if isIcon(filename) {
+				iconSize, err := getIconSize(filename)
+				if err != nil {
+					return fmt.Errorf("couldn't define icon size: %w", err)
+				}
+
+				iconType, err := getIconType(filename)
+				if err != nil {
+					return fmt.Errorf("couldn't define icon type: %w", err)
+				}
+
+				PWAData.Icons = append(PWAData.Icons, struct {
+					Src  string
+					Size string
+					Type string
+				}{
+					Src:  filename,
+					Size: iconSize,
+					Type: iconType,
+				})
+			}
+		}
+	}
+
+	manifestFilePath := filepath.Join(gallery.absPath, config.assets.manifestFile)
+	if dryRun {
+		log.Println("Would create web app manifest file:", manifestFilePath)
+	} else {
+		manifestFileHandle, err := createFile(manifestFilePath, config)
+		if err != nil {
+			return fmt.Errorf("couldn't create manifest file %s: %w", manifestFilePath, err)
+		}
+
+		err = cookedTemplate.Execute(manifestFileHandle, PWAData)
+		if err != nil {
+			manifestFileHandle.Close()
+			return fmt.Errorf("couldn't execute manifest template %s: %w", manifestFilePath, err)
+		}
+
+		manifestFileHandle.Sync()
+		manifestFileHandle.Close()
+
+		logProgress(config, "Created manifest file:", manifestFilePath)
+	}
+	return nil
+}
+
+// copyRootAssets copies all the embedded assets to the root directory of the gallery
+func copyRootAssets(gallery directory, dryRun bool, config configuration) error {
+	assetDirectoryListing, err := assets.ReadDir(config.assets.assetsDir)
+	if err != nil {
+		return fmt.Errorf("couldn't open embedded assets: %w", err)
+	}
+
+	// Iterate through all the embedded assets
+	// TODO only update assets if they're not up to date
+	// TODO then add logging for created assets
+	for _, entry := range assetDirectoryListing {
+		// Shared assets are linked from elsewhere
+		if !entry.IsDir() && !isSharedAsset(entry.Name(), config) {
+			switch filepath.Ext(strings.ToLower(entry.Name())) {
+			// Copy all javascript and CSS files
+			case ".js", ".css", ".png":
+				if dryRun {
+					log.Println("Would copy JS/CSS/PNG file", entry.Name(), "to", gallery.absPath)
+				} else {
+					if entry.Name() == config.assets.playIcon {
+						break
+					}
+
+					assetPath := filepath.Join(config.assets.assetsDir, entry.Name())
+					var filebuffer []byte
+					if isIcon(entry.Name()) {
+						filebuffer, err = readIconAsset(assetPath, config)
+					} else {
+						filebuffer, err = assets.ReadFile(assetPath)
+					}
+					if err != nil {
+						return fmt.Errorf("couldn't open embedded asset %s: %w", assetPath, err)
+					}
+					targetPath := filepath.Join(gallery.absPath, entry.Name())
+					err = writeFile(targetPath, filebuffer, config)
+					if err != nil {
+						return fmt.Errorf("couldn't write embedded asset %s: %w", targetPath, err)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// templates struct holds the parsed embedded templates. Templates are parsed once per
+// run and are safe to execute concurrently.
+type templates struct {
+	html       *template.Template
+	manifest   *template.Template
+	singleFile *template.Template
+	timeline   *template.Template
+	calendar   *template.Template
+	people     *template.Template
+	contact    *template.Template
+}
+
+// parseTemplates parses all the embedded templates
+func parseTemplates(config configuration) (cookedTemplates templates, err error) {
+	cookedTemplates.html, err = parseTemplate(config.assets.htmlTemplate, config)
+	if err != nil {
+		return cookedTemplates, err
+	}
+
+	cookedTemplates.manifest, err = parseTemplate(config.assets.manifestTemplate, config)
+	if err != nil {
+		return cookedTemplates, err
+	}
+
+	cookedTemplates.singleFile, err = parseTemplate(config.assets.singleFileTemplate, config)
+	if err != nil {
+		return cookedTemplates, err
+	}
+
+	cookedTemplates.timeline, err = parseTemplate(config.assets.timelineTemplate, config)
+	if err != nil {
+		return cookedTemplates, err
+	}
+
+	cookedTemplates.calendar, err = parseTemplate(config.assets.calendarTemplate, config)
+	if err != nil {
+		return cookedTemplates, err
+	}
+
+	cookedTemplates.people, err = parseTemplate(config.assets.peopleTemplate, config)
+	if err != nil {
+		return cookedTemplates, err
+	}
+
+	cookedTemplates.contact, err = parseTemplate(config.assets.contactTemplate, config)
+	return cookedTemplates, err
+}
+
+// parseTemplate parses one embedded template
+func parseTemplate(templateName string, config configuration) (*template.Template, error) {
+	templatePath := filepath.Join(config.assets.assetsDir, templateName)
+	cookedTemplate, err := template.ParseFS(assets, templatePath)
+	if err != nil {
+		return nil, errors.New("couldn't parse template " + templatePath + ": " + err.Error())
+	}
+	return cookedTemplate, nil
+}
+
+// createHTML creates an HTML file in the gallery directory, by filling in the thisHTML struct
+// with all the required information, combining it with the HTML template and saving it in the file.
+// The template may be executed concurrently by several goroutines.
+func createHTML(depth int, source directory, galleryDirectory string, cookedTemplate *template.Template, dryRun bool, config configuration) error {
+	// create the thisHTML struct and start filling it with the relevant data
+	var thisHTML htmlData
+
+	// The page title will be the directory name, unless there's an album title.
+	// Albums may also have a hero image and intro text shown on top of the page.
+	thisHTML.Title = albumTitle(source)
+	thisHTML.Hero = findHeroImage(source, config)
+	thisHTML.Intro = source.album.Intro
+
+	// Shared album links are previewed with the cover and title
+	thisHTML.OGImage = createOGImage(source, galleryDirectory, thisHTML.Title, dryRun, config)
+
+	// Album description is written in Markdown
+	if source.album.Description != "" {
+		description, err := renderMarkdown(source.album.Description)
+		if err != nil {
+			log.Println("couldn't render album description:", source.absPath, err.Error())
+		}
+		thisHTML.Description = description
+	}
+
+	// Non-media files like GPS tracks are offered as downloads
+	thisHTML.Attachments = getHTMLAttachments(source, config)
+
+	// The slideshow can play music picked in album.yaml
+	if source.music.absPath != "" {
+		thisHTML.Music = musicFile
+	}
+
+	// Hikes and rides are drawn on a map, with the photos along the way
+	if config.media.albumMap {
+		thisHTML.Map = createHTMLMap(source)
+	}
+
+	// Outdoor trips show how far and how high they went
+	if config.media.trackStats {
+		thisHTML.TrackStats = formatTrackStats(computeTrackStats(source.tracks))
+	}
+
+	// Photographers like to know what the light was like on the days of an album
+	if config.media.astronomy {
+		thisHTML.Astronomy = createAstronomyLines(source, config)
+	}
+
+	// Album tiles and the page header show how many photos and videos there are, and when
+	thisHTML.Stats = formatAlbumStats(collectAlbumStats(source, config), config)
+
+	// Go through each directory and file and add them to the slices
+	for _, subdir := range source.subdirectories {
+		thisHTML.Subdirectories = append(thisHTML.Subdirectories, htmlSubdirectory{
+			Name:  subdir.name,
+			Stats: formatAlbumStats(collectAlbumStats(subdir, config), config),
+		})
+	}
+	dayHeadings := getDayHeadings(source.files, config)
+	for i, file := range source.files {
+		thumbnailFilename, fullsizeFilename := getGalleryFilenames(file.absPath, config)
+		thisFile := htmlFile{
+			ID:          getFileID(path.Join(filepath.ToSlash(source.relPath), file.name)),
+			Number:      i + 1,
+			Filename:    file.name,
+			Thumbnail:   filepath.Join(config.files.thumbnailDir, thumbnailFilename),
+			Fullsize:    filepath.Join(config.files.fullsizeDir, fullsizeFilename),
+			Original:    filepath.Join(config.files.originalDir, getOriginalFilename(file.name, config)),
+			Caption:     file.sidecar.caption,
+			Keywords:    strings.Join(file.sidecar.keywords, ", "),
+			Rating:      file.sidecar.rating,
+			Label:       file.sidecar.label,
+			Taken:       formatTakenTime(file.takenTime, config),
+			Camera:      file.camera,
+			Exposure:    formatExposure(file.exposure),
+			FocalLength: formatFocalLength(file.exposure),
+			Width:       file.width,
+			Height:      file.height,
+			Size:        formatFileSize(file.size),
+		}
+
+		// Full-size dimensions are read from the image in the gallery, so the lightbox
+		// can reserve space for the image before it has loaded
+		if isImageFile(file.absPath, config) {
+			thisFile.FullsizeWidth, thisFile.FullsizeHeight, _ = readImageDimensions(filepath.Join(galleryDirectory, thisFile.Fullsize))
+			thisFile.Orientation = getOrientation(file.width, file.height)
+			thisFile.ThumbnailWebP = getWebPSource(galleryDirectory, thisFile.Thumbnail)
+			thisFile.FullsizeWebP = getWebPSource(galleryDirectory, thisFile.Fullsize)
+			thisFile.Srcset = getThumbnailSrcset(galleryDirectory, thisFile.Thumbnail, config)
+			if webpSrcset := getThumbnailSrcset(galleryDirectory, getWebPPath(thisFile.Thumbnail), config); thisFile.ThumbnailWebP != "" && webpSrcset != "" {
+				thisFile.ThumbnailWebP = webpSrcset
+			}
+		}
+
+		// Long trips are broken up by day
+		thisFile.DayHeading = dayHeadings[i]
+
+		// Without originals, the full-size file is the one to download
+		if config.files.noOriginals {
+			thisFile.Original = thisFile.Fullsize
+		}
+
+		// Names of people are only published when asked to
+		if config.media.faces {
+			thisFile.Faces = getHTMLFaces(file)
+		}
+
+		thisHTML.Files = append(thisHTML.Files, thisFile)
+	}
+
+	// We'll use relative paths to refer to the root direct assets such as icons, JS and CSS.
+	// The depth parameter is used to figure out how deep in a subdirectory we are
+	rootEscape := ""
+	for i := 0; i < depth; i = i + 1 {
+		rootEscape = rootEscape + "../"
+	}
+
+	assetDirectoryListing, err := assets.ReadDir(config.assets.assetsDir)
+	if err != nil {
+		return fmt.Errorf("couldn't list embedded assets: %w", err)
+	}
+
+	// Go through the embedded assets and add all JS and CSS files, link them
+	for _, entry := range assetDirectoryListing {
+		if !entry.IsDir() {
+			switch filepath.Ext(strings.ToLower(entry.Name())) {
+			// Copy all javascript and CSS files
+			case ".js":
+				thisHTML.JS = append(thisHTML.JS, getAssetURL(entry.Name(), rootEscape, config))
+			case ".css":
+				// Small stylesheets can be inlined to save a render-blocking request
+				if config.assets.inlineAssets {
+					entryInfo, err := entry.Info()
+					if err == nil && entryInfo.Size() <= int64(config.assets.inlineCSSMaxSize) {
+						stylesheet, err := assets.ReadFile(filepath.Join(config.assets.assetsDir, entry.Name()))
+						if err == nil {
+							thisHTML.InlineCSS = append(thisHTML.InlineCSS, string(stylesheet))
+							break
+						}
+					}
+				}
+				thisHTML.CSS = append(thisHTML.CSS, getAssetURL(entry.Name(), rootEscape, config))
+			case ".png":
+				if isIcon(entry.Name()) {
+					iconSize, _ := getIconSize(entry.Name())
+					if iconSize == "180x180" {
+						thisHTML.AppleTouchIcon = entry.Name()
+					}
+				}
+			}
+		}
+	}
+
+	// If we're not in the root directory, link the back icon and show it in the HTML page
+	if depth > 0 {
+		thisHTML.BackIcon = getAssetURL(config.assets.backIcon, rootEscape, config)
+	}
+
+	// Generic folder icon to be used for each subfolder
+	thisHTML.FolderIcon = getAssetURL(config.assets.folderIcon, rootEscape, config)
+
+	// If we're in the root directory, add manifest link, and timeline, calendar and people
+	// links if there are ones
+	if depth == 0 {
+		thisHTML.ManifestFile = config.assets.manifestFile
+		if config.assets.timeline {
+			thisHTML.Timeline = timelineFile
+		}
+		if config.assets.calendar {
+			thisHTML.Calendar = calendarFile
+		}
+		if config.media.faces {
+			thisHTML.People = peopleFile
+		}
+	}
+
+	// In proofing mode, visitors pick photos by their number and send their picks
+	thisHTML.Proofing = config.assets.proofing
+	thisHTML.ProofingEmail = config.assets.proofingEmail
+
+	// Albums with photos link to their contact sheet, if there are ones
+	if config.assets.contactSheet && len(source.files) > 0 {
+		thisHTML.ContactSheet = contactSheetFile
+	}
+
+	// The album tree sidebar is built from the tree file in the gallery root, showing
+	// where this album is
+	if config.assets.albumTree {
+		thisHTML.AlbumTree = filepath.Join(rootEscape, albumTreeFile)
+		thisHTML.AlbumPath = escapeURLPath(filepath.ToSlash(source.relPath))
+	}
+
+	// Links to other albums end with the filename of their pages, unless it's index.html
+	thisHTML.IndexLink = getIndexLink(config)
+
+	// The full and lite versions of the gallery link to the same album in each other
+	if config.assets.liteLink {
+		thisHTML.LiteLink = getLiteLink(rootEscape, source.relPath, config)
+	}
+	if config.assets.liteVersion {
+		thisHTML.FullLink = getFullLink(rootEscape, source.relPath, config)
+	}
+
+	// Scripts don't need to block rendering, they're only used after the page has loaded
+	thisHTML.DeferJS = config.assets.inlineAssets
+
+	// In development mode, link the live reload stamp file for the page to poll
+	if config.assets.liveReload {
+		thisHTML.LiveReload = filepath.Join(rootEscape, liveReloadFile)
+	}
+
+	// The service worker compares the page's hash to the current one to tell whether
+	// its cached copy is outdated
+	thisHTML.PageHash = source.pageHash
+
+	// Add image height and width
+	thisHTML.ImageHeight = fmt.Sprint(config.media.thumbnailHeight)
+	thisHTML.ImageWidth = fmt.Sprint(config.media.thumbnailWidth)
+
+	// Videos are marked with their codecs for browsers and cast devices
+	thisHTML.VideoType = getVideoMIMEType(config.media.videoProfile)
+
+	// thisHTML struct has been filled in successfully, fill in the data
+	// to the HTML template and write it to the correct file
+	htmlFilePath := filepath.Join(galleryDirectory, config.assets.htmlFile)
+	if dryRun {
+		log.Println("Would create HTML file:", htmlFilePath)
+	} else {
+		// TODO apple-touch-icon to template
+		// TODO simplify service worker
+
+		htmlFileHandle, err := createFile(htmlFilePath, config)
+		if err != nil {
+			return fmt.Errorf("couldn't create HTML file %s: %w", htmlFilePath, err)
+		}
+
+		err = cookedTemplate.Execute(htmlFileHandle, thisHTML)
+		if err != nil {
+			htmlFileHandle.Close()
+			return fmt.Errorf("couldn't execute HTML template %s: %w", htmlFilePath, err)
+		}
+
+		htmlFileHandle.Sync()
+		htmlFileHandle.Close()
+
+		logProgress(config, "Created HTML file:", htmlFilePath)
+	}
+	return nil
+}
+
+// getGalleryDirectoryNames parses the names for subdirectories for thumbnail, full size
+// and original pictures in the gallery directory
+func getGalleryDirectoryNames(galleryDirectory string, config configuration) (thumbnailGalleryDirectory string, fullsizeGalleryDirectory string, originalGalleryDirectory string) {
+	thumbnailGalleryDirectory = filepath.Join(galleryDirectory, config.files.thumbnailDir)
+	fullsizeGalleryDirectory = filepath.Join(galleryDirectory, config.files.fullsizeDir)
+	originalGalleryDirectory = filepath.Join(galleryDirectory, config.files.originalDir)
+	return
+}
+
+func transformImage(source string, fullsizeDestination string, thumbnailDestination string, config configuration) error {
+	if isImageFormatExtension(config.files.imageExtension) {
+		// First create full-size image
+		image, err := loadImage(source, config)
+		if err != nil {
+			log.Println("couldn't open full-size image:", source, err.Error())
+			return fmt.Errorf("%w: %v", errUnsupportedFormat, err)
+		}
+
+		err = image.AutoRotate()
+		if err != nil {
+			log.Println("couldn't autorotate full-size image:", source, err.Error())
+			return err
+		}
+
+		// Calculate the scaling factor used to make the image smaller
+		scale := float64(config.media.fullsizeMaxWidth) / float64(image.Width())
+		if (scale * float64(image.Height())) > float64(config.media.fullsizeMaxHeight) {
+			// If the image is tall vertically, use height instead of width to recalculate scaling factor
+			scale = float64(config.media.fullsizeMaxHeight) / float64(image.Height())
+		}
+
+		// TODO don't enlarge the file by accident
+		err = image.Resize(scale, vips.KernelAuto)
+		if err != nil {
+			log.Println("couldn't resize full-size image:", source, err.Error())
+			return err
+		}
+
+		// The full-size image is left as it is if only the thumbnail is rebuilt
+		if fullsizeDestination != "" {
+			fullsizeBuffer, err := exportImage(image, source, config)
+			if err != nil {
+				log.Println("couldn't export full-size image:", source, err.Error())
+				return err
+			}
+
+			err = writeFile(fullsizeDestination, fullsizeBuffer, config)
+			if err != nil {
+				log.Println("couldn't write full-size image:", fullsizeDestination, err.Error())
+				return wrapWriteError(err)
+			}
+
+			if config.files.webp {
+				err = exportWebP(image, source, fullsizeDestination, config)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		if thumbnailDestination == "" {
+			return nil
+		}
+
+		// After full-size image, create thumbnails, the denser ones first
+		err = exportThumbnailDensities(image, source, thumbnailDestination, config)
+		if err != nil {
+			return err
+		}
+		err = image.Thumbnail(config.media.thumbnailWidth, config.media.thumbnailHeight, vips.InterestingAttention)
+		if err != nil {
+			log.Println("couldn't crop thumbnail:", err.Error())
+			return err
+		}
+
+		thumbnailBuffer, err := exportImage(image, source, config)
+		if err != nil {
+			log.Println("couldn't export thumbnail image:", source, err.Error())
+			return err
+		}
+
+		err = writeFile(thumbnailDestination, thumbnailBuffer, config)
+		if err != nil {
+			log.Println("couldn't write thumbnail image:", thumbnailDestination, err.Error())
+			return wrapWriteError(err)
+		}
+
+		if config.files.webp {
+			err = exportWebP(image, source, thumbnailDestination, config)
+			if err != nil {
+				return err
+			}
+		}
+	} else {
+		log.Println("Can't figure out what format to convert full size image to:", source)
+		return fmt.Errorf("%w: invalid target format for full-size image", errUnsupportedFormat)
+	}
+
+	return nil
+}
+
+// getFFmpegThreads returns how many threads each ffmpeg process may use. ffmpeg uses
+// all cores by default, so with several concurrent video jobs the machine would be
+// badly oversubscribed. Unless configured, the cores are split between the workers.
+func getFFmpegThreads(config configuration) int {
+	if config.media.ffmpegThreads > 0 {
+		return config.media.ffmpegThreads
+	}
+
+	threads := runtime.NumCPU() / config.concurrency
+	if threads < 1 {
+		threads = 1
+	}
+	return threads
+}
+
+func transformVideo(source string, fullsizeDestination string, thumbnailDestination string, config configuration) error {
+	// Either one of the files is left as it is if only the other one is rebuilt
+	if fullsizeDestination != "" {
+		err := guardSource(fullsizeDestination, config)
+		if err != nil {
+			return err
+		}
+
+		// Resize full-size video, or just copy it if it's small and playable as it is
+		var probe *videoProbe
+		if probed, err := probeVideo(source); err == nil {
+			probe = &probed
+		} else {
+			logProgress(config, "Couldn't probe video, transcoding it:", source, err.Error())
+		}
+		ffmpegCommand := exec.Command("ffmpeg", getFullsizeVideoArguments(source, fullsizeDestination, probe, config)...)
+
+		// ffmpeg's output is attached to the file's failure record, instead of interleaving
+		// with the other workers' in the log
+		commandOutput, err := ffmpegCommand.CombinedOutput()
+		if err != nil {
+			return &transcodeError{file: source, stderr: truncateOutput(string(commandOutput)), err: err}
+		}
+
+		// ffmpeg creates the file with its own permissions
+		err = setPermissions(fullsizeDestination, config.files.fileMode, config)
+		if err != nil {
+			return err
+		}
+	}
+	if thumbnailDestination == "" {
+		return nil
+	}
+	err := guardSource(thumbnailDestination, config)
+	if err != nil {
+		return err
+	}
+
+	// Create thumbnail image of video, from the full-size video if it was just transcoded,
+	// which is much faster to decode than a long or high resolution original
+	thumbnailSource := source
+	if fullsizeDestination != "" {
+		thumbnailSource = fullsizeDestination
+	}
+	// The frame is taken losslessly and encoded in the format of the gallery with the overlay
+	framePath := stripExtension(thumbnailDestination) + "-frame.png"
+	defer os.Remove(framePath)
+	ffmpegCommand2 := exec.Command("ffmpeg", "-y", "-i", thumbnailSource, "-ss", "00:00:00", "-vframes", "1", "-vf", fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=increase:force_divisible_by=2,crop=%d:%d", config.media.thumbnailWidth, config.media.thumbnailHeight, config.media.thumbnailWidth, config.media.thumbnailHeight), "-threads", strconv.Itoa(getFFmpegThreads(config)), "-loglevel", "error", framePath)
+
+	commandOutput2, err := ffmpegCommand2.CombinedOutput()
+	if err != nil {
+		return &transcodeError{file: source, stderr: truncateOutput(string(commandOutput2)), err: err}
+	}
+
+	// Take thumbnail and overlay triangle image on top of it
+	image, err := vips.NewImageFromFile(framePath)
+	if err != nil {
+		log.Println("Could not open video thumbnail:", thumbnailDestination)
+		return err
+	}
+
+	playbuttonAssetPath := filepath.Join(config.assets.assetsDir, config.assets.playIcon)
+	playbuttonOverlayBuffer, err := assets.ReadFile(playbuttonAssetPath)
+	if err != nil {
+		log.Println("Could not read play button overlay asset")
+		return err
+	}
+	playbuttonOverlayImage, err := vips.NewImageFromBuffer(playbuttonOverlayBuffer)
+	if err != nil {
+		log.Println("Could not open play button overlay asset")
+		return err
+	}
+
+	// Overlay play button in the middle of thumbnail picture
+	err = image.Composite(playbuttonOverlayImage, vips.BlendModeOver, (config.media.thumbnailWidth/2)-(playbuttonOverlayImage.Width()/2), (config.media.thumbnailHeight/2)-(playbuttonOverlayImage.Height()/2))
+	if err != nil {
+		log.Println("Could not composite play button overlay on top of:", thumbnailDestination)
+		return err
+	}
+
+	imageBytes, err := exportImage(image, source, config)
+	if err != nil {
+		log.Println("Could not export video thumnail:", thumbnailDestination)
+		return err
+	}
+
+	err = writeFile(thumbnailDestination, imageBytes, config)
+	if err != nil {
+		log.Println("Could not write video thumnail:", thumbnailDestination)
+		return wrapWriteError(err)
+	}
+
+	return nil
+}
+
+// createOriginal puts the original of a source file into the gallery, as configured with
+// --originals. Hard links are the source file itself, so they keep its owner.
+func createOriginal(source string, destination string, config configuration) error {
+	var err error
+	switch config.files.originals {
+	case originalsCopy:
+		err = copyFile(source, destination, config)
+	case originalsHardlink:
+		var linked bool
+		linked, err = hardlinkFile(source, destination, config)
+		if linked {
+			return nil
+		}
+	default:
+		err = symlinkFile(source, destination, config)
+	}
+	if err != nil {
+		return wrapWriteError(err)
+	}
+	return setOwner(destination, config)
+}
+
+// getThumbnailSource returns the file to build the thumbnail of a job from, when its
+// full-size file isn't built along with it. The adopted or existing full-size file is
+// much faster to decode than a RAW, huge TIFF or long video original, and already
+// rotated. Without one, the thumbnail is built from the original.
+func getThumbnailSource(thisJob transformationJob, adoptedFullsize string) string {
+	if adoptedFullsize != "" {
+		return adoptedFullsize
+	}
+	if thisJob.thumbnailSource != "" && exists(thisJob.thumbnailSource) {
+		return thisJob.thumbnailSource
+	}
+	return thisJob.sourceFilepath
+}
+
+// getGalleryFilenames returns the thumbnail and full-size filenames of a source file. Files
+// recognised by their contents are only known by their absolute path.
+func getGalleryFilenames(sourcePath string, config configuration) (thumbnailFilename string, fullsizeFilename string) {
+	sourceFilename := filepath.Base(sourcePath)
+	thumbnailFilename = getGalleryBasename(sourceFilename, config) + config.files.imageExtension
+	// Only media files make it this far, so the ones which aren't videos are images
+	fullsizeFilename = thumbnailFilename
+	if !isImageFile(sourcePath, config) && isVideoFile(sourcePath, config) {
+		fullsizeFilename = getGalleryBasename(sourceFilename, config) + config.files.videoExtension
+	}
+	return
+}
+
+func transformFile(thisJob transformationJob, progressBar *pb.ProgressBar, config configuration) {
+	// Once the disk is full or the run has been aborted, the files left are skipped
+	if config.run.isDiskFull() || isAborted(config) {
+		return
+	}
+
+	// The files are built in a directory of their own in the workspace and only moved
+	// into the gallery when done. This way, no half-finished files will stay in the gallery
+	// if the program is killed before we're finished.
+	jobWorkspace, err := os.MkdirTemp(config.files.workspaceDir, "job-")
+	if err == nil {
+		defer os.RemoveAll(jobWorkspace)
+	}
+
+	// Temporary files keep the extension of their gallery file, ffmpeg infers the format from it
+	var thumbnailTemp, fullsizeTemp string
+	if thisJob.thumbnailFilepath != "" {
+		thumbnailTemp = filepath.Join(jobWorkspace, "thumbnail"+filepath.Ext(thisJob.thumbnailFilepath))
+	}
+	if thisJob.fullsizeFilepath != "" {
+		fullsizeTemp = filepath.Join(jobWorkspace, "fullsize"+filepath.Ext(thisJob.fullsizeFilepath))
+	}
+
+	// Do the actual transformation and increment the progress bar. Unreadable files are
+	// caught first, libvips and ffmpeg would fail on them with less telling errors.
+	if err == nil {
+		err = checkReadable(thisJob.sourceFilepath)
+	}
+	// Files of an adopted gallery are reused if they match the current settings
+	thumbnailTarget, fullsizeTarget := thumbnailTemp, fullsizeTemp
+	var adoptedFullsizePath string
+	if err == nil && config.files.adoptDir != "" {
+		adoptedThumbnail, adoptedFullsize := adoptGalleryFiles(thisJob, thumbnailTemp, fullsizeTemp, config)
+		if adoptedThumbnail {
+			thumbnailTarget = ""
+		}
+		if adoptedFullsize {
+			fullsizeTarget = ""
+			adoptedFullsizePath = fullsizeTemp
+		}
+	}
+	if err == nil && (thumbnailTarget != "" || fullsizeTarget != "") {
+		// Thumbnails built without their full-size file are built from the full-size file
+		transformSource := thisJob.sourceFilepath
+		if fullsizeTarget == "" {
+			transformSource = getThumbnailSource(thisJob, adoptedFullsizePath)
+		}
+		if isImageFile(thisJob.sourceFilepath, config) {
+			err = getImageTransformer(config).TransformImage(transformSource, fullsizeTarget, thumbnailTarget, config)
+		} else if isVideoFile(thisJob.sourceFilepath, config) {
+			err = getVideoTransformer(config).TransformVideo(transformSource, fullsizeTarget, thumbnailTarget, config)
+		} else {
+			err = fmt.Errorf("%w: not an image or video", errUnsupportedFormat)
+		}
+	}
+
+	// The thumbnail goes last, a gallery file is up to date once its thumbnail is
+	// newer than the source file
+	if err == nil && fullsizeTemp != "" {
+		err = moveIntoGallery(fullsizeTemp, thisJob.fullsizeFilepath, config)
+	}
+	if err == nil && fullsizeTemp != "" {
+		err = moveWebPIntoGallery(fullsizeTemp, thisJob.fullsizeFilepath, config)
+	}
+	if err == nil && thisJob.originalFilepath != "" {
+		err = createOriginal(thisJob.sourceFilepath, thisJob.originalFilepath, config)
+	}
+	if err == nil && thumbnailTemp != "" {
+		err = moveDensitiesIntoGallery(thumbnailTemp, thisJob.thumbnailFilepath, config)
+	}
+	if err == nil && thumbnailTemp != "" {
+		err = moveWebPIntoGallery(thumbnailTemp, thisJob.thumbnailFilepath, config)
+	}
+	if err == nil && thumbnailTemp != "" {
+		err = moveIntoGallery(thumbnailTemp, thisJob.thumbnailFilepath, config)
+	}
+	if progressBar != nil {
+		progressBar.Add64(thisJob.size)
+	}
+
+	// Files finished after aborting the run didn't fail, they're just left for the next run
+	if errors.Is(err, errWorkspaceAborted) {
+		return
+	}
+	if err != nil {
+		config.run.addFailure(thisJob.sourceFilepath, err)
+
+		// Nothing else will fit on the disk either
+		if errors.Is(err, errDiskFull) && config.run.setDiskFull() {
+			log.Println("Disk is full, cleaning up and aborting...")
+			abortWorkspace(config)
+		}
+		return
+	}
+
+	logProgress(config, "Converted media file:", thisJob.sourceFilepath)
+}
+
+// This is the main concurrent goroutine that takes care of the parallelisation. A big bunch of them
+// are created in a worker pool and they're fed new images/videos to transform via a channel.
+func transformationWorker(thisDirectoryWG *sync.WaitGroup, thisDirectoryJobs chan transformationJob, progressBar *pb.ProgressBar, config configuration) {
+	defer thisDirectoryWG.Done()
+	for thisJob := range thisDirectoryJobs {
+		transformFile(thisJob, progressBar, config)
+		runtime.GC()
+	}
+}
+
+// createMedia takes the source directory, creates the gallery subdirectories for it and
+// returns a job for creating a thumbnail, full-size version and original of each
+// non-existing file to the respective gallery directory.
+func createMedia(source directory, gallerySubdirectory string, dryRun bool, config configuration) (jobs []transformationJob, err error) {
+	thumbnailGalleryDirectory, fullsizeGalleryDirectory, originalGalleryDirectory := getGalleryDirectoryNames(gallerySubdirectory, config)
+
+	// Create subdirectories in gallery directory for thumbnails, full-size and original pics
+	mediaDirectories := []string{thumbnailGalleryDirectory, fullsizeGalleryDirectory}
+	if !config.files.noOriginals {
+		mediaDirectories = append(mediaDirectories, originalGalleryDirectory)
+	}
+	for _, mediaDirectory := range mediaDirectories {
+		err = createDirectory(mediaDirectory, dryRun, config)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, file := range source.files {
+		if !file.exists || file.outdatedThumbnail || file.outdatedFullsize {
+			var thisJob transformationJob
+			thisJob.filename = file.name
+			thisJob.relPath = filepath.Join(source.relPath, file.name)
+			thisJob.size = file.size
+			thisJob.sourceFilepath = file.absPath
+			thumbnailFilename, fullsizeFilename := getGalleryFilenames(file.absPath, config)
+			if !file.exists || file.outdatedThumbnail {
+				thisJob.thumbnailFilepath = filepath.Join(thumbnailGalleryDirectory, thumbnailFilename)
+			}
+			if !file.exists || file.outdatedFullsize {
+				thisJob.fullsizeFilepath = filepath.Join(fullsizeGalleryDirectory, fullsizeFilename)
+			} else if file.outdatedThumbnail {
+				thisJob.thumbnailSource = filepath.Join(fullsizeGalleryDirectory, fullsizeFilename)
+			}
+			if !config.files.noOriginals {
+				thisJob.originalFilepath = filepath.Join(originalGalleryDirectory, getOriginalFilename(file.name, config))
+			}
+
+			if dryRun {
+				log.Println("Would convert:", thisJob.sourceFilepath, thisJob.thumbnailFilepath, thisJob.fullsizeFilepath, thisJob.originalFilepath)
+			} else {
+				jobs = append(jobs, thisJob)
+			}
+		}
+	}
+
+	return jobs, nil
+}
+
+// scheduleJobs orders transformation jobs largest first. This way the big videos
+// are started early and the run doesn't end with one long transcode running alone
+// while all other workers idle.
+func scheduleJobs(jobs []transformationJob) {
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].size > jobs[j].size
+	})
+}
+
+// cleanUp cleans stale files and directories from the gallery recursively
+func cleanUp(gallery directory, dryRun bool, config configuration) {
+	cleanDirectory(gallery, dryRun, config)
+
+	for _, subdir := range gallery.subdirectories {
+		cleanUp(subdir, dryRun, config)
+	}
+}
+
+// Clean gallery directory of any directories or files which don't exist in source
+func cleanDirectory(gallery directory, dryRun bool, config configuration) {
+	for _, file := range gallery.files {
+		if !file.exists && !reservedFile(file.name, config) {
+			stalePath := filepath.Join(gallery.absPath, file.name)
+			if dryRun {
+				log.Println("would clean up file:", stalePath)
+			} else {
+				err := getStorage(config).RemoveAll(stalePath)
+				if err != nil {
+					log.Println("couldn't delete stale gallery file", stalePath, ":", err.Error())
+				}
+				logProgress(config, "Cleaned up file:", stalePath)
+			}
+			removeStaleWebP(stalePath, dryRun, config)
+		}
+	}
+
+	for _, dir := range gallery.subdirectories {
+		if !reservedDirectory(dir.name, config) && !dir.exists {
+			stalePath := filepath.Join(gallery.absPath, dir.name)
+			if dryRun {
+				log.Println("would clean up dir:", stalePath)
+			} else {
+				err := getStorage(config).RemoveAll(stalePath)
+				if err != nil {
+					log.Println("couldn't delete stale gallery directory", stalePath, ":", err.Error())
+				}
+				logProgress(config, "Cleaned up directory:", stalePath)
+			}
+		}
+	}
+}
+
+// preserveDirectoryTimes recursively sets the modification time of each gallery directory
+// to the one of its source directory. Must be called after the gallery directories have
+// been written to, as that updates their modification times.
+func preserveDirectoryTimes(source directory, galleryRoot string, dryRun bool, config configuration) {
+	// Albums outside the subtree of a partial run weren't read
+	if source.keptStats != nil {
+		return
+	}
+
+	galleryDirectory := filepath.Join(galleryRoot, source.relPath)
+	if dryRun {
+		log.Println("Would set modification time of directory:", galleryDirectory, source.modTime)
+	} else {
+		err := getStorage(config).Chtimes(galleryDirectory, source.modTime, source.modTime)
+		if err != nil {
+			log.Println("couldn't set modification time of directory", galleryDirectory, ":", err.Error())
+		}
+	}
+
+	for _, subdir := range source.subdirectories {
+		preserveDirectoryTimes(subdir, galleryRoot, dryRun, config)
+	}
+}
+
+// htmlJob struct is one album page to be rendered by the HTML worker pool
+type htmlJob struct {
+	depth            int
+	source           directory
+	galleryDirectory string
+}
+
+// updateHTMLFiles renders the album pages of all changed directories concurrently.
+// previousPages are the page hashes of the previous run, by album path. Returns the
+// page hashes of this run and the number of rendered pages.
+func updateHTMLFiles(source directory, gallery directory, cookedTemplate *template.Template, previousPages map[string]string, dryRun bool, config configuration) (pages map[string]string, rendered int, err error) {
+	pages = make(map[string]string)
+	jobs, _ := collectHTMLJobs(0, source, gallery, getPageSettingsHash(config), previousPages, pages, config)
+
+	jobChannel := make(chan htmlJob, len(jobs))
+	errChannel := make(chan error, config.concurrency)
+	var workerWG sync.WaitGroup
+	for i := 1; i <= config.concurrency; i = i + 1 {
+		workerWG.Add(1)
+		go htmlWorker(&workerWG, jobChannel, errChannel, cookedTemplate, dryRun, config)
+	}
+
+	for _, thisJob := range jobs {
+		jobChannel <- thisJob
+	}
+	close(jobChannel)
+	workerWG.Wait()
+	close(errChannel)
+
+	// The first page which couldn't be written is reported
+	for workerErr := range errChannel {
+		if err == nil {
+			err = workerErr
+		}
+	}
+	return pages, len(jobs), err
+}
+
+// htmlWorker renders album pages received from the channel until it's closed. Stops at
+// the first page which can't be written, sending its error to errChannel.
+func htmlWorker(workerWG *sync.WaitGroup, jobChannel chan htmlJob, errChannel chan error, cookedTemplate *template.Template, dryRun bool, config configuration) {
+	defer workerWG.Done()
+	for thisJob := range jobChannel {
+		err := createHTML(thisJob.depth, thisJob.source, thisJob.galleryDirectory, cookedTemplate, dryRun, config)
+		if err != nil {
+			errChannel <- err
+			return
+		}
+	}
+}
+
+// collectHTMLJobs recursively returns the album pages which need to be rendered: the ones
+// whose hash differs from the previous run's, and missing ones. The hash of each page is
+// recorded in pages and the hash of the page of source returned. Album tiles show
+// statistics of all the media below them, so the hash of a page includes the hashes of
+// its subalbums' pages and albums containing a changed album are rendered again too.
+func collectHTMLJobs(depth int, source directory, gallery directory, settingsHash string, previousPages map[string]string, pages map[string]string, config configuration) (jobs []htmlJob, pageHash string) {
+	// Albums outside the subtree of a partial run aren't rendered at all
+	if source.keptStats != nil {
+		return nil, keepFrozenPageHashes(source.relPath, previousPages, pages)
+	}
+
+	// Frozen albums aren't rendered again, unless their pages are unknown
+	if source.frozen {
+		if pageHash = keepFrozenPageHashes(source.relPath, previousPages, pages); pageHash != "" {
+			return nil, pageHash
+		}
+	}
+
+	var subalbumJobs []htmlJob
+	var subalbumHashes []string
+	for _, subdir := range source.subdirectories {
+		thisSubalbumJobs, subalbumHash := collectHTMLJobs(depth+1, subdir, gallery, settingsHash, previousPages, pages, config)
+		subalbumJobs = append(subalbumJobs, thisSubalbumJobs...)
+		subalbumHashes = append(subalbumHashes, subalbumHash)
+	}
+
+	pageHash = getPageHash(source, subalbumHashes, settingsHash)
+	pagePath := filepath.ToSlash(source.relPath)
+	pages[pagePath] = pageHash
+
+	galleryDirectory := filepath.Join(gallery.absPath, source.relPath)
+	if previousPages[pagePath] != pageHash || !exists(filepath.Join(galleryDirectory, config.assets.htmlFile)) {
+		source.pageHash = pageHash
+		jobs = append(jobs, htmlJob{
+			depth:            depth,
+			source:           source,
+			galleryDirectory: galleryDirectory,
+		})
+	}
+
+	return append(jobs, subalbumJobs...), pageHash
+}
+
+// Options struct holds the options of building a gallery, the command-line options of
+// fastgallery. The go-arg tags document them. Messages gets the messages of the run,
+// and Progress its progress bar; both are left out if nil.
+type Options struct {
+	Source        string    `arg:"positional,required" help:"Source directory for images/videos, or an s3:// or gs:// prefix or rclone remote to mirror with rclone"`
+	Gallery       string    `arg:"positional,required" help:"Destination directory to create gallery in"`
+	SourceMirror  string    `arg:"--source-mirror" help:"new or empty local directory to mirror a remote source to; keep it, the originals in the gallery link to it (default: in the user cache directory)"`
+	Verbose       bool      `arg:"-v,--verbose" help:"print each created and converted file, which otherwise only goes to the log file, and libvips debug messages"`
+	DryRun        bool      `arg:"--dry-run" help:"dry run; don't change anything, just print what would be done"`
+	CleanUp       bool      `arg:"-c,--cleanup" help:"cleanup, delete files and directories in gallery which don't exist in source"`
+	NoVideos      bool      `arg:"--no-videos" help:"ignore videos, only include images"`
+	NoCheck       bool      `arg:"--no-integrity-check" help:"don't check that everything the generated pages link to exists"`
+	Lite          bool      `arg:"--lite" help:"also build a lite version of the gallery with smaller, more compressed photos and no originals, offered to visitors on slow connections"`
+	IconPhoto     string    `arg:"--icon-photo" help:"photo to crop the icons of the gallery's installable web app from, instead of the fastgallery logo"`
+	Adopt         string    `arg:"--adopt" help:"reuse the thumbnails and full-size photos of an existing gallery made by fastgallery, sigal or thumbsup where they match the current settings, instead of building them again"`
+	WebP          bool      `arg:"--webp" help:"also write WebP versions of photos, which browsers supporting them load instead of the JPEGs; use --rebuild-outdated to add them to existing galleries"`
+	Densities     string    `arg:"--thumbnail-densities" help:"also write thumbnails of these pixel densities, which browsers pick for high-density screens, e.g. 2 or 2,3; use --rebuild-outdated to add them to existing galleries"`
+	ImageFormat   string    `arg:"--image-format" default:"jpeg" help:"format of thumbnails and full-size photos: jpeg, or webp or avif for much smaller files which some older browsers can't show; existing galleries are converted on the next run"`
+	HTMLFile      string    `arg:"--html-file" default:"index.html" help:"filename of album pages, e.g. index.htm for your web server, or album.html to keep existing index.html files"`
+	CheckUpdates  bool      `arg:"--check-updates" help:"check GitHub for a newer release of fastgallery after the run; galleries of newer releases may be laid out differently"`
+	Changes       string    `arg:"--changes" help:"write the gallery files added, modified and deleted since the last run with this option to this file, for deploying only them"`
+	VideoExts     []string  `arg:"--video-extension,separate" help:"also include files with this extension as videos, e.g. .dav; may be repeated"`
+	NoSniff       bool      `arg:"--no-sniff" help:"don't recognise media files without a known extension by their contents, for faster scans of sources with lots of other files"`
+	ProbeVideos   bool      `arg:"--probe-videos" help:"probe files of unknown extensions with ffprobe, and include the ones which are videos"`
+	Attachments   []string  `arg:"--attachment-ext,separate" help:"copy files with this extension into albums as downloads, e.g. .gpx or .pdf; may be repeated"`
+	Logfile       string    `arg:"-l,--log" help:"recommended: log file to save errors and failed filenames to instead of stdout"`
+	MinRating     int       `arg:"--min-rating" help:"only include files rated at least this many stars in their XMP sidecar"`
+	ExcludeKey    []string  `arg:"--exclude-keyword,separate" help:"leave out files with this keyword in their XMP sidecar, e.g. private; may be repeated; use --cleanup to remove ones already in the gallery"`
+	ExcludePerson []string  `arg:"--exclude-person,separate" help:"leave out files with this person's face tagged in their XMP sidecar; may be repeated; use --cleanup to remove ones already in the gallery"`
+	Flat          bool      `arg:"--flat" help:"flat export mode; group files in the source root into albums by XMP album or filename"`
+	FlatPattern   string    `arg:"--flat-pattern" help:"regular expression whose first group is the album name, matched against filenames in flat export mode"`
+	Takeout       bool      `arg:"--takeout" help:"Google Takeout / iCloud Photos export mode; use titles, descriptions and dates from the export metadata"`
+	Timezone      string    `arg:"--timezone" help:"timezone camera clocks were set to, used for EXIF dates without one (default: local)"`
+	TimeOffset    []string  `arg:"--time-offset,separate" help:"correct camera clock by duration, e.g. --time-offset=-1h30m or --time-offset=subdir=+9h; may be repeated"`
+	Sort          string    `arg:"--sort" default:"name" help:"order of photos in albums: name or date"`
+	OutputNames   string    `arg:"--output-names" default:"preserve" help:"names of gallery files: preserve source filenames, lowercase them, or slug for lowercase letters, digits and dashes only"`
+	OutputProfile string    `arg:"--output-profile" default:"web" help:"web, or dlna to also make the gallery browsable with DLNA media servers: plain media directory names, slug filenames unless --output-names is lowercase, and only H.264 videos and JPEG images"`
+	LiveReload    bool      `arg:"--live-reload" help:"development only: make generated pages reload themselves when the gallery is regenerated"`
+	SingleFile    string    `arg:"--single-file" help:"also export the source root album as one self-contained HTML file to this path"`
+	InlineFull    bool      `arg:"--single-file-fullsize" help:"inline full-size images in the single-file export instead of linking to them"`
+	Timeline      bool      `arg:"--timeline" help:"write a timeline page of all photos across albums, newest first, linked from the landing page"`
+	Calendar      bool      `arg:"--calendar" help:"write a calendar heatmap page of the days photos were taken, linking to them on the timeline; implies --timeline"`
+	AlbumTree     bool      `arg:"--album-tree" help:"show a collapsible tree of all albums in a sidebar on every album page"`
+	ContactSheet  bool      `arg:"--contact-sheet" help:"write a printable contact sheet of numbered thumbnails and filenames for every album, linked from the album page"`
+	Proofing      bool      `arg:"--proofing" help:"number the photos and let visitors pick them, exporting their picks as a list of filenames"`
+	ProofingEmail string    `arg:"--proofing-email" help:"email address visitors can send their picks to; implies --proofing"`
+	SharedURL     string    `arg:"--shared-assets-url" help:"link CSS, JS and icons from a versioned subdirectory of this URL shared by many galleries, instead of copying them into the gallery"`
+	SharedDir     string    `arg:"--shared-assets-dir" help:"directory served at --shared-assets-url to copy this version's assets into"`
+	Map           bool      `arg:"--map" help:"draw the tracks of GPX files and the locations of geotagged photos on a map in album headers"`
+	TrackStats    bool      `arg:"--track-stats" help:"show the distance and elevation gain of GPX tracks in album headers"`
+	Astronomy     bool      `arg:"--sun-moon" help:"show the sunrise, sunset and moon phase of each day geotagged photos were taken on in album headers"`
+	Faces         bool      `arg:"--faces" help:"publish the names of people tagged in XMP sidecars, e.g. by digiKam or Picasa: highlight their faces in the lightbox and write a page of photos for each person"`
+	SearchIndex   bool      `arg:"--search-index" help:"write a newline-delimited JSON index of all photos for external search engines into the gallery root"`
+	SearchPost    string    `arg:"--search-index-post" help:"POST the search index to this URL after building, e.g. a Meilisearch documents endpoint; implies --search-index"`
+	SearchHead    []string  `arg:"--search-index-header,separate" help:"HTTP header for --search-index-post, e.g. \"Authorization: Bearer KEY\"; may be repeated"`
+	VideoProfile  string    `arg:"--video-profile" default:"compatibility" help:"codecs of full-size videos: compatibility for H.264 playing everywhere and casting to Chromecast and AirPlay, or efficiency for smaller HEVC videos"`
+	ImageEngine   string    `arg:"--image-engine" default:"vips" help:"engine for transforming images"`
+	VideoEngine   string    `arg:"--video-engine" default:"ffmpeg" help:"engine for transcoding videos"`
+	FFmpegThreads int       `arg:"--ffmpeg-threads" help:"threads per ffmpeg video transcode (default: CPU cores divided by concurrent jobs)"`
+	Prefetch      int       `arg:"--prefetch" help:"read this many source files ahead of the transformations into the file cache, for sources on network drives"`
+	HEIFConvert   bool      `arg:"--heif-convert" help:"if libvips lacks HEIF support, convert HEIF files with heif-convert from libheif instead of skipping them"`
+	Title         string    `arg:"--title" help:"title of the gallery landing page, overrides the root album.yaml"`
+	Hero          string    `arg:"--hero" help:"cover image shown on top of the landing page, path relative to the source directory; overrides the root album.yaml"`
+	Intro         string    `arg:"--intro" help:"intro text shown on the landing page, overrides the root album.yaml"`
+	InlineAssets  bool      `arg:"--inline-assets" help:"for faster first paint, inline small stylesheets into each page and defer scripts"`
+	DirMode       string    `arg:"--dir-mode" help:"permissions of created gallery directories in octal, limited by the umask (default: 0755)"`
+	FileMode      string    `arg:"--file-mode" help:"permissions of created gallery files in octal, limited by the umask (default: 0644)"`
+	Originals     string    `arg:"--originals" help:"how originals are put into the gallery: symlink, copy for galleries uploaded or synced elsewhere, or hardlink, which keeps the owner of the source files and can't be used with --paranoid (default: symlink)"`
+	CopyOriginals bool      `arg:"--copy-originals" help:"copy originals into the gallery instead of symlinking them, same as --originals=copy"`
+	Owner         string    `arg:"--owner" help:"owner of created gallery files and directories as user:group, user or :group, e.g. for a web server user"`
+	PreserveTimes bool      `arg:"--preserve-dir-times" help:"set the modification times of gallery directories to the ones of their source directories, for backup tools"`
+	NotifyWebhook string    `arg:"--notify-webhook" help:"POST a JSON report with counts, failures and duration to this URL when the gallery is done"`
+	SkipUnread    bool      `arg:"--skip-unreadable" help:"silently skip source files without read permission instead of reporting them as failed on each run"`
+	SplitAlbums   string    `arg:"--split-albums" help:"split directories with too many files into albums by month taken, or into chunks of this many files, e.g. --split-albums=month or --split-albums=500"`
+	SplitMinFiles int       `arg:"--split-min-files" help:"number of files a directory needs to have to be split with --split-albums (default: 1000)"`
+	RebuildOut    bool      `arg:"--rebuild-outdated" help:"transform existing media files again if the settings they were built with have changed, e.g. the thumbnail size"`
+	LowMemory     bool      `arg:"--low-memory" help:"for devices with little memory like a Raspberry Pi: transform one file at a time with a small libvips cache"`
+	Workspace     string    `arg:"--workspace" help:"directory for intermediate files, e.g. on a fast local disk for a gallery on a network drive (default: system temporary directory)"`
+	Paranoid      bool      `arg:"--paranoid" help:"refuse to create, change or delete anything in the source directory, and a gallery inside the source or vice versa"`
+	Root          string    `arg:"--root" help:"partial run: only update this subdirectory of the source and the pages of the albums above it, keeping the rest of the gallery as it was; timeline, calendar, contact sheets, album tree, people pages, search index, single-file export and lite gallery aren't updated"`
+	Watch         bool      `arg:"--watch" help:"keep running after building the gallery, updating the albums whose source files are added, changed or deleted"`
+	Config        string    `arg:"--config" help:"YAML configuration file setting the thumbnail and full-size dimensions, video size, JPEG quality, gallery directory names, file modes and concurrency (default: ~/.config/fastgallery/config.yaml, if it exists)"`
+	Messages      io.Writer `arg:"-"`
+	Progress      io.Writer `arg:"-"`
+}
+
+// NewOptions returns the options of building a gallery of source into gallery, with the
+// defaults of the command-line options. Set the other options on it before Build.
+func NewOptions(source string, gallery string) Options {
+	return Options{
+		Source:        source,
+		Gallery:       gallery,
+		ImageFormat:   "jpeg",
+		HTMLFile:      defaultHTMLFile,
+		Sort:          "name",
+		OutputNames:   namePolicyPreserve,
+		OutputProfile: outputProfileWeb,
+		VideoProfile:  videoProfileCompatibility,
+		ImageEngine:   imageEngineVips,
+		VideoEngine:   videoEngineFFmpeg,
+	}
+}
+
+// Build builds or updates the gallery of given options: transforms the new and changed
+// media files of the source, writes the album pages and the other pages asked for, and
+// cleans up the gallery if asked to. Cancelling ctx aborts the run, removing its
+// intermediate files; the files finished by then stay in the gallery for the next run.
+// libvips is started by the first gallery built and kept running, with the settings of
+// that gallery, until Shutdown.
+func Build(ctx context.Context, options Options) error {
+	return build(ctx, options, nil)
+}
+
+// Shutdown shuts libvips down once a program is done building galleries. No galleries
+// can be built afterwards.
+func Shutdown() {
+	vips.Shutdown()
+}
+
+// build builds or updates the gallery of given options. The galleries of a batch have
+// their files transformed by its shared workers, the others by workers of their own.
+func build(ctx context.Context, options Options, sharedWorkers *workerPool) error {
+	started := time.Now()
+	output := getOutput(options.Messages)
+
+	// Updates of the watched source are partial runs of their own, and only local
+	// directories can be watched
+	if options.Watch && options.Root != "" {
+		return errors.New("--watch can't be used with --root, it picks the albums to update itself")
+	}
+	if options.Watch && isRemoteSource(options.Source) {
+		return errors.New("--watch can't be used with remote sources, changes there can't be watched: " + options.Source)
+	}
+
+	// Initialize configuration (assets, directories, file types), with the settings of
+	// the configuration file
+	config, err := loadConfiguration(options.Config)
+	if err != nil {
+		return err
+	}
+	config.run.output = output
+	config.run.sharedWorkers = sharedWorkers
+
+	if options.DirMode != "" {
+		config.files.directoryMode, err = parseFileMode(options.DirMode)
+		if err != nil {
+			return err
+		}
+	}
+
+	if options.FileMode != "" {
+		config.files.fileMode, err = parseFileMode(options.FileMode)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Remote sources are mirrored locally, and the gallery built from the mirror
+	if isRemoteSource(options.Source) {
+		mirrorDirectory := options.SourceMirror
+		if mirrorDirectory == "" {
+			mirrorDirectory, err = getDefaultMirrorDirectory(options.Source)
+			if err != nil {
+				return fmt.Errorf("couldn't find directory to mirror remote source to: %w", err)
+			}
+		}
+		err = mirrorRemoteSource(options.Source, mirrorDirectory, options.DryRun, config)
+		if err != nil {
+			return err
+		}
+		options.Source = mirrorDirectory
+	}
+
+	// Validate source and gallery arguments, make paths absolute
+	options.Source, options.Gallery, err = validateSourceAndGallery(options.Source, options.Gallery)
+	if err != nil {
+		return err
+	}
+
+	config.media.minRating = options.MinRating
+	config.media.excludeKeywords = options.ExcludeKey
+	config.media.excludePeople = options.ExcludePerson
+	config.files.attachmentExts = parseAttachmentExtensions(options.Attachments)
+	config.media.videoExtensions = append(config.media.videoExtensions, options.VideoExts...)
+	if err := registerVideoExtensions(config.media.videoExtensions, config); err != nil {
+		return err
+	}
+	config.media.probeVideos = options.ProbeVideos
+	config.media.sniffContents = !options.NoSniff
+	config.verbose = options.Verbose || options.Logfile != ""
+	config.media.ffmpegThreads = options.FFmpegThreads
+
+	if !isVideoProfile(options.VideoProfile) {
+		return errors.New("invalid video profile, must be compatibility or efficiency: " + options.VideoProfile)
+	}
+	config.media.videoProfile = options.VideoProfile
+	config.files.videoExtension = getVideoExtension(options.VideoProfile)
+
+	if !isImageEngine(options.ImageEngine) {
+		return errors.New("invalid image engine, must be one of " + getImageEngineNames() + ": " + options.ImageEngine)
+	}
+	if !isVideoEngine(options.VideoEngine) {
+		return errors.New("invalid video engine, must be one of " + getVideoEngineNames() + ": " + options.VideoEngine)
+	}
+	config.media.imageEngine = options.ImageEngine
+	config.media.videoEngine = options.VideoEngine
+
+	if options.Prefetch < 0 {
+		return fmt.Errorf("invalid prefetch, must be a number of files: %d", options.Prefetch)
+	}
+	config.prefetch = options.Prefetch
+	config.assets.timeline = options.Timeline || options.Calendar
+	config.assets.calendar = options.Calendar
+	config.assets.albumTree = options.AlbumTree
+	config.assets.contactSheet = options.ContactSheet
+	config.assets.proofing = options.Proofing || options.ProofingEmail != ""
+	config.assets.proofingEmail = options.ProofingEmail
+
+	if options.SharedDir != "" && options.SharedURL == "" {
+		return errors.New("--shared-assets-dir needs --shared-assets-url")
+	}
+	if options.SharedURL != "" {
+		config.assets.sharedURL, err = getSharedAssetsURL(options.SharedURL, config)
+		if err != nil {
+			return err
+		}
+	}
+	config.media.faces = options.Faces
+	config.media.albumMap = options.Map
+	config.media.trackStats = options.TrackStats
+	config.media.astronomy = options.Astronomy
+	config.assets.liteLink = options.Lite
+	config.files.webp = options.WebP
+
+	config.files.imageExtension = getImageFormatExtension(options.ImageFormat)
+	if config.files.imageExtension == "" {
+		return errors.New("invalid image format, must be jpeg, webp or avif: " + options.ImageFormat)
+	}
+	if options.Densities != "" {
+		densities, err := parseThumbnailDensities(options.Densities)
+		if err != nil {
+			return err
+		}
+		config.media.densities = densities
+	}
+	if config.files.webp && options.ImageFormat != "jpeg" {
+		return errors.New("--webp only adds WebP versions of JPEG photos, it can't be used with --image-format " + options.ImageFormat)
+	}
+
+	if !isValidHTMLFilename(options.HTMLFile) {
+		return errors.New("invalid HTML filename, must be a .html or .htm filename not used by other pages: " + options.HTMLFile)
+	}
+	config.assets.htmlFile = options.HTMLFile
+
+	if options.Adopt != "" {
+		if !isDirectory(options.Adopt) {
+			return errors.New("gallery directory to adopt doesn't exist: " + options.Adopt)
+		}
+		config.files.adoptDir, _ = filepath.Abs(options.Adopt)
+	}
+
+	if options.IconPhoto != "" {
+		if !isImageFile(options.IconPhoto, config) || !exists(options.IconPhoto) {
+			return errors.New("icon photo isn't an existing image: " + options.IconPhoto)
+		}
+		config.assets.iconPhoto, _ = filepath.Abs(options.IconPhoto)
+	}
+
+	if options.Timezone != "" {
+		location, err := time.LoadLocation(options.Timezone)
+		if err != nil {
+			return fmt.Errorf("invalid timezone %s: %w", options.Timezone, err)
+		}
+		config.media.timezone = location
+	}
+
+	timeOffsets, err := parseTimeOffsets(options.TimeOffset)
+	if err != nil {
+		return err
+	}
+	config.media.timeOffsets = timeOffsets
+
+	if options.Sort != "name" && options.Sort != "date" {
+		return errors.New("invalid sort order, must be name or date: " + options.Sort)
+	}
+	config.media.sortOrder = options.Sort
+
+	if !isNamePolicy(options.OutputNames) {
+		return errors.New("invalid output names, must be preserve, lowercase or slug: " + options.OutputNames)
+	}
+	config.files.namePolicy = options.OutputNames
+
+	if !isOutputProfile(options.OutputProfile) {
+		return errors.New("invalid output profile, must be web or dlna: " + options.OutputProfile)
+	}
+	if options.OutputProfile == outputProfileDLNA {
+		err = applyDLNAProfile(&config)
+		if err != nil {
+			return err
+		}
+		err = checkDLNADirectoryNames(options.Source, options.Gallery, config)
+		if err != nil {
+			return err
+		}
+	}
+
+	if options.SplitAlbums != "" {
+		config.media.splitByMonth, config.media.splitChunkSize, err = parseSplitAlbums(options.SplitAlbums)
+		if err != nil {
+			return err
+		}
+	}
+	if options.SplitMinFiles > 0 {
+		config.media.splitMinFiles = options.SplitMinFiles
+	}
+
+	// Protect the source from configuration mistakes and bugs
+	if options.Paranoid {
+		config.files.protectedDir = resolvePath(options.Source)
+		galleryPath := resolvePath(options.Gallery)
+		if isInsideDirectory(galleryPath, config.files.protectedDir) || isInsideDirectory(config.files.protectedDir, galleryPath) {
+			return errors.New("gallery and source directories overlap, refusing in paranoid mode: " + options.Gallery + " " + options.Source)
+		}
+	}
+
+	if options.CopyOriginals {
+		options.Originals = originalsCopy
+	}
+	if options.Originals != "" {
+		if !isOriginalsMode(options.Originals) {
+			return errors.New("invalid originals, must be symlink, copy or hardlink: " + options.Originals)
+		}
+		config.files.originals = options.Originals
+	}
+
+	// Hard linked originals are the source files themselves, so the gallery can't be
+	// kept from changing them
+	if options.Paranoid && config.files.originals == originalsHardlink {
+		return errors.New("--originals hardlink can't be used with --paranoid, hard linked originals are the source files themselves")
+	}
+
+	if options.Owner != "" {
+		config.files.uid, config.files.gid, err = parseOwner(options.Owner)
+		if err != nil {
+			return err
+		}
+	}
+	config.assets.liveReload = options.LiveReload
+	config.assets.inlineAssets = options.InlineAssets
+
+	// Parse the embedded templates up front, so errors surface before anything's changed
+	cookedTemplates, err := parseTemplates(config)
+	if err != nil {
+		return err
+	}
+
+	// Compile filename pattern used to group flat exports into albums
+	flatPattern := regexp.MustCompile(defaultFlatPattern)
+	if options.FlatPattern != "" {
+		flatPattern, err = regexp.Compile(options.FlatPattern)
+		if err != nil {
+			return fmt.Errorf("invalid flat export pattern %s: %w", options.FlatPattern, err)
+		}
+	}
+
+	// Open log file if parameter provided
+	if options.Logfile != "" {
+		fmt.Fprintln(output, "Logfile:", options.Logfile)
+		err = guardSource(options.Logfile, config)
+		if err != nil {
+			return err
+		}
+		logHandle, err := os.OpenFile(options.Logfile, os.O_RDWR|os.O_CREATE|os.O_APPEND, config.files.fileMode)
+		if err != nil {
+			return fmt.Errorf("error opening logfile %s: %w", options.Logfile, err)
+		}
+		defer logHandle.Close()
+		defer log.SetOutput(log.Writer())
+		log.SetOutput(logHandle)
+	}
+
+	fmt.Fprintln(output, "Creating gallery, source:", options.Source, "gallery:", options.Gallery)
+
+	// Start libvips, also in dry run mode so we can tell which file types it supports
+	var vipsConfig *vips.Config
+	if options.Verbose {
+		vips.LoggingSettings(nil, vips.LogLevelDebug)
+		vipsConfig = &vips.Config{
+			CacheTrace:   false,
+			CollectStats: false,
+			ReportLeaks:  true}
+	} else {
+		vips.LoggingSettings(nil, vips.LogLevelError)
+	}
+	if options.LowMemory {
+		if vipsConfig == nil {
+			vipsConfig = &vips.Config{}
+		}
+		applyLowMemoryProfile(&config, vipsConfig)
+	}
+	// libvips can't be restarted once shut down, so it's kept running for the next gallery
+	vips.Startup(vipsConfig)
+
+	// Media files are built in a workspace of this run and moved into the gallery when done
+	if !options.DryRun {
+		config.files.workspaceDir, err = createWorkspace(options.Workspace)
+		if err != nil {
+			return fmt.Errorf("couldn't create workspace: %w", err)
+		}
+		defer removeWorkspace(config.files.workspaceDir)
+		err = guardSource(config.files.workspaceDir, config)
+		if err != nil {
+			return err
+		}
+	}
+
+	thisPipeline := pipeline{
+		noVideos:       options.NoVideos,
+		dryRun:         options.DryRun,
+		cleanUp:        options.CleanUp,
+		takeout:        options.Takeout,
+		skipUnreadable: options.SkipUnread,
+		config:         config,
+	}
+
+	// Flat export directories are split into albums before comparing to the gallery
+	if options.Flat {
+		thisPipeline.flatPattern = flatPattern
+	}
+
+	// Without HEIF support in libvips, convert HEIF files with heif-convert or skip them
+	if !vips.IsTypeSupported(vips.ImageTypeHEIF) {
+		config.media.heifConverter = findHEIFConverter(options.HEIFConvert)
+		thisPipeline.config = config
+		thisPipeline.heifFallback = true
+	}
+
+	if !options.DryRun && options.Progress != nil {
+		// The progress bar is started once the first file is queued, its total grows with the queue
+		thisPipeline.progressBar = pb.New64(0).Set(pb.Bytes, true).SetWriter(options.Progress)
+	}
+
+	// Gallery files built with other settings than the current ones are found with the
+	// build manifest of the previous run
+	manifest := buildManifest{Version: getVersion(), Commit: commit, Settings: createBuildSettings(config), Files: make(map[string]artifactSettings)}
+	if previousManifest, ok := readBuildManifest(options.Gallery); ok {
+		thisPipeline.previousManifest = &previousManifest
+	}
+	thisPipeline.rebuildOutdated = options.RebuildOut
+	thisPipeline.manifestFiles = manifest.Files
+
+	// Partial runs take the albums they don't scan from the previous run
+	partial := options.Root != ""
+	if partial {
+		if options.Flat {
+			return errors.New("--root can't be used with --flat, flat exports have all their files in the source root")
+		}
+		thisPipeline.root, err = validatePartialRoot(options.Source, options.Root)
+		if err != nil {
+			return err
+		}
+		if thisPipeline.previousManifest == nil || thisPipeline.previousManifest.Albums == nil {
+			return errors.New("--root needs a gallery built by a full run of this version of fastgallery first: " + options.Gallery)
+		}
+	}
+
+	// Abort the run once ctx is cancelled, e.g. on ctrl-C
+	defer abortOnCancel(ctx, config)()
+
+	// Scan the source and gallery, reading metadata from album.yaml files, XMP sidecars,
+	// caption files, Takeout archives and EXIF, and transform new media files on the go
+	fmt.Fprintln(output, "Finding and updating media files...")
+	source, gallery, err := processGallery(options.Source, options.Gallery, &thisPipeline)
+	if err != nil {
+		return err
+	}
+	applyLandingPageArgs(&source, options.Title, options.Hero, options.Intro)
+	var previousAlbums map[string]albumStatsRecord
+	if thisPipeline.previousManifest != nil {
+		previousAlbums = thisPipeline.previousManifest.Albums
+	}
+	manifest.Albums = make(map[string]albumStatsRecord)
+	collectAlbumRecords(source, previousAlbums, manifest.Albums, config)
+
+	if thisPipeline.progressBar != nil && thisPipeline.progressBar.IsStarted() {
+		thisPipeline.progressBar.Finish()
+	}
+	warnHEIFFallback(thisPipeline.newHEIFFiles, config.media.heifConverter, options.HEIFConvert, output)
+	if thisPipeline.unreadableFiles > 0 {
+		log.Println("Skipped", thisPipeline.unreadableFiles, "source files without read permission")
+	}
+	if thisPipeline.outdatedFiles > 0 && options.RebuildOut {
+		fmt.Fprintln(output, "Rebuilt", thisPipeline.outdatedFiles, "media files built with outdated settings")
+	} else if thisPipeline.outdatedFiles > 0 {
+		fmt.Fprintln(output, "Warning:", thisPipeline.outdatedFiles, "media files were built with other settings, use --rebuild-outdated to update them")
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if failedFiles := config.run.reportFailures(); failedFiles > 0 {
+		fmt.Fprintln(output, "Couldn't transform", failedFiles, "media files, see the log for details")
+	}
+	if config.run.isDiskFull() {
+		return errDiskFull
+	}
+
+	// If there were changes in the source, update the web assets as well
+	newSourceFiles := countChanges(source, config)
+
+	if newSourceFiles > 0 {
+		log.Println("Updated", newSourceFiles, "media files.")
+
+		// Copy updated web assets (JS, CSS, icons, etc) into gallery root
+		err = copyRootAssets(gallery, options.DryRun, config)
+		if err != nil {
+			return err
+		}
+
+		// Copy PWA web manifest and fill-in relevant details
+		err = createPWAManifest(gallery, source, cookedTemplates.manifest, options.DryRun, config)
+		if err != nil {
+			return err
+		}
+		// TODO move asset creation with HTML and do version comparison
+
+		fmt.Fprintln(output, "All media files updated!")
+	} else {
+		fmt.Fprintln(output, "All media files already up to date!")
+	}
+
+	// Publish this version's web assets for all the galleries sharing them, if asked to
+	if options.SharedDir != "" {
+		err = exportSharedAssets(options.SharedDir, options.DryRun, config)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Update the HTML files of albums whose files, metadata or pages' settings have changed
+	// since the previous run, and missing HTML files
+	var previousPages map[string]string
+	if thisPipeline.previousManifest != nil {
+		previousPages = thisPipeline.previousManifest.Pages
+	}
+	fmt.Fprintln(output, "Updating HTML files...")
+	var renderedPages int
+	manifest.Pages, renderedPages, err = updateHTMLFiles(source, gallery, cookedTemplates.html, previousPages, options.DryRun, config)
+	if err != nil {
+		return err
+	}
+	writePageHashes(gallery.absPath, manifest.Pages, options.DryRun, config)
+	if renderedPages > 0 {
+		if config.assets.liveReload {
+			touchLiveReloadFile(gallery, options.DryRun, config)
+		}
+		fmt.Fprintln(output, "Updated", renderedPages, "HTML files!")
+	} else {
+		fmt.Fprintln(output, "All HTML files already up to date!")
+	}
+
+	// Pages across all albums can't be updated from a partial tree
+	if partial {
+		fmt.Fprintln(output, "Partial run, only updated", options.Root, "and the albums above it; other pages across the gallery are left as they were")
+	}
+
+	// Export a self-contained copy of the root album, if asked to
+	if options.SingleFile != "" && !partial {
+		fmt.Fprintln(output, "Exporting single-file gallery...")
+		err = exportSingleFile(source, gallery.absPath, options.SingleFile, cookedTemplates.singleFile, options.InlineFull, options.DryRun, config)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Write the timeline of all photos and the calendar linking to it, if asked to
+	if config.assets.timeline && !partial {
+		fmt.Fprintln(output, "Updating timeline...")
+		writeTimeline(source, gallery, cookedTemplates.timeline, options.DryRun, config)
+	}
+	if config.assets.calendar && !partial {
+		writeCalendar(source, gallery, cookedTemplates.calendar, options.DryRun, config)
+	}
+
+	// Write the contact sheets of albums for proofing on paper, if asked to
+	if config.assets.contactSheet && !partial {
+		fmt.Fprintln(output, "Updating contact sheets...")
+		writeContactSheets(source, gallery, cookedTemplates.contact, options.DryRun, config)
+	}
+
+	// Write the tree of albums for the sidebar, if asked to
+	if config.assets.albumTree && !partial {
+		err = writeAlbumTree(source, gallery, options.DryRun, config)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Write the pages of people tagged in the photos, if asked to
+	if config.media.faces && !partial {
+		fmt.Fprintln(output, "Updating people pages...")
+		writePeople(source, gallery, cookedTemplates.people, options.DryRun, config)
+	}
+
+	// Write the search index and push it to the search engine, if asked to
+	if options.SearchIndex || options.SearchPost != "" && !partial {
+		fmt.Fprintln(output, "Updating search index...")
+		indexPath, err := writeSearchIndex(source, gallery, options.DryRun, config)
+		if err != nil {
+			return err
+		}
+		if options.SearchPost != "" {
+			err = postSearchIndex(indexPath, options.SearchPost, options.SearchHead, options.DryRun)
+			if err != nil {
+				log.Println("couldn't post search index:", err.Error())
+			}
+		}
+	}
+
+	// Clean up any removed gallery media files
+	if options.CleanUp {
+		fmt.Fprintln(output, "Cleaning up gallery...")
+		// TODO restructure cleanUp to check here whether there's stale files, for better output
+		cleanUp(gallery, options.DryRun, config)
+		cleanAttachments(source, gallery.absPath, options.DryRun, config)
+		cleanMusic(source, gallery.absPath, options.DryRun, config)
+		fmt.Fprintln(output, "Gallery clean!")
+	}
+
+	// Build the lite version of the gallery for slow connections, if asked to
+	if options.Lite && !partial {
+		fmt.Fprintln(output, "Updating lite gallery...")
+		var previousLitePages map[string]string
+		if thisPipeline.previousManifest != nil {
+			previousLitePages = thisPipeline.previousManifest.LitePages
+		}
+		manifest.LitePages, err = buildLiteGallery(options.Source, options.Gallery, thisPipeline, cookedTemplates.html, previousLitePages, options.Title, options.Hero, options.Intro, config)
+		if err != nil {
+			return err
+		}
+	} else if partial {
+		manifest.LitePages = thisPipeline.previousManifest.LitePages
+	}
+
+	// Check that the generated pages don't link to missing files, e.g. due to clashing
+	// file names or deleted gallery files
+	if !options.DryRun && !options.NoCheck {
+		fmt.Fprintln(output, "Checking gallery integrity...")
+		dangling := checkGalleryIntegrity(gallery.absPath, config)
+		if options.Lite {
+			dangling += checkGalleryIntegrity(filepath.Join(gallery.absPath, config.files.liteDir), config)
+		}
+		if dangling > 0 {
+			fmt.Fprintln(output, "Found", dangling, "dangling references in the gallery, see the log for them.")
+		} else {
+			fmt.Fprintln(output, "Gallery intact!")
+		}
+	}
+
+	// Deploy scripts can upload just the files which have changed since the last run
+	if !options.DryRun && options.Changes != "" {
+		changesPath, _ := filepath.Abs(options.Changes)
+		inventory, err := createGalleryInventory(gallery.absPath, []string{changesPath})
+		if err != nil {
+			return fmt.Errorf("couldn't list gallery files %s: %w", gallery.absPath, err)
+		}
+
+		var previousInventory map[string]fileState
+		if thisPipeline.previousManifest != nil {
+			previousInventory = thisPipeline.previousManifest.Inventory
+		}
+		added, changed, removed := compareInventories(previousInventory, inventory)
+		err = os.WriteFile(changesPath, []byte(formatChangeList(added, changed, removed)), config.files.fileMode)
+		if err != nil {
+			return fmt.Errorf("couldn't write list of changes %s: %w", changesPath, err)
+		}
+		fmt.Fprintln(output, "Listed", len(added), "added,", len(changed), "modified and", len(removed), "deleted gallery files in", changesPath)
+		manifest.Inventory = inventory
+	} else if thisPipeline.previousManifest != nil {
+		// Changes of runs in between are listed on the next run with --changes
+		manifest.Inventory = thisPipeline.previousManifest.Inventory
+	}
+
+	manifest.Built = time.Now()
+	writeBuildManifest(gallery.absPath, manifest, options.DryRun, config)
+
+	// Only now that everything's written, gallery directory times can be set for good
+	if options.PreserveTimes {
+		preserveDirectoryTimes(source, gallery.absPath, options.DryRun, config)
+	}
+
+	// Let whoever's watching unattended builds know how it went
+	if options.NotifyWebhook != "" {
+		report := createRunReport(source, gallery, started, newSourceFiles, config)
+		err = postRunReport(report, options.NotifyWebhook, options.DryRun)
+		if err != nil {
+			log.Println("couldn't post run report:", err.Error())
+		}
+	}
+
+	// Checking for updates is opt-in, fastgallery doesn't contact anyone on its own otherwise
+	if options.CheckUpdates {
+		latest, err := checkForUpdate(latestReleaseURL)
+		if err != nil {
+			log.Println("couldn't check for updates:", err.Error())
+		} else if latest != "" {
+			fmt.Fprintln(output, "fastgallery", latest, "is available, this is", getVersion())
+		}
+	}
+	return nil
+}
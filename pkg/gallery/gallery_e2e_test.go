@@ -1,4 +1,4 @@
-package main
+package gallery
 
 import (
 	"os"
@@ -27,20 +27,15 @@ func TestE2E(t *testing.T) {
 
 	config := initializeConfig()
 
-	source := createDirectoryTree(filepath.Join(tempDir, "source"), "", true)
-	gallery := createDirectoryTree(filepath.Join(tempDir, "gallery"), "", true)
-	compareDirectoryTrees(&source, &gallery, config)
-	sourceChanges := countChanges(source, config)
-	assert.EqualValues(t, 9, sourceChanges)
-	galleryChanges := countChanges(gallery, config)
-	assert.EqualValues(t, 0, galleryChanges)
-
 	vips.LoggingSettings(nil, vips.LogLevelWarning)
 	//log.SetOutput(io.Discard)
 	vips.Startup(nil)
 
-	createDirectory(gallery.absPath, false, config.files.directoryMode)
-	updateMediaFiles(0, source, gallery, false, true, config, nil)
+	source, gallery, _ := processGallery(filepath.Join(tempDir, "source"), filepath.Join(tempDir, "gallery"), &pipeline{noVideos: true, cleanUp: true, config: config})
+	sourceChanges := countChanges(source, config)
+	assert.EqualValues(t, 9, sourceChanges)
+	galleryChanges := countChanges(gallery, config)
+	assert.EqualValues(t, 0, galleryChanges)
 
 	// Gallery created, test that files are in order
 	fullsizeFilename1 := filepath.Join(tempDir, "gallery", config.files.fullsizeDir, "panorama.heic")
@@ -62,7 +57,7 @@ func TestE2E(t *testing.T) {
 	assert.EqualValues(t, true, missingHTMLFiles)
 
 	// create HTML
-	updateHTMLFiles(0, source, gallery, false, true, config)
+	updateHTMLFiles(source, gallery, testTemplates(t, config).html, nil, false, config)
 
 	missingHTMLFiles = findMissingHTMLFiles(gallery, config)
 	assert.EqualValues(t, false, missingHTMLFiles)
@@ -80,18 +75,12 @@ func TestE2E(t *testing.T) {
 	err = os.RemoveAll(sourceFilename3)
 	assert.NoError(t, err)
 
-	source = createDirectoryTree(filepath.Join(tempDir, "source"), "", true)
-	gallery = createDirectoryTree(filepath.Join(tempDir, "gallery"), "", true)
-	compareDirectoryTrees(&source, &gallery, config)
+	// update gallery, its stale files are left for the cleanup below
+	source, gallery, _ = processGallery(filepath.Join(tempDir, "source"), filepath.Join(tempDir, "gallery"), &pipeline{noVideos: true, cleanUp: true, config: config})
 	sourceChanges = countChanges(source, config)
 	assert.EqualValues(t, 2, sourceChanges)
 	galleryChanges = countChanges(gallery, config)
 	assert.EqualValues(t, 3, galleryChanges)
-
-	// Test hasDirectoryChanged and logic to check whether to update html
-
-	// update without cleanup in gallery
-	updateMediaFiles(0, source, gallery, false, true, config, nil)
 	assert.FileExists(t, fullsizeFilename2)
 
 	// cleanup gallery
@@ -99,7 +88,7 @@ func TestE2E(t *testing.T) {
 	assert.NoFileExists(t, fullsizeFilename2)
 
 	// update HTML
-	updateHTMLFiles(0, source, gallery, false, true, config)
+	updateHTMLFiles(source, gallery, testTemplates(t, config).html, nil, false, config)
 
 	missingHTMLFiles = findMissingHTMLFiles(gallery, config)
 	assert.EqualValues(t, false, missingHTMLFiles)
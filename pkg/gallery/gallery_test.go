@@ -0,0 +1,852 @@
+package gallery
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alexflint/go-arg"
+	"github.com/stretchr/testify/assert"
+)
+
+// testTemplates parses the embedded templates, failing the test on errors
+func testTemplates(t *testing.T, config configuration) templates {
+	cookedTemplates, err := parseTemplates(config)
+	assert.NoError(t, err)
+	return cookedTemplates
+}
+
+func TestNewOptions(t *testing.T) {
+	options := NewOptions("-source", "gallery")
+	assert.Equal(t, "-source", options.Source)
+	assert.Equal(t, "gallery", options.Gallery)
+	assert.Equal(t, "jpeg", options.ImageFormat)
+	assert.Equal(t, "index.html", options.HTMLFile)
+	assert.False(t, options.CleanUp)
+
+	// The defaults are the ones of the command-line options
+	var parsed Options
+	parser, err := arg.NewParser(arg.Config{Program: "fastgallery"}, &parsed)
+	assert.NoError(t, err)
+	assert.NoError(t, parser.Parse([]string{"source", "gallery"}))
+	assert.Equal(t, parsed, NewOptions("source", "gallery"))
+}
+
+func TestValidateSourceAndGallery(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	_, _, err = validateSourceAndGallery(tempDir+"/nonexistent", tempDir+"/gallery")
+	assert.Error(t, err)
+
+	_, _, err = validateSourceAndGallery(tempDir, tempDir+"/gallery/nonexistent")
+	assert.Error(t, err)
+
+	_, _, err = validateSourceAndGallery(tempDir, tempDir+"/gallery")
+	assert.NoError(t, err)
+
+	// Cleaning up the gallery would delete a source inside it
+	err = os.MkdirAll(tempDir+"/gallery/source", 0755)
+	assert.NoError(t, err)
+	_, _, err = validateSourceAndGallery(tempDir+"/gallery/source", tempDir+"/gallery")
+	assert.Error(t, err)
+
+	_, _, err = validateSourceAndGallery(tempDir, tempDir)
+	assert.Error(t, err)
+}
+
+func TestIsDirectory(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	err = os.Mkdir(tempDir+"/subdir", 0755)
+	if err != nil {
+		t.Error("couldn't create subdirectory")
+	}
+	defer os.RemoveAll(tempDir + "/subdir")
+	assert.True(t, isDirectory(tempDir+"/subdir"))
+
+	err = os.Symlink(tempDir+"/subdir", tempDir+"/symlink")
+	if err != nil {
+		t.Error("couldn't create symlink")
+	}
+	defer os.RemoveAll(tempDir + "/symlink")
+	assert.True(t, isDirectory(tempDir+"/symlink"))
+
+	emptyFile, err := os.Create(tempDir + "/file")
+	if err != nil {
+		t.Error("couldn't create symlink")
+	}
+	defer emptyFile.Close()
+	defer os.RemoveAll(tempDir + "/file")
+	assert.False(t, isDirectory(tempDir+"/file"))
+
+	assert.False(t, isDirectory(tempDir+"/nonexistent"))
+}
+
+func TestLogProgress(t *testing.T) {
+	var logBuffer bytes.Buffer
+	log.SetOutput(&logBuffer)
+	defer log.SetOutput(os.Stderr)
+
+	config := initializeConfig()
+	logProgress(config, "Converted media file:", "a.jpg")
+	assert.Empty(t, logBuffer.String())
+
+	config.verbose = true
+	logProgress(config, "Converted media file:", "a.jpg")
+	assert.Contains(t, logBuffer.String(), "Converted media file: a.jpg")
+}
+
+func TestExists(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	emptyFile, err := os.Create(tempDir + "/file")
+	if err != nil {
+		t.Error("couldn't create symlink")
+	}
+	defer emptyFile.Close()
+	defer os.RemoveAll(tempDir + "/file")
+	assert.True(t, exists(tempDir+"/file"))
+
+	assert.False(t, exists(tempDir+"/nonexistent"))
+}
+
+func TestIsEmptyDirectory(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	assert.True(t, isEmptyDirectory(tempDir))
+	assert.True(t, isEmptyDirectory(tempDir+"/nonexistent"))
+
+	err = os.WriteFile(tempDir+"/file", []byte{}, 0644)
+	assert.NoError(t, err)
+	assert.False(t, isEmptyDirectory(tempDir))
+}
+
+func TestReadDirectoryBatches(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	for i := 0; i < readDirectoryBatchSize+1; i++ {
+		err = os.WriteFile(filepath.Join(tempDir, strconv.Itoa(i)+".jpg"), []byte{}, 0644)
+		assert.NoError(t, err)
+	}
+
+	batches, entries := 0, 0
+	err = readDirectoryBatches(tempDir, func(batch []os.DirEntry) bool {
+		batches++
+		entries = entries + len(batch)
+		return true
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, batches)
+	assert.EqualValues(t, readDirectoryBatchSize+1, entries)
+
+	// Stops reading when asked to
+	batches = 0
+	err = readDirectoryBatches(tempDir, func(batch []os.DirEntry) bool {
+		batches++
+		return false
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, batches)
+
+	err = readDirectoryBatches(tempDir+"/nonexistent", func(batch []os.DirEntry) bool { return true })
+	assert.Error(t, err)
+
+	// Scanned files are sorted regardless of directory order
+	tree, _ := scanDirectory(tempDir, "", true, initializeConfig())
+	assert.Len(t, tree.files, readDirectoryBatchSize+1)
+	assert.EqualValues(t, "0.jpg", tree.files[0].name)
+	assert.EqualValues(t, "1.jpg", tree.files[1].name)
+}
+
+func TestDirHasMediaFiles(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	emptyFile, err := os.Create(tempDir + "/file.raw")
+	if err != nil {
+		t.Error("couldn't create symlink")
+	}
+	defer emptyFile.Close()
+	defer os.RemoveAll(tempDir + "/file.raw")
+
+	assert.True(t, dirHasMediafiles(tempDir, false, initializeConfig()))
+}
+
+func TestDirHasMediaFilesFailing(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	emptyFile, err := os.Create(tempDir + "/file.txt")
+	if err != nil {
+		t.Error("couldn't create symlink")
+	}
+	defer emptyFile.Close()
+	defer os.RemoveAll(tempDir + "/file.txt")
+
+	assert.False(t, dirHasMediafiles(tempDir, false, initializeConfig()))
+}
+
+func TestDirHasMediaFilesRecurse(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	err = os.Mkdir(tempDir+"/subdir", 0755)
+	if err != nil {
+		t.Error("couldn't create subdirectory")
+	}
+	defer os.RemoveAll(tempDir + "/subdir")
+
+	emptyFile, err := os.Create(tempDir + "/subdir/file.jpg")
+	if err != nil {
+		t.Error("couldn't create symlink")
+	}
+	defer emptyFile.Close()
+	defer os.RemoveAll(tempDir + "/subdir/file.jpg")
+
+	assert.True(t, dirHasMediafiles(tempDir, false, initializeConfig()))
+}
+
+func TestDirHasMediaFilesRecurseFailing(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	err = os.Mkdir(tempDir+"/subdir", 0755)
+	if err != nil {
+		t.Error("couldn't create subdirectory")
+	}
+	defer os.RemoveAll(tempDir + "/subdir")
+
+	emptyFile, err := os.Create(tempDir + "/subdir/file.txt")
+	if err != nil {
+		t.Error("couldn't create symlink")
+	}
+	defer emptyFile.Close()
+	defer os.RemoveAll(tempDir + "/subdir/file.txt")
+
+	assert.False(t, dirHasMediafiles(tempDir, false, initializeConfig()))
+}
+
+func TestIsXxxFile(t *testing.T) {
+	config := initializeConfig()
+	assert.True(t, isVideoFile("test.mp4", config))
+	assert.False(t, isVideoFile("test.jpg", config))
+	assert.False(t, isVideoFile("test.txt", config))
+	assert.True(t, isImageFile("test.jpg", config))
+	assert.False(t, isImageFile("test.mp4", config))
+	assert.False(t, isImageFile("test.txt", config))
+	assert.True(t, isMediaFile("test.mp4", false, config))
+	assert.True(t, isMediaFile("test.jpg", false, config))
+	assert.False(t, isMediaFile("test.txt", false, config))
+	assert.False(t, isMediaFile("test.mp4", true, config))
+}
+
+func TestCopyRootAssets(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	var tempGallery directory
+	tempGallery.absPath = tempDir
+
+	config := initializeConfig()
+
+	copyRootAssets(tempGallery, false, config)
+
+	assert.FileExists(t, tempDir+"/back.png")
+	assert.FileExists(t, tempDir+"/folder.png")
+	assert.FileExists(t, tempDir+"/fastgallery.css")
+	assert.FileExists(t, tempDir+"/fastgallery.js")
+	assert.FileExists(t, tempDir+"/feather.min.js")
+	assert.FileExists(t, tempDir+"/primer.css")
+}
+
+func TestStripExtension(t *testing.T) {
+	assert.Equal(t, "file", stripExtension("file.jpg"))
+	assert.NotEqual(t, "file", stripExtension("file/"))
+}
+
+func TestReservedDirectory(t *testing.T) {
+	myConfig := initializeConfig()
+
+	assert.True(t, reservedDirectory(myConfig.files.thumbnailDir, myConfig))
+	assert.True(t, reservedDirectory(myConfig.files.fullsizeDir, myConfig))
+	assert.True(t, reservedDirectory(myConfig.files.originalDir, myConfig))
+	assert.False(t, reservedDirectory("diipadaapa", myConfig))
+}
+
+func TestCreateDirectory(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	myConfig := initializeConfig()
+
+	createDirectory(tempDir+"/xyz", true, myConfig)
+	assert.NoDirExists(t, tempDir+"/xyz")
+
+	createDirectory(tempDir+"/xyz", false, myConfig)
+	assert.DirExists(t, tempDir+"/xyz")
+	os.RemoveAll(tempDir + "/xyz")
+}
+
+func TestPreserveDirectoryTimes(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+	config := initializeConfig()
+
+	err = os.MkdirAll(filepath.Join(tempDir, "subdir"), 0755)
+	assert.NoError(t, err)
+
+	modTime := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+	source := directory{
+		modTime: modTime,
+		subdirectories: []directory{{
+			relPath: "subdir",
+			modTime: modTime.Add(time.Hour),
+		}},
+	}
+
+	preserveDirectoryTimes(source, tempDir, true, config)
+	stat, err := os.Stat(filepath.Join(tempDir, "subdir"))
+	assert.NoError(t, err)
+	assert.False(t, stat.ModTime().Equal(modTime.Add(time.Hour)))
+
+	preserveDirectoryTimes(source, tempDir, false, config)
+	stat, err = os.Stat(tempDir)
+	assert.NoError(t, err)
+	assert.True(t, stat.ModTime().Equal(modTime))
+	stat, err = os.Stat(filepath.Join(tempDir, "subdir"))
+	assert.NoError(t, err)
+	assert.True(t, stat.ModTime().Equal(modTime.Add(time.Hour)))
+}
+
+func TestCreateDirectoryTree(t *testing.T) {
+	myConfig := initializeConfig()
+
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Create source directory with two files, a subdir with third file
+	err = os.Mkdir(tempDir+"/source", 0755)
+	if err != nil {
+		t.Error("couldn't create source subdirectory")
+	}
+	defer os.RemoveAll(tempDir + "/source")
+
+	emptyFile, err := os.Create(tempDir + "/source/file.jpg")
+	if err != nil {
+		t.Error("couldn't create file")
+	}
+	defer emptyFile.Close()
+	defer os.RemoveAll(tempDir + "/source/file.jpg")
+
+	emptyFile2, err := os.Create(tempDir + "/source/file2.jpg")
+	if err != nil {
+		t.Error("couldn't create file2")
+	}
+	defer emptyFile2.Close()
+	defer os.RemoveAll(tempDir + "/source/file2.jpg")
+
+	err = os.Mkdir(tempDir+"/source/subdir", 0755)
+	if err != nil {
+		t.Error("couldn't create source subdirectory's subdirectory")
+	}
+	defer os.RemoveAll(tempDir + "/source/subdir")
+
+	emptyFile3, err := os.Create(tempDir + "/source/subdir/file.jpg")
+	if err != nil {
+		t.Error("couldn't create file in subdir")
+	}
+	defer emptyFile3.Close()
+	defer os.RemoveAll(tempDir + "/source/subdir/file.jpg")
+
+	// Create gallery subdirectory with one matching file
+	err = os.Mkdir(tempDir+"/gallery", 0755)
+	if err != nil {
+		t.Error("couldn't create gallery subdirectory")
+	}
+	defer os.RemoveAll(tempDir + "/gallery")
+
+	err = os.Mkdir(tempDir+"/gallery/"+myConfig.files.fullsizeDir, 0755)
+	if err != nil {
+		t.Error("couldn't create gallery subdirectory for fullsize")
+	}
+	defer os.RemoveAll(tempDir + "/gallery/" + myConfig.files.fullsizeDir)
+
+	err = os.Mkdir(tempDir+"/gallery/"+myConfig.files.thumbnailDir, 0755)
+	if err != nil {
+		t.Error("couldn't create gallery subdirectory for thumbnail")
+	}
+	defer os.RemoveAll(tempDir + "/gallery/" + myConfig.files.thumbnailDir)
+
+	err = os.Mkdir(tempDir+"/gallery/"+myConfig.files.originalDir, 0755)
+	if err != nil {
+		t.Error("couldn't create gallery subdirectory for original")
+	}
+	defer os.RemoveAll(tempDir + "/gallery/" + myConfig.files.originalDir)
+
+	emptyFile4, err := os.Create(tempDir + "/gallery/" + myConfig.files.originalDir + "/file.jpg")
+	if err != nil {
+		t.Error("couldn't create original gallery file")
+	}
+	defer emptyFile4.Close()
+	defer os.RemoveAll(tempDir + "/gallery/" + myConfig.files.originalDir + "/file.jpg")
+
+	emptyFile5, err := os.Create(tempDir + "/gallery/" + myConfig.files.thumbnailDir + "/file.jpg")
+	if err != nil {
+		t.Error("couldn't create original gallery file")
+	}
+	defer emptyFile5.Close()
+	defer os.RemoveAll(tempDir + "/gallery/" + myConfig.files.thumbnailDir + "/file.jpg")
+
+	// Ensure thumbnail file is newer than source file
+	err = os.Chtimes(tempDir+"/gallery/"+myConfig.files.thumbnailDir+"/file.jpg", time.Now(), time.Now())
+	if err != nil {
+		t.Error("couldn't change mtime/atime")
+	}
+
+	emptyFile6, err := os.Create(tempDir + "/gallery/" + myConfig.files.fullsizeDir + "/file.jpg")
+	if err != nil {
+		t.Error("couldn't create original gallery file")
+	}
+	defer emptyFile6.Close()
+	defer os.RemoveAll(tempDir + "/gallery/" + myConfig.files.fullsizeDir + "/file.jpg")
+
+	source, _ := createDirectoryTree(tempDir+"/source", "", false, myConfig)
+	gallery, _ := createDirectoryTree(tempDir+"/gallery", "", false, myConfig)
+
+	compareDirectoryTrees(&source, &gallery, myConfig)
+
+	changes := countChanges(source, myConfig)
+
+	assert.EqualValues(t, 2, changes)
+}
+
+// Disabled for now as Github CI's ffmpeg doesn't yet support force_divisible_by=2
+func testTransformFileAndVideo(t *testing.T) {
+	const videoName = "video.mp4"
+	config := initializeConfig()
+
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	err = os.Mkdir(filepath.Join(tempDir, "source"), 0755)
+	assert.NoError(t, err)
+	err = os.Mkdir(filepath.Join(tempDir, "gallery"), 0755)
+	assert.NoError(t, err)
+	err = os.Mkdir(filepath.Join(tempDir, "gallery", config.files.fullsizeDir), 0755)
+	assert.NoError(t, err)
+	err = os.Mkdir(filepath.Join(tempDir, "gallery", config.files.thumbnailDir), 0755)
+	assert.NoError(t, err)
+	err = os.Mkdir(filepath.Join(tempDir, "gallery", config.files.originalDir), 0755)
+	assert.NoError(t, err)
+
+	cpCommand := exec.Command("cp", "-r", "../../testing/source/"+videoName, filepath.Join(tempDir, "source"))
+	cpCommandOutput, err := cpCommand.CombinedOutput()
+	if len(cpCommandOutput) > 0 {
+		t.Error("cp produced output", string(cpCommandOutput))
+	}
+	if err != nil {
+		t.Error("cp error", err.Error())
+	}
+
+	thumbnailFilename, fullsizeFilename := getGalleryFilenames(videoName, config)
+
+	testJob := transformationJob{
+		filename:          videoName,
+		sourceFilepath:    filepath.Join(tempDir, "source", videoName),
+		thumbnailFilepath: filepath.Join(tempDir, "gallery", config.files.thumbnailDir, thumbnailFilename),
+		fullsizeFilepath:  filepath.Join(tempDir, "gallery", config.files.fullsizeDir, fullsizeFilename),
+		originalFilepath:  filepath.Join(tempDir, "gallery", config.files.originalDir, videoName),
+	}
+
+	transformFile(testJob, nil, config)
+	assert.FileExists(t, testJob.thumbnailFilepath)
+	assert.FileExists(t, testJob.fullsizeFilepath)
+
+	err = os.RemoveAll(testJob.thumbnailFilepath)
+	assert.NoError(t, err)
+	os.RemoveAll(testJob.fullsizeFilepath)
+	assert.NoError(t, err)
+
+	transformVideo(testJob.sourceFilepath, testJob.fullsizeFilepath, testJob.thumbnailFilepath, config)
+	assert.FileExists(t, testJob.thumbnailFilepath)
+	assert.FileExists(t, testJob.fullsizeFilepath)
+
+	err = createOriginal(testJob.sourceFilepath, testJob.originalFilepath, config)
+	assert.NoError(t, err)
+	assert.FileExists(t, testJob.originalFilepath)
+}
+
+func TestGetIconSize(t *testing.T) {
+	iconSize, err := getIconSize("/tmp/icon-48x48.png")
+	assert.NoError(t, err)
+	assert.EqualValues(t, "48x48", iconSize)
+
+	iconSize, err = getIconSize("test192x192-apple.svg")
+	assert.NoError(t, err)
+	assert.EqualValues(t, "192x192", iconSize)
+
+	iconSize, err = getIconSize("test-xicon-64x64.ico")
+	assert.NoError(t, err)
+	assert.EqualValues(t, "64x64", iconSize)
+
+	iconSize, err = getIconSize("test-xicon.ico")
+	assert.Error(t, err)
+	assert.EqualValues(t, "", iconSize)
+}
+
+func TestGetIconType(t *testing.T) {
+	iconType, err := getIconType("/tmp/icon-48x48.png")
+	assert.NoError(t, err)
+	assert.EqualValues(t, "image/png", iconType)
+
+	iconType, err = getIconType("icon-48x48.png")
+	assert.NoError(t, err)
+	assert.EqualValues(t, "image/png", iconType)
+
+	iconType, err = getIconType("icon-48x48.jpg")
+	assert.Error(t, err)
+	assert.EqualValues(t, "", iconType)
+}
+
+func TestCreateMediaAndScheduleJobs(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	source := directory{
+		files: []file{
+			{name: "small.jpg", absPath: "/source/small.jpg", size: 100},
+			{name: "done.jpg", absPath: "/source/done.jpg", size: 500, exists: true},
+			{name: "huge.mp4", absPath: "/source/huge.mp4", size: 10000},
+			{name: "medium.heic", absPath: "/source/medium.heic", size: 1000},
+		},
+	}
+	assert.EqualValues(t, 11100, countChangedBytes(source, config))
+
+	jobs, _ := createMedia(source, tempDir, true, config)
+	assert.Empty(t, jobs)
+	assert.False(t, exists(filepath.Join(tempDir, config.files.thumbnailDir)))
+
+	jobs, _ = createMedia(source, tempDir, false, config)
+	assert.True(t, exists(filepath.Join(tempDir, config.files.thumbnailDir)))
+	assert.Len(t, jobs, 3)
+	assert.EqualValues(t, filepath.Join(tempDir, config.files.fullsizeDir, "huge.mp4"), jobs[1].fullsizeFilepath)
+	assert.EqualValues(t, filepath.Join(tempDir, config.files.thumbnailDir, "huge.jpg"), jobs[1].thumbnailFilepath)
+
+	scheduleJobs(jobs)
+	assert.EqualValues(t, "huge.mp4", jobs[0].filename)
+	assert.EqualValues(t, "medium.heic", jobs[1].filename)
+	assert.EqualValues(t, "small.jpg", jobs[2].filename)
+
+	// Only the outdated one of the gallery files is rebuilt
+	source.files[1].outdatedThumbnail = true
+	jobs, _ = createMedia(source, tempDir, false, config)
+	assert.Len(t, jobs, 4)
+	assert.EqualValues(t, "done.jpg", jobs[1].filename)
+	assert.EqualValues(t, filepath.Join(tempDir, config.files.thumbnailDir, "done.jpg"), jobs[1].thumbnailFilepath)
+	assert.Empty(t, jobs[1].fullsizeFilepath)
+}
+
+func TestGetFFmpegThreads(t *testing.T) {
+	config := initializeConfig()
+	config.concurrency = runtime.NumCPU() * 2
+	assert.EqualValues(t, 1, getFFmpegThreads(config))
+
+	config.concurrency = 1
+	assert.EqualValues(t, runtime.NumCPU(), getFFmpegThreads(config))
+
+	config.media.ffmpegThreads = 3
+	assert.EqualValues(t, 3, getFFmpegThreads(config))
+}
+
+func TestCreateHTMLImageDimensions(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	config.media.thumbnailWidth = 300
+	config.media.thumbnailHeight = 200
+	source := directory{
+		name:           "album",
+		files:          []file{{name: "a.jpg", absPath: "/photos/a.jpg"}, {name: "b.mp4", absPath: "/photos/b.mp4"}},
+		subdirectories: []directory{{name: "subalbum"}},
+	}
+
+	createHTML(1, source, tempDir, testTemplates(t, config).html, false, config)
+	html, err := os.ReadFile(filepath.Join(tempDir, config.assets.htmlFile))
+	assert.NoError(t, err)
+
+	// Every image must be sized, so the page doesn't shift around while loading
+	images := regexp.MustCompile(`<img [^>]*>`).FindAllString(string(html), -1)
+	assert.Len(t, images, 4)
+	for _, image := range images {
+		assert.Contains(t, image, `width="300"`)
+		assert.Contains(t, image, `height="200"`)
+	}
+}
+
+func TestCreateHTMLInfo(t *testing.T) {
+	tempDir := t.TempDir()
+	config := initializeConfig()
+	source := directory{
+		name: "album",
+		files: []file{{
+			name:     "a.jpg",
+			camera:   "Canon EOS 5D",
+			exposure: exposureSettings{exposureTime: 0.004, fNumber: 2.8, iso: 100, focalLength: 35},
+		}},
+	}
+
+	assert.NoError(t, createHTML(0, source, tempDir, testTemplates(t, config).html, false, config))
+	html, err := os.ReadFile(filepath.Join(tempDir, config.assets.htmlFile))
+	assert.NoError(t, err)
+	assert.Contains(t, string(html), `camera: "Canon EOS 5D",`)
+	assert.Contains(t, string(html), `exposure: "1/250 s, f/2.8, ISO 100",`)
+	assert.Contains(t, string(html), `focalLength: "35 mm",`)
+	assert.Contains(t, string(html), `id="modalInfo"`)
+}
+
+func TestCreateHTMLTiles(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	source := directory{
+		name:           "album",
+		files:          []file{{name: "a&b.jpg", absPath: "/photos/a&b.jpg"}},
+		subdirectories: []directory{{name: "subalbum"}},
+	}
+
+	// Tiles are named for the type-ahead filter of keyboard navigation
+	createHTML(0, source, tempDir, testTemplates(t, config).html, false, config)
+	html, err := os.ReadFile(filepath.Join(tempDir, config.assets.htmlFile))
+	assert.NoError(t, err)
+	assert.Contains(t, string(html), `id="filter"`)
+	assert.Contains(t, string(html), `data-density="large"`)
+	assert.Contains(t, string(html), `id="slideshowControl"`)
+	assert.NotContains(t, string(html), `id="music"`)
+	assert.Contains(t, string(html), `data-name="subalbum"`)
+	assert.Contains(t, string(html), `data-name="a&amp;b.jpg"`)
+	assert.Len(t, regexp.MustCompile(`class="tile `).FindAllString(string(html), -1), 2)
+	assert.NotContains(t, string(html), `class="day-heading`)
+
+	// Photos of different days are broken up by headings
+	source.files = []file{
+		{name: "a.jpg", absPath: "/photos/a.jpg", takenTime: time.Date(2021, 3, 4, 12, 0, 0, 0, config.media.timezone)},
+		{name: "b.jpg", absPath: "/photos/b.jpg", takenTime: time.Date(2021, 3, 5, 12, 0, 0, 0, config.media.timezone)},
+	}
+	createHTML(0, source, tempDir, testTemplates(t, config).html, false, config)
+	html, err = os.ReadFile(filepath.Join(tempDir, config.assets.htmlFile))
+	assert.NoError(t, err)
+	assert.Regexp(t, `Thursday 4 March 2021</h2>\s*<div class="tile[^>]*data-name="a.jpg"`, string(html))
+	assert.Regexp(t, `Friday 5 March 2021</h2>\s*<div class="tile[^>]*data-name="b.jpg"`, string(html))
+
+	// Panoramas are shown full-size, spanning two columns
+	source.files = []file{{name: "portrait.jpg", absPath: "/photos/portrait.jpg", width: 300, height: 400}, {name: "panorama.jpg", absPath: "/photos/panorama.jpg", width: 900, height: 300}, {name: "video.mp4", absPath: "/photos/video.mp4", width: 900, height: 300}}
+	createHTML(0, source, tempDir, testTemplates(t, config).html, false, config)
+	html, err = os.ReadFile(filepath.Join(tempDir, config.assets.htmlFile))
+	assert.NoError(t, err)
+	assert.Regexp(t, `class="tile portrait [^>]*data-name="portrait.jpg"`, string(html))
+	assert.Regexp(t, `class="tile panorama [^>]*data-name="panorama.jpg"[^>]*>\s*<picture>\s*<img [^>]*src="_fullsize/panorama.jpg"`, string(html))
+	assert.Regexp(t, `class="tile col-4[^>]*data-name="video.mp4"`, string(html))
+
+	// Albums with music play it in the slideshow
+	source.music = file{absPath: "/source/album/song.mp3"}
+	createHTML(0, source, tempDir, testTemplates(t, config).html, false, config)
+	html, err = os.ReadFile(filepath.Join(tempDir, config.assets.htmlFile))
+	assert.NoError(t, err)
+	assert.Contains(t, string(html), `<audio id="music" src="`+musicFile+`" loop muted`)
+	assert.Contains(t, string(html), `id="musicControl"`)
+}
+
+func TestCreateHTMLProofing(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	source := directory{name: "album", relPath: "album", files: []file{{name: "a.jpg", absPath: "/photos/a.jpg"}, {name: "b.jpg", absPath: "/photos/b.jpg"}}}
+	htmlPath := filepath.Join(tempDir, config.assets.htmlFile)
+
+	createHTML(1, source, tempDir, testTemplates(t, config).html, false, config)
+	html, err := os.ReadFile(htmlPath)
+	assert.NoError(t, err)
+	assert.Contains(t, string(html), `data-id="`+getFileID("album/b.jpg")+`"`)
+	assert.NotContains(t, string(html), `id="proofing"`)
+	assert.NotContains(t, string(html), `class="pick"`)
+
+	config.assets.proofing = true
+	config.assets.proofingEmail = "studio@example.com"
+	createHTML(1, source, tempDir, testTemplates(t, config).html, false, config)
+	html, err = os.ReadFile(htmlPath)
+	assert.NoError(t, err)
+	assert.Contains(t, string(html), `data-email="studio@example.com"`)
+	assert.Contains(t, string(html), `id="pickEmail"`)
+	assert.Contains(t, string(html), `data-filename="b.jpg" onchange="updatePicks();"> <span class="text-bold">2</span>`)
+}
+
+func TestCreateHTMLInlineAssets(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	source := directory{name: "album", files: []file{{name: "a.jpg", absPath: "/photos/a.jpg"}}}
+	htmlPath := filepath.Join(tempDir, config.assets.htmlFile)
+
+	createHTML(0, source, tempDir, testTemplates(t, config).html, false, config)
+	html, err := os.ReadFile(htmlPath)
+	assert.NoError(t, err)
+	assert.Contains(t, string(html), `<meta property="og:title" content="album">`)
+	assert.Contains(t, string(html), `<link href="fastgallery.css" rel="stylesheet">`)
+	assert.Contains(t, string(html), `<script src="fastgallery.js"></script>`)
+
+	config.assets.inlineAssets = true
+	createHTML(0, source, tempDir, testTemplates(t, config).html, false, config)
+	html, err = os.ReadFile(htmlPath)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(html), `<link href="fastgallery.css" rel="stylesheet">`)
+	assert.Contains(t, string(html), "<style>.box {")
+	assert.Contains(t, string(html), `<link href="primer.css" rel="stylesheet">`)
+	assert.Contains(t, string(html), `<script src="fastgallery.js" defer></script>`)
+}
+
+func TestUpdateHTMLFiles(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	source := directory{name: "root", files: []file{{name: "a.jpg", absPath: "/photos/a.jpg"}}}
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("album%02d", i)
+		source.subdirectories = append(source.subdirectories, directory{name: name, relPath: name, files: []file{{name: "b.jpg", absPath: "/photos/b.jpg"}}})
+		err = os.Mkdir(filepath.Join(tempDir, name), 0755)
+		assert.NoError(t, err)
+	}
+	gallery := directory{absPath: tempDir}
+
+	jobs, _ := collectHTMLJobs(0, source, gallery, getPageSettingsHash(config), nil, make(map[string]string), config)
+	assert.Len(t, jobs, 21)
+	assert.EqualValues(t, 1, jobs[20].depth)
+	assert.EqualValues(t, filepath.Join(tempDir, "album19"), jobs[20].galleryDirectory)
+
+	pages, rendered, _ := updateHTMLFiles(source, gallery, testTemplates(t, config).html, nil, false, config)
+	assert.Len(t, pages, 21)
+	assert.EqualValues(t, 21, rendered)
+	html, err := os.ReadFile(filepath.Join(tempDir, config.assets.htmlFile))
+	assert.NoError(t, err)
+	assert.Contains(t, string(html), "21 photos")
+	assert.Contains(t, string(html), `<a href="album19">`)
+	for _, subdir := range source.subdirectories {
+		html, err := os.ReadFile(filepath.Join(tempDir, subdir.name, config.assets.htmlFile))
+		assert.NoError(t, err)
+		assert.Contains(t, string(html), "<title>"+subdir.name+"</title>")
+	}
+}
+
+func TestParseTemplates(t *testing.T) {
+	config := initializeConfig()
+	cookedTemplates, err := parseTemplates(config)
+	assert.NoError(t, err)
+	assert.NotNil(t, cookedTemplates.html)
+	assert.NotNil(t, cookedTemplates.manifest)
+	assert.NotNil(t, cookedTemplates.singleFile)
+	assert.NotNil(t, cookedTemplates.timeline)
+	assert.NotNil(t, cookedTemplates.calendar)
+	assert.NotNil(t, cookedTemplates.people)
+	assert.NotNil(t, cookedTemplates.contact)
+
+	config.assets.manifestTemplate = "nonexistent.tmpl"
+	_, err = parseTemplates(config)
+	assert.Error(t, err)
+}
+
+// TODO tests for
+// isDirectory with symlinked dir
+// isSymlinkDir
+// createDirectoryTree("nonexistent", "")
+// hasDirectoryChanged
+// symlinkFile
+// getGalleryDirectoryNames
+// transformImage
+// transformVideo
+// createOriginal
+// getGalleryFilenames
+// transformFile
+// transformationWorker
+// cleanDirectory
+// createGallery
+//   - exists, doesn't exist, some gallery files exist / some don't
+//   - thumbnail modified earlier than original or vice versa
+// abortOnCancel
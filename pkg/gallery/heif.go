@@ -0,0 +1,176 @@
+package gallery
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/davidbyttow/govips/v2/vips"
+)
+
+// External converter from libheif used when libvips has been built without HEIF support
+const heifConvertCommand = "heif-convert"
+
+// isHEIFFile checks whether given file is a HEIF image
+func isHEIFFile(filename string, config configuration) bool {
+	switch filepath.Ext(strings.ToLower(filename)) {
+	case ".heic", ".heif":
+		return true
+	default:
+		return getSniffedKind(filename, config) == mediaKindHEIF
+	}
+}
+
+// countNewHEIFFiles counts the HEIF files of a source directory which need to be transformed
+func countNewHEIFFiles(source directory, config configuration) (count int) {
+	for _, file := range source.files {
+		if !file.exists && isHEIFFile(file.absPath, config) {
+			count++
+		}
+	}
+	return count
+}
+
+// skipNewHEIFFiles removes the HEIF files which need to be transformed from a source
+// directory. Files already in the gallery are kept.
+func skipNewHEIFFiles(source *directory, config configuration) {
+	var keptFiles []file
+	for _, file := range source.files {
+		if file.exists || !isHEIFFile(file.absPath, config) {
+			keptFiles = append(keptFiles, file)
+		}
+	}
+	source.files = keptFiles
+}
+
+// findHEIFConverter is called when libvips can't load HEIF files. If asked to and
+// heif-convert is installed, returns its path to convert the files with. Otherwise
+// the HEIF files are to be skipped and an empty string is returned.
+func findHEIFConverter(useConverter bool) string {
+	if !useConverter {
+		return ""
+	}
+
+	converterPath, err := exec.LookPath(heifConvertCommand)
+	if err != nil {
+		return ""
+	}
+	return converterPath
+}
+
+// warnHEIFFallback prints one warning about the count HEIF files libvips couldn't load,
+// instead of every HEIF file failing on its own
+func warnHEIFFallback(count int, converterPath string, useConverter bool, output io.Writer) {
+	if count == 0 {
+		return
+	}
+
+	if converterPath != "" {
+		fmt.Fprintln(output, "Warning: libvips was built without HEIF support, converted", count, "HEIF files with", converterPath)
+	} else if useConverter {
+		fmt.Fprintln(output, "Warning: libvips was built without HEIF support and", heifConvertCommand, "wasn't found, skipped", count, "HEIF files")
+	} else {
+		fmt.Fprintln(output, "Warning: libvips was built without HEIF support, skipped", count, "HEIF files. Install", heifConvertCommand, "and use --heif-convert to include them.")
+	}
+}
+
+// heifImageTypes are the HEIF item types which are coded or derived images
+var heifImageTypes = map[string]bool{"hvc1": true, "av01": true, "jpeg": true, "grid": true, "iden": true, "iovl": true}
+
+// findHEIFTopLevelImages returns the IDs of the top-level images from the meta box of a
+// HEIF file, in the order libheif lists them. Thumbnails, auxiliary images like depth
+// maps and the tiles of grid images aren't top-level images.
+func findHEIFTopLevelImages(meta []byte) (imageIDs []uint32) {
+	iref := findBox(meta, "iref")
+	hidden := make(map[uint32]bool)
+	for _, referenceType := range []string{"thmb", "auxl"} {
+		for fromID := range readHEIFItemReferences(iref, referenceType) {
+			hidden[fromID] = true
+		}
+	}
+	for _, tileIDs := range readHEIFItemReferences(iref, "dimg") {
+		for _, tileID := range tileIDs {
+			hidden[tileID] = true
+		}
+	}
+
+	for _, item := range readHEIFItems(findBox(meta, "iinf")) {
+		if heifImageTypes[item.itemType] && !hidden[item.id] {
+			imageIDs = append(imageIDs, item.id)
+		}
+	}
+	return imageIDs
+}
+
+// findHEIFPrimaryImage returns the position of the primary image among the top-level
+// images of a HEIF file, zero if it can't be told
+func findHEIFPrimaryImage(source string) (int, error) {
+	fileHandle, err := os.Open(source)
+	if err != nil {
+		return 0, err
+	}
+	defer fileHandle.Close()
+
+	header := make([]byte, exifHeaderSize)
+	headerLength, err := io.ReadFull(fileHandle, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return 0, err
+	}
+	meta := findBox(header[:headerLength], "meta")
+	if len(meta) < 4 {
+		return 0, nil
+	}
+	// meta is a full box, skip version and flags
+	meta = meta[4:]
+
+	primaryID, ok := findHEIFPrimaryItemID(findBox(meta, "pitm"))
+	if !ok {
+		return 0, nil
+	}
+	for index, imageID := range findHEIFTopLevelImages(meta) {
+		if imageID == primaryID {
+			return index, nil
+		}
+	}
+	return 0, nil
+}
+
+// loadImage opens an image with libvips, which loads the primary image of HEIF files
+// with several images, like bursts. HEIF images are first converted to JPEG with
+// heif-convert, if libvips can't load them itself. Phones and apps sometimes save HEIF
+// images with a .jpg extension, so those are told apart by their contents.
+func loadImage(source string, config configuration) (*vips.ImageRef, error) {
+	if config.media.heifConverter == "" || !(isHEIFFile(source, config) || (config.media.sniffContents && sniffMediaKind(source) == mediaKindHEIF)) {
+		return vips.NewImageFromFile(source)
+	}
+
+	tempDirectory, err := os.MkdirTemp(config.files.workspaceDir, "heif-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tempDirectory)
+
+	convertedPath := filepath.Join(tempDirectory, "converted.jpg")
+	converterCommand := exec.Command(config.media.heifConverter, "-q", "95", source, convertedPath)
+	commandOutput, err := converterCommand.CombinedOutput()
+	if err != nil {
+		log.Println("couldn't convert HEIF image:", source, err.Error())
+		log.Println(string(commandOutput))
+		return nil, err
+	}
+
+	// heif-convert writes each top-level image of a multi-image file into a numbered file
+	if !exists(convertedPath) {
+		primaryIndex, err := findHEIFPrimaryImage(source)
+		if err != nil {
+			return nil, err
+		}
+		convertedPath = filepath.Join(tempDirectory, fmt.Sprintf("converted-%d.jpg", primaryIndex+1))
+	}
+
+	return vips.NewImageFromFile(convertedPath)
+}
@@ -0,0 +1,57 @@
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSkipNewHEIFFiles(t *testing.T) {
+	config := initializeConfig()
+	source := directory{
+		files: []file{
+			{name: "a.HEIC", absPath: "/photos/a.HEIC"},
+			{name: "b.jpg", absPath: "/photos/b.jpg"},
+			{name: "c.heic", absPath: "/photos/c.heic", exists: true},
+			{name: "d.heif", absPath: "/photos/d.heif"},
+		},
+	}
+	assert.EqualValues(t, 2, countNewHEIFFiles(source, config))
+
+	skipNewHEIFFiles(&source, config)
+	assert.EqualValues(t, 0, countNewHEIFFiles(source, config))
+	assert.Len(t, source.files, 2)
+	assert.EqualValues(t, "b.jpg", source.files[0].name)
+	assert.EqualValues(t, "c.heic", source.files[1].name)
+
+	// Only look for the converter if asked to
+	assert.EqualValues(t, "", findHEIFConverter(false))
+}
+
+func TestFindHEIFPrimaryImage(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	meta := buildTestHEIFMeta()
+	assert.EqualValues(t, []uint32{1, 2, 7}, findHEIFTopLevelImages(meta))
+
+	burstPath := filepath.Join(tempDir, "burst.heic")
+	ftyp := buildTestBox("ftyp", []byte("heic"), []byte{0, 0, 0, 0}, []byte("mif1heic"))
+	err = os.WriteFile(burstPath, append(ftyp, buildTestBox("meta", []byte{0, 0, 0, 0}, meta)...), 0644)
+	assert.NoError(t, err)
+	index, err := findHEIFPrimaryImage(burstPath)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, index)
+
+	index, err = findHEIFPrimaryImage("../../testing/source/subdir/gate.heic")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, index)
+
+	_, err = findHEIFPrimaryImage(filepath.Join(tempDir, "nonexistent.heic"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,37 @@
+package gallery
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Default filename of album pages, which web servers serve for directory URLs
+const defaultHTMLFile = "index.html"
+
+// getIndexLink returns what links to an album directory end with to get to its page:
+// nothing for index.html, which web servers serve for directories anyway, and the
+// filename of album pages otherwise
+func getIndexLink(config configuration) string {
+	if config.assets.htmlFile == defaultHTMLFile {
+		return ""
+	}
+	return config.assets.htmlFile
+}
+
+// isValidHTMLFilename checks whether album pages can be named so: a plain .html or .htm
+// filename, which isn't taken by the gallery's other pages
+func isValidHTMLFilename(filename string) bool {
+	if filename == "" || filename != filepath.Base(filename) {
+		return false
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".html", ".htm":
+	default:
+		return false
+	}
+	switch filename {
+	case timelineFile, calendarFile, peopleFile, contactSheetFile:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,41 @@
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsValidHTMLFilename(t *testing.T) {
+	assert.True(t, isValidHTMLFilename("index.html"))
+	assert.True(t, isValidHTMLFilename("index.htm"))
+	assert.True(t, isValidHTMLFilename("album.html"))
+	assert.False(t, isValidHTMLFilename(""))
+	assert.False(t, isValidHTMLFilename("index.php"))
+	assert.False(t, isValidHTMLFilename(filepath.Join("pages", "index.html")))
+	assert.False(t, isValidHTMLFilename(timelineFile))
+}
+
+func TestCreateHTMLWithHTMLFile(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	assert.Empty(t, getIndexLink(config))
+
+	config.assets.htmlFile = "album.html"
+	assert.Equal(t, "album.html", getIndexLink(config))
+	source := directory{name: "trips", relPath: "trips", subdirectories: []directory{{name: "alps"}}, files: []file{{name: "a.jpg"}}}
+
+	createHTML(1, source, tempDir, testTemplates(t, config).html, false, config)
+	html, err := os.ReadFile(filepath.Join(tempDir, "album.html"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(html), `<a href="../album.html">`)
+	assert.Contains(t, string(html), `<a href="alps/album.html">`)
+	assert.NoFileExists(t, filepath.Join(tempDir, defaultHTMLFile))
+}
@@ -0,0 +1,65 @@
+package gallery
+
+import (
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/davidbyttow/govips/v2/vips"
+)
+
+// getIconWidth returns the width of a square icon from its size, e.g. 48 for 48x48
+func getIconWidth(size string) (int, error) {
+	return strconv.Atoi(strings.SplitN(size, "x", 2)[0])
+}
+
+// createPhotoIcon creates a web app icon of given size, e.g. 192x192, from a photo by
+// cropping a square from its centre. Icons are PNGs like the embedded ones.
+func createPhotoIcon(photoPath string, size string) ([]byte, error) {
+	width, err := getIconWidth(size)
+	if err != nil {
+		log.Println("couldn't define icon width:", size, err.Error())
+		return nil, err
+	}
+
+	image, err := vips.NewImageFromFile(photoPath)
+	if err != nil {
+		log.Println("couldn't open icon photo:", photoPath, err.Error())
+		return nil, err
+	}
+
+	err = image.AutoRotate()
+	if err != nil {
+		log.Println("couldn't autorotate icon photo:", photoPath, err.Error())
+		return nil, err
+	}
+
+	err = image.Thumbnail(width, width, vips.InterestingCentre)
+	if err != nil {
+		log.Println("couldn't crop icon photo:", photoPath, err.Error())
+		return nil, err
+	}
+
+	iconBuffer, _, err := image.Export(vips.NewDefaultPNGExportParams())
+	if err != nil {
+		log.Println("couldn't export icon:", photoPath, err.Error())
+		return nil, err
+	}
+	return iconBuffer, nil
+}
+
+// readIconAsset returns the contents of an embedded icon, or with an icon photo
+// configured, an icon of the same size made from the photo. The embedded icon is
+// used if the photo can't be made into one.
+func readIconAsset(assetPath string, config configuration) ([]byte, error) {
+	if config.assets.iconPhoto != "" {
+		size, err := getIconSize(assetPath)
+		if err == nil {
+			iconBuffer, err := createPhotoIcon(config.assets.iconPhoto, size)
+			if err == nil {
+				return iconBuffer, nil
+			}
+		}
+	}
+	return assets.ReadFile(assetPath)
+}
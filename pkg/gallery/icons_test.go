@@ -0,0 +1,34 @@
+package gallery
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetIconWidth(t *testing.T) {
+	width, err := getIconWidth("192x192")
+	assert.NoError(t, err)
+	assert.Equal(t, 192, width)
+
+	_, err = getIconWidth("large")
+	assert.Error(t, err)
+}
+
+func TestReadIconAsset(t *testing.T) {
+	config := initializeConfig()
+	assetPath := filepath.Join(config.assets.assetsDir, "icon-48x48.png")
+	embedded, err := assets.ReadFile(assetPath)
+	assert.NoError(t, err)
+
+	icon, err := readIconAsset(assetPath, config)
+	assert.NoError(t, err)
+	assert.Equal(t, embedded, icon)
+
+	// Photos which can't be made into icons are replaced by the embedded icons
+	config.assets.iconPhoto = "/nonexistent/photo.jpg"
+	icon, err = readIconAsset(assetPath, config)
+	assert.NoError(t, err)
+	assert.Equal(t, embedded, icon)
+}
@@ -0,0 +1,140 @@
+package gallery
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/davidbyttow/govips/v2/vips"
+)
+
+// Formats of the thumbnails and full-size images of the gallery, by their extension.
+// WebP and AVIF images are much smaller than JPEGs of the same quality, but older
+// browsers can't show them.
+var imageFormatExtensions = map[string]string{
+	"jpeg": ".jpg",
+	"webp": webpExtension,
+	"avif": avifExtension,
+}
+
+// AVIF images are encoded with ffmpeg, the version of govips used has no AVIF encoder
+const avifExtension = ".avif"
+
+// Quality of AVIF images without a JPEG quality set. AVIF images of the same quality
+// setting are much smaller than JPEGs, so the default is lower than the one of JPEGs.
+const avifDefaultQuality = 50
+
+// getImageFormatExtension returns the extension of the gallery images of given format,
+// or an empty string if there's no such format
+func getImageFormatExtension(format string) string {
+	return imageFormatExtensions[format]
+}
+
+// isImageFormatExtension checks whether gallery images can be written with given extension
+func isImageFormatExtension(extension string) bool {
+	for _, formatExtension := range imageFormatExtensions {
+		if extension == formatExtension {
+			return true
+		}
+	}
+	return false
+}
+
+// isOtherImageFormat checks whether a gallery image was written in another format than
+// the one of the gallery, before switching formats, so it's built again and cleaned up
+func isOtherImageFormat(filename string, config configuration) bool {
+	extension := strings.ToLower(filepath.Ext(filename))
+	if extension == config.files.imageExtension || (extension == webpExtension && config.files.webp) {
+		return false
+	}
+	return isImageFormatExtension(extension)
+}
+
+// getAVIFQuantizer returns the quantizer ffmpeg encodes AVIF images of given quality
+// with, from 0 for lossless to 63 for the smallest files
+func getAVIFQuantizer(quality int) int {
+	if quality <= 0 {
+		quality = avifDefaultQuality
+	}
+	if quality > 100 {
+		quality = 100
+	}
+	return (100 - quality) * 63 / 100
+}
+
+// exportImage encodes an image in the format of the gallery, given by the extension of
+// the gallery images. Quality follows the JPEG quality, if one is set.
+func exportImage(image *vips.ImageRef, source string, config configuration) ([]byte, error) {
+	var ep *vips.ExportParams
+	switch config.files.imageExtension {
+	case ".jpg":
+		ep = vips.NewDefaultJPEGExportParams()
+	case webpExtension:
+		ep = vips.NewDefaultWEBPExportParams()
+	case avifExtension:
+		return exportAVIF(image, source, config)
+	default:
+		return nil, errors.New("unsupported image format: " + config.files.imageExtension)
+	}
+	if config.media.jpegQuality > 0 {
+		ep.Quality = config.media.jpegQuality
+	}
+	buffer, _, err := image.Export(ep)
+	return buffer, err
+}
+
+// exportAVIF encodes an image as AVIF. The image is handed to ffmpeg as a lossless PNG
+// in a temporary directory of the workspace.
+func exportAVIF(image *vips.ImageRef, source string, config configuration) ([]byte, error) {
+	pngBuffer, _, err := image.Export(vips.NewDefaultPNGExportParams())
+	if err != nil {
+		return nil, err
+	}
+
+	tempDirectory, err := os.MkdirTemp(config.files.workspaceDir, "avif-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tempDirectory)
+
+	pngPath := filepath.Join(tempDirectory, "image.png")
+	avifPath := filepath.Join(tempDirectory, "image"+avifExtension)
+	err = os.WriteFile(pngPath, pngBuffer, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	ffmpegCommand := exec.Command("ffmpeg", "-y", "-i", pngPath, "-c:v", "libaom-av1", "-still-picture", "1", "-crf", strconv.Itoa(getAVIFQuantizer(config.media.jpegQuality)), "-pix_fmt", "yuv420p", "-threads", strconv.Itoa(getFFmpegThreads(config)), "-loglevel", "error", avifPath)
+	commandOutput, err := ffmpegCommand.CombinedOutput()
+	if err != nil {
+		log.Println("couldn't encode AVIF image:", source, err.Error())
+		log.Println(string(commandOutput))
+		return nil, err
+	}
+	return os.ReadFile(avifPath)
+}
+
+// readAVIFDimensions reads the width and height of an AVIF image from the image spatial
+// extents property in its header, which Go's image package can't decode
+func readAVIFDimensions(reader io.Reader) (width int, height int, err error) {
+	header := make([]byte, 4096)
+	length, err := io.ReadFull(reader, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return 0, 0, err
+	}
+	header = header[:length]
+
+	// The property is "ispe", four bytes of version and flags, the width and the height
+	for i := 0; i+16 <= len(header); i++ {
+		if string(header[i:i+4]) == "ispe" {
+			return int(binary.BigEndian.Uint32(header[i+8:])), int(binary.BigEndian.Uint32(header[i+12:])), nil
+		}
+	}
+	return 0, 0, errors.New("no image spatial extents in AVIF header")
+}
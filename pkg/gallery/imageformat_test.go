@@ -0,0 +1,75 @@
+package gallery
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImageFormats(t *testing.T) {
+	assert.Equal(t, ".jpg", getImageFormatExtension("jpeg"))
+	assert.Equal(t, ".webp", getImageFormatExtension("webp"))
+	assert.Equal(t, ".avif", getImageFormatExtension("avif"))
+	assert.Equal(t, "", getImageFormatExtension("png"))
+
+	config := initializeConfig()
+	assert.False(t, isOtherImageFormat("a.jpg", config))
+	assert.True(t, isOtherImageFormat("a.webp", config))
+	assert.True(t, isOtherImageFormat("a.avif", config))
+	assert.False(t, isOtherImageFormat("a.mp4", config))
+
+	// WebP versions go with the JPEGs
+	config.files.webp = true
+	assert.False(t, isOtherImageFormat("a.webp", config))
+
+	config.files.webp = false
+	config.files.imageExtension = avifExtension
+	assert.True(t, isOtherImageFormat("a.JPG", config))
+	assert.False(t, isOtherImageFormat("a.avif", config))
+
+	assert.Equal(t, 31, getAVIFQuantizer(0))
+	assert.Equal(t, 0, getAVIFQuantizer(100))
+	assert.Equal(t, 12, getAVIFQuantizer(80))
+}
+
+func TestCompareDirectoryImageFormat(t *testing.T) {
+	config := initializeConfig()
+	source := directory{files: []file{{name: "a.jpg"}}}
+	gallery := directory{subdirectories: []directory{
+		{name: config.files.thumbnailDir, files: []file{{name: "a.jpg"}}},
+		{name: config.files.fullsizeDir, files: []file{{name: "a.jpg"}}},
+		{name: config.files.originalDir, files: []file{{name: "a.jpg"}}},
+	}}
+	gallery.subdirectories[0].files[0].modTime = gallery.subdirectories[0].files[0].modTime.AddDate(2000, 0, 0)
+
+	compareDirectory(&source, &gallery, config)
+	assert.True(t, source.files[0].exists)
+
+	// Images of another format are built again and cleaned up
+	config.files.imageExtension = webpExtension
+	source.files[0].exists = false
+	gallery.subdirectories[0].files[0].exists = false
+	compareDirectory(&source, &gallery, config)
+	assert.False(t, source.files[0].exists)
+	assert.False(t, gallery.subdirectories[0].files[0].exists)
+	assert.True(t, gallery.subdirectories[2].files[0].exists)
+}
+
+func TestReadAVIFDimensions(t *testing.T) {
+	var header bytes.Buffer
+	header.WriteString("\x00\x00\x00\x1cftypavif")
+	header.Write(make([]byte, 40))
+	header.WriteString("\x00\x00\x00\x14ispe\x00\x00\x00\x00")
+	_ = binary.Write(&header, binary.BigEndian, uint32(1920))
+	_ = binary.Write(&header, binary.BigEndian, uint32(1280))
+
+	width, height, err := readAVIFDimensions(&header)
+	assert.NoError(t, err)
+	assert.Equal(t, 1920, width)
+	assert.Equal(t, 1280, height)
+
+	_, _, err = readAVIFDimensions(bytes.NewReader([]byte("\x00\x00\x00\x1cftypavif")))
+	assert.Error(t, err)
+}
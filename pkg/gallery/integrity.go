@@ -0,0 +1,88 @@
+package gallery
+
+import (
+	"html"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// referencePattern matches the links of generated pages: src, srcset and href attributes,
+// and the paths in the pictures array of album pages
+var referencePattern = regexp.MustCompile(`(?:src|srcset|href)="([^"]*)"|(?:thumbnail|fullsize|webp|original): "([^"]*)"`)
+
+// findReferences returns the links in a generated page which point to files in the
+// gallery. Links to other sites, absolute paths and in-page anchors are left out.
+func findReferences(page string) (references []string) {
+	for _, match := range referencePattern.FindAllStringSubmatch(page, -1) {
+		reference := match[1] + match[2]
+		if strings.ContainsAny(reference, "?#") {
+			reference = reference[:strings.IndexAny(reference, "?#")]
+		}
+		if reference == "" || strings.HasPrefix(reference, "/") || strings.Contains(reference, ":") {
+			continue
+		}
+		references = append(references, html.UnescapeString(reference))
+	}
+	return references
+}
+
+// referenceExists checks whether a link from a page in given directory points to an
+// existing file. Links may or may not be URL-escaped.
+func referenceExists(pageDirectory string, reference string) bool {
+	if exists(filepath.Join(pageDirectory, filepath.FromSlash(reference))) {
+		return true
+	}
+	unescaped, err := url.PathUnescape(reference)
+	return err == nil && exists(filepath.Join(pageDirectory, filepath.FromSlash(unescaped)))
+}
+
+// walkGalleryPages reads every generated page in the gallery, calling visit with the
+// page's path and contents. Media directories are skipped, they don't contain pages.
+func walkGalleryPages(galleryDirectory string, config configuration, visit func(pagePath string, page string)) error {
+	return filepath.WalkDir(galleryDirectory, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path != galleryDirectory && reservedDirectory(entry.Name(), config) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".html", ".htm":
+		default:
+			return nil
+		}
+
+		page, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		visit(path, string(page))
+		return nil
+	})
+}
+
+// checkGalleryIntegrity goes through the generated pages of the gallery and logs every
+// link to a thumbnail, full-size file, original or asset which doesn't exist. Returns
+// the number of dangling links found.
+func checkGalleryIntegrity(galleryDirectory string, config configuration) (dangling int) {
+	err := walkGalleryPages(galleryDirectory, config, func(pagePath string, page string) {
+		for _, reference := range findReferences(page) {
+			if !referenceExists(filepath.Dir(pagePath), reference) {
+				log.Println("dangling reference in", pagePath, ":", reference)
+				dangling++
+			}
+		}
+	})
+	if err != nil {
+		log.Println("couldn't check gallery integrity", galleryDirectory, ":", err.Error())
+	}
+	return dangling
+}
@@ -0,0 +1,48 @@
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindReferences(t *testing.T) {
+	page := `<link href="../primer.css" rel="stylesheet">
+<a href="#">x</a> <a href="https://example.com/">y</a> <img src="/assets/back.png">
+<a href="index.html#a.jpg">z</a> <img src="_thumbnail/a&amp;b.jpg"> <source type="image/webp" srcset="_thumbnail/a%20b.webp">
+thumbnail: "_thumbnail/c.jpg",
+webp: "_fullsize/c.webp",
+original: "_original/c.jpg",`
+
+	assert.EqualValues(t, []string{"../primer.css", "index.html", "_thumbnail/a&b.jpg", "_thumbnail/a%20b.webp", "_thumbnail/c.jpg", "_fullsize/c.webp", "_original/c.jpg"}, findReferences(page))
+}
+
+func TestCheckGalleryIntegrity(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	for _, path := range []string{filepath.Join("album", "_thumbnail"), filepath.Join("album", "_fullsize")} {
+		err = os.MkdirAll(filepath.Join(tempDir, path), 0755)
+		assert.NoError(t, err)
+	}
+	for _, path := range []string{"primer.css", filepath.Join("album", "_thumbnail", "a b.jpg"), filepath.Join("album", "_fullsize", "a b.jpg")} {
+		err = os.WriteFile(filepath.Join(tempDir, path), []byte{}, 0644)
+		assert.NoError(t, err)
+	}
+
+	page := `<link href="../primer.css"><img src="_thumbnail/a b.jpg"> fullsize: "_fullsize/a%20b.jpg", <a href="../">Back</a>`
+	err = os.WriteFile(filepath.Join(tempDir, "album", "index.html"), []byte(page), 0644)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, checkGalleryIntegrity(tempDir, config))
+
+	page += ` <img src="_thumbnail/b.jpg"> original: "_original/a b.jpg",`
+	err = os.WriteFile(filepath.Join(tempDir, "album", "index.html"), []byte(page), 0644)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, checkGalleryIntegrity(tempDir, config))
+}
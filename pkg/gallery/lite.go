@@ -0,0 +1,98 @@
+package gallery
+
+import (
+	"path"
+	"path/filepath"
+	"text/template"
+)
+
+// Settings of the lite version of the gallery, for visitors on slow connections
+const (
+	liteFullsizeMaxWidth  = 1280
+	liteFullsizeMaxHeight = 720
+	liteVideoMaxSize      = 480
+	liteJPEGQuality       = 60
+)
+
+// createLiteConfig returns the configuration of the lite version of the gallery: smaller
+// and more compressed full-size files, and no originals. The extra pages are left out,
+// the lite version only has the albums.
+func createLiteConfig(config configuration) configuration {
+	liteConfig := config
+	liteConfig.media.fullsizeMaxWidth = liteFullsizeMaxWidth
+	liteConfig.media.fullsizeMaxHeight = liteFullsizeMaxHeight
+	liteConfig.media.videoMaxSize = liteVideoMaxSize
+	liteConfig.media.jpegQuality = liteJPEGQuality
+	liteConfig.media.densities = nil
+	liteConfig.files.noOriginals = true
+	liteConfig.assets.liteLink = false
+	liteConfig.assets.liteVersion = true
+	liteConfig.assets.timeline = false
+	liteConfig.assets.calendar = false
+	liteConfig.assets.albumTree = false
+	liteConfig.assets.contactSheet = false
+	liteConfig.assets.proofing = false
+	liteConfig.assets.liveReload = false
+	liteConfig.media.faces = false
+	return liteConfig
+}
+
+// getLiteLink returns the link from an album page to the same album in the lite version
+func getLiteLink(rootEscape string, relPath string, config configuration) string {
+	return path.Join(rootEscape, config.files.liteDir, filepath.ToSlash(relPath)) + "/" + getIndexLink(config)
+}
+
+// getFullLink returns the link from an album page of the lite version to the same album
+// in the full gallery, which the lite version is in
+func getFullLink(rootEscape string, relPath string, config configuration) string {
+	return path.Join(rootEscape, "..", filepath.ToSlash(relPath)) + "/" + getIndexLink(config)
+}
+
+// buildLiteGallery builds the lite version of the gallery into its directory in the
+// gallery root, running the source through the pipeline again with the lite settings.
+// basePipeline has the options of the main run. The landing page arguments are applied
+// as they are to the main gallery. previousPages are the lite version's page hashes of the
+// previous run, the ones of this run are returned.
+func buildLiteGallery(sourcePath string, galleryPath string, basePipeline pipeline, htmlTemplate *template.Template, previousPages map[string]string, title string, hero string, intro string, config configuration) (pages map[string]string, err error) {
+	liteConfig := createLiteConfig(config)
+	liteGalleryPath := filepath.Join(galleryPath, config.files.liteDir)
+	err = createDirectory(liteGalleryPath, basePipeline.dryRun, liteConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	litePipeline := pipeline{
+		noVideos:       basePipeline.noVideos,
+		dryRun:         basePipeline.dryRun,
+		cleanUp:        basePipeline.cleanUp,
+		takeout:        basePipeline.takeout,
+		flatPattern:    basePipeline.flatPattern,
+		heifFallback:   basePipeline.heifFallback,
+		skipUnreadable: basePipeline.skipUnreadable,
+		config:         liteConfig,
+	}
+	source, gallery, err := processGallery(sourcePath, liteGalleryPath, &litePipeline)
+	if err != nil {
+		return nil, err
+	}
+	applyLandingPageArgs(&source, title, hero, intro)
+
+	if countChanges(source, liteConfig) > 0 {
+		err = copyRootAssets(gallery, litePipeline.dryRun, liteConfig)
+		if err != nil {
+			return nil, err
+		}
+	}
+	pages, _, err = updateHTMLFiles(source, gallery, htmlTemplate, previousPages, litePipeline.dryRun, liteConfig)
+	if err != nil {
+		return nil, err
+	}
+	writePageHashes(gallery.absPath, pages, litePipeline.dryRun, liteConfig)
+
+	if litePipeline.cleanUp {
+		cleanUp(gallery, litePipeline.dryRun, liteConfig)
+		cleanAttachments(source, gallery.absPath, litePipeline.dryRun, liteConfig)
+		cleanMusic(source, gallery.absPath, litePipeline.dryRun, liteConfig)
+	}
+	return pages, nil
+}
@@ -0,0 +1,105 @@
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateLiteConfig(t *testing.T) {
+	config := initializeConfig()
+	config.assets.liteLink = true
+	config.assets.timeline = true
+
+	liteConfig := createLiteConfig(config)
+	assert.Equal(t, liteFullsizeMaxWidth, liteConfig.media.fullsizeMaxWidth)
+	assert.Equal(t, liteJPEGQuality, liteConfig.media.jpegQuality)
+	assert.True(t, liteConfig.files.noOriginals)
+	assert.True(t, liteConfig.assets.liteVersion)
+	assert.False(t, liteConfig.assets.liteLink)
+	assert.False(t, liteConfig.assets.timeline)
+
+	// The full gallery keeps its settings
+	assert.Equal(t, 1920, config.media.fullsizeMaxWidth)
+	assert.False(t, config.files.noOriginals)
+}
+
+func TestLiteLinks(t *testing.T) {
+	config := initializeConfig()
+	assert.Equal(t, "_lite/", getLiteLink("", "", config))
+	assert.Equal(t, "../../_lite/trips/alps/", getLiteLink("../../", filepath.Join("trips", "alps"), config))
+	assert.Equal(t, "../", getFullLink("", "", config))
+	assert.Equal(t, "../../../trips/alps/", getFullLink("../../", filepath.Join("trips", "alps"), config))
+
+	config.assets.htmlFile = "album.html"
+	assert.Equal(t, "_lite/album.html", getLiteLink("", "", config))
+	assert.Equal(t, "../../../trips/alps/album.html", getFullLink("../../", filepath.Join("trips", "alps"), config))
+}
+
+func TestCreateLiteHTML(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	config.assets.liteLink = true
+	source := directory{name: "alps", relPath: "alps", files: []file{{name: "a.jpg", absPath: "/photos/a.jpg"}}}
+	htmlPath := filepath.Join(tempDir, config.assets.htmlFile)
+
+	createHTML(1, source, tempDir, testTemplates(t, config).html, false, config)
+	html, err := os.ReadFile(htmlPath)
+	assert.NoError(t, err)
+	assert.Contains(t, string(html), `<a href="../_lite/alps/">`)
+	assert.Contains(t, string(html), `original: "_original/a.jpg"`)
+
+	liteConfig := createLiteConfig(config)
+	createHTML(1, source, tempDir, testTemplates(t, liteConfig).html, false, liteConfig)
+	html, err = os.ReadFile(htmlPath)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(html), `id="liteBanner"`)
+	assert.Contains(t, string(html), `<a href="../../alps/">`)
+	assert.Contains(t, string(html), `original: "_fullsize/a.jpg"`)
+}
+
+func TestCreateMediaWithoutOriginals(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := createLiteConfig(initializeConfig())
+	jobs, _ := createMedia(directory{files: []file{{name: "a.jpg", absPath: "/source/a.jpg"}}}, tempDir, false, config)
+	assert.Len(t, jobs, 1)
+	assert.Empty(t, jobs[0].originalFilepath)
+	assert.False(t, exists(filepath.Join(tempDir, config.files.originalDir)))
+}
+
+func TestScanGalleryDirectorySkipsLite(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	for _, directory := range []string{config.files.thumbnailDir, "album", filepath.Join(config.files.liteDir, "album")} {
+		err = os.MkdirAll(filepath.Join(tempDir, directory), 0755)
+		assert.NoError(t, err)
+		err = os.WriteFile(filepath.Join(tempDir, directory, "a.jpg"), []byte{}, 0644)
+		assert.NoError(t, err)
+	}
+
+	thisPipeline := pipeline{config: config}
+	gallery := directory{absPath: tempDir}
+	thisPipeline.scanGalleryDirectory(&gallery)
+	var names []string
+	for _, subdir := range gallery.subdirectories {
+		names = append(names, subdir.name)
+	}
+	assert.ElementsMatch(t, []string{config.files.thumbnailDir, "album"}, names)
+}
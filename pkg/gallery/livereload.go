@@ -0,0 +1,27 @@
+package gallery
+
+import (
+	"log"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Name of the stamp file in the gallery root which pages generated with --live-reload
+// poll. Its contents change each time HTML files are regenerated.
+const liveReloadFile = ".fastgallery-reload"
+
+// touchLiveReloadFile writes the current time into the live reload stamp file,
+// making any open gallery pages with live reload enabled reload themselves
+func touchLiveReloadFile(gallery directory, dryRun bool, config configuration) {
+	stampPath := filepath.Join(gallery.absPath, liveReloadFile)
+	if dryRun {
+		log.Println("Would update live reload file:", stampPath)
+		return
+	}
+
+	err := writeFile(stampPath, []byte(strconv.FormatInt(time.Now().UnixNano(), 10)), config)
+	if err != nil {
+		log.Println("couldn't write live reload file", stampPath, ":", err.Error())
+	}
+}
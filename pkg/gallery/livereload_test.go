@@ -0,0 +1,33 @@
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTouchLiveReloadFile(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	gallery := directory{absPath: tempDir}
+
+	touchLiveReloadFile(gallery, true, config)
+	assert.False(t, exists(filepath.Join(tempDir, liveReloadFile)))
+
+	touchLiveReloadFile(gallery, false, config)
+	first, err := os.ReadFile(filepath.Join(tempDir, liveReloadFile))
+	assert.NoError(t, err)
+	assert.NotEmpty(t, first)
+
+	touchLiveReloadFile(gallery, false, config)
+	second, err := os.ReadFile(filepath.Join(tempDir, liveReloadFile))
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, second)
+}
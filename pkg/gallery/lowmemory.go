@@ -0,0 +1,32 @@
+package gallery
+
+import (
+	"runtime/debug"
+
+	"github.com/davidbyttow/govips/v2/vips"
+)
+
+// Maximum memory of the libvips operation cache in low-memory mode. By default
+// libvips keeps up to 100 MB of recent results around, which a small device can't spare.
+const lowMemoryVipsCacheMem = 16 << 20
+
+// Maximum number of operations in the libvips cache in low-memory mode
+const lowMemoryVipsCacheSize = 10
+
+// Go garbage collection target in low-memory mode, so the buffers of finished images
+// are released before the heap has grown to twice its size
+const lowMemoryGCPercent = 25
+
+// applyLowMemoryProfile configures fastgallery and libvips for devices with a gigabyte
+// or two of memory, like a Raspberry Pi or a NAS. Files are transformed one at a time
+// by one libvips thread, with a small libvips cache and the Go heap kept small.
+func applyLowMemoryProfile(config *configuration, vipsConfig *vips.Config) {
+	config.concurrency = 1
+
+	vipsConfig.ConcurrencyLevel = 1
+	vipsConfig.MaxCacheFiles = 0
+	vipsConfig.MaxCacheMem = lowMemoryVipsCacheMem
+	vipsConfig.MaxCacheSize = lowMemoryVipsCacheSize
+
+	debug.SetGCPercent(lowMemoryGCPercent)
+}
@@ -0,0 +1,23 @@
+package gallery
+
+import (
+	"runtime/debug"
+	"testing"
+
+	"github.com/davidbyttow/govips/v2/vips"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyLowMemoryProfile(t *testing.T) {
+	config := initializeConfig()
+	vipsConfig := vips.Config{}
+
+	applyLowMemoryProfile(&config, &vipsConfig)
+	defer debug.SetGCPercent(100)
+
+	assert.EqualValues(t, 1, config.concurrency)
+	assert.EqualValues(t, 1, vipsConfig.ConcurrencyLevel)
+	assert.EqualValues(t, lowMemoryVipsCacheMem, vipsConfig.MaxCacheMem)
+	assert.EqualValues(t, lowMemoryVipsCacheSize, vipsConfig.MaxCacheSize)
+	assert.EqualValues(t, lowMemoryGCPercent, debug.SetGCPercent(100))
+}
@@ -0,0 +1,21 @@
+package gallery
+
+import (
+	"bytes"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// Markdown renderer for album descriptions. Raw HTML in the Markdown isn't rendered.
+var markdown = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+// renderMarkdown converts Markdown text to HTML
+func renderMarkdown(text string) (string, error) {
+	var buffer bytes.Buffer
+	err := markdown.Convert([]byte(text), &buffer)
+	if err != nil {
+		return "", err
+	}
+	return buffer.String(), nil
+}
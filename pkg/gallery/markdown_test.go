@@ -0,0 +1,19 @@
+package gallery
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	html, err := renderMarkdown("## Trip\n\n- ~~rain~~ sun\n- see https://example.com\n")
+	assert.NoError(t, err)
+	assert.Contains(t, html, "<h2>Trip</h2>")
+	assert.Contains(t, html, "<del>rain</del>")
+	assert.Contains(t, html, `<a href="https://example.com">https://example.com</a>`)
+
+	html, err = renderMarkdown("Hello <script>alert(1)</script>")
+	assert.NoError(t, err)
+	assert.NotContains(t, html, "<script>")
+}
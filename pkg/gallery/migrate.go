@@ -0,0 +1,160 @@
+package gallery
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Media directories of galleries made by gogallery, fastgallery's predecessor
+const (
+	legacyOriginalDir  = "Original"
+	legacyFullsizeDir  = "Pictures"
+	legacyThumbnailDir = "Thumbnails"
+)
+
+// getMigratedDirectory returns the fastgallery media directory a legacy media directory
+// is migrated to, or false if the name isn't one
+func getMigratedDirectory(name string, config configuration) (string, bool) {
+	switch name {
+	case legacyOriginalDir:
+		return config.files.originalDir, true
+	case legacyFullsizeDir:
+		return config.files.fullsizeDir, true
+	case legacyThumbnailDir:
+		return config.files.thumbnailDir, true
+	}
+	return "", false
+}
+
+// migrateFile moves one media file of a legacy gallery into the new gallery. Symlinks to
+// originals are recreated pointing to the same file, other files are hard linked where
+// possible and copied otherwise, keeping their modification times. The thumbnails have to
+// stay newer than their source files, or they'd be built again.
+func migrateFile(oldPath string, newPath string, config configuration) error {
+	oldInfo, err := os.Lstat(oldPath)
+	if err != nil {
+		return err
+	}
+
+	if oldInfo.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(oldPath)
+		if err != nil {
+			return err
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(oldPath), target)
+		}
+		err = symlinkFile(target, newPath, config)
+		if err != nil {
+			return err
+		}
+		return setOwner(newPath, config)
+	}
+
+	if getStorage(config).Link(oldPath, newPath) == nil {
+		return nil
+	}
+	err = copyIntoGallery(oldPath, newPath, config)
+	if err != nil {
+		return err
+	}
+	return getStorage(config).Chtimes(newPath, time.Now(), oldInfo.ModTime())
+}
+
+// migrateGallery converts a gallery made by gogallery into the layout of fastgallery in
+// a new directory, without transforming any media files again. Each album directory's
+// Original, Pictures and Thumbnails directories become its original, full-size and
+// thumbnail directories. Pages and assets are left behind, they're written by the next
+// run of fastgallery. Returns the number of migrated files.
+func migrateGallery(oldDirectory string, newDirectory string, dryRun bool, config configuration) (migrated int, err error) {
+	err = createDirectory(newDirectory, dryRun, config)
+	if err != nil {
+		return 0, err
+	}
+
+	err = filepath.WalkDir(oldDirectory, func(oldPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relativePath, _ := filepath.Rel(oldDirectory, oldPath)
+		if relativePath == "." {
+			return nil
+		}
+
+		// Albums are directories of their own, media files are in the media directories
+		// of each album
+		parent := filepath.Dir(relativePath)
+		mediaDirectory, isMedia := getMigratedDirectory(filepath.Base(parent), config)
+		if entry.IsDir() {
+			if isMedia {
+				return filepath.SkipDir
+			}
+			newName, isMediaDirectory := getMigratedDirectory(entry.Name(), config)
+			if !isMediaDirectory {
+				newName = entry.Name()
+			}
+			return createDirectory(filepath.Join(newDirectory, filepath.Dir(relativePath), newName), dryRun, config)
+		}
+		if !isMedia {
+			return nil
+		}
+
+		newPath := filepath.Join(newDirectory, filepath.Dir(parent), mediaDirectory, entry.Name())
+		if dryRun {
+			log.Println("Would migrate file:", oldPath, newPath)
+		} else {
+			err = migrateFile(oldPath, newPath, config)
+			if err != nil {
+				return err
+			}
+			logProgress(config, "Migrated file:", newPath)
+		}
+		migrated++
+		return nil
+	})
+	return migrated, err
+}
+
+// MigrateOptions struct holds the options of the migrate command, documented by their
+// go-arg tags. Messages gets the messages of the run, which are left out if it's nil.
+type MigrateOptions struct {
+	Old      string    `arg:"positional,required" help:"gallery directory made by gogallery"`
+	New      string    `arg:"positional,required" help:"directory to create the fastgallery gallery in"`
+	DryRun   bool      `arg:"--dry-run" help:"dry run; don't change anything, just print what would be done"`
+	Verbose  bool      `arg:"-v,--verbose" help:"print each migrated file"`
+	Config   string    `arg:"--config" help:"configuration file to build the gallery with (default: ~/.config/fastgallery/config.yaml, if it exists)"`
+	Messages io.Writer `arg:"-"`
+}
+
+// Migrate converts a gallery made by gogallery into a fastgallery one
+func Migrate(args MigrateOptions) error {
+	config, err := loadConfiguration(args.Config)
+	if err != nil {
+		return err
+	}
+	config.run.output = getOutput(args.Messages)
+	config.verbose = args.Verbose
+	oldDirectory, _ := filepath.Abs(args.Old)
+	if !isDirectory(oldDirectory) {
+		return errors.New("gallery directory doesn't exist: " + args.Old)
+	}
+
+	// Migrating into an existing gallery could mix up two galleries' files
+	newDirectory, _ := filepath.Abs(args.New)
+	if exists(newDirectory) {
+		return errors.New("new gallery directory already exists: " + args.New)
+	}
+
+	migrated, err := migrateGallery(oldDirectory, newDirectory, args.DryRun, config)
+	if err != nil {
+		return fmt.Errorf("couldn't migrate gallery %s: %w", oldDirectory, err)
+	}
+	fmt.Fprintln(config.run.output, "Migrated", migrated, "media files. Run fastgallery with your source directory and", args.New, "to write the album pages.")
+	return nil
+}
@@ -0,0 +1,56 @@
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrateGallery(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	oldDirectory := filepath.Join(tempDir, "old")
+	newDirectory := filepath.Join(tempDir, "new")
+	for _, directory := range []string{legacyThumbnailDir, legacyOriginalDir, filepath.Join("album", legacyFullsizeDir)} {
+		err := os.MkdirAll(filepath.Join(oldDirectory, directory), 0755)
+		assert.NoError(t, err)
+	}
+	for _, name := range []string{"index.html", filepath.Join(legacyThumbnailDir, "a.jpg"), filepath.Join("album", legacyFullsizeDir, "b.jpg")} {
+		err := os.WriteFile(filepath.Join(oldDirectory, name), []byte(name), 0644)
+		assert.NoError(t, err)
+	}
+	thumbnailTime := time.Date(2021, 3, 14, 12, 0, 0, 0, time.UTC)
+	os.Chtimes(filepath.Join(oldDirectory, legacyThumbnailDir, "a.jpg"), thumbnailTime, thumbnailTime)
+	os.WriteFile(filepath.Join(tempDir, "a.jpg"), []byte("source"), 0644)
+	os.Symlink(filepath.Join("..", "..", "a.jpg"), filepath.Join(oldDirectory, legacyOriginalDir, "a.jpg"))
+
+	migrated, err := migrateGallery(oldDirectory, newDirectory, true, config)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, migrated)
+	assert.NoDirExists(t, newDirectory)
+
+	migrated, err = migrateGallery(oldDirectory, newDirectory, false, config)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, migrated)
+
+	thumbnailInfo, err := os.Stat(filepath.Join(newDirectory, config.files.thumbnailDir, "a.jpg"))
+	assert.NoError(t, err)
+	assert.True(t, thumbnailInfo.ModTime().Equal(thumbnailTime))
+	assert.FileExists(t, filepath.Join(newDirectory, "album", config.files.fullsizeDir, "b.jpg"))
+	original, err := os.ReadFile(filepath.Join(newDirectory, config.files.originalDir, "a.jpg"))
+	assert.NoError(t, err)
+	assert.Equal(t, "source", string(original))
+
+	// Pages are written by the next run, and the old media directories are gone
+	assert.NoFileExists(t, filepath.Join(newDirectory, "index.html"))
+	assert.NoDirExists(t, filepath.Join(newDirectory, legacyThumbnailDir))
+	assert.NoDirExists(t, filepath.Join(newDirectory, "album", legacyFullsizeDir))
+}
@@ -0,0 +1,105 @@
+package gallery
+
+import (
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+)
+
+// Name of an album's slideshow music in its gallery directory, transcoded to AAC
+const musicFile = "_music.m4a"
+
+// readDirectoryMusic finds the audio file album.yaml picks as the album's slideshow
+// music. The file has to be inside the album's directory. Needs the album.yaml to be
+// read already.
+func readDirectoryMusic(source *directory) {
+	if source.album.Music == "" || source.album.Private {
+		return
+	}
+
+	musicPath := filepath.Join(source.absPath, filepath.FromSlash(source.album.Music))
+	if !isInsideDirectory(musicPath, source.absPath) {
+		log.Println("album music must be inside the album:", source.absPath, source.album.Music)
+		return
+	}
+	info, err := os.Stat(musicPath)
+	if err != nil || !info.Mode().IsRegular() {
+		log.Println("couldn't find album music:", source.absPath, source.album.Music)
+		return
+	}
+
+	source.music = file{
+		name:    filepath.Base(musicPath),
+		relPath: filepath.Join(source.relPath, filepath.FromSlash(source.album.Music)),
+		absPath: musicPath,
+		modTime: info.ModTime(),
+		size:    info.Size(),
+	}
+}
+
+// transcodeMusic converts an audio file to stereo AAC, which all browsers can play
+func transcodeMusic(source string, destination string, config configuration) error {
+	err := guardSource(destination, config)
+	if err != nil {
+		return err
+	}
+	ffmpegCommand := exec.Command("ffmpeg", "-y", "-i", source, "-vn", "-acodec", "aac", "-ac", "2", "-b:a", "128k", "-movflags", "faststart", "-threads", strconv.Itoa(getFFmpegThreads(config)), "-loglevel", "error", "-f", "mp4", destination)
+	commandOutput, err := ffmpegCommand.CombinedOutput()
+	if err != nil {
+		return &transcodeError{file: source, stderr: truncateOutput(string(commandOutput)), err: err}
+	}
+
+	// ffmpeg creates the file with its own permissions
+	return setPermissions(destination, config.files.fileMode, config)
+}
+
+// updateMusic transcodes the album's slideshow music into its gallery directory, unless
+// it's already there and newer than the source, in which case it's marked as existing
+func updateMusic(source *directory, galleryDirectory string, dryRun bool, config configuration) {
+	if source.music.absPath == "" {
+		return
+	}
+
+	destination := filepath.Join(galleryDirectory, musicFile)
+	if galleryInfo, err := os.Stat(destination); err == nil && !galleryInfo.ModTime().Before(source.music.modTime) {
+		source.music.exists = true
+		return
+	}
+
+	if dryRun {
+		log.Println("Would transcode album music:", source.music.absPath, destination)
+		return
+	}
+	err := transcodeMusic(source.music.absPath, destination, config)
+	if err != nil {
+		log.Println("couldn't transcode album music:", err.Error())
+		getStorage(config).Remove(destination)
+		return
+	}
+	logProgress(config, "Transcoded album music:", destination)
+}
+
+// cleanMusic recursively removes the slideshow music of albums which no longer have any
+func cleanMusic(source directory, galleryRoot string, dryRun bool, config configuration) {
+	// Albums outside the subtree of a partial run weren't read
+	if source.keptStats != nil {
+		return
+	}
+
+	musicPath := filepath.Join(galleryRoot, source.relPath, musicFile)
+	if source.music.absPath == "" && exists(musicPath) {
+		if dryRun {
+			log.Println("would clean up album music:", musicPath)
+		} else if err := getStorage(config).Remove(musicPath); err != nil {
+			log.Println("couldn't delete stale album music", musicPath, ":", err.Error())
+		} else {
+			logProgress(config, "Cleaned up album music:", musicPath)
+		}
+	}
+
+	for _, subdir := range source.subdirectories {
+		cleanMusic(subdir, galleryRoot, dryRun, config)
+	}
+}
@@ -0,0 +1,89 @@
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadDirectoryMusic(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	err = os.WriteFile(filepath.Join(tempDir, "song.mp3"), []byte("music"), 0644)
+	assert.NoError(t, err)
+
+	source := directory{absPath: tempDir, relPath: "album", album: albumConfig{Music: "song.mp3"}}
+	readDirectoryMusic(&source)
+	assert.Equal(t, filepath.Join(tempDir, "song.mp3"), source.music.absPath)
+	assert.Equal(t, filepath.Join("album", "song.mp3"), source.music.relPath)
+	assert.EqualValues(t, 5, source.music.size)
+
+	// Music has to exist and be in the album
+	for _, music := range []string{"missing.mp3", "../song.mp3"} {
+		source = directory{absPath: tempDir, album: albumConfig{Music: music}}
+		readDirectoryMusic(&source)
+		assert.Equal(t, "", source.music.absPath)
+	}
+
+	source = directory{absPath: tempDir, album: albumConfig{Music: "song.mp3", Private: true}}
+	readDirectoryMusic(&source)
+	assert.Equal(t, "", source.music.absPath)
+}
+
+func TestUpdateMusic(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	source := directory{music: file{absPath: filepath.Join(tempDir, "song.mp3"), modTime: time.Now().Add(-time.Hour)}}
+
+	// Nothing is transcoded in a dry run
+	updateMusic(&source, tempDir, true, config)
+	assert.False(t, source.music.exists)
+	assert.NoFileExists(t, filepath.Join(tempDir, musicFile))
+
+	// Music newer than the source is kept
+	err = os.WriteFile(filepath.Join(tempDir, musicFile), []byte("music"), 0644)
+	assert.NoError(t, err)
+	updateMusic(&source, tempDir, false, config)
+	assert.True(t, source.music.exists)
+}
+
+func TestCleanMusic(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	err = os.MkdirAll(filepath.Join(tempDir, "kept"), 0755)
+	assert.NoError(t, err)
+	err = os.MkdirAll(filepath.Join(tempDir, "removed"), 0755)
+	assert.NoError(t, err)
+	for _, album := range []string{"kept", "removed"} {
+		err = os.WriteFile(filepath.Join(tempDir, album, musicFile), []byte("music"), 0644)
+		assert.NoError(t, err)
+	}
+
+	source := directory{subdirectories: []directory{
+		{relPath: "kept", music: file{absPath: "/source/kept/song.mp3"}},
+		{relPath: "removed"},
+	}}
+	cleanMusic(source, tempDir, true, config)
+	assert.FileExists(t, filepath.Join(tempDir, "removed", musicFile))
+
+	cleanMusic(source, tempDir, false, config)
+	assert.FileExists(t, filepath.Join(tempDir, "kept", musicFile))
+	assert.NoFileExists(t, filepath.Join(tempDir, "removed", musicFile))
+}
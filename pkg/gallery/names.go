@@ -0,0 +1,146 @@
+package gallery
+
+import (
+	"log"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// Policies for naming the thumbnail, full-size and original files in the gallery.
+// preserve keeps the source filename, lowercase lowercases it and slug also replaces
+// everything but letters and digits with dashes, for URLs without any escaping.
+const (
+	namePolicyPreserve  = "preserve"
+	namePolicyLowercase = "lowercase"
+	namePolicySlug      = "slug"
+)
+
+// isNamePolicy checks whether given string is a known gallery file naming policy
+func isNamePolicy(policy string) bool {
+	switch policy {
+	case namePolicyPreserve, namePolicyLowercase, namePolicySlug:
+		return true
+	default:
+		return false
+	}
+}
+
+// slugify lowercases a filename and replaces each run of characters other than letters
+// and digits with a dash
+func slugify(name string) string {
+	var slug strings.Builder
+	dash := false
+	for _, character := range strings.ToLower(name) {
+		if unicode.IsLetter(character) || unicode.IsDigit(character) {
+			if dash && slug.Len() > 0 {
+				slug.WriteRune('-')
+			}
+			slug.WriteRune(character)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return slug.String()
+}
+
+// getGalleryBasename returns the filename without extension of a source file's gallery
+// files, according to the naming policy
+func getGalleryBasename(sourceFilename string, config configuration) string {
+	basename := stripExtension(sourceFilename)
+	switch config.files.namePolicy {
+	case namePolicyLowercase:
+		return strings.ToLower(basename)
+	case namePolicySlug:
+		if slug := slugify(basename); slug != "" {
+			return slug
+		}
+		return basename
+	default:
+		return basename
+	}
+}
+
+// getOriginalFilename returns the filename of a source file's original in the gallery,
+// according to the naming policy. Only the preserve policy keeps the extension's case.
+func getOriginalFilename(sourceFilename string, config configuration) string {
+	if config.files.namePolicy == namePolicyPreserve || config.files.namePolicy == "" {
+		return sourceFilename
+	}
+	return getGalleryBasename(sourceFilename, config) + strings.ToLower(filepath.Ext(sourceFilename))
+}
+
+// getCaseName returns the name a gallery file of a source file with given gallery
+// basename should have, after matching it case-insensitively: the basename in the case
+// of the source file and the rest in lower case, e.g. IMG_0001@2x.jpg for img_0001@2X.JPG
+func getCaseName(galleryFilename string, basename string) string {
+	if len(galleryFilename) < len(basename) {
+		return galleryFilename
+	}
+	return basename + strings.ToLower(galleryFilename[len(basename):])
+}
+
+// matchesSourceBasename checks whether a gallery file basename belongs to the source file
+// with given gallery basename. Names only differing in case match, unless another source
+// file of the directory has the exact name of the gallery file: case twins like A.jpg
+// and a.jpg each keep their own gallery files.
+func matchesSourceBasename(galleryBasename string, sourceBasename string, sourceBasenames map[string]bool) bool {
+	if galleryBasename == sourceBasename {
+		return true
+	}
+	return strings.EqualFold(galleryBasename, sourceBasename) && !sourceBasenames[galleryBasename]
+}
+
+// setCaseName marks a gallery file to be renamed to given name, if its name only differs
+// from it in case
+func setCaseName(galleryFile *file, name string) {
+	if galleryFile.name != name && strings.EqualFold(galleryFile.name, name) {
+		galleryFile.caseName = name
+	}
+}
+
+// renameGalleryFileCases renames the thumbnail, full-size and original files of a gallery
+// directory whose names only differ in case from the ones of their source files, e.g.
+// after renaming IMG_0001.JPG to img_0001.jpg in the source. On case-sensitive file
+// systems the links of the album page would be broken otherwise, and on case-insensitive
+// ones the files would be built again and then cleaned up as stale. A file which has a
+// twin with the right name already is left stale.
+func renameGalleryFileCases(gallery *directory, dryRun bool, config configuration) {
+	for h, subdir := range gallery.subdirectories {
+		if subdir.name != config.files.thumbnailDir && subdir.name != config.files.fullsizeDir && subdir.name != config.files.originalDir {
+			continue
+		}
+
+		names := make(map[string]bool)
+		for _, galleryFile := range subdir.files {
+			names[galleryFile.name] = true
+		}
+		for i := range subdir.files {
+			galleryFile := &gallery.subdirectories[h].files[i]
+			if galleryFile.caseName == "" {
+				continue
+			}
+			caseName := galleryFile.caseName
+			galleryFile.caseName = ""
+			if names[caseName] {
+				galleryFile.exists = false
+				continue
+			}
+
+			oldPath, newPath := filepath.Join(subdir.absPath, galleryFile.name), filepath.Join(subdir.absPath, caseName)
+			if dryRun {
+				log.Println("Would rename gallery file:", oldPath, newPath)
+				continue
+			}
+			err := getStorage(config).Rename(oldPath, newPath)
+			if err != nil {
+				log.Println("couldn't rename gallery file", oldPath, ":", err.Error())
+				continue
+			}
+			logProgress(config, "Renamed gallery file:", oldPath, newPath)
+			galleryFile.name = caseName
+			names[caseName] = true
+		}
+	}
+}
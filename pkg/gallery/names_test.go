@@ -0,0 +1,166 @@
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlugify(t *testing.T) {
+	assert.EqualValues(t, "img-0012", slugify("IMG_0012"))
+	assert.EqualValues(t, "summer-party-3", slugify("  Summer party (3) "))
+	assert.EqualValues(t, "järvi", slugify("Järvi"))
+	assert.EqualValues(t, "", slugify("__"))
+}
+
+func TestGalleryNames(t *testing.T) {
+	config := initializeConfig()
+	assert.True(t, isNamePolicy(config.files.namePolicy))
+	assert.False(t, isNamePolicy("uppercase"))
+
+	thumbnailFilename, fullsizeFilename := getGalleryFilenames("My Trip_01.JPG", config)
+	assert.EqualValues(t, "My Trip_01.jpg", thumbnailFilename)
+	assert.EqualValues(t, "My Trip_01.jpg", fullsizeFilename)
+	assert.EqualValues(t, "My Trip_01.JPG", getOriginalFilename("My Trip_01.JPG", config))
+
+	config.files.namePolicy = namePolicyLowercase
+	thumbnailFilename, fullsizeFilename = getGalleryFilenames("My Trip_01.MOV", config)
+	assert.EqualValues(t, "my trip_01.jpg", thumbnailFilename)
+	assert.EqualValues(t, "my trip_01.mp4", fullsizeFilename)
+	assert.EqualValues(t, "my trip_01.mov", getOriginalFilename("My Trip_01.MOV", config))
+
+	config.files.namePolicy = namePolicySlug
+	thumbnailFilename, _ = getGalleryFilenames("My Trip_01.JPG", config)
+	assert.EqualValues(t, "my-trip-01.jpg", thumbnailFilename)
+	assert.EqualValues(t, "my-trip-01.jpg", getOriginalFilename("My Trip_01.JPG", config))
+	assert.EqualValues(t, "__", getGalleryBasename("__.jpg", config))
+}
+
+func TestCompareDirectoryNamePolicy(t *testing.T) {
+	config := initializeConfig()
+	config.files.namePolicy = namePolicySlug
+
+	source := directory{files: []file{{name: "My Trip.JPG"}}}
+	gallery := directory{subdirectories: []directory{
+		{name: config.files.thumbnailDir, files: []file{{name: "my-trip.jpg"}}},
+		{name: config.files.fullsizeDir, files: []file{{name: "my-trip.jpg"}}},
+		{name: config.files.originalDir, files: []file{{name: "my-trip.jpg"}}},
+	}}
+	gallery.subdirectories[0].files[0].modTime = gallery.subdirectories[0].files[0].modTime.AddDate(2000, 0, 0)
+
+	compareDirectory(&source, &gallery, config)
+	assert.True(t, source.files[0].exists)
+	assert.True(t, gallery.subdirectories[0].files[0].exists)
+
+	// Gallery files named by another policy are stale
+	config.files.namePolicy = namePolicyPreserve
+	source.files[0].exists = false
+	compareDirectory(&source, &gallery, config)
+	assert.False(t, source.files[0].exists)
+}
+
+func TestCompareDirectoryCase(t *testing.T) {
+	config := initializeConfig()
+	config.media.densities = []int{2}
+
+	source := directory{files: []file{{name: "Photo.JPG"}, {name: "b.jpg"}}}
+	gallery := directory{subdirectories: []directory{
+		{name: config.files.thumbnailDir, files: []file{{name: "photo.jpg"}, {name: "PHOTO@2X.JPG"}, {name: "b.jpg"}}},
+		{name: config.files.fullsizeDir, files: []file{{name: "photo.jpg"}, {name: "b.jpg"}}},
+		{name: config.files.originalDir, files: []file{{name: "PHOTO.JPG"}, {name: "b.jpg"}}},
+	}}
+	for h := range gallery.subdirectories {
+		for i := range gallery.subdirectories[h].files {
+			gallery.subdirectories[h].files[i].modTime = gallery.subdirectories[h].files[i].modTime.AddDate(2000, 0, 0)
+		}
+	}
+
+	compareDirectory(&source, &gallery, config)
+	assert.True(t, source.files[0].exists)
+	assert.Equal(t, "Photo.jpg", gallery.subdirectories[0].files[0].caseName)
+	assert.Equal(t, "Photo@2x.jpg", gallery.subdirectories[0].files[1].caseName)
+	assert.Equal(t, "Photo.jpg", gallery.subdirectories[1].files[0].caseName)
+	assert.Equal(t, "Photo.JPG", gallery.subdirectories[2].files[0].caseName)
+	assert.Empty(t, gallery.subdirectories[0].files[2].caseName)
+}
+
+func TestCompareDirectoryCaseTwins(t *testing.T) {
+	config := initializeConfig()
+	config.media.densities = []int{2}
+
+	source := directory{files: []file{{name: "A.jpg"}, {name: "a.jpg"}, {name: "B.jpg"}, {name: "b.jpg"}}}
+	gallery := directory{subdirectories: []directory{
+		{name: config.files.thumbnailDir, files: []file{{name: "A.jpg"}, {name: "A@2x.jpg"}, {name: "a.jpg"}, {name: "a@2x.jpg"}, {name: "B.jpg"}}},
+		{name: config.files.fullsizeDir, files: []file{{name: "A.jpg"}, {name: "a.jpg"}, {name: "B.jpg"}}},
+		{name: config.files.originalDir, files: []file{{name: "A.jpg"}, {name: "a.jpg"}, {name: "B.jpg"}}},
+	}}
+	for h := range gallery.subdirectories {
+		for i := range gallery.subdirectories[h].files {
+			gallery.subdirectories[h].files[i].modTime = gallery.subdirectories[h].files[i].modTime.AddDate(2000, 0, 0)
+		}
+	}
+
+	compareDirectory(&source, &gallery, config)
+	assert.True(t, source.files[0].exists)
+	assert.True(t, source.files[1].exists)
+	assert.True(t, source.files[2].exists)
+	// The gallery files of B.jpg don't belong to its twin b.jpg, which is built
+	assert.False(t, source.files[3].exists)
+	for _, subdir := range gallery.subdirectories {
+		for _, galleryFile := range subdir.files {
+			assert.True(t, galleryFile.exists, galleryFile.name)
+			assert.Empty(t, galleryFile.caseName, galleryFile.name)
+		}
+	}
+
+	renameGalleryFileCases(&gallery, true, config)
+	for _, subdir := range gallery.subdirectories {
+		for _, galleryFile := range subdir.files {
+			assert.True(t, galleryFile.exists, galleryFile.name)
+		}
+	}
+}
+
+func TestRenameGalleryFileCases(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	thumbnailDir := filepath.Join(tempDir, config.files.thumbnailDir)
+	os.Mkdir(thumbnailDir, 0755)
+	os.WriteFile(filepath.Join(thumbnailDir, "photo.jpg"), []byte("jpeg"), 0644)
+	os.WriteFile(filepath.Join(thumbnailDir, "b.jpg"), []byte("old"), 0644)
+
+	gallery := directory{subdirectories: []directory{{name: config.files.thumbnailDir, absPath: thumbnailDir, files: []file{
+		{name: "photo.jpg", exists: true, caseName: "Photo.jpg"},
+		{name: "b.jpg", exists: true, caseName: "B.jpg"},
+		{name: "B.jpg", exists: true},
+	}}}}
+
+	// Dry runs leave the files be
+	renameGalleryFileCases(&gallery, true, config)
+	assert.FileExists(t, filepath.Join(thumbnailDir, "photo.jpg"))
+
+	gallery.subdirectories[0].files[0].caseName = "Photo.jpg"
+	gallery.subdirectories[0].files[1].caseName = "B.jpg"
+	renameGalleryFileCases(&gallery, false, config)
+	assert.Equal(t, "Photo.jpg", gallery.subdirectories[0].files[0].name)
+	assert.True(t, gallery.subdirectories[0].files[0].exists)
+	entries, err := os.ReadDir(thumbnailDir)
+	assert.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.Contains(t, names, "Photo.jpg")
+	assert.NotContains(t, names, "photo.jpg")
+
+	// A file with a twin of the right name is left stale for the cleanup
+	assert.Equal(t, "b.jpg", gallery.subdirectories[0].files[1].name)
+	assert.False(t, gallery.subdirectories[0].files[1].exists)
+}
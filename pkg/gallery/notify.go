@@ -0,0 +1,87 @@
+package gallery
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// runReport struct is the end-of-run report posted to the --notify-webhook URL.
+// UpdatedFiles counts the new and changed media files, including the failed ones.
+type runReport struct {
+	Source          string          `json:"source"`
+	Gallery         string          `json:"gallery"`
+	Started         time.Time       `json:"started"`
+	DurationSeconds float64         `json:"durationSeconds"`
+	UpdatedFiles    int             `json:"updatedFiles"`
+	FailedFiles     int             `json:"failedFiles"`
+	Failures        []reportFailure `json:"failures,omitempty"`
+}
+
+// reportFailure struct is one file which couldn't be transformed in the run report.
+// Output is the truncated output of ffmpeg, if it failed.
+type reportFailure struct {
+	File   string `json:"file"`
+	Cause  string `json:"cause"`
+	Error  string `json:"error"`
+	Output string `json:"output,omitempty"`
+}
+
+// createRunReport collects the counts and failures of the run into a report
+func createRunReport(source directory, gallery directory, started time.Time, updatedFiles int, config configuration) (report runReport) {
+	report.Source = source.absPath
+	report.Gallery = gallery.absPath
+	report.Started = started
+	report.DurationSeconds = time.Since(started).Seconds()
+	report.UpdatedFiles = updatedFiles
+
+	config.run.failureMutex.Lock()
+	defer config.run.failureMutex.Unlock()
+	for _, thisFailure := range config.run.sortedFailures() {
+		reported := reportFailure{
+			File:  thisFailure.file,
+			Cause: failureCause(thisFailure.err),
+			Error: thisFailure.err.Error(),
+		}
+		var thisTranscodeError *transcodeError
+		if errors.As(thisFailure.err, &thisTranscodeError) {
+			reported.Output = thisTranscodeError.stderr
+		}
+		report.Failures = append(report.Failures, reported)
+	}
+	report.FailedFiles = len(report.Failures)
+
+	return report
+}
+
+// postRunReport POSTs the run report as JSON to given webhook URL, so unattended
+// builds can alert someone when something breaks
+func postRunReport(report runReport, webhookURL string, dryRun bool) error {
+	if dryRun {
+		log.Println("Would post run report to", webhookURL)
+		return nil
+	}
+
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	client := http.Client{Timeout: time.Minute}
+	response, err := client.Post(webhookURL, "application/json", bytes.NewReader(reportJSON))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("run report notification to %s failed: %s", webhookURL, response.Status)
+	}
+
+	log.Println("Posted run report to", webhookURL)
+	return nil
+}
@@ -0,0 +1,45 @@
+package gallery
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostRunReport(t *testing.T) {
+	config := initializeConfig()
+	config.run.addFailure("/source/a.mov", &transcodeError{file: "/source/a.mov", stderr: "moov atom not found", err: errors.New("exit status 1")})
+
+	started := time.Now().Add(-time.Minute)
+	report := createRunReport(directory{absPath: "/source"}, directory{absPath: "/gallery"}, started, 3, config)
+	assert.EqualValues(t, 3, report.UpdatedFiles)
+	assert.EqualValues(t, 1, report.FailedFiles)
+	assert.EqualValues(t, "video transcoding failed", report.Failures[0].Cause)
+	assert.EqualValues(t, "moov atom not found", report.Failures[0].Output)
+	assert.True(t, report.DurationSeconds >= 60)
+
+	var received runReport
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.EqualValues(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	err := postRunReport(report, server.URL, false)
+	assert.NoError(t, err)
+	assert.EqualValues(t, "/gallery", received.Gallery)
+	assert.EqualValues(t, "/source/a.mov", received.Failures[0].File)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	assert.Error(t, postRunReport(report, failing.URL, false))
+	assert.NoError(t, postRunReport(report, failing.URL, true))
+}
@@ -0,0 +1,115 @@
+package gallery
+
+import (
+	"html"
+	"log"
+	"path/filepath"
+
+	"github.com/davidbyttow/govips/v2/vips"
+)
+
+// Each album gets a social preview image linked as its og:image, so shared album links
+// show the album's cover with its title in chat apps and social media. The size is the
+// 1.91:1 aspect ratio recommended for link previews.
+const (
+	ogImageFile   = "_preview.jpg"
+	ogImageWidth  = 1200
+	ogImageHeight = 630
+	ogTitleHeight = 90
+	ogTitleMargin = 50
+)
+
+// findAlbumCover returns the path of the full-size image in the gallery used as the
+// album's cover: the hero image, or the album's first image. Returns an empty string
+// if the album has no images.
+func findAlbumCover(source directory, galleryDirectory string, config configuration) string {
+	hero := findHeroImage(source, config)
+	if hero != "" {
+		return filepath.Join(galleryDirectory, filepath.FromSlash(hero))
+	}
+
+	for _, file := range source.files {
+		if isImageFile(file.absPath, config) {
+			_, fullsizeFilename := getGalleryFilenames(file.absPath, config)
+			return filepath.Join(galleryDirectory, config.files.fullsizeDir, fullsizeFilename)
+		}
+	}
+	return ""
+}
+
+// createOGImage creates the album's social preview image in the gallery directory by
+// cropping the cover image and writing the album title on a darkened band at the bottom.
+// Returns the preview's filename, or an empty string if the album has no cover image or
+// the preview couldn't be created.
+func createOGImage(source directory, galleryDirectory string, title string, dryRun bool, config configuration) string {
+	cover := findAlbumCover(source, galleryDirectory, config)
+	if cover == "" {
+		return ""
+	}
+
+	ogImagePath := filepath.Join(galleryDirectory, ogImageFile)
+	if dryRun {
+		log.Println("Would create preview image:", ogImagePath)
+		return ogImageFile
+	}
+
+	image, err := vips.NewImageFromFile(cover)
+	if err != nil {
+		log.Println("couldn't open cover image:", cover, err.Error())
+		return ""
+	}
+
+	err = image.Thumbnail(ogImageWidth, ogImageHeight, vips.InterestingAttention)
+	if err != nil {
+		log.Println("couldn't crop preview image:", cover, err.Error())
+		return ""
+	}
+
+	// Darken the bottom of the image so the title is legible on light covers
+	bandHeight := ogTitleHeight + 2*ogTitleMargin
+	band, err := image.Copy()
+	if err == nil {
+		err = band.ExtractArea(0, ogImageHeight-bandHeight, ogImageWidth, bandHeight)
+	}
+	if err == nil {
+		err = band.Linear1(0.4, 0)
+	}
+	if err == nil {
+		err = image.Composite(band, vips.BlendModeOver, 0, ogImageHeight-bandHeight)
+	}
+	if err != nil {
+		log.Println("couldn't darken preview image:", cover, err.Error())
+		return ""
+	}
+
+	// The label text is Pango markup, and its font size is fitted to the label's box
+	err = image.Label(&vips.LabelParams{
+		Text:      html.EscapeString(title),
+		Font:      "sans bold",
+		Width:     vips.ValueOf(ogImageWidth - 2*ogTitleMargin),
+		Height:    vips.ValueOf(ogTitleHeight),
+		OffsetX:   vips.ValueOf(ogTitleMargin),
+		OffsetY:   vips.ValueOf(ogImageHeight - ogTitleHeight - ogTitleMargin),
+		Opacity:   1,
+		Color:     vips.Color{R: 255, G: 255, B: 255},
+		Alignment: vips.AlignLow,
+	})
+	if err != nil {
+		log.Println("couldn't write title on preview image:", cover, err.Error())
+		return ""
+	}
+
+	ogImageBuffer, _, err := image.Export(vips.NewDefaultJPEGExportParams())
+	if err != nil {
+		log.Println("couldn't export preview image:", cover, err.Error())
+		return ""
+	}
+
+	err = writeFile(ogImagePath, ogImageBuffer, config)
+	if err != nil {
+		log.Println("couldn't write preview image:", ogImagePath, err.Error())
+		return ""
+	}
+
+	return ogImageFile
+}
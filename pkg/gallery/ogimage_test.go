@@ -0,0 +1,29 @@
+package gallery
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindAlbumCover(t *testing.T) {
+	config := initializeConfig()
+	source := directory{
+		files:          []file{{name: "a.mp4", absPath: "/photos/a.mp4"}, {name: "b.jpg", absPath: "/photos/b.jpg"}, {name: "c.jpg", absPath: "/photos/c.jpg"}},
+		subdirectories: []directory{{name: "trip", files: []file{{name: "sunset.jpg", absPath: "/photos/sunset.jpg"}}}},
+	}
+	assert.EqualValues(t, filepath.Join("gallery", "_fullsize", "b.jpg"), findAlbumCover(source, "gallery", config))
+
+	source.album.Hero = "trip/sunset.jpg"
+	assert.EqualValues(t, filepath.Join("gallery", "trip", "_fullsize", "sunset.jpg"), findAlbumCover(source, "gallery", config))
+
+	assert.EqualValues(t, "", findAlbumCover(directory{files: []file{{name: "a.mp4", absPath: "/photos/a.mp4"}}}, "gallery", config))
+}
+
+func TestCreateOGImage(t *testing.T) {
+	config := initializeConfig()
+	assert.EqualValues(t, ogImageFile, createOGImage(directory{files: []file{{name: "a.jpg", absPath: "/photos/a.jpg"}}}, "gallery", "Album", true, config))
+	assert.EqualValues(t, "", createOGImage(directory{files: []file{{name: "a.mp4", absPath: "/photos/a.mp4"}}}, "gallery", "Album", true, config))
+	assert.True(t, reservedFile(ogImageFile, config))
+}
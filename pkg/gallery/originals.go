@@ -0,0 +1,127 @@
+package gallery
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// How originals are put into the gallery. Symlinks take no space but break when the
+// gallery is uploaded or synced elsewhere, copies work anywhere and hard links work
+// anywhere on the same file system without taking space.
+const (
+	originalsSymlink  = "symlink"
+	originalsCopy     = "copy"
+	originalsHardlink = "hardlink"
+)
+
+// isOriginalsMode checks whether given name is a way of putting originals into the gallery
+func isOriginalsMode(mode string) bool {
+	switch mode {
+	case originalsSymlink, originalsCopy, originalsHardlink:
+		return true
+	default:
+		return false
+	}
+}
+
+// removeOriginal removes an existing original before it's replaced. Symlinks are removed
+// themselves, writing through them would overwrite the source file.
+func removeOriginal(destination string, config configuration) error {
+	if _, err := os.Lstat(destination); err != nil {
+		return nil
+	}
+	err := getStorage(config).Remove(destination)
+	if err != nil {
+		log.Println("couldn't remove original:", destination)
+	}
+	return err
+}
+
+// copyFile copies a source file into the gallery, keeping its modification time
+func copyFile(source string, destination string, config configuration) error {
+	sourceHandle, err := os.Open(source)
+	if err != nil {
+		log.Println("couldn't open source file for copy:", source, err.Error())
+		return err
+	}
+	defer sourceHandle.Close()
+
+	err = removeOriginal(destination, config)
+	if err != nil {
+		return err
+	}
+	destinationHandle, err := createFile(destination, config)
+	if err != nil {
+		log.Println("couldn't create copy of source file:", destination, err.Error())
+		return err
+	}
+	_, err = io.Copy(destinationHandle, sourceHandle)
+	if err == nil {
+		err = destinationHandle.Sync()
+	}
+	if closeErr := destinationHandle.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Println("couldn't copy file:", source, destination, err.Error())
+		return err
+	}
+
+	if sourceInfo, err := sourceHandle.Stat(); err == nil {
+		err = getStorage(config).Chtimes(destination, sourceInfo.ModTime(), sourceInfo.ModTime())
+		if err != nil {
+			log.Println("couldn't set modification time of copy:", destination, err.Error())
+		}
+	}
+	return nil
+}
+
+// hardlinkFile hard links a source file into the gallery. Hard links only work on the
+// same file system, so the file is copied if it's on another one. Returns whether the
+// file was linked.
+func hardlinkFile(source string, destination string, config configuration) (linked bool, err error) {
+	err = removeOriginal(destination, config)
+	if err != nil {
+		return false, err
+	}
+	err = getStorage(config).Link(source, destination)
+	if err != nil {
+		logProgress(config, "Couldn't hard link original, copying it instead:", source, err.Error())
+		return false, copyFile(source, destination, config)
+	}
+	return true, nil
+}
+
+// convertOriginals replaces the symlinked originals of the files of a source directory
+// already in the gallery with copies or hard links, after switching from symlinks. New
+// files get their originals with their transformation.
+func convertOriginals(source directory, galleryDirectory string, dryRun bool, config configuration) {
+	if config.files.noOriginals || config.files.originals == originalsSymlink {
+		return
+	}
+
+	originalDirectory := filepath.Join(galleryDirectory, config.files.originalDir)
+	for _, file := range source.files {
+		if !file.exists {
+			continue
+		}
+		originalPath := filepath.Join(originalDirectory, getOriginalFilename(file.name, config))
+		info, err := os.Lstat(originalPath)
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+
+		if dryRun {
+			log.Println("Would replace symlinked original:", originalPath)
+			continue
+		}
+		err = createOriginal(file.absPath, originalPath, config)
+		if err != nil {
+			log.Println("couldn't replace symlinked original", originalPath, ":", err.Error())
+			continue
+		}
+		logProgress(config, "Replaced symlinked original:", originalPath)
+	}
+}
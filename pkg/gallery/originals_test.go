@@ -0,0 +1,140 @@
+package gallery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateOriginal(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	sourcePath := filepath.Join(tempDir, "a.jpg")
+	err = os.WriteFile(sourcePath, []byte("photo"), 0644)
+	assert.NoError(t, err)
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	err = os.Chtimes(sourcePath, modTime, modTime)
+	assert.NoError(t, err)
+	sourceInfo, err := os.Stat(sourcePath)
+	assert.NoError(t, err)
+
+	config := initializeConfig()
+	destination := filepath.Join(tempDir, "original.jpg")
+	err = createOriginal(sourcePath, destination, config)
+	assert.NoError(t, err)
+	info, err := os.Lstat(destination)
+	assert.NoError(t, err)
+	assert.NotZero(t, info.Mode()&os.ModeSymlink)
+
+	// Copies replace symlinks without writing through them
+	config.files.originals = originalsCopy
+	err = createOriginal(sourcePath, destination, config)
+	assert.NoError(t, err)
+	info, err = os.Lstat(destination)
+	assert.NoError(t, err)
+	assert.True(t, info.Mode().IsRegular())
+	assert.False(t, os.SameFile(sourceInfo, info))
+	assert.True(t, modTime.Equal(info.ModTime()))
+	contents, err := os.ReadFile(destination)
+	assert.NoError(t, err)
+	assert.Equal(t, "photo", string(contents))
+
+	config.files.originals = originalsHardlink
+	err = createOriginal(sourcePath, destination, config)
+	assert.NoError(t, err)
+	info, err = os.Lstat(destination)
+	assert.NoError(t, err)
+	assert.True(t, os.SameFile(sourceInfo, info))
+
+	contents, err = os.ReadFile(sourcePath)
+	assert.NoError(t, err)
+	assert.Equal(t, "photo", string(contents))
+}
+
+func TestHardlinkedOriginalOwner(t *testing.T) {
+	tempDir := t.TempDir()
+	sourcePath := filepath.Join(tempDir, "a.jpg")
+	err := os.WriteFile(sourcePath, []byte("photo"), 0644)
+	assert.NoError(t, err)
+
+	memory := useMemoryStorage(t)
+	config := initializeConfig()
+	config.files.uid = 4242
+	galleryDirectory := filepath.Join(tempDir, "gallery")
+
+	// Hard links keep the owner of the source file, copies get the gallery's
+	config.files.originals = originalsHardlink
+	linked := filepath.Join(galleryDirectory, "linked.jpg")
+	err = createOriginal(sourcePath, linked, config)
+	assert.NoError(t, err)
+	assert.Contains(t, memory.symlinks, linked)
+	assert.NotContains(t, memory.owners, linked)
+
+	config.files.originals = originalsCopy
+	copied := filepath.Join(galleryDirectory, "copied.jpg")
+	err = createOriginal(sourcePath, copied, config)
+	assert.NoError(t, err)
+	assert.Equal(t, 4242, memory.owners[copied])
+}
+
+func TestHardlinkedOriginalsParanoid(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceDirectory := filepath.Join(tempDir, "source")
+	galleryDirectory := filepath.Join(tempDir, "gallery")
+	assert.NoError(t, os.Mkdir(sourceDirectory, 0755))
+	assert.NoError(t, os.Mkdir(galleryDirectory, 0755))
+
+	options := NewOptions(sourceDirectory, galleryDirectory)
+	options.Originals = originalsHardlink
+	options.Paranoid = true
+	err := Build(context.Background(), options)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "--paranoid")
+	assert.NoFileExists(t, filepath.Join(galleryDirectory, defaultHTMLFile))
+}
+
+func TestConvertOriginals(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	sourcePath := filepath.Join(tempDir, "a.jpg")
+	err = os.WriteFile(sourcePath, []byte("photo"), 0644)
+	assert.NoError(t, err)
+	galleryDirectory := filepath.Join(tempDir, "gallery")
+	originalPath := filepath.Join(galleryDirectory, config.files.originalDir, "a.jpg")
+	err = os.MkdirAll(filepath.Dir(originalPath), 0755)
+	assert.NoError(t, err)
+	err = os.Symlink(sourcePath, originalPath)
+	assert.NoError(t, err)
+	source := directory{files: []file{{name: "a.jpg", absPath: sourcePath, exists: true}, {name: "b.jpg", absPath: filepath.Join(tempDir, "b.jpg")}}}
+
+	// Symlinked originals are kept as long as originals are symlinked
+	convertOriginals(source, galleryDirectory, false, config)
+	info, err := os.Lstat(originalPath)
+	assert.NoError(t, err)
+	assert.NotZero(t, info.Mode()&os.ModeSymlink)
+
+	config.files.originals = originalsCopy
+	convertOriginals(source, galleryDirectory, true, config)
+	info, err = os.Lstat(originalPath)
+	assert.NoError(t, err)
+	assert.NotZero(t, info.Mode()&os.ModeSymlink)
+
+	convertOriginals(source, galleryDirectory, false, config)
+	info, err = os.Lstat(originalPath)
+	assert.NoError(t, err)
+	assert.True(t, info.Mode().IsRegular())
+	assert.NoFileExists(t, filepath.Join(galleryDirectory, config.files.originalDir, "b.jpg"))
+}
@@ -0,0 +1,88 @@
+package gallery
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"log"
+	"path/filepath"
+)
+
+// Name of the file in the gallery root listing the hash of each album page, for the
+// service worker to tell which of its cached pages are outdated
+const pageHashesFile = "pages.json"
+
+// getPageSettingsHash hashes what all album pages depend on besides their albums: the
+// fastgallery version, the page template and the settings. The workspace and adopted
+// gallery are different on each run without changing the pages, so they're left out.
+func getPageSettingsHash(config configuration) string {
+	pageHash := sha256.New()
+	fmt.Fprintln(pageHash, getVersion())
+
+	template, err := assets.ReadFile(filepath.Join(config.assets.assetsDir, config.assets.htmlTemplate))
+	if err == nil {
+		pageHash.Write(template)
+	}
+
+	files := config.files
+	files.workspaceDir = ""
+	files.adoptDir = ""
+	media := config.media
+	media.timezone = nil
+	fmt.Fprintf(pageHash, "%+v\n%+v\n%+v\n%s\n", files, config.assets, media, config.media.timezone)
+	return hex.EncodeToString(pageHash.Sum(nil))
+}
+
+// getPageHash hashes everything the album page of a source directory is made of: its
+// files with their metadata, album.yaml settings, attachments and music, the hashes of
+// its subalbums' pages, whose statistics are shown on the album tiles, and the settings
+// hash. Files with rebuilt gallery files count as changed, as their full-size dimensions
+// may have changed.
+func getPageHash(source directory, subalbumHashes []string, settingsHash string) string {
+	pageHash := sha256.New()
+	fmt.Fprintln(pageHash, settingsHash, source.relPath, source.title, source.split)
+	fmt.Fprintf(pageHash, "%+v\n", source.album)
+
+	for _, file := range source.files {
+		writeFileHash(pageHash, file)
+		fmt.Fprintln(pageHash, file.takenTime.UnixNano(), file.camera, file.exposure, file.width, file.height, file.latitude, file.longitude, file.geotagged, file.outdatedThumbnail, file.outdatedFullsize)
+		fmt.Fprintf(pageHash, "%+v\n", file.sidecar)
+	}
+	for _, attachment := range source.attachments {
+		writeFileHash(pageHash, attachment)
+	}
+	writeFileHash(pageHash, source.music)
+
+	for i, subdir := range source.subdirectories {
+		fmt.Fprintln(pageHash, subdir.name, subalbumHashes[i])
+	}
+	return hex.EncodeToString(pageHash.Sum(nil))
+}
+
+// writeFileHash adds the name, size and modification time of a source file to a hash
+func writeFileHash(pageHash hash.Hash, file file) {
+	fmt.Fprintln(pageHash, file.name, file.size, file.modTime.UnixNano())
+}
+
+// writePageHashes writes the hash of each album page, by album path, into the gallery
+// root. The same hashes are in the pages' fastgallery-hash meta tags.
+func writePageHashes(galleryDirectory string, pages map[string]string, dryRun bool, config configuration) {
+	pageHashesPath := filepath.Join(galleryDirectory, pageHashesFile)
+	if dryRun {
+		log.Println("Would write page hashes:", pageHashesPath)
+		return
+	}
+
+	pagesJSON, err := json.Marshal(pages)
+	if err != nil {
+		log.Println("couldn't encode page hashes:", err.Error())
+		return
+	}
+
+	err = writeFile(pageHashesPath, append(pagesJSON, '\n'), config)
+	if err != nil {
+		log.Println("couldn't write page hashes", pageHashesPath, ":", err.Error())
+	}
+}
@@ -0,0 +1,106 @@
+package gallery
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetPageSettingsHash(t *testing.T) {
+	config := initializeConfig()
+	settingsHash := getPageSettingsHash(config)
+	assert.Equal(t, settingsHash, getPageSettingsHash(config))
+
+	// The workspace is different on each run
+	config.files.workspaceDir = filepath.Join(os.TempDir(), "fastgallery-workspace")
+	assert.Equal(t, settingsHash, getPageSettingsHash(config))
+
+	config.media.sortOrder = "date"
+	assert.NotEqual(t, settingsHash, getPageSettingsHash(config))
+}
+
+func TestGetPageHash(t *testing.T) {
+	source := directory{name: "album", relPath: "album", files: []file{{name: "a.jpg"}}}
+	pageHash := getPageHash(source, nil, "settings")
+	assert.Equal(t, pageHash, getPageHash(source, nil, "settings"))
+	assert.NotEqual(t, pageHash, getPageHash(source, nil, "other settings"))
+
+	captioned := source
+	captioned.files = []file{{name: "a.jpg", sidecar: sidecarMetadata{caption: "Harbour"}}}
+	assert.NotEqual(t, pageHash, getPageHash(captioned, nil, "settings"))
+
+	titled := source
+	titled.album.Title = "Harbour"
+	assert.NotEqual(t, pageHash, getPageHash(titled, nil, "settings"))
+
+	// Changes in subalbums change the album tiles
+	source.subdirectories = []directory{{name: "sub"}}
+	assert.NotEqual(t, getPageHash(source, []string{"a"}, "settings"), getPageHash(source, []string{"b"}, "settings"))
+}
+
+func TestUpdateChangedHTMLFiles(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	for _, name := range []string{"a", "b"} {
+		err = os.Mkdir(filepath.Join(tempDir, name), 0755)
+		assert.NoError(t, err)
+	}
+	source := directory{name: "root", subdirectories: []directory{
+		{name: "a", relPath: "a", files: []file{{name: "a.jpg"}}},
+		{name: "b", relPath: "b", files: []file{{name: "b.jpg"}}},
+	}}
+	gallery := directory{absPath: tempDir}
+	tmpl := testTemplates(t, config).html
+
+	pages, rendered, _ := updateHTMLFiles(source, gallery, tmpl, nil, false, config)
+	assert.EqualValues(t, 3, rendered)
+
+	// Nothing changed, nothing to render
+	pages, rendered, _ = updateHTMLFiles(source, gallery, tmpl, pages, false, config)
+	assert.EqualValues(t, 0, rendered)
+
+	// A new caption renders its album and the root again
+	source.subdirectories[1].files[0].sidecar.caption = "Harbour"
+	pages, rendered, _ = updateHTMLFiles(source, gallery, tmpl, pages, false, config)
+	assert.EqualValues(t, 2, rendered)
+	html, err := os.ReadFile(filepath.Join(tempDir, "b", config.assets.htmlFile))
+	assert.NoError(t, err)
+	assert.Contains(t, string(html), "Harbour")
+	assert.Contains(t, string(html), `<meta name="fastgallery-hash" content="`+pages["b"]+`">`)
+
+	// Missing pages are rendered even if nothing changed
+	err = os.Remove(filepath.Join(tempDir, "a", config.assets.htmlFile))
+	assert.NoError(t, err)
+	_, rendered, _ = updateHTMLFiles(source, gallery, tmpl, pages, false, config)
+	assert.EqualValues(t, 1, rendered)
+	assert.FileExists(t, filepath.Join(tempDir, "a", config.assets.htmlFile))
+}
+
+func TestWritePageHashes(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	pages := map[string]string{"": "00ff", "trips/alps": "ff00"}
+	writePageHashes(tempDir, pages, true, config)
+	assert.NoFileExists(t, filepath.Join(tempDir, pageHashesFile))
+
+	writePageHashes(tempDir, pages, false, config)
+	pagesJSON, err := os.ReadFile(filepath.Join(tempDir, pageHashesFile))
+	assert.NoError(t, err)
+	var written map[string]string
+	err = json.Unmarshal(pagesJSON, &written)
+	assert.NoError(t, err)
+	assert.Equal(t, pages, written)
+}
@@ -0,0 +1,154 @@
+package gallery
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// isInsideDirectory checks whether path is directory itself or anything below it.
+// Both must be absolute.
+func isInsideDirectory(path string, directory string) bool {
+	relPath, err := filepath.Rel(directory, path)
+	if err != nil {
+		return false
+	}
+	return relPath != ".." && !strings.HasPrefix(relPath, ".."+string(filepath.Separator))
+}
+
+// resolvePath returns the absolute path with symlinks resolved. For paths which don't
+// exist yet, the closest existing parent directory is resolved instead.
+func resolvePath(path string) string {
+	path, _ = filepath.Abs(path)
+	resolved, err := filepath.EvalSymlinks(path)
+	if err == nil {
+		return resolved
+	}
+
+	parent := filepath.Dir(path)
+	if parent == path || !os.IsNotExist(err) {
+		return path
+	}
+	return filepath.Join(resolvePath(parent), filepath.Base(path))
+}
+
+// errSourceProtected is returned for changes to the source directory in --paranoid mode
+var errSourceProtected = errors.New("refusing to modify source directory in paranoid mode")
+
+// checkOutsideSource returns an error if path is inside the protected source directory,
+// also through symlinks like the originals in the gallery
+func checkOutsideSource(path string, protectedDir string) error {
+	if isInsideDirectory(resolvePath(path), protectedDir) {
+		return fmt.Errorf("%w: %s", errSourceProtected, path)
+	}
+	return nil
+}
+
+// checkEntryOutsideSource is like checkOutsideSource, but for changes to a directory
+// entry itself which don't follow symlinks, like removing a symlink to an original
+func checkEntryOutsideSource(path string, protectedDir string) error {
+	if isInsideDirectory(filepath.Join(resolvePath(filepath.Dir(path)), filepath.Base(path)), protectedDir) {
+		return fmt.Errorf("%w: %s", errSourceProtected, path)
+	}
+	return nil
+}
+
+// guardSource checks a gallery path written by other programs like ffmpeg, which don't
+// go through the gallery storage. In --paranoid mode, paths inside the source directory
+// are an error.
+func guardSource(path string, config configuration) error {
+	if config.files.protectedDir == "" {
+		return nil
+	}
+	return checkOutsideSource(path, config.files.protectedDir)
+}
+
+// guardedStorage is the gallery storage in --paranoid mode. It refuses every change to
+// the source directory, so a bug or configuration mistake can't touch the source files.
+type guardedStorage struct {
+	galleryStorage
+	protectedDir string
+}
+
+func (s guardedStorage) Mkdir(path string, mode os.FileMode) error {
+	if err := checkOutsideSource(path, s.protectedDir); err != nil {
+		return err
+	}
+	return s.galleryStorage.Mkdir(path, mode)
+}
+
+func (s guardedStorage) Create(path string, mode os.FileMode) (storageFile, error) {
+	if err := checkOutsideSource(path, s.protectedDir); err != nil {
+		return nil, err
+	}
+	return s.galleryStorage.Create(path, mode)
+}
+
+func (s guardedStorage) WriteFile(path string, data []byte, mode os.FileMode) error {
+	if err := checkOutsideSource(path, s.protectedDir); err != nil {
+		return err
+	}
+	return s.galleryStorage.WriteFile(path, data, mode)
+}
+
+func (s guardedStorage) Remove(path string) error {
+	if err := checkEntryOutsideSource(path, s.protectedDir); err != nil {
+		return err
+	}
+	return s.galleryStorage.Remove(path)
+}
+
+func (s guardedStorage) RemoveAll(path string) error {
+	if err := checkEntryOutsideSource(path, s.protectedDir); err != nil {
+		return err
+	}
+	return s.galleryStorage.RemoveAll(path)
+}
+
+func (s guardedStorage) Symlink(target string, path string) error {
+	if err := checkEntryOutsideSource(path, s.protectedDir); err != nil {
+		return err
+	}
+	return s.galleryStorage.Symlink(target, path)
+}
+
+func (s guardedStorage) Link(target string, path string) error {
+	if err := checkEntryOutsideSource(path, s.protectedDir); err != nil {
+		return err
+	}
+	return s.galleryStorage.Link(target, path)
+}
+
+func (s guardedStorage) Rename(oldPath string, newPath string) error {
+	if err := checkEntryOutsideSource(oldPath, s.protectedDir); err != nil {
+		return err
+	}
+	if err := checkEntryOutsideSource(newPath, s.protectedDir); err != nil {
+		return err
+	}
+	return s.galleryStorage.Rename(oldPath, newPath)
+}
+
+func (s guardedStorage) Chmod(path string, mode os.FileMode) error {
+	if err := checkOutsideSource(path, s.protectedDir); err != nil {
+		return err
+	}
+	return s.galleryStorage.Chmod(path, mode)
+}
+
+func (s guardedStorage) Lchown(path string, uid int, gid int) error {
+	if err := checkEntryOutsideSource(path, s.protectedDir); err != nil {
+		return err
+	}
+	return s.galleryStorage.Lchown(path, uid, gid)
+}
+
+func (s guardedStorage) Chtimes(path string, atime time.Time, mtime time.Time) error {
+	if err := checkOutsideSource(path, s.protectedDir); err != nil {
+		return err
+	}
+	return s.galleryStorage.Chtimes(path, atime, mtime)
+}
@@ -0,0 +1,91 @@
+package gallery
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsInsideDirectory(t *testing.T) {
+	assert.True(t, isInsideDirectory("/photos", "/photos"))
+	assert.True(t, isInsideDirectory("/photos/2019/a.jpg", "/photos"))
+	assert.False(t, isInsideDirectory("/photos-gallery", "/photos"))
+	assert.False(t, isInsideDirectory("/", "/photos"))
+	assert.False(t, isInsideDirectory("/gallery/..photos", "/photos"))
+}
+
+func TestGuardSource(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	err = os.MkdirAll(filepath.Join(tempDir, "source"), 0755)
+	assert.NoError(t, err)
+	err = os.MkdirAll(filepath.Join(tempDir, "gallery", "_original"), 0755)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(tempDir, "source", "a.jpg"), []byte{}, 0644)
+	assert.NoError(t, err)
+	originalPath := filepath.Join(tempDir, "gallery", "_original", "a.jpg")
+	err = os.Symlink(filepath.Join(tempDir, "source", "a.jpg"), originalPath)
+	assert.NoError(t, err)
+
+	config := initializeConfig()
+	assert.NoError(t, guardSource(originalPath, config))
+
+	config.files.protectedDir = resolvePath(filepath.Join(tempDir, "source"))
+	assert.NoError(t, guardSource(filepath.Join(tempDir, "gallery", "index.html"), config))
+
+	// Writing through the symlink to the original would change the source
+	err = guardSource(originalPath, config)
+	assert.True(t, errors.Is(err, errSourceProtected))
+	err = guardSource(filepath.Join(tempDir, "source", "new", "index.html"), config)
+	assert.True(t, errors.Is(err, errSourceProtected))
+}
+
+func TestGuardedStorage(t *testing.T) {
+	tempDir := t.TempDir()
+	err := os.MkdirAll(filepath.Join(tempDir, "source"), 0755)
+	assert.NoError(t, err)
+	err = os.MkdirAll(filepath.Join(tempDir, "gallery", "_original"), 0755)
+	assert.NoError(t, err)
+	sourcePath := filepath.Join(tempDir, "source", "a.jpg")
+	err = os.WriteFile(sourcePath, []byte{}, 0644)
+	assert.NoError(t, err)
+	originalPath := filepath.Join(tempDir, "gallery", "_original", "a.jpg")
+	err = os.Symlink(sourcePath, originalPath)
+	assert.NoError(t, err)
+
+	memory := useMemoryStorage(t)
+	config := initializeConfig()
+	config.files.protectedDir = resolvePath(filepath.Join(tempDir, "source"))
+
+	// Changes to the gallery go through, also to the symlink to the original itself
+	storage := getStorage(config)
+	indexPath := filepath.Join(tempDir, "gallery", "index.html")
+	assert.NoError(t, storage.WriteFile(indexPath, []byte("gallery"), 0644))
+	assert.NoError(t, storage.Lchown(originalPath, 1000, 1000))
+	assert.NoError(t, storage.Remove(originalPath))
+	assert.Equal(t, []byte("gallery"), memory.files[indexPath])
+
+	// Changes to the source are refused, also through the symlink to the original
+	err = storage.WriteFile(originalPath, []byte("gallery"), 0644)
+	assert.True(t, errors.Is(err, errSourceProtected))
+	err = storage.Chmod(originalPath, 0600)
+	assert.True(t, errors.Is(err, errSourceProtected))
+	_, err = storage.Create(filepath.Join(tempDir, "source", "index.html"), 0644)
+	assert.True(t, errors.Is(err, errSourceProtected))
+	err = storage.RemoveAll(filepath.Join(tempDir, "source"))
+	assert.True(t, errors.Is(err, errSourceProtected))
+	err = storage.Rename(sourcePath, indexPath)
+	assert.True(t, errors.Is(err, errSourceProtected))
+	assert.NotContains(t, memory.files, originalPath)
+	assert.NotContains(t, memory.modes, originalPath)
+
+	// Without --paranoid, the gallery is written to the storage as it is
+	assert.Equal(t, store, getStorage(initializeConfig()))
+}
@@ -0,0 +1,116 @@
+package gallery
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// albumStatsRecord struct is an album's statistics in the build manifest, for the tiles
+// of albums outside the subtree of a partial run
+type albumStatsRecord struct {
+	Photos  int       `json:"photos"`
+	Videos  int       `json:"videos"`
+	First   time.Time `json:"first,omitempty"`
+	Last    time.Time `json:"last,omitempty"`
+	Updated time.Time `json:"updated,omitempty"`
+}
+
+// validatePartialRoot checks that the root of a partial run is a directory inside the
+// source and returns its path relative to the source
+func validatePartialRoot(sourceDirectory string, root string) (string, error) {
+	relPath := filepath.Clean(root)
+	if filepath.IsAbs(root) {
+		var err error
+		relPath, err = filepath.Rel(sourceDirectory, root)
+		if err != nil {
+			return "", err
+		}
+	}
+	if relPath == "." || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return "", errors.New("root must be a subdirectory of the source directory: " + root)
+	}
+	if !isDirectory(filepath.Join(sourceDirectory, relPath)) {
+		return "", errors.New("root isn't a directory in the source directory: " + root)
+	}
+	return relPath, nil
+}
+
+// isInPartialRun checks whether a source directory is scanned in a partial run rooted at
+// root: the directories in the root's subtree, and the ones above it whose pages link
+// to it. Without a root, all of them are.
+func isInPartialRun(relPath string, root string) bool {
+	if root == "" || relPath == "" || relPath == root {
+		return true
+	}
+	separator := string(filepath.Separator)
+	return strings.HasPrefix(relPath, root+separator) || strings.HasPrefix(root, relPath+separator)
+}
+
+// keepAlbums keeps the subalbums of a source directory outside the subtree of a partial
+// run as they were on the previous run, without scanning them. Only their statistics are
+// needed, for their tiles on the directory's page. Their gallery directories, page hashes
+// and gallery file settings are kept as well. Subalbums not in the gallery yet are left
+// out until a run covers them.
+func (thisPipeline *pipeline) keepAlbums(source *directory, gallery *directory) {
+	var keptSubdirectories []directory
+	for _, subdir := range source.subdirectories {
+		if subdir.split || isInPartialRun(subdir.relPath, thisPipeline.root) {
+			keptSubdirectories = append(keptSubdirectories, subdir)
+			continue
+		}
+
+		var gallerySubdir *directory
+		if gallery != nil {
+			gallerySubdir = findGallerySubdirectory(subdir, gallery, thisPipeline.config)
+		}
+		if gallerySubdir == nil {
+			continue
+		}
+		gallerySubdir.exists = true
+		record, ok := thisPipeline.previousManifest.Albums[filepath.ToSlash(subdir.relPath)]
+		if !ok {
+			continue
+		}
+
+		subdir.exists = true
+		subdir.keptStats = &albumStats{
+			photos:  record.Photos,
+			videos:  record.Videos,
+			first:   record.First,
+			last:    record.Last,
+			updated: record.Updated,
+		}
+		thisPipeline.keepFrozenArtifacts(subdir.relPath)
+		keptSubdirectories = append(keptSubdirectories, subdir)
+	}
+	source.subdirectories = keptSubdirectories
+}
+
+// collectAlbumRecords records the statistics of each album in a source tree by album path,
+// for the build manifest. Albums kept from the previous run keep the records of their
+// subalbums from it as well.
+func collectAlbumRecords(source directory, previousAlbums map[string]albumStatsRecord, albums map[string]albumStatsRecord, config configuration) {
+	albumPath := filepath.ToSlash(source.relPath)
+	if source.keptStats != nil {
+		for recordPath, record := range previousAlbums {
+			if recordPath == albumPath || strings.HasPrefix(recordPath, albumPath+"/") {
+				albums[recordPath] = record
+			}
+		}
+		return
+	}
+
+	stats := collectAlbumStats(source, config)
+	albums[albumPath] = albumStatsRecord{
+		Photos:  stats.photos,
+		Videos:  stats.videos,
+		First:   stats.first,
+		Last:    stats.last,
+		Updated: stats.updated,
+	}
+	for _, subdir := range source.subdirectories {
+		collectAlbumRecords(subdir, previousAlbums, albums, config)
+	}
+}
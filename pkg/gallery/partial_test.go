@@ -0,0 +1,107 @@
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidatePartialRoot(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+	err = os.MkdirAll(filepath.Join(tempDir, "2020", "trip"), 0755)
+	assert.NoError(t, err)
+
+	relPath, err := validatePartialRoot(tempDir, "2020/trip/")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join("2020", "trip"), relPath)
+	relPath, err = validatePartialRoot(tempDir, filepath.Join(tempDir, "2020"))
+	assert.NoError(t, err)
+	assert.Equal(t, "2020", relPath)
+
+	for _, root := range []string{".", "..", "../other", "2021", tempDir} {
+		_, err = validatePartialRoot(tempDir, root)
+		assert.Error(t, err, root)
+	}
+}
+
+func TestIsInPartialRun(t *testing.T) {
+	root := filepath.Join("2020", "trip")
+	assert.True(t, isInPartialRun("", root))
+	assert.True(t, isInPartialRun("2020", root))
+	assert.True(t, isInPartialRun(root, root))
+	assert.True(t, isInPartialRun(filepath.Join(root, "day1"), root))
+	assert.False(t, isInPartialRun(filepath.Join("2020", "tripod"), root))
+	assert.False(t, isInPartialRun("2021", root))
+	assert.True(t, isInPartialRun("2021", ""))
+}
+
+func TestProcessGalleryPartial(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	stub := useStubTransformers(t, &config)
+	config.files.workspaceDir = tempDir
+	sourceDirectory := filepath.Join(tempDir, "source")
+	galleryDirectory := filepath.Join(tempDir, "gallery")
+	for _, path := range []string{filepath.Join(sourceDirectory, "trip"), filepath.Join(sourceDirectory, "home"), galleryDirectory} {
+		err = os.MkdirAll(path, 0755)
+		assert.NoError(t, err)
+	}
+	for _, path := range []string{"a.jpg", filepath.Join("trip", "b.jpg"), filepath.Join("home", "c.jpg"), filepath.Join("home", "d.mp4")} {
+		err = os.WriteFile(filepath.Join(sourceDirectory, path), []byte{}, 0644)
+		assert.NoError(t, err)
+	}
+
+	// A full run records the statistics of all albums
+	manifest := buildManifest{Files: make(map[string]artifactSettings)}
+	fullPipeline := pipeline{config: config, manifestFiles: manifest.Files}
+	source, gallery, _ := processGallery(sourceDirectory, galleryDirectory, &fullPipeline)
+	assert.EqualValues(t, 4, atomic.LoadInt64(&stub.calls))
+	manifest.Albums = make(map[string]albumStatsRecord)
+	collectAlbumRecords(source, nil, manifest.Albums, config)
+	assert.Equal(t, albumStatsRecord{Photos: 1, Videos: 1, Updated: source.subdirectories[0].files[1].modTime}, manifest.Albums["home"])
+	assert.Equal(t, 4, manifest.Albums[""].Photos+manifest.Albums[""].Videos)
+	manifest.Pages, _, _ = updateHTMLFiles(source, gallery, nil, nil, true, config)
+
+	// A partial run only scans its subtree and the albums above it
+	for _, path := range []string{filepath.Join("trip", "e.jpg"), filepath.Join("home", "f.jpg")} {
+		err = os.WriteFile(filepath.Join(sourceDirectory, path), []byte{}, 0644)
+		assert.NoError(t, err)
+	}
+	partialManifest := buildManifest{Files: make(map[string]artifactSettings)}
+	partialPipeline := pipeline{cleanUp: true, config: config, previousManifest: &manifest, manifestFiles: partialManifest.Files, root: "trip"}
+	source, gallery, _ = processGallery(sourceDirectory, galleryDirectory, &partialPipeline)
+	assert.EqualValues(t, 5, atomic.LoadInt64(&stub.calls))
+	assert.Len(t, source.subdirectories, 2)
+	home := source.subdirectories[0]
+	assert.Equal(t, "home", home.name)
+	assert.Empty(t, home.files)
+	assert.Equal(t, albumStats{photos: 1, videos: 1, updated: manifest.Albums["home"].Updated}, collectAlbumStats(home, config))
+	assert.Len(t, source.subdirectories[1].files, 2)
+	assert.Equal(t, manifest.Files[filepath.ToSlash(filepath.Join("home", "c.jpg"))], partialManifest.Files[filepath.ToSlash(filepath.Join("home", "c.jpg"))])
+
+	// The albums outside the subtree keep their records, page hashes and gallery files
+	partialManifest.Albums = make(map[string]albumStatsRecord)
+	collectAlbumRecords(source, manifest.Albums, partialManifest.Albums, config)
+	assert.Equal(t, manifest.Albums["home"], partialManifest.Albums["home"])
+	assert.Equal(t, 2, partialManifest.Albums["trip"].Photos)
+	pages := make(map[string]string)
+	jobs, _ := collectHTMLJobs(0, source, gallery, getPageSettingsHash(config), manifest.Pages, pages, config)
+	assert.Len(t, jobs, 2)
+	assert.Equal(t, manifest.Pages["home"], pages["home"])
+	cleanUp(gallery, false, config)
+	cleanAttachments(source, galleryDirectory, false, config)
+	thumbnailFilename, _ := getGalleryFilenames("c.jpg", config)
+	assert.FileExists(t, filepath.Join(galleryDirectory, "home", config.files.thumbnailDir, thumbnailFilename))
+}
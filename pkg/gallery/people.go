@@ -0,0 +1,219 @@
+package gallery
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"text/template"
+)
+
+// Name of the page listing the people tagged in the gallery, in the gallery root
+const peopleFile = "people.html"
+
+// Name of the directory in the gallery root holding the page of each person
+const peopleDirectory = "_people"
+
+// htmlFace struct is one named face shown in the lightbox. The area is in percent of
+// the image's width and height.
+type htmlFace struct {
+	Name   string
+	Left   float64
+	Top    float64
+	Width  float64
+	Height float64
+}
+
+// peoplePage struct is loaded with the information to fill in the people template, for
+// either the list of People or the Photos of the person named in Heading. Root is the
+// relative path from the page to the gallery root, and HTMLFile the album page there.
+type peoplePage struct {
+	Title       string
+	Heading     string
+	Root        string
+	HTMLFile    string
+	CSS         []string
+	People      []personLink
+	Photos      []personPhoto
+	ImageWidth  string
+	ImageHeight string
+}
+
+// personLink is one person in the list of people, with the number of photos they're in
+type personLink struct {
+	Name  string
+	URL   string
+	Count int
+}
+
+// personPhoto is one photo on the page of a person. URLs are relative to the gallery root.
+type personPhoto struct {
+	Thumbnail string
+	URL       string
+	Filename  string
+	Caption   string
+	Album     string
+}
+
+// getHTMLFaces returns the named faces of a file for the lightbox. MWG regions are given
+// by their center, the lightbox positions them by their top left corner.
+func getHTMLFaces(sourceFile file) (faces []htmlFace) {
+	for _, face := range sourceFile.sidecar.faces {
+		faces = append(faces, htmlFace{
+			Name:   face.name,
+			Left:   (face.x - face.width/2) * 100,
+			Top:    (face.y - face.height/2) * 100,
+			Width:  face.width * 100,
+			Height: face.height * 100,
+		})
+	}
+	return faces
+}
+
+// collectPeople recursively collects the photos of each person tagged in the source
+// directory, by name. Photos with the same person tagged twice are listed once.
+func collectPeople(source directory, people map[string][]personPhoto, config configuration) {
+	album := albumTitle(source)
+	albumPath := filepath.ToSlash(source.relPath)
+
+	for _, sourceFile := range source.files {
+		thumbnailFilename, _ := getGalleryFilenames(sourceFile.name, config)
+		photo := personPhoto{
+			Thumbnail: escapeURLPath(path.Join(albumPath, config.files.thumbnailDir, thumbnailFilename)),
+			URL:       escapeURLPath(path.Join(albumPath, config.assets.htmlFile)) + "#" + url.PathEscape(sourceFile.name),
+			Filename:  sourceFile.name,
+			Caption:   sourceFile.sidecar.caption,
+			Album:     album,
+		}
+
+		seen := make(map[string]bool)
+		for _, face := range sourceFile.sidecar.faces {
+			if !seen[face.name] {
+				seen[face.name] = true
+				people[face.name] = append(people[face.name], photo)
+			}
+		}
+	}
+
+	for _, subdir := range source.subdirectories {
+		collectPeople(subdir, people, config)
+	}
+}
+
+// getPersonFilenames returns the filename of each person's page, made of their name.
+// Names which make the same filename are told apart by a number.
+func getPersonFilenames(names []string) map[string]string {
+	filenames := make(map[string]string)
+	used := make(map[string]bool)
+	for _, name := range names {
+		slug := slugify(name)
+		if slug == "" {
+			slug = "person"
+		}
+		filename := slug + ".html"
+		for i := 2; used[filename]; i++ {
+			filename = slug + "-" + strconv.Itoa(i) + ".html"
+		}
+		used[filename] = true
+		filenames[name] = filename
+	}
+	return filenames
+}
+
+// writePeople writes a page listing the people tagged in the photos' XMP sidecars into
+// the gallery root, and a page of photos for each person. Names are only published when
+// asked to, with --faces.
+func writePeople(source directory, gallery directory, cookedTemplate *template.Template, dryRun bool, config configuration) {
+	pagePath := filepath.Join(gallery.absPath, peopleFile)
+	personDirectory := filepath.Join(gallery.absPath, peopleDirectory)
+	if dryRun {
+		log.Println("Would write people pages:", pagePath)
+		return
+	}
+
+	// The previous pages are removed, as people may have been untagged
+	err := getStorage(config).RemoveAll(personDirectory)
+	if err != nil {
+		log.Println("couldn't remove old people pages", personDirectory, ":", err.Error())
+		return
+	}
+	err = createDirectory(personDirectory, false, config)
+	if err != nil {
+		log.Println(err.Error())
+		return
+	}
+
+	people := make(map[string][]personPhoto)
+	collectPeople(source, people, config)
+
+	var names []string
+	for name := range people {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	filenames := getPersonFilenames(names)
+
+	stylesheets, err := listStylesheets("", config)
+	if err != nil {
+		log.Println("couldn't write people pages", pagePath, ":", err.Error())
+		return
+	}
+	indexPage := peoplePage{
+		Title:       albumTitle(source),
+		HTMLFile:    config.assets.htmlFile,
+		CSS:         stylesheets,
+		ImageWidth:  fmt.Sprint(config.media.thumbnailWidth),
+		ImageHeight: fmt.Sprint(config.media.thumbnailHeight),
+	}
+
+	for _, name := range names {
+		personPage := indexPage
+		personPage.Heading = name
+		personPage.Root = "../"
+		personPage.CSS, err = listStylesheets(personPage.Root, config)
+		if err != nil {
+			log.Println("couldn't write people pages", pagePath, ":", err.Error())
+			return
+		}
+		for _, photo := range people[name] {
+			photo.Thumbnail = personPage.Root + photo.Thumbnail
+			photo.URL = personPage.Root + photo.URL
+			personPage.Photos = append(personPage.Photos, photo)
+		}
+
+		err = writePeoplePage(filepath.Join(personDirectory, filenames[name]), personPage, cookedTemplate, config)
+		if err != nil {
+			return
+		}
+
+		indexPage.People = append(indexPage.People, personLink{
+			Name:  name,
+			URL:   path.Join(peopleDirectory, url.PathEscape(filenames[name])),
+			Count: len(people[name]),
+		})
+	}
+
+	err = writePeoplePage(pagePath, indexPage, cookedTemplate, config)
+	if err == nil {
+		logProgress(config, "Wrote people pages:", pagePath)
+	}
+}
+
+// writePeoplePage fills in the people template and writes it to given path
+func writePeoplePage(pagePath string, page peoplePage, cookedTemplate *template.Template, config configuration) error {
+	pageHandle, err := createFile(pagePath, config)
+	if err != nil {
+		log.Println("couldn't create people page", pagePath, ":", err.Error())
+		return err
+	}
+	defer pageHandle.Close()
+
+	err = cookedTemplate.Execute(pageHandle, page)
+	if err != nil {
+		log.Println("couldn't execute people template", pagePath, ":", err.Error())
+	}
+	return err
+}
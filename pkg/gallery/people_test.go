@@ -0,0 +1,70 @@
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetHTMLFaces(t *testing.T) {
+	sourceFile := file{sidecar: sidecarMetadata{faces: []faceRegion{{name: "Alice", x: 0.5, y: 0.5, width: 0.2, height: 0.4}}}}
+	faces := getHTMLFaces(sourceFile)
+	assert.Len(t, faces, 1)
+	assert.EqualValues(t, "Alice", faces[0].Name)
+	assert.InDelta(t, 40, faces[0].Left, 0.001)
+	assert.InDelta(t, 30, faces[0].Top, 0.001)
+	assert.InDelta(t, 20, faces[0].Width, 0.001)
+	assert.InDelta(t, 40, faces[0].Height, 0.001)
+}
+
+func TestGetPersonFilenames(t *testing.T) {
+	filenames := getPersonFilenames([]string{"Ann Marie", "Ann-Marie", "???"})
+	assert.EqualValues(t, "ann-marie.html", filenames["Ann Marie"])
+	assert.EqualValues(t, "ann-marie-2.html", filenames["Ann-Marie"])
+	assert.EqualValues(t, "person.html", filenames["???"])
+}
+
+func TestWritePeople(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	cookedTemplates := testTemplates(t, config)
+	alice := faceRegion{name: "Alice", regionType: "Face"}
+	source := directory{
+		name: "Photos",
+		subdirectories: []directory{
+			{
+				name:    "Holiday",
+				relPath: "Holiday",
+				files: []file{
+					{name: "a.jpg", sidecar: sidecarMetadata{faces: []faceRegion{alice, alice, {name: "Bob"}}}},
+					{name: "b.jpg", sidecar: sidecarMetadata{faces: []faceRegion{alice}}},
+					{name: "c.jpg"},
+				},
+			},
+		},
+	}
+	gallery := directory{absPath: tempDir}
+
+	writePeople(source, gallery, cookedTemplates.people, true, config)
+	assert.NoFileExists(t, filepath.Join(tempDir, peopleFile))
+
+	writePeople(source, gallery, cookedTemplates.people, false, config)
+	html, err := os.ReadFile(filepath.Join(tempDir, peopleFile))
+	assert.NoError(t, err)
+	assert.Contains(t, string(html), `<a href="_people/alice.html">Alice</a> <span class="text-gray">2</span>`)
+	assert.Contains(t, string(html), `<a href="_people/bob.html">Bob</a> <span class="text-gray">1</span>`)
+
+	html, err = os.ReadFile(filepath.Join(tempDir, peopleDirectory, "alice.html"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(html), `href="../primer.css"`)
+	assert.Contains(t, string(html), `href="../Holiday/index.html#a.jpg"`)
+	assert.Contains(t, string(html), `src="../Holiday/_thumbnail/b.jpg"`)
+	assert.NotContains(t, string(html), "c.jpg")
+}
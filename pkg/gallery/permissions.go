@@ -0,0 +1,101 @@
+package gallery
+
+import (
+	"errors"
+	"log"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// parseFileMode parses permissions given in octal on the command line, e.g. "0750"
+func parseFileMode(value string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, errors.New("invalid permissions " + value + ", must be octal like 0755")
+	}
+	return os.FileMode(mode), nil
+}
+
+// parseOwner parses the owner of gallery files given as user:group, user or :group,
+// with names or numeric IDs. Returns -1 for the user or group to leave unchanged.
+func parseOwner(owner string) (uid int, gid int, err error) {
+	uid, gid = -1, -1
+	parts := strings.SplitN(owner, ":", 2)
+
+	if parts[0] != "" {
+		uid, err = strconv.Atoi(parts[0])
+		if err != nil {
+			ownerUser, err := user.Lookup(parts[0])
+			if err != nil {
+				return -1, -1, errors.New("unknown user " + parts[0] + ": " + err.Error())
+			}
+			uid, _ = strconv.Atoi(ownerUser.Uid)
+		}
+	}
+
+	if len(parts) == 2 && parts[1] != "" {
+		gid, err = strconv.Atoi(parts[1])
+		if err != nil {
+			ownerGroup, err := user.LookupGroup(parts[1])
+			if err != nil {
+				return -1, -1, errors.New("unknown group " + parts[1] + ": " + err.Error())
+			}
+			gid, _ = strconv.Atoi(ownerGroup.Gid)
+		}
+	}
+
+	return uid, gid, nil
+}
+
+// setOwner changes the owner of a gallery file or directory, if asked to.
+// Symlinks are changed themselves instead of the file they point to.
+func setOwner(path string, config configuration) error {
+	if config.files.uid == -1 && config.files.gid == -1 {
+		return nil
+	}
+
+	err := getStorage(config).Lchown(path, config.files.uid, config.files.gid)
+	if err != nil {
+		log.Println("couldn't change owner of", path, ":", err.Error())
+	}
+	return err
+}
+
+// setPermissions gives a gallery file or directory the configured permissions, limited
+// by the process umask, and owner. This also covers files created by other programs
+// like ffmpeg, and files overwritten in place which would keep their old permissions.
+func setPermissions(path string, mode os.FileMode, config configuration) error {
+	err := getStorage(config).Chmod(path, mode&^config.files.umask)
+	if err != nil {
+		log.Println("couldn't change permissions of", path, ":", err.Error())
+		return err
+	}
+	return setOwner(path, config)
+}
+
+// writeFile writes data to a gallery file with the configured permissions and owner
+func writeFile(path string, data []byte, config configuration) error {
+	err := getStorage(config).WriteFile(path, data, config.files.fileMode)
+	if err != nil {
+		return err
+	}
+	return setPermissions(path, config.files.fileMode, config)
+}
+
+// createFile creates or truncates a gallery file for writing, with the configured
+// permissions and owner
+func createFile(path string, config configuration) (storageFile, error) {
+	fileHandle, err := getStorage(config).Create(path, config.files.fileMode)
+	if err != nil {
+		return nil, err
+	}
+
+	err = setPermissions(path, config.files.fileMode, config)
+	if err != nil {
+		fileHandle.Close()
+		return nil, err
+	}
+	return fileHandle, nil
+}
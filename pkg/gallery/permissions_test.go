@@ -0,0 +1,58 @@
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFileMode(t *testing.T) {
+	mode, err := parseFileMode("0750")
+	assert.NoError(t, err)
+	assert.EqualValues(t, os.FileMode(0750), mode)
+
+	_, err = parseFileMode("0999")
+	assert.Error(t, err)
+	_, err = parseFileMode("01777")
+	assert.Error(t, err)
+}
+
+func TestParseOwner(t *testing.T) {
+	uid, gid, err := parseOwner("1000:33")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1000, uid)
+	assert.EqualValues(t, 33, gid)
+
+	uid, gid, err = parseOwner(":33")
+	assert.NoError(t, err)
+	assert.EqualValues(t, -1, uid)
+	assert.EqualValues(t, 33, gid)
+
+	_, _, err = parseOwner("no-such-user-fastgallery")
+	assert.Error(t, err)
+}
+
+func TestWriteFilePermissions(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	config.files.fileMode = 0640
+	config.files.umask = 0027
+
+	// Existing files get the new permissions too, limited by the umask
+	filePath := filepath.Join(tempDir, "file.jpg")
+	err = os.WriteFile(filePath, []byte{}, 0666)
+	assert.NoError(t, err)
+	err = writeFile(filePath, []byte("x"), config)
+	assert.NoError(t, err)
+
+	fileInfo, err := os.Stat(filePath)
+	assert.NoError(t, err)
+	assert.EqualValues(t, os.FileMode(0640), fileInfo.Mode().Perm())
+}
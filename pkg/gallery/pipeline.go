@@ -0,0 +1,358 @@
+package gallery
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cheggaaa/pb/v3"
+)
+
+// Number of transformation jobs queued on a channel before the sender has to wait
+const pipelineQueueSize = 1024
+
+// pipeline struct holds the settings and state of one scan-and-process run.
+// flatPattern is only set in flat export mode. heifFallback is set if libvips can't
+// load HEIF files, then newHEIFFiles counts the ones to convert or, without a
+// converter, skip. If skipUnreadable is set, new files without read permission are
+// skipped and counted in unreadableFiles. excludedDir is the resolved path of the
+// gallery, if it's inside the source. previousManifest is the gallery's build manifest,
+// if it has one, to find the gallery files built with outdated settings. They're counted
+// in outdatedFiles, and rebuilt if rebuildOutdated is set. manifestFiles collects the
+// settings of each file for the new build manifest. err is the first error which stopped
+// the run, nothing more is scanned or queued after it.
+type pipeline struct {
+	noVideos         bool
+	dryRun           bool
+	cleanUp          bool
+	takeout          bool
+	flatPattern      *regexp.Regexp
+	heifFallback     bool
+	newHEIFFiles     int
+	skipUnreadable   bool
+	unreadableFiles  int
+	excludedDir      string
+	previousManifest *buildManifest
+	rebuildOutdated  bool
+	outdatedFiles    int
+	manifestFiles    map[string]artifactSettings
+	root             string
+	gallery          *directory
+	jobs             chan transformationJob
+	progressBar      *pb.ProgressBar
+	config           configuration
+	err              error
+}
+
+// processGallery scans the source and gallery directories and transforms the new and
+// changed media files as a streaming pipeline. Each directory is compared to the gallery
+// and its files queued for transformation as soon as it's been scanned, so the
+// transformation workers get going while the rest of the source is still being scanned.
+// Returns the complete source and gallery trees for generating the HTML files and cleanup.
+func processGallery(sourcePath string, galleryPath string, thisPipeline *pipeline) (source directory, gallery directory, err error) {
+	thisPipeline.jobs = make(chan transformationJob, pipelineQueueSize)
+
+	// The jobs of all directories wait in one queue, for the workers to take the largest
+	workerJobs := make(chan transformationJob)
+	go scheduleQueuedJobs(thisPipeline.jobs, workerJobs)
+
+	// With prefetching, the source files are read ahead of the workers
+	if thisPipeline.config.prefetch > 0 {
+		scheduledJobs := workerJobs
+		workerJobs = make(chan transformationJob, thisPipeline.config.prefetch)
+		go prefetchFiles(scheduledJobs, workerJobs)
+	}
+
+	// The galleries of a batch share its workers
+	var workerWG sync.WaitGroup
+	if sharedWorkers := thisPipeline.config.run.sharedWorkers; sharedWorkers != nil {
+		workerWG.Add(1)
+		go sharedWorkers.forward(&workerWG, workerJobs, thisPipeline.progressBar, thisPipeline.config)
+	} else {
+		for i := 1; i <= thisPipeline.config.concurrency; i = i + 1 {
+			workerWG.Add(1)
+			go transformationWorker(&workerWG, workerJobs, thisPipeline.progressBar, thisPipeline.config)
+		}
+	}
+
+	source.name = filepath.Base(sourcePath)
+	source.absPath = sourcePath
+	gallery.name = filepath.Base(galleryPath)
+	gallery.absPath = galleryPath
+	thisPipeline.gallery = &gallery
+
+	// The gallery mustn't be read as an album if it's inside the source, the job count
+	// would explode on each run
+	if resolvedGallery := resolvePath(galleryPath); isInsideDirectory(resolvedGallery, resolvePath(sourcePath)) {
+		thisPipeline.excludedDir = resolvedGallery
+	}
+
+	// A brand new gallery has nothing to compare the source to
+	if isEmptyDirectory(galleryPath) {
+		thisPipeline.processDirectory(&source, nil, 0)
+	} else {
+		thisPipeline.processDirectory(&source, &gallery, 0)
+	}
+
+	// Wait for the workers to finish the files still queued
+	close(thisPipeline.jobs)
+	workerWG.Wait()
+
+	return source, gallery, thisPipeline.err
+}
+
+// fail stops the run with its first error
+func (thisPipeline *pipeline) fail(err error) {
+	if thisPipeline.err == nil {
+		thisPipeline.err = err
+	}
+}
+
+// processDirectory scans one source directory, reads its metadata, compares it to the
+// gallery directory and queues its new files for transformation. Then does the same for
+// each subdirectory. gallery is nil if there's no corresponding gallery directory yet.
+func (thisPipeline *pipeline) processDirectory(source *directory, gallery *directory, inheritedOffset time.Duration) {
+	if thisPipeline.err != nil || isAborted(thisPipeline.config) {
+		return
+	}
+	config := thisPipeline.config
+	galleryDirectory := filepath.Join(thisPipeline.gallery.absPath, source.relPath)
+
+	// Frozen albums already in the gallery are read from their snapshot, nothing in them
+	// is transformed or cleaned up
+	if gallery != nil && source.relPath != "" && loadFrozenAlbum(source, galleryDirectory) {
+		gallery.exists = true
+		thisPipeline.keepFrozenArtifacts(source.relPath)
+		logProgress(config, "Skipped frozen album:", source.absPath)
+		return
+	}
+
+	// Virtual albums of flat exports don't exist on disk, they only carry files from the root
+	if exists(source.absPath) {
+		scanned, err := scanDirectory(source.absPath, source.relPath, thisPipeline.noVideos, config)
+		if err != nil {
+			thisPipeline.fail(err)
+			return
+		}
+		if thisPipeline.excludedDir != "" {
+			excludeSubdirectory(&scanned, thisPipeline.excludedDir)
+		}
+		readDirectoryMetadata(&scanned, thisPipeline.takeout, config)
+		scanned.files = append(scanned.files, source.files...)
+		sortFilesByName(scanned.files)
+		*source = scanned
+	}
+
+	if thisPipeline.flatPattern != nil && source.relPath == "" {
+		groupFlatDirectory(source, thisPipeline.flatPattern, config)
+	}
+
+	// Albums split from a huge directory were already read with it
+	offset := inheritedOffset
+	if !source.split {
+		offset = readDirectoryExifMetadata(source, inheritedOffset, config)
+		splitDirectory(source, config)
+	}
+
+	if gallery != nil {
+		err := thisPipeline.scanGalleryDirectory(gallery)
+		if err != nil {
+			thisPipeline.fail(err)
+			return
+		}
+		compareDirectory(source, gallery, config)
+		renameGalleryFileCases(gallery, thisPipeline.dryRun, config)
+	}
+
+	if thisPipeline.heifFallback {
+		thisPipeline.newHEIFFiles = thisPipeline.newHEIFFiles + countNewHEIFFiles(*source, config)
+		if config.media.heifConverter == "" {
+			skipNewHEIFFiles(source, config)
+		}
+	}
+
+	if thisPipeline.skipUnreadable {
+		thisPipeline.unreadableFiles = thisPipeline.unreadableFiles + skipUnreadableFiles(source)
+	}
+
+	if thisPipeline.manifestFiles != nil {
+		thisPipeline.outdatedFiles = thisPipeline.outdatedFiles + checkOutdatedFiles(source, thisPipeline.previousManifest, thisPipeline.manifestFiles, thisPipeline.rebuildOutdated, config)
+	}
+
+	err := createDirectory(galleryDirectory, thisPipeline.dryRun, config)
+	if err != nil {
+		thisPipeline.fail(err)
+		return
+	}
+	updateAttachments(source, galleryDirectory, thisPipeline.dryRun, config)
+	updateMusic(source, galleryDirectory, thisPipeline.dryRun, config)
+	// Without a gallery directory, all of the source directory is new
+	if gallery == nil || hasDirectoryChanged(*source, *thisPipeline.gallery, thisPipeline.cleanUp, config) {
+		jobs, err := createMedia(*source, galleryDirectory, thisPipeline.dryRun, config)
+		if err != nil {
+			thisPipeline.fail(err)
+			return
+		}
+		thisPipeline.queueJobs(jobs)
+	}
+	convertOriginals(*source, galleryDirectory, thisPipeline.dryRun, config)
+
+	// Partial runs leave the albums outside their subtree as they were
+	if thisPipeline.root != "" {
+		thisPipeline.keepAlbums(source, gallery)
+	}
+
+	for i := range source.subdirectories {
+		if source.subdirectories[i].keptStats != nil {
+			continue
+		}
+		var gallerySubdir *directory
+		if gallery != nil {
+			gallerySubdir = findGallerySubdirectory(source.subdirectories[i], gallery, config)
+		}
+		thisPipeline.processDirectory(&source.subdirectories[i], gallerySubdir, offset)
+	}
+
+	// Subdirectories with all of their files rated too low don't belong in the gallery
+	for _, subdir := range pruneEmptySubdirectories(source) {
+		if subdir.exists {
+			// Already in the gallery, so it's stale and left for the cleanup
+			findGallerySubdirectory(subdir, gallery, config).exists = false
+		} else {
+			thisPipeline.removeGalleryDirectory(filepath.Join(thisPipeline.gallery.absPath, subdir.relPath))
+		}
+	}
+
+	// Gallery directories without a source directory are read completely, to be cleaned up
+	if gallery != nil {
+		for i, subdir := range gallery.subdirectories {
+			if !subdir.exists && !reservedDirectory(subdir.name, config) {
+				gallery.subdirectories[i], err = createDirectoryTree(subdir.absPath, subdir.relPath, thisPipeline.noVideos, thisPipeline.config)
+				if err != nil {
+					thisPipeline.fail(err)
+					return
+				}
+			}
+		}
+	}
+
+	// Albums are frozen once they're complete, so the snapshot includes their subalbums
+	if source.relPath != "" {
+		updateFrozenSnapshot(*source, galleryDirectory, thisPipeline.dryRun, config)
+	}
+}
+
+// keepFrozenArtifacts records the settings the gallery files of a frozen album were
+// built with in the new build manifest, as they were in the previous one
+func (thisPipeline *pipeline) keepFrozenArtifacts(relPath string) {
+	if thisPipeline.manifestFiles == nil || thisPipeline.previousManifest == nil {
+		return
+	}
+	albumPath := filepath.ToSlash(relPath) + "/"
+	for manifestPath, artifact := range thisPipeline.previousManifest.Files {
+		if strings.HasPrefix(manifestPath, albumPath) {
+			thisPipeline.manifestFiles[manifestPath] = artifact
+		}
+	}
+}
+
+// excludeSubdirectory removes the subdirectory with given resolved path from a source directory
+func excludeSubdirectory(source *directory, excludedDir string) {
+	var keptSubdirectories []directory
+	for _, subdir := range source.subdirectories {
+		if resolvePath(subdir.absPath) != excludedDir {
+			keptSubdirectories = append(keptSubdirectories, subdir)
+		}
+	}
+	source.subdirectories = keptSubdirectories
+}
+
+// scanGalleryDirectory reads one gallery directory, including the thumbnail, full-size
+// and original subdirectories with the transformed files in it
+func (thisPipeline *pipeline) scanGalleryDirectory(gallery *directory) error {
+	scanned, err := scanDirectory(gallery.absPath, gallery.relPath, thisPipeline.noVideos, thisPipeline.config)
+	if err != nil {
+		return err
+	}
+	var subdirectories []directory
+	for _, subdir := range scanned.subdirectories {
+		// The lite version is a gallery of its own, kept up to date by its own run
+		if subdir.name == thisPipeline.config.files.liteDir {
+			continue
+		}
+		if reservedDirectory(subdir.name, thisPipeline.config) {
+			subdir, err = createDirectoryTree(subdir.absPath, subdir.relPath, thisPipeline.noVideos, thisPipeline.config)
+			if err != nil {
+				return err
+			}
+		}
+		subdirectories = append(subdirectories, subdir)
+	}
+	scanned.subdirectories = subdirectories
+	*gallery = scanned
+	return nil
+}
+
+// queueJobs queues the transformation jobs of one directory for the workers, which
+// take the largest one waiting of the whole gallery first
+func (thisPipeline *pipeline) queueJobs(jobs []transformationJob) {
+	for _, thisJob := range jobs {
+		if thisPipeline.progressBar != nil {
+			// The progress bar is weighted by bytes, so one big video counts for more than a photo
+			thisPipeline.progressBar.SetTotal(thisPipeline.progressBar.Total() + thisJob.size)
+			if !thisPipeline.progressBar.IsStarted() {
+				thisPipeline.progressBar.Start()
+			}
+		}
+		thisPipeline.jobs <- thisJob
+	}
+}
+
+// removeGalleryDirectory removes a gallery directory created during this run for a
+// source directory which turned out to have nothing to show
+func (thisPipeline *pipeline) removeGalleryDirectory(galleryDirectory string) {
+	if thisPipeline.dryRun {
+		return
+	}
+
+	err := getStorage(thisPipeline.config).RemoveAll(galleryDirectory)
+	if err != nil {
+		log.Println("couldn't remove empty gallery directory", galleryDirectory, ":", err.Error())
+	}
+}
+
+// skipUnreadableFiles removes the new files without read permission from a source
+// directory, so they're not retried and reported on each run. Files already in the
+// gallery are kept. Returns the number of removed files.
+func skipUnreadableFiles(source *directory) (skipped int) {
+	var keptFiles []file
+	for _, file := range source.files {
+		if !file.exists && os.IsPermission(checkReadable(file.absPath)) {
+			skipped++
+			continue
+		}
+		keptFiles = append(keptFiles, file)
+	}
+	source.files = keptFiles
+	return skipped
+}
+
+// readDirectoryMetadata reads the album.yaml settings, XMP sidecars, caption files and,
+// in Takeout mode, the export metadata of one source directory. Files rated too low or
+// marked private are dropped. Captions from caption files override the ones in sidecars.
+func readDirectoryMetadata(source *directory, takeout bool, config configuration) {
+	readDirectoryAlbumConfig(source)
+	removePrivateFiles(source)
+	readDirectoryAttachments(source, config)
+	readDirectoryMusic(source)
+	readDirectoryTracks(source, config)
+	readDirectorySidecars(source, config)
+	readDirectoryCaptions(source)
+	if takeout {
+		readDirectoryTakeoutMetadata(source)
+	}
+}
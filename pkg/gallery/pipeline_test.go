@@ -0,0 +1,114 @@
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessGallery(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	config.media.minRating = 3
+
+	// Source with a subdirectory of badly rated files only, and a gallery
+	// with a stale album whose source has been removed
+	for _, path := range []string{
+		filepath.Join("source", "subdir"),
+		filepath.Join("source", "rejects"),
+		filepath.Join("gallery", "removed", config.files.thumbnailDir),
+	} {
+		err = os.MkdirAll(filepath.Join(tempDir, path), 0755)
+		assert.NoError(t, err)
+	}
+	for _, path := range []string{
+		filepath.Join("source", "good.jpg"),
+		filepath.Join("source", "subdir", "good.jpg"),
+		filepath.Join("source", "rejects", "bad.jpg"),
+		filepath.Join("gallery", "removed", config.files.thumbnailDir, "old.jpg"),
+	} {
+		err = os.WriteFile(filepath.Join(tempDir, path), []byte{}, 0644)
+		assert.NoError(t, err)
+	}
+	for _, path := range []string{"good.xmp", filepath.Join("subdir", "good.xmp")} {
+		err = os.WriteFile(filepath.Join(tempDir, "source", path), []byte(testXMPAttributes), 0644)
+		assert.NoError(t, err)
+	}
+	err = os.WriteFile(filepath.Join(tempDir, "source", "rejects", "bad.jpg.xmp"), []byte(testXMPElements), 0644)
+	assert.NoError(t, err)
+
+	source, gallery, _ := processGallery(filepath.Join(tempDir, "source"), filepath.Join(tempDir, "gallery"), &pipeline{dryRun: true, config: config})
+
+	assert.EqualValues(t, 2, countChanges(source, config))
+	assert.Len(t, source.subdirectories, 1)
+	assert.EqualValues(t, "subdir", source.subdirectories[0].name)
+	assert.EqualValues(t, "Sunset over the harbour", source.subdirectories[0].files[0].sidecar.caption)
+
+	// The stale album is read completely for the cleanup
+	assert.EqualValues(t, 1, countChanges(gallery, config))
+	assert.Len(t, gallery.subdirectories, 1)
+	assert.False(t, gallery.subdirectories[0].exists)
+
+	// Dry run doesn't create anything
+	assert.NoDirExists(t, filepath.Join(tempDir, "gallery", "subdir"))
+
+	// Nothing to compare to in a brand new gallery
+	source, gallery, _ = processGallery(filepath.Join(tempDir, "source"), filepath.Join(tempDir, "new"), &pipeline{dryRun: true, config: config})
+	assert.EqualValues(t, 2, countChanges(source, config))
+	assert.False(t, source.exists)
+	assert.Empty(t, gallery.subdirectories)
+}
+
+func TestSkipUnreadableFiles(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can read all files")
+	}
+
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	for filename, mode := range map[string]os.FileMode{"readable.jpg": 0644, "unreadable.jpg": 0000, "old.jpg": 0000} {
+		err = os.WriteFile(filepath.Join(tempDir, filename), []byte{}, mode)
+		assert.NoError(t, err)
+	}
+
+	source := directory{files: []file{
+		{name: "readable.jpg", absPath: filepath.Join(tempDir, "readable.jpg")},
+		{name: "unreadable.jpg", absPath: filepath.Join(tempDir, "unreadable.jpg")},
+		{name: "old.jpg", absPath: filepath.Join(tempDir, "old.jpg"), exists: true},
+	}}
+	assert.EqualValues(t, 1, skipUnreadableFiles(&source))
+	assert.Len(t, source.files, 2)
+	assert.EqualValues(t, "readable.jpg", source.files[0].name)
+	assert.EqualValues(t, "old.jpg", source.files[1].name)
+}
+
+func TestProcessGalleryInsideSource(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	err = os.MkdirAll(filepath.Join(tempDir, "gallery", config.files.thumbnailDir), 0755)
+	assert.NoError(t, err)
+	for _, path := range []string{"a.jpg", filepath.Join("gallery", config.files.thumbnailDir, "a.jpg")} {
+		err = os.WriteFile(filepath.Join(tempDir, path), []byte{}, 0644)
+		assert.NoError(t, err)
+	}
+
+	source, _, _ := processGallery(tempDir, filepath.Join(tempDir, "gallery"), &pipeline{dryRun: true, config: config})
+	assert.Len(t, source.files, 1)
+	assert.Empty(t, source.subdirectories)
+}
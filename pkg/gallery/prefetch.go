@@ -0,0 +1,31 @@
+package gallery
+
+import (
+	"io"
+	"os"
+)
+
+// prefetchFiles reads the source files of queued transformation jobs into the operating
+// system's file cache ahead of the transformation workers, and passes the jobs on to them.
+// On network drives the workers then don't stall waiting for the first bytes of each
+// file, the network I/O overlaps with transforming the previous files. How far ahead it
+// reads is set by the capacity of prefetched, which is closed once jobs is.
+func prefetchFiles(jobs chan transformationJob, prefetched chan transformationJob) {
+	for thisJob := range jobs {
+		readIntoCache(thisJob.sourceFilepath)
+		prefetched <- thisJob
+	}
+	close(prefetched)
+}
+
+// readIntoCache reads a file through once so it's in the file cache when it's transformed.
+// Errors are ignored, the transformation worker reports unreadable files.
+func readIntoCache(path string) {
+	fileHandle, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer fileHandle.Close()
+
+	io.Copy(io.Discard, fileHandle)
+}
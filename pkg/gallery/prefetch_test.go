@@ -0,0 +1,34 @@
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefetchFiles(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	err = os.WriteFile(filepath.Join(tempDir, "a.jpg"), []byte("image"), 0644)
+	assert.NoError(t, err)
+
+	jobs := make(chan transformationJob, 2)
+	prefetched := make(chan transformationJob, 1)
+	jobs <- transformationJob{filename: "a.jpg", sourceFilepath: filepath.Join(tempDir, "a.jpg")}
+	// Missing files are passed on for the worker to report
+	jobs <- transformationJob{filename: "b.jpg", sourceFilepath: filepath.Join(tempDir, "b.jpg")}
+	close(jobs)
+	go prefetchFiles(jobs, prefetched)
+
+	var filenames []string
+	for thisJob := range prefetched {
+		filenames = append(filenames, thisJob.filename)
+	}
+	assert.EqualValues(t, []string{"a.jpg", "b.jpg"}, filenames)
+}
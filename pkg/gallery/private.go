@@ -0,0 +1,36 @@
+package gallery
+
+import (
+	"strings"
+)
+
+// Files named like photo.private.jpg are kept out of the gallery, as are files with an
+// empty marker file named like photo.jpg.private next to them
+const privateMarker = ".private"
+
+// isPrivateFile checks whether a source file is marked private by its name or a marker file
+func isPrivateFile(sourceFile file) bool {
+	if strings.HasSuffix(strings.ToLower(stripExtension(sourceFile.name)), privateMarker) {
+		return true
+	}
+	return exists(sourceFile.absPath + privateMarker)
+}
+
+// removePrivateFiles drops the files marked private from a source directory, or all of
+// its files and subdirectories if its album.yaml marks the whole album private. Needs
+// the album.yaml to be read already.
+func removePrivateFiles(source *directory) {
+	if source.album.Private {
+		source.files = nil
+		source.subdirectories = nil
+		return
+	}
+
+	var keptFiles []file
+	for _, sourceFile := range source.files {
+		if !isPrivateFile(sourceFile) {
+			keptFiles = append(keptFiles, sourceFile)
+		}
+	}
+	source.files = keptFiles
+}
@@ -0,0 +1,43 @@
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessGalleryPrivate(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	for _, path := range []string{filepath.Join("source", "secret", "deeper"), filepath.Join("source", "public")} {
+		err = os.MkdirAll(filepath.Join(tempDir, path), 0755)
+		assert.NoError(t, err)
+	}
+	for _, path := range []string{
+		"a.jpg",
+		"b.Private.JPG",
+		"c.jpg",
+		"c.jpg.private",
+		filepath.Join("secret", "d.jpg"),
+		filepath.Join("secret", "deeper", "e.jpg"),
+		filepath.Join("public", "f.jpg"),
+	} {
+		err = os.WriteFile(filepath.Join(tempDir, "source", path), []byte{}, 0644)
+		assert.NoError(t, err)
+	}
+	err = os.WriteFile(filepath.Join(tempDir, "source", "secret", albumConfigFile), []byte("private: true\n"), 0644)
+	assert.NoError(t, err)
+
+	source, _, _ := processGallery(filepath.Join(tempDir, "source"), filepath.Join(tempDir, "gallery"), &pipeline{dryRun: true, config: config})
+	assert.Len(t, source.files, 1)
+	assert.EqualValues(t, "a.jpg", source.files[0].name)
+	assert.Len(t, source.subdirectories, 1)
+	assert.EqualValues(t, "public", source.subdirectories[0].name)
+}
@@ -0,0 +1,118 @@
+package gallery
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// External tool used to copy sources from object storage and other remotes
+const rcloneCommand = "rclone"
+
+// Marker file in the directories fastgallery mirrors remote sources to. rclone deletes
+// everything in the mirror which isn't on the remote, so only directories with it are
+// mirrored to.
+const mirrorMarker = ".fastgallery-mirror"
+
+// Matches rclone remotes like "photos:archive", but not Windows drive letters like "C:\"
+var rcloneRemotePattern = regexp.MustCompile(`^[\w.-]{2,}:`)
+
+// isRemoteSource checks whether the source argument is object storage instead of a local
+// directory: an s3:// or gs:// URL, or an rclone remote like "photos:archive"
+func isRemoteSource(source string) bool {
+	if strings.HasPrefix(source, "s3://") || strings.HasPrefix(source, "gs://") {
+		return true
+	}
+	return !isDirectory(source) && rcloneRemotePattern.MatchString(source)
+}
+
+// getRcloneRemote converts s3:// and gs:// URLs into rclone's on-the-fly remotes, which
+// take their credentials from the environment. rclone remotes are returned as they are.
+func getRcloneRemote(source string) string {
+	if strings.HasPrefix(source, "s3://") {
+		return ":s3,env_auth:" + strings.TrimPrefix(source, "s3://")
+	}
+	if strings.HasPrefix(source, "gs://") {
+		return ":gcs,env_auth:" + strings.TrimPrefix(source, "gs://")
+	}
+	return source
+}
+
+// getDefaultMirrorDirectory returns the directory in the user's cache a remote source is
+// mirrored to, unique to the remote
+func getDefaultMirrorDirectory(source string) (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "fastgallery", "remotes", slugify(source)), nil
+}
+
+// mirrorRemoteSource mirrors a remote source into a local directory with rclone, which
+// only transfers new and changed originals and deletes the ones removed from the remote.
+// The gallery is then built from the mirror, which needs to be kept as the originals in
+// the gallery link to it. In dry run mode, an existing mirror is used as it is. The
+// mirror is created with a marker file, and other directories with files in them are
+// refused, as rclone would delete their files. The output of rclone goes to the messages.
+func mirrorRemoteSource(source string, mirrorDirectory string, dryRun bool, config configuration) error {
+	output := config.run.output
+	markerPath := filepath.Join(mirrorDirectory, mirrorMarker)
+	if dryRun {
+		if !isDirectory(mirrorDirectory) {
+			return errors.New("remote source hasn't been mirrored yet, run without --dry-run first: " + source)
+		}
+		if !exists(markerPath) {
+			return errors.New("directory isn't a mirror created by fastgallery, refusing to mirror remote source to it: " + mirrorDirectory)
+		}
+		fmt.Fprintln(output, "Would mirror remote source", source, "to", mirrorDirectory)
+		return nil
+	}
+
+	rclonePath, err := exec.LookPath(rcloneCommand)
+	if err != nil {
+		return errors.New("remote sources need rclone, please install it: " + err.Error())
+	}
+
+	err = createMirrorDirectory(mirrorDirectory, config)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(output, "Mirroring remote source", source, "to", mirrorDirectory)
+	// rclone leaves excluded files alone, so the marker stays
+	syncCommand := exec.Command(rclonePath, "sync", "--exclude", "/"+mirrorMarker, getRcloneRemote(source), mirrorDirectory)
+	syncCommand.Stdout = output
+	syncCommand.Stderr = output
+	err = syncCommand.Run()
+	if err != nil {
+		return fmt.Errorf("couldn't mirror remote source %s: %w", source, err)
+	}
+	return nil
+}
+
+// createMirrorDirectory creates the directory a remote source is mirrored to with its
+// marker file, unless it's already a mirror. Existing directories with other files in
+// them are refused.
+func createMirrorDirectory(mirrorDirectory string, config configuration) error {
+	markerPath := filepath.Join(mirrorDirectory, mirrorMarker)
+	if exists(markerPath) {
+		return nil
+	}
+	if !isEmptyDirectory(mirrorDirectory) {
+		return errors.New("directory isn't empty or a mirror created by fastgallery, refusing to mirror remote source to it: " + mirrorDirectory)
+	}
+
+	err := os.MkdirAll(mirrorDirectory, config.files.directoryMode)
+	if err != nil {
+		return fmt.Errorf("couldn't create directory %s for mirror: %w", mirrorDirectory, err)
+	}
+	err = os.WriteFile(markerPath, []byte{}, config.files.fileMode)
+	if err != nil {
+		return fmt.Errorf("couldn't create marker file of mirror %s: %w", mirrorDirectory, err)
+	}
+	return nil
+}
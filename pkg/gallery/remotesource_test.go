@@ -0,0 +1,97 @@
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsRemoteSource(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	assert.True(t, isRemoteSource("s3://photos/archive"))
+	assert.True(t, isRemoteSource("gs://photos"))
+	assert.True(t, isRemoteSource("nas:photos/2021"))
+	assert.False(t, isRemoteSource(tempDir))
+	assert.False(t, isRemoteSource("photos/2021"))
+	assert.False(t, isRemoteSource(`C:\photos`))
+
+	// Local directories win over remotes of the same name
+	err = os.Mkdir(filepath.Join(tempDir, "nas:photos"), 0755)
+	assert.NoError(t, err)
+	assert.False(t, isRemoteSource(filepath.Join(tempDir, "nas:photos")))
+}
+
+func TestGetRcloneRemote(t *testing.T) {
+	assert.EqualValues(t, ":s3,env_auth:photos/archive", getRcloneRemote("s3://photos/archive"))
+	assert.EqualValues(t, ":gcs,env_auth:photos", getRcloneRemote("gs://photos"))
+	assert.EqualValues(t, "nas:photos", getRcloneRemote("nas:photos"))
+}
+
+func TestMirrorRemoteSourceDryRun(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	err = mirrorRemoteSource("s3://photos", filepath.Join(tempDir, "mirror"), true, config)
+	assert.Error(t, err)
+	assert.NoDirExists(t, filepath.Join(tempDir, "mirror"))
+
+	// Only mirrors created by fastgallery are used
+	err = mirrorRemoteSource("s3://photos", tempDir, true, config)
+	assert.Error(t, err)
+
+	err = os.WriteFile(filepath.Join(tempDir, mirrorMarker), []byte{}, 0644)
+	assert.NoError(t, err)
+	err = mirrorRemoteSource("s3://photos", tempDir, true, config)
+	assert.NoError(t, err)
+}
+
+func TestCreateMirrorDirectory(t *testing.T) {
+	tempDir := t.TempDir()
+	config := initializeConfig()
+	config.files.directoryMode = 0750
+	config.files.fileMode = 0640
+
+	// A new mirror is created with the gallery's permissions and a marker file
+	mirrorDirectory := filepath.Join(tempDir, "cache", "mirror")
+	err := createMirrorDirectory(mirrorDirectory, config)
+	assert.NoError(t, err)
+	info, err := os.Stat(mirrorDirectory)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0750)&^getUmask(), info.Mode().Perm())
+	assert.FileExists(t, filepath.Join(mirrorDirectory, mirrorMarker))
+
+	// Mirrored files are kept on the next run
+	err = os.WriteFile(filepath.Join(mirrorDirectory, "a.jpg"), []byte{}, 0644)
+	assert.NoError(t, err)
+	err = createMirrorDirectory(mirrorDirectory, config)
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(mirrorDirectory, "a.jpg"))
+
+	// An empty directory can be used, one with other files in it can't
+	emptyDirectory := filepath.Join(tempDir, "empty")
+	err = os.Mkdir(emptyDirectory, 0755)
+	assert.NoError(t, err)
+	err = createMirrorDirectory(emptyDirectory, config)
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(emptyDirectory, mirrorMarker))
+
+	photosDirectory := filepath.Join(tempDir, "photos")
+	err = os.Mkdir(photosDirectory, 0755)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(photosDirectory, "b.jpg"), []byte{}, 0644)
+	assert.NoError(t, err)
+	err = createMirrorDirectory(photosDirectory, config)
+	assert.Error(t, err)
+	assert.NoFileExists(t, filepath.Join(photosDirectory, mirrorMarker))
+}
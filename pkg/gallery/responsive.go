@@ -0,0 +1,152 @@
+package gallery
+
+import (
+	"errors"
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/davidbyttow/govips/v2/vips"
+)
+
+// Highest pixel density of thumbnails, phones rarely have denser screens
+const maxThumbnailDensity = 4
+
+// parseThumbnailDensities parses the pixel densities thumbnails are written in besides
+// the normal one, given as a comma-separated list, e.g. "2" or "2,3"
+func parseThumbnailDensities(densities string) ([]int, error) {
+	var parsed []int
+	seen := make(map[int]bool)
+	for _, element := range strings.Split(densities, ",") {
+		density, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(element), "x"))
+		if err != nil || density < 2 || density > maxThumbnailDensity {
+			return nil, errors.New("invalid thumbnail densities, must be a comma-separated list of 2 to " + strconv.Itoa(maxThumbnailDensity) + ", e.g. 2,3: " + densities)
+		}
+		if !seen[density] {
+			seen[density] = true
+			parsed = append(parsed, density)
+		}
+	}
+	sort.Ints(parsed)
+	return parsed, nil
+}
+
+// formatThumbnailDensities formats thumbnail densities for the build manifest, e.g. "2,3"
+func formatThumbnailDensities(densities []int) string {
+	formatted := make([]string, len(densities))
+	for i, density := range densities {
+		formatted[i] = strconv.Itoa(density)
+	}
+	return strings.Join(formatted, ",")
+}
+
+// getDensityPath returns the path of the thumbnail of given pixel density, written next
+// to the normal thumbnail, e.g. _thumbnail/sunset@2x.jpg
+func getDensityPath(thumbnailPath string, density int) string {
+	return stripExtension(thumbnailPath) + "@" + strconv.Itoa(density) + "x" + filepath.Ext(thumbnailPath)
+}
+
+// isDensityThumbnail checks whether a gallery thumbnail basename is the one of a thumbnail
+// of another pixel density of given basename, with the current densities. Names are
+// matched like the other gallery files, against the gallery basenames of the source files.
+func isDensityThumbnail(thumbnailBasename string, basename string, sourceBasenames map[string]bool, config configuration) bool {
+	for _, density := range config.media.densities {
+		suffix := "@" + strconv.Itoa(density) + "x"
+		if len(thumbnailBasename) != len(basename)+len(suffix) {
+			continue
+		}
+		if strings.EqualFold(thumbnailBasename[len(basename):], suffix) && matchesSourceBasename(thumbnailBasename[:len(basename)], basename, sourceBasenames) {
+			return true
+		}
+	}
+	return false
+}
+
+// exportThumbnailDensities writes the thumbnails of higher pixel densities next to the
+// thumbnail written to destination, from the full-size image. The densest one is made
+// first, and the image is left as its smallest thumbnail for the normal one. Densities
+// the image isn't big enough for are left out, browsers use the normal thumbnail then.
+func exportThumbnailDensities(image *vips.ImageRef, source string, destination string, config configuration) error {
+	for i := len(config.media.densities) - 1; i >= 0; i-- {
+		density := config.media.densities[i]
+		width, height := config.media.thumbnailWidth*density, config.media.thumbnailHeight*density
+		if image.Width() < width || image.Height() < height {
+			continue
+		}
+
+		err := image.Thumbnail(width, height, vips.InterestingAttention)
+		if err != nil {
+			log.Println("couldn't crop thumbnail:", err.Error())
+			return err
+		}
+		thumbnailBuffer, err := exportImage(image, source, config)
+		if err != nil {
+			log.Println("couldn't export thumbnail image:", source, err.Error())
+			return err
+		}
+
+		densityDestination := getDensityPath(destination, density)
+		err = writeFile(densityDestination, thumbnailBuffer, config)
+		if err != nil {
+			log.Println("couldn't write thumbnail image:", densityDestination, err.Error())
+			return wrapWriteError(err)
+		}
+		if config.files.webp {
+			err = exportWebP(image, source, densityDestination, config)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// moveDensitiesIntoGallery moves the thumbnails of higher pixel densities of a finished
+// thumbnail into the gallery. Ones of the thumbnail's previous version which weren't
+// written again, because the source has got smaller, are removed.
+func moveDensitiesIntoGallery(temp string, destination string, config configuration) error {
+	for _, density := range config.media.densities {
+		densityTemp, densityDestination := getDensityPath(temp, density), getDensityPath(destination, density)
+		if !exists(densityTemp) {
+			for _, stalePath := range []string{densityDestination, getWebPPath(densityDestination)} {
+				if exists(stalePath) {
+					err := getStorage(config).Remove(stalePath)
+					if err != nil {
+						log.Println("couldn't delete stale gallery file", stalePath, ":", err.Error())
+					}
+				}
+			}
+			continue
+		}
+
+		err := moveWebPIntoGallery(densityTemp, densityDestination, config)
+		if err != nil {
+			return err
+		}
+		err = moveIntoGallery(densityTemp, densityDestination, config)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getThumbnailSrcset returns the srcset attribute of a gallery thumbnail with its higher
+// pixel densities, e.g. "_thumbnail/sunset.jpg 1x, _thumbnail/sunset@2x.jpg 2x", or an
+// empty string if there are none. The links are URL-escaped, srcsets are split at
+// whitespace.
+func getThumbnailSrcset(galleryDirectory string, thumbnailPath string, config configuration) string {
+	var srcset []string
+	for _, density := range config.media.densities {
+		densityPath := getDensityPath(thumbnailPath, density)
+		if exists(filepath.Join(galleryDirectory, densityPath)) {
+			srcset = append(srcset, escapeURLPath(filepath.ToSlash(densityPath))+" "+strconv.Itoa(density)+"x")
+		}
+	}
+	if len(srcset) == 0 {
+		return ""
+	}
+	return strings.Join(append([]string{escapeURLPath(filepath.ToSlash(thumbnailPath)) + " 1x"}, srcset...), ", ")
+}
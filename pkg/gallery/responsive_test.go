@@ -0,0 +1,96 @@
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseThumbnailDensities(t *testing.T) {
+	densities, err := parseThumbnailDensities("3, 2x,2")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{2, 3}, densities)
+	assert.Equal(t, "2,3", formatThumbnailDensities(densities))
+
+	for _, invalid := range []string{"", "1", "5", "2,a"} {
+		_, err = parseThumbnailDensities(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestDensityThumbnails(t *testing.T) {
+	config := initializeConfig()
+	config.media.densities = []int{2}
+	assert.Equal(t, filepath.Join("_thumbnail", "a b@2x.jpg"), getDensityPath(filepath.Join("_thumbnail", "a b.jpg"), 2))
+	assert.True(t, isDensityThumbnail("a@2x", "a", nil, config))
+	assert.True(t, isDensityThumbnail("A@2X", "a", nil, config))
+	assert.False(t, isDensityThumbnail("A@2x", "a", map[string]bool{"A": true, "a": true}, config))
+	assert.False(t, isDensityThumbnail("a@3x", "a", nil, config))
+	assert.False(t, isDensityThumbnail("b@2x", "a", nil, config))
+
+	// Thumbnails of the current densities go with their source file, others are stale
+	source := directory{files: []file{{name: "a.jpg", absPath: "/photos/a.jpg"}}}
+	gallery := directory{subdirectories: []directory{
+		{name: config.files.thumbnailDir, files: []file{{name: "a.jpg", absPath: "/photos/a.jpg"}, {name: "a@2x.jpg", absPath: "/photos/a@2x.jpg"}, {name: "a@3x.jpg", absPath: "/photos/a@3x.jpg"}}},
+	}}
+	compareDirectory(&source, &gallery, config)
+	assert.True(t, gallery.subdirectories[0].files[0].exists)
+	assert.True(t, gallery.subdirectories[0].files[1].exists)
+	assert.False(t, gallery.subdirectories[0].files[2].exists)
+}
+
+func TestThumbnailSrcset(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	config.media.densities = []int{2, 3}
+	os.Mkdir(filepath.Join(tempDir, config.files.thumbnailDir), 0755)
+	os.WriteFile(filepath.Join(tempDir, config.files.thumbnailDir, "a b@2x.jpg"), []byte("jpeg"), 0644)
+
+	assert.Equal(t, "_thumbnail/a%20b.jpg 1x, _thumbnail/a%20b@2x.jpg 2x", getThumbnailSrcset(tempDir, filepath.Join(config.files.thumbnailDir, "a b.jpg"), config))
+	assert.Empty(t, getThumbnailSrcset(tempDir, filepath.Join(config.files.thumbnailDir, "c.jpg"), config))
+
+	source := directory{name: "alps", relPath: "alps", files: []file{{name: "a b.jpg", absPath: "/photos/a b.jpg"}, {name: "c.jpg", absPath: "/photos/c.jpg"}}}
+	createHTML(1, source, tempDir, testTemplates(t, config).html, false, config)
+	html, err := os.ReadFile(filepath.Join(tempDir, config.assets.htmlFile))
+	assert.NoError(t, err)
+	assert.Contains(t, string(html), `srcset="_thumbnail/a%20b.jpg 1x, _thumbnail/a%20b@2x.jpg 2x"`)
+	assert.NotContains(t, string(html), `c@2x.jpg`)
+}
+
+func TestMoveDensitiesIntoGallery(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	config.media.densities = []int{2, 3}
+	workspace := filepath.Join(tempDir, "workspace")
+	gallery := filepath.Join(tempDir, "gallery")
+	os.Mkdir(workspace, 0755)
+	os.Mkdir(gallery, 0755)
+	os.WriteFile(filepath.Join(workspace, "thumbnail@2x.jpg"), []byte("new"), 0644)
+	os.WriteFile(filepath.Join(gallery, "a@3x.jpg"), []byte("old"), 0644)
+
+	err = moveDensitiesIntoGallery(filepath.Join(workspace, "thumbnail.jpg"), filepath.Join(gallery, "a.jpg"), config)
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(gallery, "a@2x.jpg"))
+	assert.NoFileExists(t, filepath.Join(gallery, "a@3x.jpg"))
+}
+
+func TestDensityArtifactSettings(t *testing.T) {
+	config := initializeConfig()
+	config.media.densities = []int{2}
+	settings := createBuildSettings(config)
+	assert.Equal(t, "2", settings.ThumbnailDensities)
+	assert.Contains(t, getArtifactSettings("a.jpg", settings, config).Thumbnail, " @2")
+	assert.NotContains(t, getArtifactSettings("a.mp4", settings, config).Thumbnail, "@")
+}
@@ -0,0 +1,203 @@
+package gallery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/davidbyttow/govips/v2/vips"
+)
+
+// parseThumbnailSize parses a thumbnail size given as width x height, e.g. 400x300
+func parseThumbnailSize(size string) (width int, height int, err error) {
+	parts := strings.Split(strings.ToLower(size), "x")
+	if len(parts) == 2 {
+		width, err = strconv.Atoi(parts[0])
+		if err == nil {
+			height, err = strconv.Atoi(parts[1])
+		}
+	}
+	if len(parts) != 2 || err != nil || width <= 0 || height <= 0 {
+		return 0, 0, errors.New("invalid thumbnail size, must be width x height in pixels, e.g. 400x300: " + size)
+	}
+	return width, height, nil
+}
+
+// collectRethumbJobs returns a job for building each thumbnail of a gallery again. The
+// thumbnails are built from the full-size files, which are much faster to decode than
+// RAW or huge originals. Files without a full-size file fall back to their original.
+func collectRethumbJobs(galleryDirectory string, relPath string, config configuration) (jobs []transformationJob) {
+	albumDirectory := filepath.Join(galleryDirectory, relPath)
+	thumbnailDirectory, fullsizeDirectory, originalDirectory := getGalleryDirectoryNames(albumDirectory, config)
+
+	fullsizeBasenames := make(map[string]bool)
+	addJob := func(directory string, entry os.DirEntry) {
+		if entry.IsDir() || !(isMediaFile(entry.Name(), false, config) || strings.EqualFold(filepath.Ext(entry.Name()), config.files.imageExtension)) {
+			return
+		}
+		var size int64
+		if info, err := os.Stat(filepath.Join(directory, entry.Name())); err == nil {
+			size = info.Size()
+		}
+		jobs = append(jobs, transformationJob{
+			filename:          entry.Name(),
+			relPath:           filepath.Join(relPath, entry.Name()),
+			sourceFilepath:    filepath.Join(directory, entry.Name()),
+			thumbnailFilepath: filepath.Join(thumbnailDirectory, stripExtension(entry.Name())+config.files.imageExtension),
+			size:              size,
+		})
+	}
+
+	fullsizeEntries, _ := os.ReadDir(fullsizeDirectory)
+	for _, entry := range fullsizeEntries {
+		fullsizeBasenames[stripExtension(entry.Name())] = true
+		addJob(fullsizeDirectory, entry)
+	}
+	originalEntries, _ := os.ReadDir(originalDirectory)
+	for _, entry := range originalEntries {
+		if !fullsizeBasenames[stripExtension(entry.Name())] {
+			addJob(originalDirectory, entry)
+		}
+	}
+
+	entries, err := os.ReadDir(albumDirectory)
+	if err != nil {
+		return jobs
+	}
+	for _, entry := range entries {
+		// The lite version has thumbnails of its own, and so do other galleries' workspaces
+		if !entry.IsDir() || reservedDirectory(entry.Name(), config) || entry.Name() == config.files.liteDir || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		jobs = append(jobs, collectRethumbJobs(galleryDirectory, filepath.Join(relPath, entry.Name()), config)...)
+	}
+	return jobs
+}
+
+// updateRethumbManifest records the new thumbnail size in the build manifest, so the
+// thumbnails aren't taken to be outdated. Files in albums with failed thumbnails keep
+// their old thumbnail settings, and are rebuilt with --rebuild-outdated.
+func updateRethumbManifest(manifest *buildManifest, galleryDirectory string, failedFiles []failure, config configuration) {
+	failedAlbums := make(map[string]bool)
+	for _, thisFailure := range failedFiles {
+		relPath, err := filepath.Rel(galleryDirectory, filepath.Dir(filepath.Dir(thisFailure.file)))
+		if err == nil {
+			failedAlbums[filepath.ToSlash(relPath)] = true
+		}
+	}
+
+	thumbnailSize := fmt.Sprintf("%dx%d", config.media.thumbnailWidth, config.media.thumbnailHeight)
+	for manifestPath, artifact := range manifest.Files {
+		if failedAlbums[path.Dir(manifestPath)] {
+			continue
+		}
+		// Markers of WebP versions and pixel densities follow the size
+		if i := strings.Index(artifact.Thumbnail, " "); i >= 0 {
+			artifact.Thumbnail = thumbnailSize + artifact.Thumbnail[i:]
+		} else {
+			artifact.Thumbnail = thumbnailSize
+		}
+		manifest.Files[manifestPath] = artifact
+	}
+	manifest.Settings.ThumbnailWidth = config.media.thumbnailWidth
+	manifest.Settings.ThumbnailHeight = config.media.thumbnailHeight
+}
+
+// RethumbOptions struct holds the options of the rethumb command, documented by their
+// go-arg tags. Messages gets the messages of the run, which are left out if it's nil.
+type RethumbOptions struct {
+	Gallery       string    `arg:"positional,required" help:"Gallery directory to rebuild the thumbnails of"`
+	ThumbnailSize string    `arg:"--thumbnail-size,required" help:"new size of thumbnails as width x height in pixels, e.g. 400x300"`
+	DryRun        bool      `arg:"--dry-run" help:"dry run; don't change anything, just print the thumbnails which would be rebuilt"`
+	Verbose       bool      `arg:"-v,--verbose" help:"print each rebuilt thumbnail"`
+	Config        string    `arg:"--config" help:"configuration file the gallery was built with (default: ~/.config/fastgallery/config.yaml, if it exists)"`
+	Messages      io.Writer `arg:"-"`
+}
+
+// Rethumb builds the thumbnails of a gallery again in another size, e.g. for a theme
+// with bigger album tiles, without touching the full-size files. Cancelling ctx aborts
+// it, the thumbnails rebuilt by then stay in the gallery.
+func Rethumb(ctx context.Context, args RethumbOptions) error {
+	config, err := loadConfiguration(args.Config)
+	if err != nil {
+		return err
+	}
+	output := getOutput(args.Messages)
+	config.run.output = output
+	config.verbose = args.Verbose
+	config.media.thumbnailWidth, config.media.thumbnailHeight, err = parseThumbnailSize(args.ThumbnailSize)
+	if err != nil {
+		return err
+	}
+	galleryDirectory, _ := filepath.Abs(args.Gallery)
+	if !isDirectory(galleryDirectory) {
+		return errors.New("gallery directory doesn't exist: " + args.Gallery)
+	}
+
+	// The gallery's file formats are the ones it was built with
+	manifest, hasManifest := readBuildManifest(galleryDirectory)
+	if hasManifest {
+		config.files.imageExtension = manifest.Settings.ImageExtension
+		config.files.webp = manifest.Settings.WebP
+		if manifest.Settings.OutputProfile == outputProfileDLNA {
+			useDLNADirectoryNames(&config)
+		}
+		if manifest.Settings.ThumbnailDensities != "" {
+			config.media.densities, _ = parseThumbnailDensities(manifest.Settings.ThumbnailDensities)
+		}
+	}
+
+	jobs := collectRethumbJobs(galleryDirectory, "", config)
+	if args.DryRun {
+		for _, thisJob := range jobs {
+			fmt.Fprintln(output, "Would rebuild thumbnail:", thisJob.thumbnailFilepath)
+		}
+		return nil
+	}
+
+	vips.LoggingSettings(nil, vips.LogLevelError)
+	vips.Startup(nil)
+
+	config.files.workspaceDir, err = createWorkspace("")
+	if err != nil {
+		return fmt.Errorf("couldn't create workspace: %w", err)
+	}
+	defer removeWorkspace(config.files.workspaceDir)
+	defer abortOnCancel(ctx, config)()
+
+	fmt.Fprintln(output, "Rebuilding", len(jobs), "thumbnails...")
+	scheduleJobs(jobs)
+	jobChannel := make(chan transformationJob, pipelineQueueSize)
+	var workerWG sync.WaitGroup
+	for i := 0; i < config.concurrency; i++ {
+		workerWG.Add(1)
+		go transformationWorker(&workerWG, jobChannel, nil, config)
+	}
+	for _, thisJob := range jobs {
+		jobChannel <- thisJob
+	}
+	close(jobChannel)
+	workerWG.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	failedFiles := config.run.failures
+	if failedThumbnails := config.run.reportFailures(); failedThumbnails > 0 {
+		fmt.Fprintln(output, "Couldn't rebuild", failedThumbnails, "thumbnails, see the log for details")
+	}
+	if hasManifest {
+		updateRethumbManifest(&manifest, galleryDirectory, failedFiles, config)
+		writeBuildManifest(galleryDirectory, manifest, false, config)
+	}
+	fmt.Fprintln(output, "Rebuilt", len(jobs)-len(failedFiles), "thumbnails!")
+	fmt.Fprintf(output, "Set thumbnail_width: %d and thumbnail_height: %d in the configuration file and build the gallery again to update its pages.\n", config.media.thumbnailWidth, config.media.thumbnailHeight)
+	return nil
+}
@@ -0,0 +1,86 @@
+package gallery
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseThumbnailSize(t *testing.T) {
+	width, height, err := parseThumbnailSize("400x300")
+	assert.NoError(t, err)
+	assert.Equal(t, 400, width)
+	assert.Equal(t, 300, height)
+
+	for _, size := range []string{"", "400", "400x", "x300", "0x300", "-1x300", "400x300x200", "wide"} {
+		_, _, err = parseThumbnailSize(size)
+		assert.Error(t, err, size)
+	}
+}
+
+func TestCollectRethumbJobs(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	for _, path := range []string{
+		filepath.Join(config.files.fullsizeDir, "a.jpg"),
+		filepath.Join(config.files.originalDir, "a.CR2"),
+		filepath.Join(config.files.originalDir, "b.jpg"),
+		filepath.Join("trip", config.files.fullsizeDir, "clip.mp4"),
+		filepath.Join("trip", config.files.fullsizeDir, "notes.txt"),
+		filepath.Join(config.files.liteDir, config.files.fullsizeDir, "a.jpg"),
+	} {
+		err = os.MkdirAll(filepath.Join(tempDir, filepath.Dir(path)), 0755)
+		assert.NoError(t, err)
+		err = os.WriteFile(filepath.Join(tempDir, path), []byte{}, 0644)
+		assert.NoError(t, err)
+	}
+
+	// Thumbnails are built from full-size files, or from originals without one
+	jobs := collectRethumbJobs(tempDir, "", config)
+	var sources, thumbnails []string
+	for _, thisJob := range jobs {
+		assert.Empty(t, thisJob.fullsizeFilepath)
+		assert.Empty(t, thisJob.originalFilepath)
+		sources = append(sources, thisJob.sourceFilepath)
+		thumbnails = append(thumbnails, thisJob.thumbnailFilepath)
+	}
+	sort.Strings(sources)
+	sort.Strings(thumbnails)
+	assert.Equal(t, []string{
+		filepath.Join(tempDir, config.files.fullsizeDir, "a.jpg"),
+		filepath.Join(tempDir, config.files.originalDir, "b.jpg"),
+		filepath.Join(tempDir, "trip", config.files.fullsizeDir, "clip.mp4"),
+	}, sources)
+	assert.Equal(t, []string{
+		filepath.Join(tempDir, config.files.thumbnailDir, "a.jpg"),
+		filepath.Join(tempDir, config.files.thumbnailDir, "b.jpg"),
+		filepath.Join(tempDir, "trip", config.files.thumbnailDir, "clip.jpg"),
+	}, thumbnails)
+}
+
+func TestUpdateRethumbManifest(t *testing.T) {
+	config := initializeConfig()
+	config.media.thumbnailWidth, config.media.thumbnailHeight = 400, 300
+	manifest := buildManifest{Files: map[string]artifactSettings{
+		"a.jpg":        {Thumbnail: "280x210 webp", Fullsize: "1920x1080 webp"},
+		"trip/b.jpg":   {Thumbnail: "280x210", Fullsize: "1920x1080"},
+		"broken/c.jpg": {Thumbnail: "280x210", Fullsize: "1920x1080"},
+	}}
+	failedFiles := []failure{{file: filepath.Join("/gallery", "broken", config.files.fullsizeDir, "c.jpg"), err: errors.New("failed")}}
+
+	updateRethumbManifest(&manifest, "/gallery", failedFiles, config)
+	assert.Equal(t, artifactSettings{Thumbnail: "400x300 webp", Fullsize: "1920x1080 webp"}, manifest.Files["a.jpg"])
+	assert.Equal(t, "400x300", manifest.Files["trip/b.jpg"].Thumbnail)
+	assert.Equal(t, "280x210", manifest.Files["broken/c.jpg"].Thumbnail)
+	assert.Equal(t, 400, manifest.Settings.ThumbnailWidth)
+	assert.Equal(t, 300, manifest.Settings.ThumbnailHeight)
+}
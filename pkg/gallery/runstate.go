@@ -0,0 +1,46 @@
+package gallery
+
+import (
+	"io"
+	"sync"
+)
+
+// runState struct holds what one run finds out and registers along the way, shared by
+// all the copies of its configuration. failures are the files which couldn't be
+// transformed, and diskFull is set once the gallery's disk has run out of space.
+// sniffedFiles has the kind of each media file recognised by its contents, by absolute path.
+// registeredVideoExtensions are the extensions added with --video-extension, and
+// probedVideoExtensions the ones probed with ffprobe. aborted is set once the run has
+// been cancelled, after which no more files are moved into the gallery. The galleries
+// of a batch have its sharedWorkers. output is where the messages of the run go.
+// Every run has its own, so a program can build galleries one after another or at once.
+type runState struct {
+	failures                  []failure
+	failureMutex              sync.Mutex
+	diskFull                  int32
+	sniffedFiles              sync.Map
+	registeredVideoExtensions map[string]bool
+	probedVideoExtensions     map[string]bool
+	videoExtensionsLock       sync.RWMutex
+	workspaceMutex            sync.Mutex
+	aborted                   bool
+	sharedWorkers             *workerPool
+	output                    io.Writer
+}
+
+// newRunState returns the state of a new run, which discards its messages
+func newRunState() *runState {
+	return &runState{
+		registeredVideoExtensions: make(map[string]bool),
+		probedVideoExtensions:     make(map[string]bool),
+		output:                    io.Discard,
+	}
+}
+
+// getOutput returns given writer for the messages of a run, or one discarding them if it's nil
+func getOutput(output io.Writer) io.Writer {
+	if output == nil {
+		return io.Discard
+	}
+	return output
+}
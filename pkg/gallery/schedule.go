@@ -0,0 +1,76 @@
+package gallery
+
+import (
+	"container/heap"
+)
+
+// queuedJob is a transformation job waiting for a worker. order is the position it was
+// queued in, so jobs of the same size keep their order.
+type queuedJob struct {
+	job   transformationJob
+	order int
+}
+
+// jobQueue holds the transformation jobs waiting for a worker, largest first, as a heap
+type jobQueue []queuedJob
+
+func (queue jobQueue) Len() int { return len(queue) }
+
+func (queue jobQueue) Less(i, j int) bool {
+	if queue[i].job.size != queue[j].job.size {
+		return queue[i].job.size > queue[j].job.size
+	}
+	return queue[i].order < queue[j].order
+}
+
+func (queue jobQueue) Swap(i, j int) { queue[i], queue[j] = queue[j], queue[i] }
+
+func (queue *jobQueue) Push(x interface{}) { *queue = append(*queue, x.(queuedJob)) }
+
+func (queue *jobQueue) Pop() interface{} {
+	old := *queue
+	last := old[len(old)-1]
+	*queue = old[:len(old)-1]
+	return last
+}
+
+// scheduleQueuedJobs passes the jobs queued by the scan on to the workers, always the
+// largest one waiting first, across all directories of the gallery. This way the big
+// videos are started early and the run doesn't end with one long transcode running alone
+// while all other workers idle. As the workers get going while the source is still being
+// scanned, only the jobs queued so far are ordered: a big video found late is started
+// ahead of all smaller files still waiting, but not of the ones already started. The
+// workers should take scheduled without a buffer, so the jobs wait here to be ordered.
+// scheduled is closed once queued is and all of its jobs have been passed on.
+func scheduleQueuedJobs(queued chan transformationJob, scheduled chan transformationJob) {
+	var waiting jobQueue
+	order := 0
+	for queued != nil || waiting.Len() > 0 {
+		// The jobs queued by now are all ordered before the next one is passed on
+		for queued != nil && len(queued) > 0 {
+			heap.Push(&waiting, queuedJob{job: <-queued, order: order})
+			order++
+		}
+
+		// Nothing is sent until there's a job waiting
+		var next chan transformationJob
+		var largest transformationJob
+		if waiting.Len() > 0 {
+			next = scheduled
+			largest = waiting[0].job
+		}
+
+		select {
+		case thisJob, ok := <-queued:
+			if !ok {
+				queued = nil
+				continue
+			}
+			heap.Push(&waiting, queuedJob{job: thisJob, order: order})
+			order++
+		case next <- largest:
+			heap.Pop(&waiting)
+		}
+	}
+	close(scheduled)
+}
@@ -0,0 +1,32 @@
+package gallery
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduleQueuedJobs(t *testing.T) {
+	queued := make(chan transformationJob, pipelineQueueSize)
+	scheduled := make(chan transformationJob)
+
+	// Jobs of two directories, queued one directory after another before the workers start
+	queued <- transformationJob{filename: "a.jpg", relPath: "2019", size: 100}
+	queued <- transformationJob{filename: "b.jpg", relPath: "2019", size: 300}
+	queued <- transformationJob{filename: "c.mp4", relPath: "2020", size: 5000}
+	queued <- transformationJob{filename: "d.jpg", relPath: "2020", size: 300}
+	go scheduleQueuedJobs(queued, scheduled)
+
+	// The largest job of all directories goes first, equal ones in queued order
+	var filenames []string
+	filenames = append(filenames, (<-scheduled).filename)
+	filenames = append(filenames, (<-scheduled).filename)
+
+	// A big video found later is started ahead of the smaller jobs still waiting
+	queued <- transformationJob{filename: "e.mp4", relPath: "2021", size: 9000}
+	close(queued)
+	for thisJob := range scheduled {
+		filenames = append(filenames, thisJob.filename)
+	}
+	assert.EqualValues(t, []string{"c.mp4", "b.jpg", "e.mp4", "d.jpg", "a.jpg"}, filenames)
+}
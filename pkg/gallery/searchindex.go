@@ -0,0 +1,167 @@
+package gallery
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Name of the search index file in the gallery root
+const searchIndexFile = "search-index.ndjson"
+
+// searchRecord is one photo or video in the search index. The field names are
+// chosen to work as-is with Algolia and Meilisearch, which both want an id field
+// made of letters, digits, dashes and underscores.
+type searchRecord struct {
+	ID        string   `json:"id"`
+	Path      string   `json:"path"`
+	Album     string   `json:"album"`
+	AlbumPath string   `json:"albumPath"`
+	URL       string   `json:"url"`
+	Thumbnail string   `json:"thumbnail"`
+	Date      string   `json:"date,omitempty"`
+	Timestamp int64    `json:"timestamp,omitempty"`
+	Caption   string   `json:"caption,omitempty"`
+	Keywords  []string `json:"keywords,omitempty"`
+	Camera    string   `json:"camera,omitempty"`
+	Rating    int      `json:"rating,omitempty"`
+}
+
+// createSearchRecords recursively creates search index records for all files in the
+// source directory. URLs are relative to the gallery root.
+func createSearchRecords(source directory, config configuration) (records []searchRecord) {
+	album := albumTitle(source)
+	albumPath := filepath.ToSlash(source.relPath)
+
+	for _, file := range source.files {
+		thumbnailFilename, _ := getGalleryFilenames(file.name, config)
+		filePath := path.Join(albumPath, file.name)
+
+		record := searchRecord{
+			ID:        getFileID(filePath),
+			Path:      filePath,
+			Album:     album,
+			AlbumPath: albumPath,
+			URL:       escapeURLPath(path.Join(albumPath, config.assets.htmlFile)) + "#" + url.PathEscape(file.name),
+			Thumbnail: escapeURLPath(path.Join(albumPath, config.files.thumbnailDir, thumbnailFilename)),
+			Caption:   file.sidecar.caption,
+			Keywords:  file.sidecar.keywords,
+			Camera:    file.camera,
+			Rating:    file.sidecar.rating,
+		}
+		if !file.takenTime.IsZero() {
+			record.Date = file.takenTime.In(config.media.timezone).Format(time.RFC3339)
+			record.Timestamp = file.takenTime.Unix()
+		}
+		records = append(records, record)
+	}
+
+	for _, subdir := range source.subdirectories {
+		records = append(records, createSearchRecords(subdir, config)...)
+	}
+
+	return records
+}
+
+// getFileID returns a stable ID of a file from its slash-separated path relative to the
+// source root, made of letters and digits
+func getFileID(filePath string) string {
+	hash := sha1.Sum([]byte(filePath))
+	return hex.EncodeToString(hash[:])
+}
+
+// escapeURLPath escapes each element of a slash-separated relative path for use in a URL
+func escapeURLPath(relativePath string) string {
+	elements := strings.Split(relativePath, "/")
+	for i := range elements {
+		elements[i] = url.PathEscape(elements[i])
+	}
+	return strings.Join(elements, "/")
+}
+
+// writeSearchIndex writes a newline-delimited JSON file of all source files into the
+// gallery root, to be pushed into an external search engine. Returns the file path.
+func writeSearchIndex(source directory, gallery directory, dryRun bool, config configuration) (string, error) {
+	indexPath := filepath.Join(gallery.absPath, searchIndexFile)
+	if dryRun {
+		log.Println("Would create search index:", indexPath)
+		return indexPath, nil
+	}
+
+	indexHandle, err := createFile(indexPath, config)
+	if err != nil {
+		return indexPath, fmt.Errorf("couldn't create search index %s: %w", indexPath, err)
+	}
+	defer indexHandle.Close()
+
+	writer := bufio.NewWriter(indexHandle)
+	encoder := json.NewEncoder(writer)
+	encoder.SetEscapeHTML(false)
+	for _, record := range createSearchRecords(source, config) {
+		err = encoder.Encode(record)
+		if err != nil {
+			return indexPath, fmt.Errorf("couldn't write search index %s: %w", indexPath, err)
+		}
+	}
+
+	err = writer.Flush()
+	if err != nil {
+		return indexPath, fmt.Errorf("couldn't write search index %s: %w", indexPath, err)
+	}
+
+	log.Println("Created search index:", indexPath)
+	return indexPath, nil
+}
+
+// postSearchIndex POSTs the search index file to given URL, e.g. a Meilisearch
+// documents endpoint. Headers are given as "Name: value", typically for an API key.
+func postSearchIndex(indexPath string, postURL string, headers []string, dryRun bool) error {
+	if dryRun {
+		log.Println("Would post search index", indexPath, "to", postURL)
+		return nil
+	}
+
+	indexHandle, err := os.Open(indexPath)
+	if err != nil {
+		return err
+	}
+	defer indexHandle.Close()
+
+	request, err := http.NewRequest(http.MethodPost, postURL, indexHandle)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-ndjson")
+	for _, header := range headers {
+		nameValue := strings.SplitN(header, ":", 2)
+		if len(nameValue) != 2 {
+			return errors.New("invalid header, must be Name: value: " + header)
+		}
+		request.Header.Set(strings.TrimSpace(nameValue[0]), strings.TrimSpace(nameValue[1]))
+	}
+
+	client := http.Client{Timeout: 5 * time.Minute}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("search index upload to %s failed: %s", postURL, response.Status)
+	}
+
+	log.Println("Posted search index to", postURL)
+	return nil
+}
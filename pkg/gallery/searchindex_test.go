@@ -0,0 +1,109 @@
+package gallery
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateSearchRecords(t *testing.T) {
+	config := initializeConfig()
+	config.media.timezone = time.UTC
+
+	source := directory{
+		name:  "source",
+		files: []file{{name: "a.jpg"}},
+		subdirectories: []directory{{
+			name:    "Summer trip",
+			relPath: "Summer trip",
+			title:   "Summer 2021",
+			files: []file{{
+				name:      "beach #1.heic",
+				takenTime: time.Date(2021, 6, 12, 18, 30, 0, 0, time.UTC),
+				camera:    "Apple iPhone 12",
+				sidecar:   sidecarMetadata{caption: "Beach", keywords: []string{"sea", "sand"}, rating: 4},
+			}},
+		}},
+	}
+
+	records := createSearchRecords(source, config)
+	assert.Len(t, records, 2)
+	assert.EqualValues(t, "a.jpg", records[0].Path)
+	assert.EqualValues(t, "index.html#a.jpg", records[0].URL)
+	assert.Empty(t, records[0].Date)
+
+	record := records[1]
+	assert.Regexp(t, "^[0-9a-f]{40}$", record.ID)
+	assert.NotEqual(t, records[0].ID, record.ID)
+	assert.EqualValues(t, "Summer trip/beach #1.heic", record.Path)
+	assert.EqualValues(t, "Summer 2021", record.Album)
+	assert.EqualValues(t, "Summer trip", record.AlbumPath)
+	assert.EqualValues(t, "Summer%20trip/index.html#beach%20%231.heic", record.URL)
+	assert.EqualValues(t, "Summer%20trip/_thumbnail/beach%20%231.jpg", record.Thumbnail)
+	assert.EqualValues(t, "2021-06-12T18:30:00Z", record.Date)
+	assert.EqualValues(t, []string{"sea", "sand"}, record.Keywords)
+	assert.EqualValues(t, "Apple iPhone 12", record.Camera)
+	assert.EqualValues(t, 4, record.Rating)
+}
+
+func TestWriteAndPostSearchIndex(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	source := directory{name: "source", files: []file{{name: "a.jpg"}, {name: "b.mp4"}}}
+	gallery := directory{absPath: tempDir}
+
+	indexPath, _ := writeSearchIndex(source, gallery, true, config)
+	assert.False(t, exists(indexPath))
+
+	indexPath, _ = writeSearchIndex(source, gallery, false, config)
+	assert.EqualValues(t, filepath.Join(tempDir, searchIndexFile), indexPath)
+
+	indexHandle, err := os.Open(indexPath)
+	assert.NoError(t, err)
+	defer indexHandle.Close()
+	scanner := bufio.NewScanner(indexHandle)
+	var paths []string
+	for scanner.Scan() {
+		var record searchRecord
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		paths = append(paths, record.Path)
+	}
+	assert.EqualValues(t, []string{"a.jpg", "b.mp4"}, paths)
+
+	var received []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.EqualValues(t, "application/x-ndjson", r.Header.Get("Content-Type"))
+		assert.EqualValues(t, "Bearer secret", r.Header.Get("Authorization"))
+		received, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	err = postSearchIndex(indexPath, server.URL, []string{"Authorization: Bearer secret"}, false)
+	assert.NoError(t, err)
+	written, _ := os.ReadFile(indexPath)
+	assert.EqualValues(t, written, received)
+
+	err = postSearchIndex(indexPath, server.URL, []string{"no separator"}, false)
+	assert.Error(t, err)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer failing.Close()
+	err = postSearchIndex(indexPath, failing.URL, nil, false)
+	assert.Error(t, err)
+}
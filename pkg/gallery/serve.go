@@ -0,0 +1,170 @@
+package gallery
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// MIME types of gallery files missing from Go's built-in table, which some systems
+// don't have a mime.types file for either
+var serveMIMETypes = map[string]string{
+	".webp":        "image/webp",
+	".avif":        "image/avif",
+	".mp4":         "video/mp4",
+	".webm":        "video/webm",
+	".mp3":         "audio/mpeg",
+	".m4a":         "audio/mp4",
+	".ogg":         "audio/ogg",
+	".gpx":         "application/gpx+xml",
+	".webmanifest": "application/manifest+json",
+	".ndjson":      "application/x-ndjson",
+}
+
+// Script injected into pages served with live reload, polling the reload stamp the same
+// way pages built with --live-reload do
+const serveLiveReloadScript = `<script>
+(() => {
+    let stamp
+    setInterval(() => {
+        fetch("/` + liveReloadFile + `", { cache: "no-store" })
+            .then((response) => response.text())
+            .then((text) => {
+                if (stamp !== undefined && text !== stamp) {
+                    window.location.reload()
+                }
+                stamp = text
+            })
+            .catch(() => {})
+    }, 1000)
+})()
+</script>
+`
+
+// galleryHandler serves a gallery directory for previewing it locally. Directories are
+// served with their album pages. With live reload, open pages reload themselves once the
+// gallery has been built again.
+type galleryHandler struct {
+	galleryDirectory string
+	htmlFile         string
+	liveReload       bool
+}
+
+func (handler galleryHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	urlPath := path.Clean("/" + request.URL.Path)
+
+	// The reload stamp changes with the build manifest, written at the end of each run
+	if handler.liveReload && urlPath == "/"+liveReloadFile {
+		writer.Header().Set("Cache-Control", "no-store")
+		manifestInfo, err := os.Stat(filepath.Join(handler.galleryDirectory, buildManifestFile))
+		if err == nil {
+			fmt.Fprint(writer, strconv.FormatInt(manifestInfo.ModTime().UnixNano(), 10))
+		}
+		return
+	}
+
+	filePath := filepath.Join(handler.galleryDirectory, filepath.FromSlash(urlPath))
+	if isDirectory(filePath) {
+		// Relative links of album pages only work with the trailing slash
+		if !strings.HasSuffix(request.URL.Path, "/") {
+			http.Redirect(writer, request, request.URL.Path+"/", http.StatusMovedPermanently)
+			return
+		}
+		filePath = filepath.Join(filePath, handler.htmlFile)
+	}
+
+	if handler.liveReload && isHTMLFilename(filePath) {
+		handler.serveLiveReloadPage(writer, request, filePath)
+		return
+	}
+	http.ServeFile(writer, request, filePath)
+}
+
+// serveLiveReloadPage serves an HTML page with the live reload script added, unless it was
+// built with --live-reload and already has it
+func (handler galleryHandler) serveLiveReloadPage(writer http.ResponseWriter, request *http.Request, filePath string) {
+	page, err := os.ReadFile(filePath)
+	if err != nil {
+		http.NotFound(writer, request)
+		return
+	}
+
+	if !bytes.Contains(page, []byte(liveReloadFile)) {
+		bodyEnd := bytes.LastIndex(page, []byte("</body>"))
+		if bodyEnd < 0 {
+			bodyEnd = len(page)
+		}
+		page = append(page[:bodyEnd:bodyEnd], append([]byte(serveLiveReloadScript), page[bodyEnd:]...)...)
+	}
+
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+	writer.Header().Set("Cache-Control", "no-store")
+	_, _ = writer.Write(page)
+}
+
+// isHTMLFilename checks whether given file is an HTML page
+func isHTMLFilename(filename string) bool {
+	extension := strings.ToLower(filepath.Ext(filename))
+	return extension == ".html" || extension == ".htm"
+}
+
+// registerServeMIMETypes adds the MIME types of gallery files missing from the system
+func registerServeMIMETypes() {
+	for extension, mimeType := range serveMIMETypes {
+		if mime.TypeByExtension(extension) == "" {
+			_ = mime.AddExtensionType(extension, mimeType)
+		}
+	}
+}
+
+// ServeOptions struct holds the options of the serve command, documented by their
+// go-arg tags; empty ones get the defaults of the command. Messages gets the messages of
+// the server, which are left out if it's nil.
+type ServeOptions struct {
+	Gallery    string    `arg:"positional,required" help:"Gallery directory to serve"`
+	Listen     string    `arg:"--listen" default:"localhost:8080" help:"address and port to serve the gallery at"`
+	HTMLFile   string    `arg:"--html-file" default:"index.html" help:"filename of album pages the gallery was built with"`
+	LiveReload bool      `arg:"--live-reload" help:"make served pages reload themselves when the gallery is built again"`
+	Messages   io.Writer `arg:"-"`
+}
+
+// Serve serves a gallery over HTTP for previewing it locally, e.g. with a run with
+// --watch updating it in another terminal. Returns once ctx is done, or if serving fails.
+func Serve(ctx context.Context, args ServeOptions) error {
+	if args.Listen == "" {
+		args.Listen = "localhost:8080"
+	}
+	if args.HTMLFile == "" {
+		args.HTMLFile = defaultHTMLFile
+	}
+	galleryDirectory, _ := filepath.Abs(args.Gallery)
+	if !isDirectory(galleryDirectory) {
+		return errors.New("gallery directory doesn't exist: " + args.Gallery)
+	}
+	if !isValidHTMLFilename(args.HTMLFile) {
+		return errors.New("invalid HTML filename, must be a .html or .htm filename not used by other pages: " + args.HTMLFile)
+	}
+
+	registerServeMIMETypes()
+	handler := galleryHandler{galleryDirectory: galleryDirectory, htmlFile: args.HTMLFile, liveReload: args.LiveReload}
+	server := &http.Server{Addr: args.Listen, Handler: handler}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	fmt.Fprintln(getOutput(args.Messages), "Serving", galleryDirectory, "at http://"+args.Listen+"/, press ctrl-C to stop...")
+	err := server.ListenAndServe()
+	if ctx.Err() != nil {
+		return nil
+	}
+	return fmt.Errorf("couldn't serve gallery: %w", err)
+}
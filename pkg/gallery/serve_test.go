@@ -0,0 +1,65 @@
+package gallery
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGalleryHandler(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+	err = os.MkdirAll(filepath.Join(tempDir, "trip"), 0755)
+	assert.NoError(t, err)
+	for name, contents := range map[string]string{
+		"album.html":                         "<html><body>Root</body></html>",
+		filepath.Join("trip", "album.html"):  "<html><body>Trip</body></html>",
+		filepath.Join("trip", "clip.mp4"):    "video",
+		filepath.Join("trip", "track.gpx"):   "<gpx/>",
+		filepath.Join("trip", "reload.html"): "<html><body>" + liveReloadFile + "</body></html>",
+		buildManifestFile:                    "{}",
+	} {
+		err = os.WriteFile(filepath.Join(tempDir, name), []byte(contents), 0644)
+		assert.NoError(t, err)
+	}
+	registerServeMIMETypes()
+
+	serve := func(handler galleryHandler, url string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, url, nil))
+		return recorder
+	}
+	handler := galleryHandler{galleryDirectory: tempDir, htmlFile: "album.html"}
+
+	// Directories are served with their album pages, after adding the trailing slash
+	response := serve(handler, "/trip/")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Contains(t, response.Body.String(), "Trip")
+	assert.NotContains(t, response.Body.String(), "setInterval")
+	response = serve(handler, "/trip")
+	assert.Equal(t, http.StatusMovedPermanently, response.Code)
+	assert.Equal(t, "/trip/", response.Header().Get("Location"))
+
+	// Gallery files have their MIME types
+	assert.Equal(t, "video/mp4", serve(handler, "/trip/clip.mp4").Header().Get("Content-Type"))
+	assert.Contains(t, serve(handler, "/trip/track.gpx").Header().Get("Content-Type"), "xml")
+
+	// Nothing outside the gallery is served
+	assert.Equal(t, http.StatusBadRequest, serve(handler, "/../../etc/passwd").Code)
+	assert.Equal(t, http.StatusNotFound, serve(handler, "/missing/").Code)
+
+	// With live reload, pages poll the reload stamp of the last build
+	handler.liveReload = true
+	response = serve(handler, "/")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Regexp(t, "setInterval(.|\n)*</body></html>$", response.Body.String())
+	assert.NotContains(t, serve(handler, "/trip/reload.html").Body.String(), "setInterval")
+	assert.NotEmpty(t, serve(handler, "/"+liveReloadFile).Body.String())
+}
@@ -0,0 +1,89 @@
+package gallery
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// The service worker has to be served from the gallery itself for browsers to install it
+const serviceWorkerFile = "serviceWorker.js"
+
+// getAssetsVersion returns a short hash of the embedded web assets. Shared assets are
+// kept in a directory named by it, so galleries built with other versions of fastgallery
+// keep working when assets change.
+func getAssetsVersion(config configuration) (string, error) {
+	assetDirectoryListing, err := assets.ReadDir(config.assets.assetsDir)
+	if err != nil {
+		return "", fmt.Errorf("couldn't list embedded assets: %w", err)
+	}
+
+	hash := sha1.New()
+	for _, entry := range assetDirectoryListing {
+		if entry.IsDir() {
+			continue
+		}
+		assetPath := filepath.Join(config.assets.assetsDir, entry.Name())
+		asset, err := assets.ReadFile(assetPath)
+		if err != nil {
+			return "", fmt.Errorf("couldn't open embedded asset %s: %w", assetPath, err)
+		}
+		hash.Write([]byte(entry.Name()))
+		hash.Write(asset)
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:12], nil
+}
+
+// getSharedAssetsURL returns the URL of this version's assets under the shared asset root
+func getSharedAssetsURL(rootURL string, config configuration) (string, error) {
+	version, err := getAssetsVersion(config)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(rootURL, "/") + "/" + version + "/", nil
+}
+
+// isSharedAsset checks whether an asset is linked from the shared asset location instead
+// of the gallery root. The PWA icons and service worker stay in every gallery, as they
+// have to be served from the gallery's own origin.
+func isSharedAsset(name string, config configuration) bool {
+	if config.assets.sharedURL == "" || name == serviceWorkerFile || isIcon(name) {
+		return false
+	}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".js", ".css", ".png":
+		return true
+	}
+	return false
+}
+
+// getAssetURL returns the link to an asset from a page rootEscape below the gallery root
+func getAssetURL(name string, rootEscape string, config configuration) string {
+	if isSharedAsset(name, config) {
+		return config.assets.sharedURL + name
+	}
+	return filepath.Join(rootEscape, name)
+}
+
+// exportSharedAssets copies the web assets into a directory named by their version under
+// the shared asset directory. Earlier versions are left in place for older galleries.
+func exportSharedAssets(sharedDirectory string, dryRun bool, config configuration) error {
+	version, err := getAssetsVersion(config)
+	if err != nil {
+		return err
+	}
+	versionDirectory := filepath.Join(sharedDirectory, version)
+	for _, assetDirectory := range []string{sharedDirectory, versionDirectory} {
+		err := createDirectory(assetDirectory, dryRun, config)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Shared assets aren't filtered out when exporting them
+	exportConfig := config
+	exportConfig.assets.sharedURL = ""
+	return copyRootAssets(directory{absPath: versionDirectory}, dryRun, exportConfig)
+}
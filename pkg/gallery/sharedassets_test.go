@@ -0,0 +1,73 @@
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSharedAssetURLs(t *testing.T) {
+	config := initializeConfig()
+	version, err := getAssetsVersion(config)
+	assert.NoError(t, err)
+	assert.Regexp(t, "^[0-9a-f]{12}$", version)
+	sharedURL, err := getSharedAssetsURL("https://example.com/assets/", config)
+	assert.NoError(t, err)
+	assert.EqualValues(t, "https://example.com/assets/"+version+"/", sharedURL)
+	sharedURL, err = getSharedAssetsURL("/assets", config)
+	assert.NoError(t, err)
+	assert.EqualValues(t, "/assets/"+version+"/", sharedURL)
+
+	// Missing assets are an error, not a crash
+	brokenConfig := initializeConfig()
+	brokenConfig.assets.assetsDir = "missing"
+	_, err = getAssetsVersion(brokenConfig)
+	assert.Error(t, err)
+
+	assert.False(t, isSharedAsset("fastgallery.css", config))
+	assert.EqualValues(t, filepath.Join("..", "fastgallery.css"), getAssetURL("fastgallery.css", "../", config))
+
+	config.assets.sharedURL = "/assets/1/"
+	assert.True(t, isSharedAsset("fastgallery.css", config))
+	assert.True(t, isSharedAsset("folder.png", config))
+	assert.False(t, isSharedAsset(serviceWorkerFile, config))
+	assert.False(t, isSharedAsset("icon-192x192.png", config))
+	assert.EqualValues(t, "/assets/1/fastgallery.css", getAssetURL("fastgallery.css", "../", config))
+	assert.EqualValues(t, filepath.Join("..", serviceWorkerFile), getAssetURL(serviceWorkerFile, "../", config))
+}
+
+func TestExportSharedAssets(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	config.assets.sharedURL, err = getSharedAssetsURL("/assets", config)
+	assert.NoError(t, err)
+	version, err := getAssetsVersion(config)
+	assert.NoError(t, err)
+	sharedDirectory := filepath.Join(tempDir, "assets")
+	galleryDirectory := filepath.Join(tempDir, "gallery")
+	err = os.Mkdir(galleryDirectory, 0755)
+	assert.NoError(t, err)
+
+	exportSharedAssets(sharedDirectory, false, config)
+	assert.FileExists(t, filepath.Join(sharedDirectory, version, "fastgallery.css"))
+	assert.FileExists(t, filepath.Join(sharedDirectory, version, "folder.png"))
+
+	// Only the files which must be served by the gallery itself are copied into it
+	copyRootAssets(directory{absPath: galleryDirectory}, false, config)
+	assert.NoFileExists(t, filepath.Join(galleryDirectory, "fastgallery.css"))
+	assert.FileExists(t, filepath.Join(galleryDirectory, serviceWorkerFile))
+	assert.FileExists(t, filepath.Join(galleryDirectory, "icon-192x192.png"))
+
+	createHTML(1, directory{name: "album", files: []file{{name: "a.jpg"}}}, galleryDirectory, testTemplates(t, config).html, false, config)
+	html, err := os.ReadFile(filepath.Join(galleryDirectory, config.assets.htmlFile))
+	assert.NoError(t, err)
+	assert.Contains(t, string(html), `<link href="`+config.assets.sharedURL+`fastgallery.css" rel="stylesheet">`)
+	assert.Contains(t, string(html), `src="`+config.assets.sharedURL+`back.png"`)
+}
@@ -0,0 +1,99 @@
+package gallery
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// exportSingleFile writes the media files in the root of the source directory into one
+// self-contained HTML file, for emailing or archiving a small album. Thumbnails are
+// inlined as data URIs. Full-size images are inlined too if inlineFullsize is set,
+// otherwise they and all videos are linked relative to the output file.
+// Must be called after the gallery has been updated, as the files are read from there.
+func exportSingleFile(source directory, galleryDirectory string, outputPath string, cookedTemplate *template.Template, inlineFullsize bool, dryRun bool, config configuration) error {
+	outputPath, err := filepath.Abs(outputPath)
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		log.Println("Would export single-file gallery:", outputPath)
+		return nil
+	}
+
+	thisHTML := htmlData{
+		Title:       albumTitle(source),
+		ImageWidth:  fmt.Sprint(config.media.thumbnailWidth),
+		ImageHeight: fmt.Sprint(config.media.thumbnailHeight),
+	}
+
+	thumbnailGalleryDirectory, fullsizeGalleryDirectory, _ := getGalleryDirectoryNames(galleryDirectory, config)
+	for _, file := range source.files {
+		thumbnailFilename, fullsizeFilename := getGalleryFilenames(file.absPath, config)
+
+		thumbnail, err := dataURI(filepath.Join(thumbnailGalleryDirectory, thumbnailFilename))
+		if err != nil {
+			log.Println("couldn't inline thumbnail:", err.Error())
+			continue
+		}
+
+		fullsizePath := filepath.Join(fullsizeGalleryDirectory, fullsizeFilename)
+		var fullsize string
+		if inlineFullsize && isImageFile(file.absPath, config) {
+			fullsize, err = dataURI(fullsizePath)
+		} else {
+			fullsize, err = filepath.Rel(filepath.Dir(outputPath), fullsizePath)
+			fullsize = filepath.ToSlash(fullsize)
+		}
+		if err != nil {
+			log.Println("couldn't include full-size file:", err.Error())
+			continue
+		}
+
+		thisHTML.Files = append(thisHTML.Files, htmlFile{
+			Filename:  file.name,
+			Thumbnail: thumbnail,
+			Fullsize:  fullsize,
+			Caption:   file.sidecar.caption,
+			Keywords:  strings.Join(file.sidecar.keywords, ", "),
+			Rating:    file.sidecar.rating,
+			Label:     file.sidecar.label,
+			Taken:     formatTakenTime(file.takenTime, config),
+		})
+	}
+
+	outputHandle, err := createFile(outputPath, config)
+	if err != nil {
+		return fmt.Errorf("couldn't create single-file gallery %s: %w", outputPath, err)
+	}
+	defer outputHandle.Close()
+
+	err = cookedTemplate.Execute(outputHandle, thisHTML)
+	if err != nil {
+		return fmt.Errorf("couldn't execute single-file template %s: %w", outputPath, err)
+	}
+
+	log.Println("Exported single-file gallery:", outputPath)
+	return nil
+}
+
+// dataURI reads a file and returns it base64-encoded as a data URI
+func dataURI(filePath string) (string, error) {
+	contents, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	mimeType := mime.TypeByExtension(strings.ToLower(filepath.Ext(filePath)))
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(contents), nil
+}
@@ -0,0 +1,67 @@
+package gallery
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportSingleFile(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	cookedTemplates := testTemplates(t, config)
+	galleryDirectory := filepath.Join(tempDir, "gallery")
+	thumbnailGalleryDirectory, fullsizeGalleryDirectory, _ := getGalleryDirectoryNames(galleryDirectory, config)
+	for _, directory := range []string{thumbnailGalleryDirectory, fullsizeGalleryDirectory} {
+		err = os.MkdirAll(directory, 0755)
+		assert.NoError(t, err)
+	}
+
+	galleryFiles := map[string]string{
+		filepath.Join(thumbnailGalleryDirectory, "photo.jpg"): "photo thumbnail",
+		filepath.Join(fullsizeGalleryDirectory, "photo.jpg"):  "photo full-size",
+		filepath.Join(thumbnailGalleryDirectory, "video.jpg"): "video thumbnail",
+		filepath.Join(fullsizeGalleryDirectory, "video.mp4"):  "video full-size",
+	}
+	for filename, contents := range galleryFiles {
+		err = os.WriteFile(filename, []byte(contents), 0644)
+		assert.NoError(t, err)
+	}
+
+	source := directory{
+		name: "Holiday",
+		files: []file{
+			{name: "photo.heic", absPath: "/photos/photo.heic", sidecar: sidecarMetadata{caption: "Beach <3"}},
+			{name: "video.mov", absPath: "/photos/video.mov"},
+			{name: "missing.jpg", absPath: "/photos/missing.jpg"},
+		},
+	}
+
+	outputPath := filepath.Join(tempDir, "holiday.html")
+	exportSingleFile(source, galleryDirectory, outputPath, cookedTemplates.singleFile, false, true, config)
+	assert.False(t, exists(outputPath))
+
+	exportSingleFile(source, galleryDirectory, outputPath, cookedTemplates.singleFile, false, false, config)
+	html, err := os.ReadFile(outputPath)
+	assert.NoError(t, err)
+	assert.Contains(t, string(html), "<title>Holiday</title>")
+	assert.Contains(t, string(html), "data:image/jpeg;base64,"+base64.StdEncoding.EncodeToString([]byte("photo thumbnail")))
+	assert.Contains(t, string(html), "Beach &lt;3")
+	assert.Contains(t, string(html), `href="gallery/_fullsize/photo.jpg"`)
+	assert.Contains(t, string(html), `href="gallery/_fullsize/video.mp4"`)
+	assert.NotContains(t, string(html), "missing.jpg")
+
+	exportSingleFile(source, galleryDirectory, outputPath, cookedTemplates.singleFile, true, false, config)
+	html, err = os.ReadFile(outputPath)
+	assert.NoError(t, err)
+	assert.Contains(t, string(html), `href="data:image/jpeg;base64,`+base64.StdEncoding.EncodeToString([]byte("photo full-size")))
+	assert.Contains(t, string(html), `href="gallery/_fullsize/video.mp4"`)
+}
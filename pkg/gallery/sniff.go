@@ -0,0 +1,99 @@
+package gallery
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Kinds of media files told apart by their contents
+const (
+	mediaKindImage = "image"
+	mediaKindHEIF  = "heif"
+	mediaKindVideo = "video"
+)
+
+// Brands of ISO base media files which are HEIF images rather than videos
+var heifBrands = map[string]bool{"heic": true, "heix": true, "heim": true, "heis": true, "mif1": true, "msf1": true, "avif": true}
+
+// sniffMediaKind reads the first bytes of a file and returns its kind of media, or an
+// empty string if it isn't a media file fastgallery knows
+func sniffMediaKind(path string) string {
+	fileHandle, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer fileHandle.Close()
+
+	header := make([]byte, 192)
+	length, err := io.ReadFull(fileHandle, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return ""
+	}
+	return getMediaKind(header[:length])
+}
+
+// getMediaKind returns the kind of media of a file by its first bytes, or an empty
+// string if it isn't a media file fastgallery knows
+func getMediaKind(header []byte) string {
+	switch {
+	case bytes.HasPrefix(header, []byte{0xff, 0xd8, 0xff}),
+		bytes.HasPrefix(header, []byte("\x89PNG\r\n\x1a\n")),
+		bytes.HasPrefix(header, []byte("GIF87a")),
+		bytes.HasPrefix(header, []byte("GIF89a")),
+		// TIFF, and the RAW formats based on it
+		bytes.HasPrefix(header, []byte("II*\x00")),
+		bytes.HasPrefix(header, []byte("MM\x00*")):
+		return mediaKindImage
+	case len(header) >= 12 && string(header[4:8]) == "ftyp":
+		if heifBrands[string(header[8:12])] {
+			return mediaKindHEIF
+		}
+		return mediaKindVideo
+	case len(header) >= 12 && string(header[0:4]) == "RIFF" && string(header[8:12]) == "AVI ",
+		// Matroska and WebM
+		bytes.HasPrefix(header, []byte{0x1a, 0x45, 0xdf, 0xa3}),
+		// Windows Media
+		bytes.HasPrefix(header, []byte{0x30, 0x26, 0xb2, 0x75, 0x8e, 0x66, 0xcf, 0x11}),
+		bytes.HasPrefix(header, []byte("FLV\x01")),
+		// MPEG program streams
+		bytes.HasPrefix(header, []byte{0x00, 0x00, 0x01, 0xba}),
+		// MPEG transport streams have a sync byte every 188 bytes
+		len(header) > 188 && header[0] == 0x47 && header[188] == 0x47:
+		return mediaKindVideo
+	default:
+		return ""
+	}
+}
+
+// getSniffedKind returns the kind of media a file was found to be by its contents during
+// this run, or an empty string if it wasn't. Files are remembered by absolute path, as
+// files of the same name in other albums can be anything.
+func getSniffedKind(filename string, config configuration) string {
+	kind, ok := config.run.sniffedFiles.Load(filename)
+	if !ok {
+		return ""
+	}
+	return kind.(string)
+}
+
+// isSniffedMediaFile checks a file without a known extension by its contents, if it's
+// given with an absolute path, while scanning the source, unless turned off with
+// --no-sniff for faster scans. Media files found are remembered, so they're transformed
+// like the ones with known extensions. Files with extensions of other files sources have
+// plenty of aren't read.
+func isSniffedMediaFile(filename string, noVideos bool, config configuration) bool {
+	extension := strings.ToLower(filepath.Ext(filename))
+	if !config.media.sniffContents || nonMediaExtensions[extension] || !filepath.IsAbs(filename) {
+		return false
+	}
+
+	kind := sniffMediaKind(filename)
+	if kind == "" || (kind == mediaKindVideo && noVideos) {
+		return false
+	}
+	config.run.sniffedFiles.Store(filename, kind)
+	return true
+}
@@ -0,0 +1,107 @@
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetMediaKind(t *testing.T) {
+	transportStream := make([]byte, 192)
+	transportStream[0], transportStream[188] = 0x47, 0x47
+
+	for header, kind := range map[string]string{
+		"\xff\xd8\xff\xe1\x00\x10Exif":      mediaKindImage,
+		"\x89PNG\r\n\x1a\n\x00\x00":         mediaKindImage,
+		"II*\x00\x10\x00\x00\x00CR\x02\x00": mediaKindImage,
+		"\x00\x00\x00\x18ftypheic\x00\x00":  mediaKindHEIF,
+		"\x00\x00\x00\x18ftypqt  \x00\x00":  mediaKindVideo,
+		"\x00\x00\x00\x18ftypisom\x00\x00":  mediaKindVideo,
+		"RIFF\x00\x00\x00\x00AVI LIST":      mediaKindVideo,
+		"\x1a\x45\xdf\xa3\x01\x00\x00\x00":  mediaKindVideo,
+		"FLV\x01\x05\x00\x00\x00\x09":       mediaKindVideo,
+		string(transportStream):             mediaKindVideo,
+		"RIFF\x00\x00\x00\x00WEBPVP8 ":      "",
+		"<?xml version=\"1.0\"?>":           "",
+		"":                                  "",
+	} {
+		assert.Equal(t, kind, getMediaKind([]byte(header)), header)
+	}
+}
+
+func TestSniffedMediaFiles(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+	config := initializeConfig()
+
+	os.WriteFile(filepath.Join(tempDir, "IMG_1234"), []byte("\xff\xd8\xff\xe1\x00\x10Exif"), 0644)
+	os.WriteFile(filepath.Join(tempDir, "IMG_1235"), []byte("\x00\x00\x00\x18ftypheic\x00\x00"), 0644)
+	os.WriteFile(filepath.Join(tempDir, "MVI_1236"), []byte("\x00\x00\x00\x18ftypqt  \x00\x00"), 0644)
+	os.WriteFile(filepath.Join(tempDir, "notes"), []byte("shopping list"), 0644)
+	os.WriteFile(filepath.Join(tempDir, "IMG_1237.thm"), []byte("\xff\xd8\xff\xe1\x00\x10Exif"), 0644)
+
+	// Turned off, only known extensions are media files
+	config.media.sniffContents = false
+	assert.False(t, isMediaFile(filepath.Join(tempDir, "IMG_1234"), false, config))
+
+	config.media.sniffContents = true
+	assert.False(t, isMediaFile(filepath.Join(tempDir, "MVI_1236"), true, config))
+	tree, _ := createDirectoryTree(tempDir, "", false, config)
+	var names []string
+	for _, file := range tree.files {
+		names = append(names, file.name)
+	}
+	assert.ElementsMatch(t, []string{"IMG_1234", "IMG_1235", "MVI_1236"}, names)
+
+	// Later checks know the files found by their path
+	assert.True(t, isImageFile(filepath.Join(tempDir, "IMG_1234"), config))
+	assert.True(t, isImageFile(filepath.Join(tempDir, "IMG_1235"), config))
+	assert.True(t, isHEIFFile(filepath.Join(tempDir, "IMG_1235"), config))
+	assert.False(t, isVideoFile(filepath.Join(tempDir, "IMG_1234"), config))
+	assert.True(t, isVideoFile(filepath.Join(tempDir, "MVI_1236"), config))
+	assert.False(t, isImageFile(filepath.Join(tempDir, "notes"), config))
+
+	// Other runs haven't found them
+	assert.False(t, isImageFile(filepath.Join(tempDir, "IMG_1234"), initializeConfig()))
+
+	thumbnailFilename, fullsizeFilename := getGalleryFilenames(filepath.Join(tempDir, "MVI_1236"), config)
+	assert.Equal(t, "MVI_1236.jpg", thumbnailFilename)
+	assert.Equal(t, "MVI_1236.mp4", fullsizeFilename)
+}
+
+func TestSniffedFilesOfSameName(t *testing.T) {
+	tempDir := t.TempDir()
+	config := initializeConfig()
+
+	// A video without an extension in one album, and a text file of the same name in another
+	for _, album := range []string{"a", "b"} {
+		err := os.Mkdir(filepath.Join(tempDir, album), 0755)
+		assert.NoError(t, err)
+	}
+	videoPath := filepath.Join(tempDir, "a", "README")
+	textPath := filepath.Join(tempDir, "b", "README")
+	err := os.WriteFile(videoPath, []byte("\x00\x00\x00\x18ftypqt  \x00\x00"), 0644)
+	assert.NoError(t, err)
+	err = os.WriteFile(textPath, []byte("read me"), 0644)
+	assert.NoError(t, err)
+
+	assert.True(t, isMediaFile(videoPath, false, config))
+	assert.True(t, isVideoFile(videoPath, config))
+	assert.False(t, isMediaFile(textPath, false, config))
+	assert.False(t, isVideoFile(textPath, config))
+
+	tree, err := createDirectoryTree(tempDir, "", false, config)
+	assert.NoError(t, err)
+	for _, subdir := range tree.subdirectories {
+		if subdir.name == "a" {
+			assert.Len(t, subdir.files, 1)
+		} else {
+			assert.Empty(t, subdir.files)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package gallery
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// Default number of files a directory needs to have to be split into albums
+const defaultSplitMinFiles = 1000
+
+// splitMonthLayout names the albums of a directory split by month, e.g. "2021-03"
+const splitMonthLayout = "2006-01"
+
+// parseSplitAlbums parses the --split-albums argument, which is either "month" or the
+// number of files in each album
+func parseSplitAlbums(value string) (byMonth bool, chunkSize int, err error) {
+	if value == "month" {
+		return true, 0, nil
+	}
+
+	chunkSize, err = strconv.Atoi(value)
+	if err != nil || chunkSize < 1 {
+		return false, 0, errors.New("invalid album split, must be month or a positive number of files: " + value)
+	}
+	return false, chunkSize, nil
+}
+
+// splitAlbumName returns the name of the album the file at given index of a directory
+// with count files is split into. By month, files without a capture time go by their
+// modification time. In chunks, albums are named by the range of files in them, like
+// "0501-1000", in the directory's sort order.
+func splitAlbumName(sourceFile file, index int, count int, config configuration) string {
+	if config.media.splitByMonth {
+		takenTime := sourceFile.takenTime
+		if takenTime.IsZero() {
+			takenTime = sourceFile.modTime
+		}
+		return takenTime.In(config.media.timezone).Format(splitMonthLayout)
+	}
+
+	first := index/config.media.splitChunkSize*config.media.splitChunkSize + 1
+	last := first + config.media.splitChunkSize - 1
+	if last > count {
+		last = count
+	}
+	width := len(strconv.Itoa(count))
+	return fmt.Sprintf("%0*d-%0*d", width, first, width, last)
+}
+
+// splitDirectory moves the files of a source directory with too many of them to browse
+// into virtual albums, one subdirectory per month or chunk of files, like groupFlatDirectory
+// does for flat exports. Needs the files' capture times to be read already.
+func splitDirectory(source *directory, config configuration) {
+	if !config.media.splitByMonth && config.media.splitChunkSize == 0 {
+		return
+	}
+	if len(source.files) < config.media.splitMinFiles {
+		return
+	}
+
+	albums := make(map[string][]file)
+	for i, sourceFile := range source.files {
+		album := splitAlbumName(sourceFile, i, len(source.files), config)
+		sourceFile.relPath = filepath.Join(source.relPath, album, sourceFile.name)
+		albums[album] = append(albums[album], sourceFile)
+	}
+
+	// Go through albums in a stable order so the gallery looks the same on each run
+	var albumNames []string
+	for album := range albums {
+		albumNames = append(albumNames, album)
+	}
+	sort.Strings(albumNames)
+
+	for _, album := range albumNames {
+		addVirtualAlbum(source, album, albums[album], true)
+	}
+	sortDirectoriesByName(source.subdirectories)
+
+	source.files = nil
+}
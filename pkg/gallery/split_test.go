@@ -0,0 +1,87 @@
+package gallery
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSplitAlbums(t *testing.T) {
+	byMonth, chunkSize, err := parseSplitAlbums("month")
+	assert.NoError(t, err)
+	assert.True(t, byMonth)
+	assert.EqualValues(t, 0, chunkSize)
+
+	byMonth, chunkSize, err = parseSplitAlbums("500")
+	assert.NoError(t, err)
+	assert.False(t, byMonth)
+	assert.EqualValues(t, 500, chunkSize)
+
+	for _, invalid := range []string{"0", "-1", "weekly"} {
+		_, _, err = parseSplitAlbums(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestSplitDirectory(t *testing.T) {
+	config := initializeConfig()
+	config.media.timezone = time.UTC
+	config.media.splitMinFiles = 3
+
+	newSource := func() directory {
+		return directory{
+			name:    "Camera Uploads",
+			relPath: "Camera Uploads",
+			absPath: "/source/Camera Uploads",
+			files: []file{
+				{name: "a.jpg", takenTime: time.Date(2021, 3, 14, 12, 0, 0, 0, time.UTC)},
+				{name: "b.jpg", takenTime: time.Date(2021, 3, 31, 12, 0, 0, 0, time.UTC)},
+				{name: "c.jpg", modTime: time.Date(2021, 4, 1, 12, 0, 0, 0, time.UTC)},
+			},
+		}
+	}
+
+	// Not enabled
+	source := newSource()
+	splitDirectory(&source, config)
+	assert.Len(t, source.files, 3)
+	assert.Empty(t, source.subdirectories)
+
+	config.media.splitByMonth = true
+	source = newSource()
+	splitDirectory(&source, config)
+	assert.Empty(t, source.files)
+	assert.Len(t, source.subdirectories, 2)
+	assert.EqualValues(t, "2021-03", source.subdirectories[0].name)
+	assert.EqualValues(t, filepath.Join("Camera Uploads", "2021-03"), source.subdirectories[0].relPath)
+	assert.True(t, source.subdirectories[0].split)
+	assert.Len(t, source.subdirectories[0].files, 2)
+	assert.EqualValues(t, filepath.Join("Camera Uploads", "2021-03", "a.jpg"), source.subdirectories[0].files[0].relPath)
+	assert.EqualValues(t, "2021-04", source.subdirectories[1].name)
+
+	config.media.splitByMonth = false
+	config.media.splitChunkSize = 2
+	source = newSource()
+	splitDirectory(&source, config)
+	assert.Len(t, source.subdirectories, 2)
+	assert.EqualValues(t, "1-2", source.subdirectories[0].name)
+	assert.Len(t, source.subdirectories[0].files, 2)
+	assert.EqualValues(t, "3-3", source.subdirectories[1].name)
+
+	// Small directories stay as they are
+	config.media.splitMinFiles = 4
+	source = newSource()
+	splitDirectory(&source, config)
+	assert.Len(t, source.files, 3)
+}
+
+func TestSplitAlbumName(t *testing.T) {
+	config := initializeConfig()
+	config.media.splitChunkSize = 500
+
+	assert.EqualValues(t, "0001-0500", splitAlbumName(file{}, 0, 1200, config))
+	assert.EqualValues(t, "0501-1000", splitAlbumName(file{}, 999, 1200, config))
+	assert.EqualValues(t, "1001-1200", splitAlbumName(file{}, 1000, 1200, config))
+}
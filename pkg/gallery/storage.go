@@ -0,0 +1,96 @@
+package gallery
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+// galleryStorage is where the gallery is written to. All changes to the gallery go through
+// it, so galleries can be written to other places than the local file system, and tests
+// can check what would be written without temporary directories. The gallery is still
+// read from the local file system.
+type galleryStorage interface {
+	Mkdir(path string, mode os.FileMode) error
+	Create(path string, mode os.FileMode) (storageFile, error)
+	WriteFile(path string, data []byte, mode os.FileMode) error
+	Remove(path string) error
+	RemoveAll(path string) error
+	Symlink(target string, path string) error
+	Link(target string, path string) error
+	Rename(oldPath string, newPath string) error
+	Chmod(path string, mode os.FileMode) error
+	Lchown(path string, uid int, gid int) error
+	Chtimes(path string, atime time.Time, mtime time.Time) error
+}
+
+// storageFile is a gallery file open for writing
+type storageFile interface {
+	io.Writer
+	Sync() error
+	Close() error
+}
+
+// localStorage writes the gallery to the local file system
+type localStorage struct{}
+
+// Storage the gallery is written to
+var store galleryStorage = localStorage{}
+
+// getStorage returns the storage a run writes its gallery to. In --paranoid mode, it
+// refuses changes to the source directory.
+func getStorage(config configuration) galleryStorage {
+	if config.files.protectedDir == "" {
+		return store
+	}
+	return guardedStorage{galleryStorage: store, protectedDir: config.files.protectedDir}
+}
+
+func (localStorage) Mkdir(path string, mode os.FileMode) error {
+	return os.Mkdir(path, mode)
+}
+
+// Create creates or truncates a file
+func (localStorage) Create(path string, mode os.FileMode) (storageFile, error) {
+	fileHandle, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return nil, err
+	}
+	return fileHandle, nil
+}
+
+func (localStorage) WriteFile(path string, data []byte, mode os.FileMode) error {
+	return os.WriteFile(path, data, mode)
+}
+
+func (localStorage) Remove(path string) error {
+	return os.Remove(path)
+}
+
+func (localStorage) RemoveAll(path string) error {
+	return os.RemoveAll(path)
+}
+
+func (localStorage) Symlink(target string, path string) error {
+	return os.Symlink(target, path)
+}
+
+func (localStorage) Link(target string, path string) error {
+	return os.Link(target, path)
+}
+
+func (localStorage) Rename(oldPath string, newPath string) error {
+	return os.Rename(oldPath, newPath)
+}
+
+func (localStorage) Chmod(path string, mode os.FileMode) error {
+	return os.Chmod(path, mode)
+}
+
+func (localStorage) Lchown(path string, uid int, gid int) error {
+	return os.Lchown(path, uid, gid)
+}
+
+func (localStorage) Chtimes(path string, atime time.Time, mtime time.Time) error {
+	return os.Chtimes(path, atime, mtime)
+}
@@ -0,0 +1,151 @@
+package gallery
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryStorage keeps written gallery files in memory, for testing what's written
+// without temporary directories
+type memoryStorage struct {
+	mutex       sync.Mutex
+	files       map[string][]byte
+	directories map[string]bool
+	symlinks    map[string]string
+	modes       map[string]os.FileMode
+	owners      map[string]int
+}
+
+// memoryFile is a file being written to memory, saved when closed
+type memoryFile struct {
+	bytes.Buffer
+	path    string
+	storage *memoryStorage
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{files: make(map[string][]byte), directories: make(map[string]bool), symlinks: make(map[string]string), modes: make(map[string]os.FileMode), owners: make(map[string]int)}
+}
+
+// useMemoryStorage writes the gallery to memory until the test is done
+func useMemoryStorage(t *testing.T) *memoryStorage {
+	memory := newMemoryStorage()
+	store = memory
+	t.Cleanup(func() { store = localStorage{} })
+	return memory
+}
+
+func (m *memoryStorage) Mkdir(path string, mode os.FileMode) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.directories[path] = true
+	m.modes[path] = mode
+	return nil
+}
+
+func (m *memoryStorage) Create(path string, mode os.FileMode) (storageFile, error) {
+	return &memoryFile{path: path, storage: m}, m.WriteFile(path, nil, mode)
+}
+
+func (m *memoryStorage) WriteFile(path string, data []byte, mode os.FileMode) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.files[path] = append([]byte(nil), data...)
+	m.modes[path] = mode
+	return nil
+}
+
+func (m *memoryStorage) Remove(path string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.files, path)
+	delete(m.directories, path)
+	delete(m.symlinks, path)
+	return nil
+}
+
+func (m *memoryStorage) RemoveAll(path string) error {
+	return m.Remove(path)
+}
+
+func (m *memoryStorage) Symlink(target string, path string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.symlinks[path] = target
+	return nil
+}
+
+func (m *memoryStorage) Link(target string, path string) error {
+	return m.Symlink(target, path)
+}
+
+func (m *memoryStorage) Rename(oldPath string, newPath string) error {
+	data, err := os.ReadFile(oldPath)
+	if err != nil {
+		return err
+	}
+	return m.WriteFile(newPath, data, 0644)
+}
+
+func (m *memoryStorage) Chmod(path string, mode os.FileMode) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.modes[path] = mode
+	return nil
+}
+
+func (m *memoryStorage) Lchown(path string, uid int, gid int) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.owners[path] = uid
+	return nil
+}
+
+func (m *memoryStorage) Chtimes(path string, atime time.Time, mtime time.Time) error {
+	return nil
+}
+
+func (f *memoryFile) Sync() error {
+	return nil
+}
+
+func (f *memoryFile) Close() error {
+	return f.storage.WriteFile(f.path, f.Bytes(), f.storage.modes[f.path])
+}
+
+func TestMemoryStorage(t *testing.T) {
+	memory := useMemoryStorage(t)
+	config := initializeConfig()
+	galleryDirectory := filepath.Join(os.TempDir(), "fastgallery-memory-test")
+
+	createDirectory(galleryDirectory, false, config)
+	assert.True(t, memory.directories[galleryDirectory])
+	assert.NoDirExists(t, galleryDirectory)
+
+	filePath := filepath.Join(galleryDirectory, "a.txt")
+	err := writeFile(filePath, []byte("a"), config)
+	assert.NoError(t, err)
+	assert.Equal(t, "a", string(memory.files[filePath]))
+	assert.Equal(t, config.files.fileMode&^config.files.umask, memory.modes[filePath])
+
+	pagePath := filepath.Join(galleryDirectory, config.assets.htmlFile)
+	pageHandle, err := createFile(pagePath, config)
+	assert.NoError(t, err)
+	pageHandle.Write([]byte("<html>"))
+	pageHandle.Close()
+	assert.Equal(t, "<html>", string(memory.files[pagePath]))
+
+	originalPath := filepath.Join(galleryDirectory, config.files.originalDir, "a.jpg")
+	err = symlinkFile("/source/a.jpg", originalPath, config)
+	assert.NoError(t, err)
+	assert.Equal(t, "/source/a.jpg", memory.symlinks[originalPath])
+
+	cleanDirectory(directory{absPath: galleryDirectory, files: []file{{name: "a.txt"}}}, false, config)
+	assert.NotContains(t, memory.files, filePath)
+}
@@ -0,0 +1,208 @@
+package gallery
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Google Takeout truncates sidecar filenames (including the .json extension) to this length
+const takeoutMaxFilenameLength = 51
+
+// Apple's iCloud Photos export lists photos of each folder in this CSV file, with
+// capture dates formatted like "Saturday October 9,2021 10:32 AM GMT"
+const (
+	appleDetailsFile       = "Photo Details.csv"
+	appleDetailsTimeLayout = "Monday January 2,2006 3:04 PM MST"
+)
+
+// takeoutTimestamp is the timestamp format used by Google Takeout JSON sidecars
+type takeoutTimestamp struct {
+	Timestamp string `json:"timestamp"`
+}
+
+// takeoutMetadata struct holds the fields we use from a Google Takeout JSON sidecar.
+// The same format is used both for media files and for the album metadata.json.
+type takeoutMetadata struct {
+	Title          string           `json:"title"`
+	Description    string           `json:"description"`
+	PhotoTakenTime takeoutTimestamp `json:"photoTakenTime"`
+	CreationTime   takeoutTimestamp `json:"creationTime"`
+}
+
+// takenTime returns the capture time from the sidecar, falling back to upload time
+func (metadata takeoutMetadata) takenTime() time.Time {
+	for _, timestamp := range []string{metadata.PhotoTakenTime.Timestamp, metadata.CreationTime.Timestamp} {
+		seconds, err := strconv.ParseInt(timestamp, 10, 64)
+		if err == nil && seconds > 0 {
+			return time.Unix(seconds, 0)
+		}
+	}
+	return time.Time{}
+}
+
+// findTakeoutSidecar returns the path of the Takeout JSON sidecar for given media file,
+// or an empty string if there isn't one. Takeout names sidecars after the full filename,
+// truncates long names, and shares the sidecar of an original with its "-edited" copy.
+func findTakeoutSidecar(mediaPath string) string {
+	directory, filename := filepath.Split(mediaPath)
+	basename := stripExtension(filename)
+	extension := filepath.Ext(filename)
+
+	var candidates []string
+	for _, name := range []string{filename, strings.TrimSuffix(basename, "-edited") + extension} {
+		candidates = append(candidates, name+".supplemental-metadata.json", name+".json")
+		if len(name)+len(".json") > takeoutMaxFilenameLength {
+			candidates = append(candidates, name[:takeoutMaxFilenameLength-len(".json")]+".json")
+		}
+	}
+	candidates = append(candidates, basename+".json")
+
+	for _, candidate := range candidates {
+		candidatePath := filepath.Join(directory, candidate)
+		if filestat, err := os.Stat(candidatePath); err == nil && !filestat.IsDir() {
+			return candidatePath
+		}
+	}
+
+	return ""
+}
+
+// readTakeoutSidecar opens and parses a Takeout JSON sidecar file
+func readTakeoutSidecar(sidecarPath string) (metadata takeoutMetadata, err error) {
+	buffer, err := os.ReadFile(sidecarPath)
+	if err != nil {
+		return metadata, err
+	}
+
+	err = json.Unmarshal(buffer, &metadata)
+	return metadata, err
+}
+
+// readAppleDetails parses an iCloud Photos "Photo Details.csv" file and returns the
+// capture time of each listed filename
+func readAppleDetails(detailsPath string) (takenTimes map[string]time.Time, err error) {
+	detailsHandle, err := os.Open(detailsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer detailsHandle.Close()
+
+	records, err := csv.NewReader(detailsHandle).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	takenTimes = make(map[string]time.Time)
+	if len(records) == 0 {
+		return takenTimes, nil
+	}
+
+	nameColumn, dateColumn := -1, -1
+	for i, header := range records[0] {
+		switch header {
+		case "imgName":
+			nameColumn = i
+		case "originalCreationDate":
+			dateColumn = i
+		}
+	}
+	if nameColumn == -1 || dateColumn == -1 {
+		return takenTimes, nil
+	}
+
+	for _, record := range records[1:] {
+		if len(record) <= nameColumn || len(record) <= dateColumn {
+			continue
+		}
+		takenTime, err := time.Parse(appleDetailsTimeLayout, record[dateColumn])
+		if err == nil {
+			takenTimes[record[nameColumn]] = takenTime
+		}
+	}
+
+	return takenTimes, nil
+}
+
+// readTakeoutMetadata recursively applies Takeout JSON sidecars to the source tree:
+// album titles from metadata.json, captions and capture times from per-file sidecars.
+// Capture times are also read from iCloud Photos' "Photo Details.csv" if present.
+// Files are then ordered by capture time instead of filename. Captions from XMP
+// sidecars take precedence over Takeout descriptions.
+func readTakeoutMetadata(source *directory) {
+	readDirectoryTakeoutMetadata(source)
+
+	for i := range source.subdirectories {
+		readTakeoutMetadata(&source.subdirectories[i])
+	}
+}
+
+// readDirectoryTakeoutMetadata applies the Takeout and iCloud Photos metadata of one
+// source directory to it and its files
+func readDirectoryTakeoutMetadata(source *directory) {
+	albumMetadataPath := filepath.Join(source.absPath, "metadata.json")
+	if exists(albumMetadataPath) {
+		albumMetadata, err := readTakeoutSidecar(albumMetadataPath)
+		if err != nil {
+			log.Println("couldn't parse Takeout album metadata:", albumMetadataPath, err.Error())
+		} else {
+			source.title = albumMetadata.Title
+		}
+	}
+
+	var appleTakenTimes map[string]time.Time
+	appleDetailsPath := filepath.Join(source.absPath, appleDetailsFile)
+	if exists(appleDetailsPath) {
+		var err error
+		appleTakenTimes, err = readAppleDetails(appleDetailsPath)
+		if err != nil {
+			log.Println("couldn't parse iCloud Photos details:", appleDetailsPath, err.Error())
+		}
+	}
+
+	for i := range source.files {
+		if takenTime, ok := appleTakenTimes[source.files[i].name]; ok {
+			source.files[i].takenTime = takenTime
+		}
+
+		sidecarPath := findTakeoutSidecar(source.files[i].absPath)
+		if sidecarPath == "" {
+			continue
+		}
+
+		metadata, err := readTakeoutSidecar(sidecarPath)
+		if err != nil {
+			log.Println("couldn't parse Takeout sidecar:", sidecarPath, err.Error())
+			continue
+		}
+
+		if source.files[i].sidecar.caption == "" {
+			source.files[i].sidecar.caption = strings.TrimSpace(metadata.Description)
+		}
+		if takenTime := metadata.takenTime(); !takenTime.IsZero() {
+			source.files[i].takenTime = takenTime
+		}
+	}
+
+	sortFilesByTakenTime(source.files)
+}
+
+// sortFilesByTakenTime orders files chronologically by capture time. Files without
+// a known capture time keep their original order after the dated ones.
+func sortFilesByTakenTime(files []file) {
+	sort.SliceStable(files, func(i, j int) bool {
+		if files[j].takenTime.IsZero() {
+			return !files[i].takenTime.IsZero()
+		}
+		if files[i].takenTime.IsZero() {
+			return false
+		}
+		return files[i].takenTime.Before(files[j].takenTime)
+	})
+}
@@ -0,0 +1,81 @@
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindTakeoutSidecar(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	longName := "PXL_20210612_083312345.PORTRAIT-01.COVER~2_longer.jpg"
+	for _, filename := range []string{"IMG_0001.jpg.json", "IMG_0002.jpg.supplemental-metadata.json", "PXL_20210612_083312345.PORTRAIT-01.COVER~2_lon.json"} {
+		err = os.WriteFile(filepath.Join(tempDir, filename), []byte("{}"), 0644)
+		assert.NoError(t, err)
+	}
+
+	assert.EqualValues(t, filepath.Join(tempDir, "IMG_0001.jpg.json"), findTakeoutSidecar(filepath.Join(tempDir, "IMG_0001.jpg")))
+	assert.EqualValues(t, filepath.Join(tempDir, "IMG_0001.jpg.json"), findTakeoutSidecar(filepath.Join(tempDir, "IMG_0001-edited.jpg")))
+	assert.EqualValues(t, filepath.Join(tempDir, "IMG_0002.jpg.supplemental-metadata.json"), findTakeoutSidecar(filepath.Join(tempDir, "IMG_0002.jpg")))
+	assert.EqualValues(t, filepath.Join(tempDir, "PXL_20210612_083312345.PORTRAIT-01.COVER~2_lon.json"), findTakeoutSidecar(filepath.Join(tempDir, longName)))
+	assert.EqualValues(t, "", findTakeoutSidecar(filepath.Join(tempDir, "IMG_0003.jpg")))
+}
+
+func TestReadTakeoutMetadata(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	testFiles := map[string]string{
+		"a.jpg":         "",
+		"b.jpg":         "",
+		"c.jpg":         "",
+		"a.jpg.json":    `{"title": "a.jpg", "description": "Later", "photoTakenTime": {"timestamp": "1600000000"}}`,
+		"b.jpg.json":    `{"title": "b.jpg", "description": " Earlier ", "photoTakenTime": {"timestamp": "1500000000"}}`,
+		"metadata.json": `{"title": "Trip to Lapland"}`,
+	}
+	for filename, contents := range testFiles {
+		err = os.WriteFile(filepath.Join(tempDir, filename), []byte(contents), 0644)
+		assert.NoError(t, err)
+	}
+
+	source, _ := createDirectoryTree(tempDir, "", false, initializeConfig())
+	readTakeoutMetadata(&source)
+
+	assert.EqualValues(t, "Trip to Lapland", source.title)
+	assert.EqualValues(t, "b.jpg", source.files[0].name)
+	assert.EqualValues(t, "Earlier", source.files[0].sidecar.caption)
+	assert.EqualValues(t, time.Unix(1500000000, 0), source.files[0].takenTime)
+	assert.EqualValues(t, "a.jpg", source.files[1].name)
+	assert.EqualValues(t, "c.jpg", source.files[2].name)
+	assert.True(t, source.files[2].takenTime.IsZero())
+}
+
+func TestReadAppleDetails(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	detailsPath := filepath.Join(tempDir, appleDetailsFile)
+	details := "imgName,fileChecksum,favorite,hidden,deleted,originalCreationDate,viewCount,importDate\n" +
+		"IMG_0001.HEIC,abc,no,no,no,\"Saturday October 9,2021 10:32 AM GMT\",1,\"Saturday October 9,2021 10:40 AM GMT\"\n"
+	err = os.WriteFile(detailsPath, []byte(details), 0644)
+	assert.NoError(t, err)
+
+	takenTimes, err := readAppleDetails(detailsPath)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2021, takenTimes["IMG_0001.HEIC"].Year())
+	assert.EqualValues(t, 32, takenTimes["IMG_0001.HEIC"].Minute())
+}
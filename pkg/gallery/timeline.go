@@ -0,0 +1,202 @@
+package gallery
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Name of the timeline page in the gallery root
+const timelineFile = "timeline.html"
+
+// Name of the directory in the gallery root holding the timeline's JSON chunks
+const timelineDirectory = "_timeline"
+
+// Layout of the days of photos in the timeline, also used in links to days
+const timelineDayLayout = "2006-01-02"
+
+// Number of photos in each chunk of the timeline, loaded one at a time when scrolling
+const timelineChunkSize = 500
+
+// timelineEntry is one photo or video in the timeline. URLs are relative to the gallery
+// root. Month is the heading the photo is shown under, e.g. "March 2021", and Day the
+// day it was taken, e.g. "2021-03-14".
+type timelineEntry struct {
+	Thumbnail string `json:"thumbnail"`
+	URL       string `json:"url"`
+	Filename  string `json:"filename"`
+	Caption   string `json:"caption,omitempty"`
+	Album     string `json:"album"`
+	Month     string `json:"month"`
+	Day       string `json:"day"`
+	time      time.Time
+}
+
+// timelinePage struct is loaded with the information to fill in the timeline template.
+// Chunks are the JSON files of timeline entries, newest photos first. HTMLFile is the
+// album page.
+type timelinePage struct {
+	Title       string
+	HTMLFile    string
+	CSS         []string
+	Chunks      []string
+	ImageWidth  string
+	ImageHeight string
+}
+
+// timelineKey identifies a photo for deduplication, as the same photo may be copied into
+// several albums: copies have the same capture time, camera and size. Files without a
+// capture time are only deduplicated if they are links to the same file.
+func timelineKey(sourceFile file) string {
+	if !sourceFile.takenTime.IsZero() {
+		return fmt.Sprint(sourceFile.takenTime.UnixNano(), "|", sourceFile.camera, "|", sourceFile.size)
+	}
+	return resolvePath(sourceFile.absPath)
+}
+
+// collectTimelineEntries recursively collects the timeline entries of all files in the
+// source directory, skipping the copies of photos already seen
+func collectTimelineEntries(source directory, seen map[string]bool, config configuration) (entries []timelineEntry) {
+	album := albumTitle(source)
+	albumPath := filepath.ToSlash(source.relPath)
+
+	for _, sourceFile := range source.files {
+		key := timelineKey(sourceFile)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		// Files without a capture time go by their modification time, like in split albums
+		fileTime := sourceFile.takenTime
+		if fileTime.IsZero() {
+			fileTime = sourceFile.modTime
+		}
+
+		thumbnailFilename, _ := getGalleryFilenames(sourceFile.name, config)
+		entries = append(entries, timelineEntry{
+			Thumbnail: escapeURLPath(path.Join(albumPath, config.files.thumbnailDir, thumbnailFilename)),
+			URL:       escapeURLPath(path.Join(albumPath, config.assets.htmlFile)) + "#" + url.PathEscape(sourceFile.name),
+			Filename:  sourceFile.name,
+			Caption:   sourceFile.sidecar.caption,
+			Album:     album,
+			Month:     fileTime.In(config.media.timezone).Format("January 2006"),
+			Day:       fileTime.In(config.media.timezone).Format(timelineDayLayout),
+			time:      fileTime,
+		})
+	}
+
+	for _, subdir := range source.subdirectories {
+		entries = append(entries, collectTimelineEntries(subdir, seen, config)...)
+	}
+
+	return entries
+}
+
+// createTimelineEntries returns the deduplicated timeline entries of the whole gallery,
+// newest first. Photos taken at the same time stay in gallery order.
+func createTimelineEntries(source directory, config configuration) []timelineEntry {
+	entries := collectTimelineEntries(source, make(map[string]bool), config)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].time.After(entries[j].time)
+	})
+	return entries
+}
+
+// writeTimeline writes a page into the gallery root showing all photos of the gallery
+// ordered by capture date across albums. The photos are written into JSON chunks, which
+// the page loads one at a time while scrolling, so huge galleries stay fast to open.
+func writeTimeline(source directory, gallery directory, cookedTemplate *template.Template, dryRun bool, config configuration) {
+	pagePath := filepath.Join(gallery.absPath, timelineFile)
+	chunkDirectory := filepath.Join(gallery.absPath, timelineDirectory)
+	if dryRun {
+		log.Println("Would write timeline:", pagePath)
+		return
+	}
+
+	// The previous chunks are removed, as there may be fewer of them now
+	err := getStorage(config).RemoveAll(chunkDirectory)
+	if err != nil {
+		log.Println("couldn't remove old timeline", chunkDirectory, ":", err.Error())
+		return
+	}
+	err = createDirectory(chunkDirectory, false, config)
+	if err != nil {
+		log.Println(err.Error())
+		return
+	}
+
+	page := timelinePage{
+		Title:       albumTitle(source),
+		HTMLFile:    config.assets.htmlFile,
+		ImageWidth:  fmt.Sprint(config.media.thumbnailWidth),
+		ImageHeight: fmt.Sprint(config.media.thumbnailHeight),
+	}
+
+	entries := createTimelineEntries(source, config)
+	for i := 0; i < len(entries); i += timelineChunkSize {
+		end := i + timelineChunkSize
+		if end > len(entries) {
+			end = len(entries)
+		}
+
+		chunkJSON, err := json.Marshal(entries[i:end])
+		if err != nil {
+			log.Println("couldn't encode timeline:", err.Error())
+			return
+		}
+
+		chunkFilename := fmt.Sprintf("%04d.json", i/timelineChunkSize+1)
+		chunkPath := filepath.Join(chunkDirectory, chunkFilename)
+		err = writeFile(chunkPath, chunkJSON, config)
+		if err != nil {
+			log.Println("couldn't write timeline", chunkPath, ":", err.Error())
+			return
+		}
+		page.Chunks = append(page.Chunks, path.Join(timelineDirectory, chunkFilename))
+	}
+
+	// The page lies in the gallery root, next to the stylesheets
+	page.CSS, err = listStylesheets("", config)
+	if err != nil {
+		log.Println("couldn't write timeline", pagePath, ":", err.Error())
+		return
+	}
+
+	pageHandle, err := createFile(pagePath, config)
+	if err != nil {
+		log.Println("couldn't create timeline", pagePath, ":", err.Error())
+		return
+	}
+	defer pageHandle.Close()
+
+	err = cookedTemplate.Execute(pageHandle, page)
+	if err != nil {
+		log.Println("couldn't execute timeline template", pagePath, ":", err.Error())
+		return
+	}
+
+	logProgress(config, "Wrote timeline:", pagePath)
+}
+
+// listStylesheets returns the links to the stylesheets copied into the gallery root or
+// the shared asset location, from pages rootEscape below the gallery root
+func listStylesheets(rootEscape string, config configuration) (stylesheets []string, err error) {
+	assetDirectoryListing, err := assets.ReadDir(config.assets.assetsDir)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't list embedded assets: %w", err)
+	}
+	for _, entry := range assetDirectoryListing {
+		if !entry.IsDir() && strings.ToLower(filepath.Ext(entry.Name())) == ".css" {
+			stylesheets = append(stylesheets, getAssetURL(entry.Name(), rootEscape, config))
+		}
+	}
+	return stylesheets, nil
+}
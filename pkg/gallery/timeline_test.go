@@ -0,0 +1,92 @@
+package gallery
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateTimelineEntries(t *testing.T) {
+	config := initializeConfig()
+	config.media.timezone = time.UTC
+
+	march := time.Date(2021, 3, 14, 12, 0, 0, 0, time.UTC)
+	source := directory{
+		name: "Photos",
+		files: []file{
+			{name: "old.jpg", takenTime: time.Date(2020, 12, 24, 18, 0, 0, 0, time.UTC), size: 100},
+			{name: "scan.jpg", absPath: "/source/scan.jpg", modTime: time.Date(2021, 4, 1, 12, 0, 0, 0, time.UTC)},
+		},
+		subdirectories: []directory{
+			{
+				name:    "Best of",
+				relPath: "Best of",
+				files: []file{
+					{name: "beach.jpg", takenTime: march, camera: "Canon", size: 200},
+				},
+			},
+			{
+				name:    "Holiday 2021",
+				relPath: "Holiday 2021",
+				files: []file{
+					// Copy of the photo in Best of
+					{name: "IMG_0001.jpg", takenTime: march, camera: "Canon", size: 200},
+					{name: "IMG_0002.jpg", takenTime: march, camera: "Canon", size: 300},
+				},
+			},
+		},
+	}
+
+	entries := createTimelineEntries(source, config)
+	var filenames []string
+	for _, entry := range entries {
+		filenames = append(filenames, entry.Filename)
+	}
+	assert.EqualValues(t, []string{"scan.jpg", "beach.jpg", "IMG_0002.jpg", "old.jpg"}, filenames)
+	assert.EqualValues(t, "April 2021", entries[0].Month)
+	assert.EqualValues(t, "Best of", entries[1].Album)
+	assert.EqualValues(t, "Best%20of/_thumbnail/beach.jpg", entries[1].Thumbnail)
+	assert.EqualValues(t, "Best%20of/index.html#beach.jpg", entries[1].URL)
+}
+
+func TestWriteTimeline(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	cookedTemplates := testTemplates(t, config)
+	source := directory{name: "Photos", files: []file{{name: "a.jpg", takenTime: time.Now()}}}
+	gallery := directory{absPath: tempDir}
+
+	writeTimeline(source, gallery, cookedTemplates.timeline, true, config)
+	assert.NoFileExists(t, filepath.Join(tempDir, timelineFile))
+
+	// Stale chunks of a bigger gallery are removed
+	err = os.MkdirAll(filepath.Join(tempDir, timelineDirectory), 0755)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(tempDir, timelineDirectory, "0002.json"), []byte("[]"), 0644)
+	assert.NoError(t, err)
+
+	writeTimeline(source, gallery, cookedTemplates.timeline, false, config)
+	html, err := os.ReadFile(filepath.Join(tempDir, timelineFile))
+	assert.NoError(t, err)
+	assert.Contains(t, string(html), "<title>Photos</title>")
+	assert.Contains(t, string(html), `"_timeline/0001.json"`)
+	assert.Contains(t, string(html), `href="primer.css"`)
+	assert.NoFileExists(t, filepath.Join(tempDir, timelineDirectory, "0002.json"))
+
+	chunk, err := os.ReadFile(filepath.Join(tempDir, timelineDirectory, "0001.json"))
+	assert.NoError(t, err)
+	var entries []timelineEntry
+	err = json.Unmarshal(chunk, &entries)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.EqualValues(t, "a.jpg", entries[0].Filename)
+}
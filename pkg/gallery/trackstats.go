@@ -0,0 +1,106 @@
+package gallery
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Mean radius of the earth in meters, for distances between track points
+const earthRadius = 6371000
+
+// Elevation changes smaller than this many meters are treated as GPS noise when summing
+// up the climbs and descents of a track
+const trackElevationThreshold = 5
+
+// trackStats struct is the total length of an album's tracks in meters, with the
+// elevation gained and lost, and the highest point if the tracks have elevations
+type trackStats struct {
+	distance     float64
+	ascent       float64
+	descent      float64
+	highest      float64
+	hasElevation bool
+}
+
+// getDistance returns the great-circle distance between two points in meters
+func getDistance(from geoPoint, to geoPoint) float64 {
+	radians := math.Pi / 180
+	deltaLatitude := (to.latitude - from.latitude) * radians
+	deltaLongitude := (to.longitude - from.longitude) * radians
+	a := math.Pow(math.Sin(deltaLatitude/2), 2) +
+		math.Cos(from.latitude*radians)*math.Cos(to.latitude*radians)*math.Pow(math.Sin(deltaLongitude/2), 2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+// computeTrackStats sums up the distance and elevation changes of tracks. Points without
+// an elevation are skipped when counting climbs.
+func computeTrackStats(tracks [][]geoPoint) (stats trackStats) {
+	for _, track := range tracks {
+		var reference *geoPoint
+		for i := range track {
+			if i > 0 {
+				stats.distance += getDistance(track[i-1], track[i])
+			}
+			if !track[i].hasElevation {
+				continue
+			}
+			if !stats.hasElevation || track[i].elevation > stats.highest {
+				stats.highest = track[i].elevation
+			}
+			stats.hasElevation = true
+
+			// Changes are measured from the last point where the climb or descent was counted
+			if reference == nil {
+				reference = &track[i]
+				continue
+			}
+			change := track[i].elevation - reference.elevation
+			if math.Abs(change) < trackElevationThreshold {
+				continue
+			}
+			if change > 0 {
+				stats.ascent += change
+			} else {
+				stats.descent -= change
+			}
+			reference = &track[i]
+		}
+	}
+	return stats
+}
+
+// formatTrackStats describes the track statistics for the album header, e.g.
+// "12.4 km · 530 m ascent · 515 m descent · highest point 1,204 m". Returns an empty
+// string if there are no tracks.
+func formatTrackStats(stats trackStats) string {
+	if stats.distance == 0 && !stats.hasElevation {
+		return ""
+	}
+
+	var parts []string
+	if stats.distance < 1000 {
+		parts = append(parts, fmt.Sprintf("%.0f m", stats.distance))
+	} else {
+		parts = append(parts, fmt.Sprintf("%.1f km", stats.distance/1000))
+	}
+	if stats.hasElevation {
+		parts = append(parts,
+			formatMeters(stats.ascent)+" ascent",
+			formatMeters(stats.descent)+" descent",
+			"highest point "+formatMeters(stats.highest))
+	}
+	return strings.Join(parts, " · ")
+}
+
+// formatMeters rounds meters and groups their thousands, e.g. 1,204 m
+func formatMeters(meters float64) string {
+	digits := fmt.Sprintf("%d", int(math.Abs(math.Round(meters))))
+	for i := len(digits) - 3; i > 0; i -= 3 {
+		digits = digits[:i] + "," + digits[i:]
+	}
+	if math.Round(meters) < 0 {
+		digits = "-" + digits
+	}
+	return digits + " m"
+}
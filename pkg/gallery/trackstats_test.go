@@ -0,0 +1,42 @@
+package gallery
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetDistance(t *testing.T) {
+	// One degree of latitude is about 111 km
+	assert.InDelta(t, 111195, getDistance(geoPoint{latitude: 60, longitude: 24}, geoPoint{latitude: 61, longitude: 24}), 1)
+	assert.Zero(t, getDistance(geoPoint{latitude: 60, longitude: 24}, geoPoint{latitude: 60, longitude: 24}))
+}
+
+func TestComputeTrackStats(t *testing.T) {
+	assert.EqualValues(t, trackStats{}, computeTrackStats(nil))
+
+	point := func(latitude float64, elevation float64) geoPoint {
+		return geoPoint{latitude: latitude, longitude: 24, elevation: elevation, hasElevation: true}
+	}
+	tracks := [][]geoPoint{
+		// Climbs 100 m with some jitter, then descends 40 m
+		{point(60, 100), point(60.001, 102), point(60.002, 99), point(60.003, 150), point(60.004, 200), point(60.005, 160)},
+		// A track without elevations only adds to the distance
+		{{latitude: 61, longitude: 24}, {latitude: 61.01, longitude: 24}},
+	}
+	stats := computeTrackStats(tracks)
+	assert.InDelta(t, 5*111.195+1111.95, stats.distance, 1)
+	assert.True(t, stats.hasElevation)
+	assert.InDelta(t, 100, stats.ascent, 0.001)
+	assert.InDelta(t, 40, stats.descent, 0.001)
+	assert.InDelta(t, 200, stats.highest, 0.001)
+}
+
+func TestFormatTrackStats(t *testing.T) {
+	assert.Equal(t, "", formatTrackStats(trackStats{}))
+	assert.Equal(t, "850 m", formatTrackStats(trackStats{distance: 850}))
+	assert.Equal(t, "12.4 km · 530 m ascent · 515 m descent · highest point 1,204 m",
+		formatTrackStats(trackStats{distance: 12380, ascent: 530.2, descent: 514.8, highest: 1204, hasElevation: true}))
+	assert.Equal(t, "-12 m", formatMeters(-12.3))
+	assert.Equal(t, "1,234,568 m", formatMeters(1234567.8))
+}
@@ -0,0 +1,88 @@
+package gallery
+
+import (
+	"sort"
+	"strings"
+)
+
+// Names of the built-in transformation engines
+const (
+	imageEngineVips   = "vips"
+	videoEngineFFmpeg = "ffmpeg"
+)
+
+// imageTransformer makes the full-size version and thumbnail of a source image. Either
+// destination is empty if that file is left as it is.
+type imageTransformer interface {
+	TransformImage(source string, fullsizeDestination string, thumbnailDestination string, config configuration) error
+}
+
+// videoTransformer makes the full-size version and thumbnail of a source video. Either
+// destination is empty if that file is left as it is.
+type videoTransformer interface {
+	TransformVideo(source string, fullsizeDestination string, thumbnailDestination string, config configuration) error
+}
+
+// vipsTransformer transforms images with libvips
+type vipsTransformer struct{}
+
+func (vipsTransformer) TransformImage(source string, fullsizeDestination string, thumbnailDestination string, config configuration) error {
+	return transformImage(source, fullsizeDestination, thumbnailDestination, config)
+}
+
+// ffmpegTransformer transcodes videos with ffmpeg and overlays a play button on their
+// thumbnails with libvips
+type ffmpegTransformer struct{}
+
+func (ffmpegTransformer) TransformVideo(source string, fullsizeDestination string, thumbnailDestination string, config configuration) error {
+	return transformVideo(source, fullsizeDestination, thumbnailDestination, config)
+}
+
+// Engines the media files can be transformed with, by name. Selected with --image-engine
+// and --video-engine, tests register mock engines of their own.
+var (
+	imageEngines = map[string]imageTransformer{imageEngineVips: vipsTransformer{}}
+	videoEngines = map[string]videoTransformer{videoEngineFFmpeg: ffmpegTransformer{}}
+)
+
+// getImageTransformer returns the configured image engine
+func getImageTransformer(config configuration) imageTransformer {
+	return imageEngines[config.media.imageEngine]
+}
+
+// getVideoTransformer returns the configured video engine
+func getVideoTransformer(config configuration) videoTransformer {
+	return videoEngines[config.media.videoEngine]
+}
+
+// isImageEngine checks whether an image engine of given name exists
+func isImageEngine(name string) bool {
+	_, ok := imageEngines[name]
+	return ok
+}
+
+// isVideoEngine checks whether a video engine of given name exists
+func isVideoEngine(name string) bool {
+	_, ok := videoEngines[name]
+	return ok
+}
+
+// getImageEngineNames lists the image engines for error messages
+func getImageEngineNames() string {
+	var names []string
+	for name := range imageEngines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// getVideoEngineNames lists the video engines for error messages
+func getVideoEngineNames() string {
+	var names []string
+	for name := range videoEngines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
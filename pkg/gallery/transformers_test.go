@@ -0,0 +1,107 @@
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEngineNames(t *testing.T) {
+	assert.True(t, isImageEngine(imageEngineVips))
+	assert.False(t, isImageEngine(videoEngineFFmpeg))
+	assert.True(t, isVideoEngine(videoEngineFFmpeg))
+	assert.False(t, isVideoEngine(""))
+	assert.Equal(t, "vips", getImageEngineNames())
+	assert.Equal(t, "ffmpeg", getVideoEngineNames())
+
+	config := initializeConfig()
+	assert.IsType(t, vipsTransformer{}, getImageTransformer(config))
+	assert.IsType(t, ffmpegTransformer{}, getVideoTransformer(config))
+}
+
+func TestTransformFileWithMockEngines(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	config.files.workspaceDir = tempDir
+	stub := useStubTransformers(t, &config)
+	memory := useMemoryStorage(t)
+
+	for _, filename := range []string{"a.jpg", "b.mp4"} {
+		err = os.WriteFile(filepath.Join(tempDir, filename), []byte{}, 0644)
+		assert.NoError(t, err)
+
+		thumbnailFilename, fullsizeFilename := getGalleryFilenames(filename, config)
+		transformFile(transformationJob{
+			filename:          filename,
+			sourceFilepath:    filepath.Join(tempDir, filename),
+			thumbnailFilepath: filepath.Join("/gallery", config.files.thumbnailDir, thumbnailFilename),
+			fullsizeFilepath:  filepath.Join("/gallery", config.files.fullsizeDir, fullsizeFilename),
+		}, nil, config)
+	}
+
+	assert.EqualValues(t, 2, stub.calls)
+	assert.Empty(t, config.run.failures)
+	assert.Equal(t, filepath.Join(tempDir, "b.mp4"), string(memory.files[filepath.Join("/gallery", config.files.fullsizeDir, "b.mp4")]))
+	assert.Contains(t, memory.files, filepath.Join("/gallery", config.files.thumbnailDir, "b.jpg"))
+	assert.Contains(t, memory.files, filepath.Join("/gallery", config.files.fullsizeDir, "a.jpg"))
+
+	// Failing engines are recorded as failures of the file
+	err = os.WriteFile(filepath.Join(tempDir, "broken.jpg"), []byte{}, 0644)
+	assert.NoError(t, err)
+	transformFile(transformationJob{filename: "broken.jpg", sourceFilepath: filepath.Join(tempDir, "broken.jpg"), thumbnailFilepath: filepath.Join("/gallery", "broken.jpg")}, nil, config)
+	assert.Len(t, config.run.failures, 1)
+	assert.NotContains(t, memory.files, filepath.Join("/gallery", "broken.jpg"))
+}
+
+func TestThumbnailFromFullsize(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	config.files.workspaceDir = tempDir
+	stub := useStubTransformers(t, &config)
+	memory := useMemoryStorage(t)
+
+	sourcePath := filepath.Join(tempDir, "a.CR2")
+	fullsizePath := filepath.Join(tempDir, "a.jpg")
+	for _, path := range []string{sourcePath, fullsizePath} {
+		err = os.WriteFile(path, []byte{}, 0644)
+		assert.NoError(t, err)
+	}
+
+	// Rebuilt thumbnails are built from the existing full-size file
+	job := transformationJob{filename: "a.CR2", sourceFilepath: sourcePath, thumbnailFilepath: filepath.Join("/gallery", "a.jpg"), thumbnailSource: fullsizePath}
+	assert.Equal(t, fullsizePath, getThumbnailSource(job, ""))
+	assert.Equal(t, "/adopted.jpg", getThumbnailSource(job, "/adopted.jpg"))
+	transformFile(job, nil, config)
+	_, fromFullsize := stub.transformed.Load(fullsizePath)
+	assert.True(t, fromFullsize)
+	assert.Equal(t, fullsizePath, string(memory.files[filepath.Join("/gallery", "a.jpg")]))
+
+	// Without one, they're built from the original
+	job.thumbnailSource = filepath.Join(tempDir, "missing.jpg")
+	assert.Equal(t, sourcePath, getThumbnailSource(job, ""))
+
+	// Only thumbnail-only jobs get a thumbnail source
+	source := directory{files: []file{
+		{name: "new.jpg", absPath: filepath.Join(tempDir, "new.jpg")},
+		{name: "outdated.jpg", absPath: filepath.Join(tempDir, "outdated.jpg"), exists: true, outdatedThumbnail: true},
+		{name: "both.jpg", absPath: filepath.Join(tempDir, "both.jpg"), exists: true, outdatedThumbnail: true, outdatedFullsize: true},
+	}}
+	jobs, _ := createMedia(source, "/gallery", false, config)
+	assert.Len(t, jobs, 3)
+	assert.Empty(t, jobs[0].thumbnailSource)
+	assert.Equal(t, filepath.Join("/gallery", config.files.fullsizeDir, "outdated.jpg"), jobs[1].thumbnailSource)
+	assert.Empty(t, jobs[1].fullsizeFilepath)
+	assert.Empty(t, jobs[2].thumbnailSource)
+}
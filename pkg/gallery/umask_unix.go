@@ -0,0 +1,56 @@
+//go:build !windows
+// +build !windows
+
+package gallery
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// File mode creation mask of the process, read once at package initialization, before
+// any goroutines of the program could be creating files
+var processUmask = readUmask()
+
+// getUmask returns the file mode creation mask of the process
+func getUmask() os.FileMode {
+	return processUmask
+}
+
+// readUmask reads the file mode creation mask of the process. Linux has it in
+// /proc/self/status; elsewhere it can only be read by setting it and restoring it,
+// during which files created by the process would get the wrong permissions.
+func readUmask() os.FileMode {
+	if umask, ok := readProcUmask("/proc/self/status"); ok {
+		return umask
+	}
+	umask := syscall.Umask(0)
+	syscall.Umask(umask)
+	return os.FileMode(umask)
+}
+
+// readProcUmask reads the umask from the Umask line of a Linux process status file
+func readProcUmask(statusPath string) (os.FileMode, bool) {
+	fileHandle, err := os.Open(statusPath)
+	if err != nil {
+		return 0, false
+	}
+	defer fileHandle.Close()
+
+	scanner := bufio.NewScanner(fileHandle)
+	for scanner.Scan() {
+		value := strings.TrimPrefix(scanner.Text(), "Umask:")
+		if value == scanner.Text() {
+			continue
+		}
+		umask, err := strconv.ParseUint(strings.TrimSpace(value), 8, 32)
+		if err != nil {
+			return 0, false
+		}
+		return os.FileMode(umask), true
+	}
+	return 0, false
+}
@@ -0,0 +1,40 @@
+//go:build !windows
+// +build !windows
+
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadProcUmask(t *testing.T) {
+	tempDir := t.TempDir()
+	statusPath := filepath.Join(tempDir, "status")
+	err := os.WriteFile(statusPath, []byte("Name:\tfastgallery\nUmask:\t0027\nState:\tR (running)\n"), 0644)
+	assert.NoError(t, err)
+
+	umask, ok := readProcUmask(statusPath)
+	assert.True(t, ok)
+	assert.Equal(t, os.FileMode(0027), umask)
+
+	// Kernels older than 4.7 don't have the line
+	err = os.WriteFile(statusPath, []byte("Name:\tfastgallery\n"), 0644)
+	assert.NoError(t, err)
+	_, ok = readProcUmask(statusPath)
+	assert.False(t, ok)
+
+	_, ok = readProcUmask(filepath.Join(tempDir, "missing"))
+	assert.False(t, ok)
+}
+
+func TestGetUmask(t *testing.T) {
+	umask := syscall.Umask(0)
+	syscall.Umask(umask)
+	assert.Equal(t, os.FileMode(umask), getUmask())
+	assert.Equal(t, os.FileMode(umask), readUmask())
+}
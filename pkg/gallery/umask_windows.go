@@ -0,0 +1,11 @@
+//go:build windows
+// +build windows
+
+package gallery
+
+import "os"
+
+// getUmask returns the file mode creation mask of the process, which Windows doesn't have
+func getUmask() os.FileMode {
+	return 0
+}
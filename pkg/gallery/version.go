@@ -0,0 +1,121 @@
+package gallery
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// version, commit and build date of fastgallery, set with SetVersion by the fastgallery
+// command, which gets them from GoReleaser or the Makefile at build time
+var (
+	version = "dev"
+	commit  = ""
+	date    = ""
+)
+
+// latestReleaseURL is the GitHub API endpoint of the latest fastgallery release
+var latestReleaseURL = "https://api.github.com/repos/tonimelisma/fastgallery/releases/latest"
+
+// SetVersion sets the version, commit and build date of fastgallery, recorded in the
+// build manifests of galleries and printed with --version. Empty commit and date are unknown.
+func SetVersion(newVersion string, newCommit string, newDate string) {
+	version, commit, date = newVersion, newCommit, newDate
+}
+
+// getVersion returns the version of fastgallery. Binaries installed with go install
+// don't get ldflags, but have their module version in the build info.
+func getVersion() string {
+	if version == "dev" {
+		if buildInfo, ok := debug.ReadBuildInfo(); ok && buildInfo.Main.Version != "" && buildInfo.Main.Version != "(devel)" {
+			return buildInfo.Main.Version
+		}
+	}
+	return version
+}
+
+// VersionString returns the version of fastgallery with the commit and date it was
+// built from, if known, e.g. "fastgallery 1.2.3 (commit 1a2b3c4, built 2021-03-14)"
+func VersionString() string {
+	var details []string
+	if commit != "" {
+		details = append(details, "commit "+commit)
+	}
+	if date != "" {
+		details = append(details, "built "+date)
+	}
+
+	versionString := "fastgallery " + getVersion()
+	if len(details) > 0 {
+		versionString = versionString + " (" + strings.Join(details, ", ") + ")"
+	}
+	return versionString
+}
+
+// parseVersion parses a version like v1.2.3 into its numbers. Returns false for
+// versions which aren't releases, such as dev builds.
+func parseVersion(versionString string) (numbers [3]int, ok bool) {
+	versionString = strings.TrimPrefix(versionString, "v")
+	parts := strings.Split(strings.SplitN(versionString, "-", 2)[0], ".")
+	if len(parts) != len(numbers) {
+		return numbers, false
+	}
+	for i, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil {
+			return numbers, false
+		}
+		numbers[i] = number
+	}
+	return numbers, true
+}
+
+// isNewerVersion checks whether the latest version is newer than the current one
+func isNewerVersion(latest string, current string) bool {
+	latestNumbers, ok := parseVersion(latest)
+	if !ok {
+		return false
+	}
+	currentNumbers, ok := parseVersion(current)
+	if !ok {
+		return false
+	}
+	for i := range latestNumbers {
+		if latestNumbers[i] != currentNumbers[i] {
+			return latestNumbers[i] > currentNumbers[i]
+		}
+	}
+	return false
+}
+
+// checkForUpdate asks GitHub for the latest release of fastgallery. Returns its version
+// if it's newer than this one, or an empty string. Dev builds are never out of date.
+func checkForUpdate(releaseURL string) (string, error) {
+	client := http.Client{Timeout: 10 * time.Second}
+	response, err := client.Get(releaseURL)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return "", fmt.Errorf("checking for updates at %s failed: %s", releaseURL, response.Status)
+	}
+
+	var release struct {
+		TagName string `json:"tag_name"`
+	}
+	err = json.NewDecoder(response.Body).Decode(&release)
+	if err != nil {
+		return "", err
+	}
+
+	if isNewerVersion(release.TagName, getVersion()) {
+		return release.TagName, nil
+	}
+	return "", nil
+}
@@ -0,0 +1,55 @@
+package gallery
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersionString(t *testing.T) {
+	defer SetVersion(version, commit, date)
+
+	SetVersion("1.2.3", "", "")
+	assert.Equal(t, "fastgallery 1.2.3", VersionString())
+
+	SetVersion("1.2.3", "1a2b3c4", "2021-03-14")
+	assert.Equal(t, "fastgallery 1.2.3 (commit 1a2b3c4, built 2021-03-14)", VersionString())
+}
+
+func TestIsNewerVersion(t *testing.T) {
+	assert.True(t, isNewerVersion("v1.3.0", "1.2.3"))
+	assert.True(t, isNewerVersion("v2.0.0", "v1.10.0"))
+	assert.False(t, isNewerVersion("v1.2.3", "1.2.3"))
+	assert.False(t, isNewerVersion("v1.2.3", "v1.10.0"))
+	assert.False(t, isNewerVersion("v1.3.0", "dev"))
+	assert.False(t, isNewerVersion("nightly", "1.2.3"))
+}
+
+func TestCheckForUpdate(t *testing.T) {
+	defer func(v string) { version = v }(version)
+	version = "1.2.3"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"tag_name": "v1.3.0"}`))
+	}))
+	defer server.Close()
+
+	latest, err := checkForUpdate(server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, "v1.3.0", latest)
+
+	version = "1.3.0"
+	latest, err = checkForUpdate(server.URL)
+	assert.NoError(t, err)
+	assert.Empty(t, latest)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer failing.Close()
+
+	_, err = checkForUpdate(failing.URL)
+	assert.Error(t, err)
+}
@@ -0,0 +1,125 @@
+package gallery
+
+import (
+	"errors"
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+// Extensions of video files, more can be added with --video-extension. Screen
+// recorders write WebM, cameras and dashcams Matroska or AVCHD streams, and old phones
+// and cameras Windows Media and Flash videos.
+var videoExtensions = map[string]bool{
+	".mp4":  true,
+	".mov":  true,
+	".3gp":  true,
+	".avi":  true,
+	".mts":  true,
+	".m2ts": true,
+	".ts":   true,
+	".m4v":  true,
+	".mpg":  true,
+	".webm": true,
+	".mkv":  true,
+	".wmv":  true,
+	".flv":  true,
+}
+
+// Extensions of files which aren't media files of their own, and which sources and
+// galleries have plenty of, so they aren't probed or sniffed. Camera thumbnails and
+// low-resolution proxies are JPEGs and videos, but they go with the actual files.
+var nonMediaExtensions = map[string]bool{
+	".xmp":         true,
+	".yaml":        true,
+	".yml":         true,
+	".json":        true,
+	".md":          true,
+	".txt":         true,
+	".gpx":         true,
+	".html":        true,
+	".htm":         true,
+	".css":         true,
+	".js":          true,
+	".mp3":         true,
+	".m4a":         true,
+	".ogg":         true,
+	".aae":         true,
+	".thm":         true,
+	".lrv":         true,
+	".pdf":         true,
+	".xml":         true,
+	".db":          true,
+	".ini":         true,
+	".webmanifest": true,
+	".ndjson":      true,
+}
+
+// isVideoFile checks whether given file is a video file by its extension, or by its
+// contents if it was sniffed. With --probe-videos, files of unknown extensions are
+// probed with ffprobe when they're given with an absolute path. The first file probed
+// of each extension decides whether the files of that extension are videos.
+func isVideoFile(filename string, config configuration) bool {
+	extension := strings.ToLower(filepath.Ext(filename))
+	config.run.videoExtensionsLock.RLock()
+	isVideo := videoExtensions[extension] || config.run.registeredVideoExtensions[extension]
+	probedVideo, probed := config.run.probedVideoExtensions[extension]
+	config.run.videoExtensionsLock.RUnlock()
+	if isVideo || getSniffedKind(filename, config) == mediaKindVideo {
+		return true
+	}
+	if probed {
+		return probedVideo
+	}
+	if !config.media.probeVideos || extension == "" || nonMediaExtensions[extension] || isImageFile(filename, config) || !filepath.IsAbs(filename) {
+		return false
+	}
+
+	probedVideo = isProbedVideo(filename)
+	config.run.videoExtensionsLock.Lock()
+	config.run.probedVideoExtensions[extension] = probedVideo
+	config.run.videoExtensionsLock.Unlock()
+	if probedVideo {
+		log.Println("Found videos with unknown extension by probing them:", extension)
+	}
+	return probedVideo
+}
+
+// isProbedVideo checks with ffprobe whether given file is a video. ffprobe reads
+// images and text files as videos of a single frame, so those are told apart by their
+// format.
+func isProbedVideo(source string) bool {
+	probe, err := probeVideo(source)
+	if err != nil {
+		return false
+	}
+	switch {
+	case probe.formatName == "image2", probe.formatName == "tty", probe.formatName == "gif":
+		return false
+	case strings.HasSuffix(probe.formatName, "_pipe"):
+		return false
+	default:
+		return true
+	}
+}
+
+// registerVideoExtensions adds extensions of video files, e.g. ".dav", to the known ones
+// of this run
+func registerVideoExtensions(extensions []string, config configuration) error {
+	config.run.videoExtensionsLock.Lock()
+	defer config.run.videoExtensionsLock.Unlock()
+	for _, extension := range extensions {
+		extension = strings.ToLower(strings.TrimSpace(extension))
+		if !strings.HasPrefix(extension, ".") {
+			extension = "." + extension
+		}
+		if extension == "." || strings.ContainsAny(extension[1:], `./\`) {
+			return errors.New("invalid video extension: " + extension)
+		}
+		if isImageFile("video"+extension, config) {
+			return errors.New("invalid video extension, it's the one of images: " + extension)
+		}
+		config.run.registeredVideoExtensions[extension] = true
+	}
+	return nil
+}
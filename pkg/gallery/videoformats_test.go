@@ -0,0 +1,68 @@
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsVideoFile(t *testing.T) {
+	config := initializeConfig()
+	for _, filename := range []string{"a.mp4", "a.MOV", "screen.webm", "dashcam.mkv", "old.wmv", "old.flv", "00001.ts", "00001.m2ts"} {
+		assert.True(t, isVideoFile(filename, config), filename)
+	}
+	for _, filename := range []string{"a.jpg", "a.dav", "a", "a.xmp"} {
+		assert.False(t, isVideoFile(filename, config), filename)
+	}
+}
+
+func TestRegisterVideoExtensions(t *testing.T) {
+	config := initializeConfig()
+	assert.NoError(t, registerVideoExtensions([]string{".DAV", "vob"}, config))
+	assert.True(t, isVideoFile("cctv.dav", config))
+	assert.True(t, isVideoFile("VTS_01_1.VOB", config))
+
+	// Other runs don't have them
+	assert.False(t, isVideoFile("cctv.dav", initializeConfig()))
+
+	for _, invalid := range []string{".", "", ".a/b", ".jpg"} {
+		assert.Error(t, registerVideoExtensions([]string{invalid}, config), invalid)
+	}
+}
+
+func TestProbeUnknownVideos(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+	config := initializeConfig()
+	davPath := filepath.Join(tempDir, "cctv.dav")
+	os.WriteFile(davPath, []byte("video"), 0644)
+
+	// Without probing, unknown extensions aren't videos
+	assert.False(t, isVideoFile(davPath, config))
+	assert.NotContains(t, config.run.probedVideoExtensions, ".dav")
+
+	// The first file probed decides for its extension
+	config.media.probeVideos = true
+	config.run.probedVideoExtensions[".dav"] = true
+	assert.True(t, isVideoFile(davPath, config))
+	assert.True(t, isVideoFile("other.dav", config))
+
+	// Files without an absolute path aren't probed
+	assert.False(t, isVideoFile("data.bin", config))
+	assert.NotContains(t, config.run.probedVideoExtensions, ".bin")
+}
+
+func TestParseProbedFormat(t *testing.T) {
+	probe, err := parseVideoProbe([]byte(`{"streams": [{"codec_type": "video", "codec_name": "png"}], "format": {"format_name": "png_pipe"}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "png_pipe", probe.formatName)
+
+	probe, err = parseVideoProbe([]byte(`{"streams": [{"codec_type": "video", "codec_name": "h264"}], "format": {"format_name": "mpegts"}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "mpegts", probe.formatName)
+}
@@ -0,0 +1,122 @@
+package gallery
+
+import (
+	"encoding/json"
+	"errors"
+	"os/exec"
+	"strconv"
+)
+
+// Highest bit rate in bits per second of source videos copied into the gallery as they
+// are, instead of being transcoded. Small clips with higher bit rates are still worth
+// making smaller.
+const videoCopyMaxBitRate = 3000000
+
+// videoProbe struct holds what ffprobe tells about a source video: the codecs of its
+// first video and audio streams, the dimensions and pixel format of the video, the
+// overall bit rate and the container format. Codecs are empty and the bit rate zero if
+// unknown.
+type videoProbe struct {
+	videoCodec  string
+	audioCodec  string
+	width       int
+	height      int
+	pixelFormat string
+	bitRate     int64
+	formatName  string
+}
+
+// ffprobeOutput struct is the JSON output of ffprobe with the entries read
+type ffprobeOutput struct {
+	Streams []struct {
+		CodecType   string `json:"codec_type"`
+		CodecName   string `json:"codec_name"`
+		Width       int    `json:"width"`
+		Height      int    `json:"height"`
+		PixelFormat string `json:"pix_fmt"`
+	} `json:"streams"`
+	Format struct {
+		BitRate    string `json:"bit_rate"`
+		FormatName string `json:"format_name"`
+	} `json:"format"`
+}
+
+// parseVideoProbe parses the JSON output of ffprobe
+func parseVideoProbe(output []byte) (probe videoProbe, err error) {
+	var parsed ffprobeOutput
+	err = json.Unmarshal(output, &parsed)
+	if err != nil {
+		return probe, err
+	}
+
+	for _, stream := range parsed.Streams {
+		if stream.CodecType == "video" && probe.videoCodec == "" {
+			probe.videoCodec = stream.CodecName
+			probe.width = stream.Width
+			probe.height = stream.Height
+			probe.pixelFormat = stream.PixelFormat
+		} else if stream.CodecType == "audio" && probe.audioCodec == "" {
+			probe.audioCodec = stream.CodecName
+		}
+	}
+	if probe.videoCodec == "" {
+		return probe, errors.New("no video stream")
+	}
+	probe.bitRate, _ = strconv.ParseInt(parsed.Format.BitRate, 10, 64)
+	probe.formatName = parsed.Format.FormatName
+	return probe, nil
+}
+
+// probeVideo reads the codecs, dimensions, bit rate and format of a source video with ffprobe
+func probeVideo(source string) (videoProbe, error) {
+	ffprobeCommand := exec.Command("ffprobe", "-v", "error", "-show_entries", "stream=codec_type,codec_name,width,height,pix_fmt:format=bit_rate,format_name", "-of", "json", source)
+	output, err := ffprobeCommand.Output()
+	if err != nil {
+		return videoProbe{}, err
+	}
+	return parseVideoProbe(output)
+}
+
+// needsVideoScaling checks whether a source video has to be scaled down to the maximum
+// size of full-size videos. Odd dimensions are scaled too, the encoders need even ones.
+func needsVideoScaling(probe videoProbe, config configuration) bool {
+	return probe.width > config.media.videoMaxSize || probe.height > config.media.videoMaxSize || probe.width%2 != 0 || probe.height%2 != 0
+}
+
+// canCopyVideo checks whether a source video can be copied into the gallery as it is,
+// without transcoding: it's small enough and has a modest bit rate, and its codecs are
+// the ones of the video profile, in the 8-bit 4:2:0 format every player supports
+func canCopyVideo(probe videoProbe, config configuration) bool {
+	codecName := getVideoCodec(config.media.videoProfile)
+	return !needsVideoScaling(probe, config) &&
+		probe.videoCodec == codecName &&
+		(probe.audioCodec == "" || probe.audioCodec == videoCodecs[codecName].audioCodec) &&
+		probe.pixelFormat == "yuv420p" &&
+		probe.bitRate > 0 && probe.bitRate <= videoCopyMaxBitRate
+}
+
+// getFullsizeVideoArguments returns the ffmpeg arguments for making the full-size video of
+// a source video. Videos with the codecs of the profile, already small enough, are only
+// copied into the container of full-size videos. Others are transcoded, and only scaled if
+// they're too big. Without a probe, the video is transcoded and scaled to be sure.
+func getFullsizeVideoArguments(source string, destination string, probe *videoProbe, config configuration) []string {
+	ffmpegArguments := []string{"-y", "-i", source}
+	if probe != nil && canCopyVideo(*probe, config) {
+		ffmpegArguments = append(ffmpegArguments, "-map", "0:v:0", "-map", "0:a:0?", "-c", "copy")
+		// Apple devices only play HEVC tagged as hvc1
+		if getVideoCodec(config.media.videoProfile) == "hevc" {
+			ffmpegArguments = append(ffmpegArguments, "-tag:v", "hvc1")
+		}
+		ffmpegArguments = append(ffmpegArguments, getVideoContainerArguments(config.media.videoProfile)...)
+		return append(ffmpegArguments, "-loglevel", "error", destination)
+	}
+
+	ffmpegArguments = append(ffmpegArguments, "-pix_fmt", "yuv420p")
+	ffmpegArguments = append(ffmpegArguments, getVideoCodecArguments(config.media.videoProfile)...)
+	ffmpegArguments = append(ffmpegArguments, getVideoContainerArguments(config.media.videoProfile)...)
+	ffmpegArguments = append(ffmpegArguments, "-r", "24")
+	if probe == nil || needsVideoScaling(*probe, config) {
+		ffmpegArguments = append(ffmpegArguments, "-vf", "scale='min("+strconv.Itoa(config.media.videoMaxSize)+",iw)':'min("+strconv.Itoa(config.media.videoMaxSize)+",ih)':force_original_aspect_ratio=decrease:force_divisible_by=2")
+	}
+	return append(ffmpegArguments, "-crf", "28", "-threads", strconv.Itoa(getFFmpegThreads(config)), "-loglevel", "error", destination)
+}
@@ -0,0 +1,68 @@
+package gallery
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseVideoProbe(t *testing.T) {
+	probe, err := parseVideoProbe([]byte(`{
+		"streams": [
+			{"codec_type": "video", "codec_name": "h264", "width": 640, "height": 360, "pix_fmt": "yuv420p"},
+			{"codec_type": "audio", "codec_name": "aac"},
+			{"codec_type": "video", "codec_name": "mjpeg", "width": 1920, "height": 1080}
+		],
+		"format": {"bit_rate": "1500000"}
+	}`))
+	assert.NoError(t, err)
+	assert.Equal(t, videoProbe{videoCodec: "h264", audioCodec: "aac", width: 640, height: 360, pixelFormat: "yuv420p", bitRate: 1500000}, probe)
+
+	_, err = parseVideoProbe([]byte(`{"streams": [{"codec_type": "audio", "codec_name": "mp3"}], "format": {}}`))
+	assert.Error(t, err)
+	_, err = parseVideoProbe([]byte("not json"))
+	assert.Error(t, err)
+}
+
+func TestFullsizeVideoArguments(t *testing.T) {
+	config := initializeConfig()
+	small := videoProbe{videoCodec: "h264", audioCodec: "aac", width: 640, height: 360, pixelFormat: "yuv420p", bitRate: 1500000}
+
+	// Small videos in the codecs of the profile are copied as they are
+	assert.True(t, canCopyVideo(small, config))
+	arguments := strings.Join(getFullsizeVideoArguments("in.mov", "out.mp4", &small, config), " ")
+	assert.Contains(t, arguments, "-c copy")
+	assert.Contains(t, arguments, "faststart")
+	assert.NotContains(t, arguments, "libx264")
+	assert.True(t, strings.HasSuffix(arguments, "out.mp4"))
+
+	// Others are transcoded, and only scaled if they're too big
+	for _, probe := range []videoProbe{
+		{videoCodec: "hevc", audioCodec: "aac", width: 640, height: 360, pixelFormat: "yuv420p", bitRate: 1500000},
+		{videoCodec: "h264", audioCodec: "pcm_s16le", width: 640, height: 360, pixelFormat: "yuv420p", bitRate: 1500000},
+		{videoCodec: "h264", audioCodec: "aac", width: 640, height: 360, pixelFormat: "yuv420p10le", bitRate: 1500000},
+		{videoCodec: "h264", audioCodec: "aac", width: 640, height: 360, pixelFormat: "yuv420p", bitRate: 8000000},
+		{videoCodec: "h264", audioCodec: "aac", width: 640, height: 360, pixelFormat: "yuv420p"},
+	} {
+		assert.False(t, canCopyVideo(probe, config), probe)
+		arguments = strings.Join(getFullsizeVideoArguments("in.mov", "out.mp4", &probe, config), " ")
+		assert.Contains(t, arguments, "libx264")
+		assert.NotContains(t, arguments, "scale=")
+	}
+	for _, probe := range []*videoProbe{
+		{videoCodec: "h264", audioCodec: "aac", width: 1920, height: 1080, pixelFormat: "yuv420p", bitRate: 1500000},
+		{videoCodec: "h264", audioCodec: "aac", width: 639, height: 360, pixelFormat: "yuv420p", bitRate: 1500000},
+		nil,
+	} {
+		arguments = strings.Join(getFullsizeVideoArguments("in.mov", "out.mp4", probe, config), " ")
+		assert.Contains(t, arguments, "libx264")
+		assert.Contains(t, arguments, "scale=")
+	}
+
+	// Copied HEVC videos are tagged for Apple devices
+	config.media.videoProfile = videoProfileEfficiency
+	small.videoCodec = "hevc"
+	arguments = strings.Join(getFullsizeVideoArguments("in.mov", "out.mp4", &small, config), " ")
+	assert.Contains(t, arguments, "-c copy -tag:v hvc1")
+}
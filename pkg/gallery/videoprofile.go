@@ -0,0 +1,80 @@
+package gallery
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Video profiles selecting the codec parameters of full-size videos. Compatibility videos
+// play everywhere and can be cast to Chromecast and AirPlay devices from mobile browsers.
+// Efficiency videos are about half the size, but older browsers and Chromecasts can't
+// play them.
+const (
+	videoProfileCompatibility = "compatibility"
+	videoProfileEfficiency    = "efficiency"
+)
+
+// videoCodec describes a video codec of full-size videos: the container it's written in,
+// as the file extension, the codecs parameter of its MIME type and the audio codec
+// going with it
+type videoCodec struct {
+	extension  string
+	mimeCodecs string
+	audioCodec string
+}
+
+// Video codecs and their containers. Browsers play H.264 and HEVC in MP4, VP9 and AV1
+// in WebM.
+var videoCodecs = map[string]videoCodec{
+	"h264": {extension: ".mp4", mimeCodecs: "avc1.640029, mp4a.40.2", audioCodec: "aac"},
+	"hevc": {extension: ".mp4", mimeCodecs: "hvc1.1.6.L93.B0, mp4a.40.2", audioCodec: "aac"},
+	"vp9":  {extension: ".webm", mimeCodecs: "vp09.00.31.08, opus", audioCodec: "opus"},
+	"av1":  {extension: ".webm", mimeCodecs: "av01.0.05M.08, opus", audioCodec: "opus"},
+}
+
+// isVideoProfile checks whether given string is a supported video profile
+func isVideoProfile(profile string) bool {
+	return profile == videoProfileCompatibility || profile == videoProfileEfficiency
+}
+
+// getVideoCodecArguments returns the ffmpeg arguments for the codecs of given profile.
+// H.264 is limited to High profile level 4.1 and audio to stereo AAC, which is what
+// Chromecasts support. Apple devices only play HEVC in MP4 files tagged as hvc1.
+func getVideoCodecArguments(profile string) []string {
+	audio := []string{"-acodec", "aac", "-ac", "2", "-b:a", "128k"}
+	if profile == videoProfileEfficiency {
+		return append([]string{"-vcodec", "libx265", "-tag:v", "hvc1", "-x265-params", "log-level=error:level-idc=3.1"}, audio...)
+	}
+	return append([]string{"-vcodec", "libx264", "-profile:v", "high", "-level", "4.1", "-tag:v", "avc1"}, audio...)
+}
+
+// getVideoCodec returns the video codec of given profile
+func getVideoCodec(profile string) string {
+	if profile == videoProfileEfficiency {
+		return "hevc"
+	}
+	return "h264"
+}
+
+// getVideoExtension returns the file extension of full-size videos of given profile,
+// following the container of its codec
+func getVideoExtension(profile string) string {
+	return videoCodecs[getVideoCodec(profile)].extension
+}
+
+// getVideoContainerArguments returns the ffmpeg arguments for the container of full-size
+// videos of given profile. MP4 files have their index moved to the start, so browsers
+// can start playing before the whole file is loaded. WebM files have it there already.
+func getVideoContainerArguments(profile string) []string {
+	if getVideoExtension(profile) == ".mp4" {
+		return []string{"-movflags", "faststart"}
+	}
+	return nil
+}
+
+// getVideoMIMEType returns the MIME type of full-size videos of given profile with their
+// codecs, so browsers and cast devices can tell whether they play a video before loading it
+func getVideoMIMEType(profile string) string {
+	codec := videoCodecs[getVideoCodec(profile)]
+	return fmt.Sprintf(`video/%s; codecs="%s"`, strings.TrimPrefix(codec.extension, "."), codec.mimeCodecs)
+}
@@ -0,0 +1,38 @@
+package gallery
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVideoProfiles(t *testing.T) {
+	assert.True(t, isVideoProfile(videoProfileCompatibility))
+	assert.True(t, isVideoProfile(videoProfileEfficiency))
+	assert.False(t, isVideoProfile("hevc"))
+
+	assert.Contains(t, getVideoCodecArguments(videoProfileCompatibility), "libx264")
+	assert.Contains(t, getVideoCodecArguments(videoProfileCompatibility), "avc1")
+	assert.Contains(t, getVideoCodecArguments(videoProfileEfficiency), "libx265")
+	assert.Contains(t, getVideoCodecArguments(videoProfileEfficiency), "hvc1")
+
+	assert.Contains(t, getVideoMIMEType(videoProfileCompatibility), "avc1.640029")
+	assert.Contains(t, getVideoMIMEType(videoProfileEfficiency), "hvc1")
+}
+
+func TestVideoContainers(t *testing.T) {
+	assert.Equal(t, ".mp4", getVideoExtension(videoProfileCompatibility))
+	assert.Equal(t, ".mp4", getVideoExtension(videoProfileEfficiency))
+	assert.Equal(t, ".webm", videoCodecs["vp9"].extension)
+	assert.Equal(t, ".webm", videoCodecs["av1"].extension)
+	assert.Contains(t, getVideoContainerArguments(videoProfileCompatibility), "faststart")
+
+	// The MIME type follows the container of the codec
+	assert.Equal(t, `video/mp4; codecs="avc1.640029, mp4a.40.2"`, getVideoMIMEType(videoProfileCompatibility))
+	assert.True(t, isVideoFile("clip.webm", initializeConfig()))
+
+	config := initializeConfig()
+	assert.Equal(t, getVideoExtension(config.media.videoProfile), config.files.videoExtension)
+	_, fullsizeFilename := getGalleryFilenames("clip.mov", config)
+	assert.Equal(t, "clip.mp4", fullsizeFilename)
+}
@@ -0,0 +1,190 @@
+package gallery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// How long the source has to stay unchanged before the gallery is updated, so a phone
+// dump copying hundreds of files is handled in one update
+const watchSettleTime = 5 * time.Second
+
+// addWatches watches a source directory and all of its subdirectories for changes,
+// except the gallery if it's inside the source
+func addWatches(watcher *fsnotify.Watcher, sourceDirectory string, excludedDir string) error {
+	return filepath.Walk(sourceDirectory, func(path string, info os.FileInfo, err error) error {
+		// Directories deleted while walking are noticed as changes anyway
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		if excludedDir != "" && resolvePath(path) == excludedDir {
+			return filepath.SkipDir
+		}
+		return watcher.Add(path)
+	})
+}
+
+// collectChanges waits for changes in the watched source directories and collects the
+// paths changed until the source has stayed unchanged for the settle time. New
+// directories are watched as well. Returns false once the watcher is closed or ctx is
+// done.
+func collectChanges(ctx context.Context, watcher *fsnotify.Watcher, excludedDir string, settle time.Duration) (changed []string, ok bool) {
+	var settled <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return changed, false
+		case event, open := <-watcher.Events:
+			if !open {
+				return changed, false
+			}
+			// Permission and access time changes don't change the gallery
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			if excludedDir != "" && isInsideDirectory(resolvePath(event.Name), excludedDir) {
+				continue
+			}
+			if event.Op&fsnotify.Create != 0 && isDirectory(event.Name) {
+				err := addWatches(watcher, event.Name, excludedDir)
+				if err != nil {
+					log.Println("couldn't watch source directory", event.Name, ":", err.Error())
+				}
+			}
+			changed = append(changed, event.Name)
+			settled = time.After(settle)
+		case err, open := <-watcher.Errors:
+			if !open {
+				return changed, false
+			}
+			log.Println("couldn't watch source directory:", err.Error())
+		case <-settled:
+			return changed, true
+		}
+	}
+}
+
+// getCommonDirectory returns the deepest directory containing both given relative
+// directories, "." if it's the root
+func getCommonDirectory(first string, second string) string {
+	firstParts := strings.Split(first, string(filepath.Separator))
+	secondParts := strings.Split(second, string(filepath.Separator))
+	var common []string
+	for i := 0; i < len(firstParts) && i < len(secondParts) && firstParts[i] == secondParts[i]; i++ {
+		common = append(common, firstParts[i])
+	}
+	if len(common) == 0 {
+		return "."
+	}
+	return filepath.Join(common...)
+}
+
+// getWatchRoot returns the source subdirectory a partial run has to update for given
+// changed paths: the deepest directory containing all of them, which still exists.
+// Returns an empty string if the whole gallery has to be updated.
+func getWatchRoot(sourceDirectory string, changed []string) string {
+	var root string
+	for i, path := range changed {
+		relPath, err := filepath.Rel(sourceDirectory, path)
+		if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+			return ""
+		}
+
+		// Changed files are updated with their album, deleted directories with their parent
+		directory := relPath
+		for directory != "." && !isDirectory(filepath.Join(sourceDirectory, directory)) {
+			directory = filepath.Dir(directory)
+		}
+		if i == 0 {
+			root = directory
+		} else {
+			root = getCommonDirectory(root, directory)
+		}
+	}
+	if root == "." {
+		return ""
+	}
+	return root
+}
+
+// Watch keeps watching the source directory of a built gallery, and updates the gallery
+// after each batch of changes with update. Unless the options are for a flat gallery,
+// update is given the source subdirectory containing the changes, and only has to update
+// it and the albums above it like a run with --root; an empty root means the whole
+// gallery. Without update, the gallery is built again with the options. Failed updates
+// are logged and watching goes on. Returns nil once ctx is done, or an error if watching
+// fails.
+func Watch(ctx context.Context, options Options, update func(root string) error) error {
+	if update == nil {
+		update = func(root string) error {
+			options.Root = root
+			options.Watch = false
+			return Build(ctx, options)
+		}
+	}
+	output := getOutput(options.Messages)
+
+	sourceDirectory, err := filepath.Abs(options.Source)
+	if err != nil {
+		return fmt.Errorf("couldn't find source directory %s: %w", options.Source, err)
+	}
+	galleryDirectory, err := filepath.Abs(options.Gallery)
+	if err != nil {
+		return fmt.Errorf("couldn't find gallery directory %s: %w", options.Gallery, err)
+	}
+
+	// The gallery's own changes mustn't trigger updates if it's inside the source
+	var excludedDir string
+	if resolvedGallery := resolvePath(galleryDirectory); isInsideDirectory(resolvedGallery, resolvePath(sourceDirectory)) {
+		excludedDir = resolvedGallery
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("couldn't watch source directory: %w", err)
+	}
+	defer watcher.Close()
+
+	err = addWatches(watcher, sourceDirectory, excludedDir)
+	if err != nil {
+		return fmt.Errorf("couldn't watch source directory %s: %w", sourceDirectory, err)
+	}
+	fmt.Fprintln(output, "Watching", sourceDirectory, "for changes...")
+
+	for {
+		changed, ok := collectChanges(ctx, watcher, excludedDir, watchSettleTime)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if !ok {
+			return errors.New("stopped watching source directory: " + sourceDirectory)
+		}
+
+		var root string
+		if !options.Flat {
+			root = getWatchRoot(sourceDirectory, changed)
+		}
+		if root != "" {
+			fmt.Fprintln(output, "Source changed, updating", root, "...")
+		} else {
+			fmt.Fprintln(output, "Source changed, updating gallery...")
+		}
+
+		err = update(root)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			log.Println("couldn't update gallery:", err.Error())
+		}
+		fmt.Fprintln(output, "Watching", sourceDirectory, "for changes...")
+	}
+}
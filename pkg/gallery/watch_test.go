@@ -0,0 +1,81 @@
+package gallery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetCommonDirectory(t *testing.T) {
+	assert.Equal(t, filepath.Join("2020", "trip"), getCommonDirectory(filepath.Join("2020", "trip", "day1"), filepath.Join("2020", "trip", "day2")))
+	assert.Equal(t, "2020", getCommonDirectory("2020", filepath.Join("2020", "trip")))
+	assert.Equal(t, ".", getCommonDirectory("2020", "2021"))
+	assert.Equal(t, ".", getCommonDirectory("2020", "."))
+}
+
+func TestGetWatchRoot(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+	err = os.MkdirAll(filepath.Join(tempDir, "2020", "trip", "day1"), 0755)
+	assert.NoError(t, err)
+
+	// Changed files are updated with their album
+	assert.Equal(t, filepath.Join("2020", "trip"), getWatchRoot(tempDir, []string{filepath.Join(tempDir, "2020", "trip", "a.jpg")}))
+	assert.Equal(t, filepath.Join("2020", "trip", "day1"), getWatchRoot(tempDir, []string{filepath.Join(tempDir, "2020", "trip", "day1")}))
+	assert.Equal(t, filepath.Join("2020", "trip"), getWatchRoot(tempDir, []string{filepath.Join(tempDir, "2020", "trip", "day1", "a.jpg"), filepath.Join(tempDir, "2020", "trip", "b.jpg")}))
+
+	// Deleted directories are updated with their parent
+	assert.Equal(t, "2020", getWatchRoot(tempDir, []string{filepath.Join(tempDir, "2020", "gone", "a.jpg")}))
+
+	// Changes in the source root need a full run
+	assert.Equal(t, "", getWatchRoot(tempDir, []string{filepath.Join(tempDir, "a.jpg")}))
+	assert.Equal(t, "", getWatchRoot(tempDir, []string{filepath.Join(tempDir, "2020", "a.jpg"), filepath.Join(tempDir, "2021")}))
+}
+
+func TestCollectChanges(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+	galleryDirectory := filepath.Join(tempDir, "gallery")
+	err = os.Mkdir(galleryDirectory, 0755)
+	assert.NoError(t, err)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Skip("couldn't watch directories:", err.Error())
+	}
+	defer watcher.Close()
+	excludedDir := resolvePath(galleryDirectory)
+	err = addWatches(watcher, tempDir, excludedDir)
+	assert.NoError(t, err)
+
+	// Changes in the gallery are ignored, new directories are watched too
+	go func() {
+		_ = os.WriteFile(filepath.Join(galleryDirectory, "index.html"), []byte{}, 0644)
+		_ = os.Mkdir(filepath.Join(tempDir, "trip"), 0755)
+		time.Sleep(50 * time.Millisecond)
+		_ = os.WriteFile(filepath.Join(tempDir, "trip", "a.jpg"), []byte{}, 0644)
+	}()
+	changed, ok := collectChanges(context.Background(), watcher, excludedDir, 500*time.Millisecond)
+	assert.True(t, ok)
+	assert.Contains(t, changed, filepath.Join(tempDir, "trip"))
+	assert.Contains(t, changed, filepath.Join(tempDir, "trip", "a.jpg"))
+	assert.NotContains(t, changed, filepath.Join(galleryDirectory, "index.html"))
+	assert.Equal(t, "trip", getWatchRoot(tempDir, changed))
+
+	// Watching stops once the context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, ok = collectChanges(ctx, watcher, excludedDir, 500*time.Millisecond)
+	assert.False(t, ok)
+}
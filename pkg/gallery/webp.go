@@ -0,0 +1,83 @@
+package gallery
+
+import (
+	"log"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/davidbyttow/govips/v2/vips"
+)
+
+// WebP versions of the thumbnails and full-size images are written next to the JPEGs
+const webpExtension = ".webp"
+
+// getWebPPath returns the path of the WebP version of a gallery image
+func getWebPPath(imagePath string) string {
+	return stripExtension(imagePath) + webpExtension
+}
+
+// exportWebP writes the WebP version of an image next to the JPEG written to destination.
+// Quality follows the JPEG quality, if one is set.
+func exportWebP(image *vips.ImageRef, source string, destination string, config configuration) error {
+	ep := vips.NewDefaultWEBPExportParams()
+	if config.media.jpegQuality > 0 {
+		ep.Quality = config.media.jpegQuality
+	}
+	webpBuffer, _, err := image.Export(ep)
+	if err != nil {
+		log.Println("couldn't export WebP image:", source, err.Error())
+		return err
+	}
+
+	webpDestination := getWebPPath(destination)
+	err = writeFile(webpDestination, webpBuffer, config)
+	if err != nil {
+		log.Println("couldn't write WebP image:", webpDestination, err.Error())
+		return wrapWriteError(err)
+	}
+	return nil
+}
+
+// moveWebPIntoGallery moves the WebP version of a finished image into the gallery, if
+// one was written
+func moveWebPIntoGallery(temp string, destination string, config configuration) error {
+	if !exists(getWebPPath(temp)) {
+		return nil
+	}
+	return moveIntoGallery(getWebPPath(temp), getWebPPath(destination), config)
+}
+
+// removeStaleWebP removes the WebP version of a stale gallery image. The WebP versions
+// aren't media files of their own, so they aren't in the gallery tree. In galleries of
+// WebP images, the WebP file is the image of the source file itself.
+func removeStaleWebP(stalePath string, dryRun bool, config configuration) {
+	webpPath := getWebPPath(stalePath)
+	if filepath.Ext(stalePath) == webpExtension || config.files.imageExtension == webpExtension || !exists(webpPath) {
+		return
+	}
+	if dryRun {
+		log.Println("would clean up file:", webpPath)
+		return
+	}
+	err := getStorage(config).Remove(webpPath)
+	if err != nil {
+		log.Println("couldn't delete stale gallery file", webpPath, ":", err.Error())
+	}
+}
+
+// getWebPSource returns the link to the WebP version of a gallery image for a srcset
+// attribute, or an empty string if there's none. Srcsets are split at whitespace, so
+// the link is URL-escaped. WebP images are their own WebP version.
+func getWebPSource(galleryDirectory string, imagePath string) string {
+	webpPath := getWebPPath(imagePath)
+	if filepath.Ext(imagePath) == webpExtension || !exists(filepath.Join(galleryDirectory, webpPath)) {
+		return ""
+	}
+
+	segments := strings.Split(filepath.ToSlash(webpPath), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
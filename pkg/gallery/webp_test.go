@@ -0,0 +1,70 @@
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetWebPPath(t *testing.T) {
+	assert.Equal(t, filepath.Join("_thumbnail", "a.webp"), getWebPPath(filepath.Join("_thumbnail", "a.jpg")))
+	assert.Equal(t, "a b.webp", getWebPPath("a b.jpg"))
+}
+
+func TestGetWebPSource(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	os.Mkdir(filepath.Join(tempDir, config.files.thumbnailDir), 0755)
+	os.WriteFile(filepath.Join(tempDir, config.files.thumbnailDir, "a b.webp"), []byte("webp"), 0644)
+
+	assert.Equal(t, "_thumbnail/a%20b.webp", getWebPSource(tempDir, filepath.Join(config.files.thumbnailDir, "a b.jpg")))
+	assert.Empty(t, getWebPSource(tempDir, filepath.Join(config.files.thumbnailDir, "c.jpg")))
+}
+
+func TestRemoveStaleWebP(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	webpPath := filepath.Join(tempDir, "a.webp")
+	os.WriteFile(webpPath, []byte("webp"), 0644)
+
+	removeStaleWebP(filepath.Join(tempDir, "a.jpg"), true, config)
+	assert.FileExists(t, webpPath)
+
+	removeStaleWebP(filepath.Join(tempDir, "a.jpg"), false, config)
+	assert.NoFileExists(t, webpPath)
+}
+
+func TestCreateWebPHTML(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+	source := directory{name: "alps", relPath: "alps", files: []file{{name: "a.jpg", absPath: "/photos/a.jpg"}, {name: "b.jpg", absPath: "/photos/b.jpg"}}}
+	os.Mkdir(filepath.Join(tempDir, config.files.thumbnailDir), 0755)
+	os.Mkdir(filepath.Join(tempDir, config.files.fullsizeDir), 0755)
+	os.WriteFile(filepath.Join(tempDir, config.files.thumbnailDir, "a.webp"), []byte("webp"), 0644)
+	os.WriteFile(filepath.Join(tempDir, config.files.fullsizeDir, "a.webp"), []byte("webp"), 0644)
+
+	createHTML(1, source, tempDir, testTemplates(t, config).html, false, config)
+	html, err := os.ReadFile(filepath.Join(tempDir, config.assets.htmlFile))
+	assert.NoError(t, err)
+	assert.Contains(t, string(html), `<source type="image/webp" srcset="_thumbnail/a.webp">`)
+	assert.Contains(t, string(html), `webp: "_fullsize/a.webp"`)
+	assert.NotContains(t, string(html), `_thumbnail/b.webp`)
+	assert.Contains(t, string(html), `webp: ""`)
+}
@@ -0,0 +1,105 @@
+package gallery
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"syscall"
+)
+
+// errWorkspaceAborted is returned for files finished after the run has been aborted
+var errWorkspaceAborted = errors.New("aborted")
+
+// createWorkspace creates the workspace directory for the intermediate files of this run
+// inside given directory, the system temporary directory if empty. A fast local disk
+// speeds up galleries on network drives.
+func createWorkspace(parent string) (string, error) {
+	return os.MkdirTemp(parent, "fastgallery-")
+}
+
+// removeWorkspace removes the workspace with all intermediate files at the end of the run
+func removeWorkspace(workspace string) {
+	if workspace == "" {
+		return
+	}
+	err := os.RemoveAll(workspace)
+	if err != nil {
+		log.Println("couldn't remove workspace", workspace, ":", err.Error())
+	}
+}
+
+// abortWorkspace removes the workspace of the run when aborting, and stops moving
+// finished files into the gallery. Moving files is serialized with removing the
+// workspace, so an aborted run never leaves a half-moved file in the gallery.
+func abortWorkspace(config configuration) {
+	config.run.workspaceMutex.Lock()
+	defer config.run.workspaceMutex.Unlock()
+	config.run.aborted = true
+	removeWorkspace(config.files.workspaceDir)
+}
+
+// isAborted checks whether the run has been aborted
+func isAborted(config configuration) bool {
+	config.run.workspaceMutex.Lock()
+	defer config.run.workspaceMutex.Unlock()
+	return config.run.aborted
+}
+
+// abortOnCancel aborts the run once ctx is done, e.g. on ctrl-C, until the returned
+// function is called at the end of the run. The workspace is removed right away, and
+// the files still being transformed are dropped.
+func abortOnCancel(ctx context.Context, config configuration) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			log.Println("Cancelled, cleaning up and aborting...")
+			abortWorkspace(config)
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+// moveIntoGallery moves a finished file from the workspace to its place in the gallery.
+// Files are copied if the workspace is on another file system than the gallery.
+func moveIntoGallery(workspacePath string, destination string, config configuration) error {
+	config.run.workspaceMutex.Lock()
+	defer config.run.workspaceMutex.Unlock()
+	if config.run.aborted {
+		return errWorkspaceAborted
+	}
+
+	err := getStorage(config).Rename(workspacePath, destination)
+	if errors.Is(err, syscall.EXDEV) {
+		err = copyIntoGallery(workspacePath, destination, config)
+	}
+	return wrapWriteError(err)
+}
+
+// copyIntoGallery copies a file from the workspace into the gallery with the configured
+// permissions and owner, removing the partial copy on failure
+func copyIntoGallery(workspacePath string, destination string, config configuration) error {
+	sourceHandle, err := os.Open(workspacePath)
+	if err != nil {
+		return err
+	}
+	defer sourceHandle.Close()
+
+	destinationHandle, err := createFile(destination, config)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(destinationHandle, sourceHandle)
+	closeErr := destinationHandle.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		getStorage(config).Remove(destination)
+	}
+	return err
+}
@@ -0,0 +1,75 @@
+package gallery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkspace(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := initializeConfig()
+
+	workspace, err := createWorkspace(tempDir)
+	assert.NoError(t, err)
+	assert.DirExists(t, workspace)
+
+	workspaceFile := filepath.Join(workspace, "fullsize.jpg")
+	err = os.WriteFile(workspaceFile, []byte("image"), 0644)
+	assert.NoError(t, err)
+
+	destination := filepath.Join(tempDir, "a.jpg")
+	err = moveIntoGallery(workspaceFile, destination, config)
+	assert.NoError(t, err)
+	assert.NoFileExists(t, workspaceFile)
+	assert.FileExists(t, destination)
+
+	err = os.WriteFile(workspaceFile, []byte("image"), 0644)
+	assert.NoError(t, err)
+	copied := filepath.Join(tempDir, "b.jpg")
+	err = copyIntoGallery(workspaceFile, copied, config)
+	assert.NoError(t, err)
+	buffer, err := os.ReadFile(copied)
+	assert.NoError(t, err)
+	assert.EqualValues(t, "image", string(buffer))
+
+	// Failed copies don't leave a partial file behind
+	err = copyIntoGallery(filepath.Join(workspace, "missing.jpg"), filepath.Join(tempDir, "c.jpg"), config)
+	assert.Error(t, err)
+	assert.NoFileExists(t, filepath.Join(tempDir, "c.jpg"))
+
+	removeWorkspace(workspace)
+	assert.NoDirExists(t, workspace)
+	assert.FileExists(t, destination)
+}
+
+func TestAbortOnCancel(t *testing.T) {
+	tempDir := t.TempDir()
+	config := initializeConfig()
+	workspace, err := createWorkspace(tempDir)
+	assert.NoError(t, err)
+	config.files.workspaceDir = workspace
+
+	// Runs which finish aren't aborted
+	stop := abortOnCancel(context.Background(), config)
+	stop()
+	assert.False(t, isAborted(config))
+
+	// Cancelled runs remove their workspace, and move no more files into the gallery
+	ctx, cancel := context.WithCancel(context.Background())
+	defer abortOnCancel(ctx, config)()
+	cancel()
+	assert.Eventually(t, func() bool { return isAborted(config) }, time.Second, 10*time.Millisecond)
+	assert.NoDirExists(t, workspace)
+	err = moveIntoGallery(filepath.Join(workspace, "a.jpg"), filepath.Join(tempDir, "a.jpg"), config)
+	assert.Equal(t, errWorkspaceAborted, err)
+}
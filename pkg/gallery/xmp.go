@@ -0,0 +1,310 @@
+package gallery
+
+import (
+	"encoding/xml"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// XML namespaces used by Lightroom, Darktable and friends in XMP sidecar files
+const (
+	xmpNamespace = "http://ns.adobe.com/xap/1.0/"
+	dcNamespace  = "http://purl.org/dc/elements/1.1/"
+	rdfNamespace = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	dmNamespace  = "http://ns.adobe.com/xmp/1.0/DynamicMedia/"
+
+	// Face regions of the Metadata Working Group, written by digiKam and Picasa
+	mwgRegionsNamespace = "http://www.metadataworkinggroup.com/schemas/regions/"
+	stAreaNamespace     = "http://ns.adobe.com/xmp/sType/Area#"
+)
+
+// sidecarMetadata struct holds the culling information read from an XMP sidecar file
+type sidecarMetadata struct {
+	rating   int
+	label    string
+	caption  string
+	keywords []string
+	album    string
+	faces    []faceRegion
+}
+
+// faceRegion struct is a named face tagged in a photo. x and y are the center of the
+// face and width and height its size, as fractions of the image's width and height.
+type faceRegion struct {
+	name       string
+	regionType string
+	unit       string
+	x          float64
+	y          float64
+	width      float64
+	height     float64
+}
+
+// findSidecar returns the path of the XMP sidecar for given media file, or an empty
+// string if there isn't one. Lightroom replaces the extension (photo.xmp) while
+// Darktable appends to it (photo.jpg.xmp), so we check both in either case.
+func findSidecar(mediaPath string) string {
+	candidates := []string{
+		mediaPath + ".xmp",
+		mediaPath + ".XMP",
+		stripExtension(mediaPath) + ".xmp",
+		stripExtension(mediaPath) + ".XMP",
+	}
+
+	for _, candidate := range candidates {
+		if filestat, err := os.Stat(candidate); err == nil && !filestat.IsDir() {
+			return candidate
+		}
+	}
+
+	return ""
+}
+
+// readSidecar opens and parses an XMP sidecar file
+func readSidecar(sidecarPath string) (metadata sidecarMetadata, err error) {
+	sidecarHandle, err := os.Open(sidecarPath)
+	if err != nil {
+		return metadata, err
+	}
+	defer sidecarHandle.Close()
+
+	return parseXMP(sidecarHandle)
+}
+
+// parseXMP reads rating, color label, caption, keywords and named face regions from an
+// XMP document. Rating and label can be stored either as attributes of rdf:Description
+// or as elements of their own, depending on the application which wrote the file.
+func parseXMP(reader io.Reader) (metadata sidecarMetadata, err error) {
+	decoder := xml.NewDecoder(reader)
+
+	// Stack of enclosing element names, used to figure out which property
+	// the character data or rdf:li element we're looking at belongs to
+	var elements []xml.Name
+
+	// Face region being read, and the depth of its rdf:li element in the stack
+	var region *faceRegion
+	var regionDepth int
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return metadata, err
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			if isRegionListItem(elements, element.Name) {
+				region = &faceRegion{}
+				regionDepth = len(elements)
+			}
+			if region != nil {
+				for _, attribute := range element.Attr {
+					setRegionProperty(region, attribute.Name, attribute.Value)
+				}
+			}
+			if element.Name.Space == rdfNamespace && element.Name.Local == "Description" {
+				for _, attribute := range element.Attr {
+					if attribute.Name.Space == xmpNamespace || attribute.Name.Space == dmNamespace {
+						setXMPProperty(&metadata, attribute.Name.Local, attribute.Value)
+					}
+				}
+			}
+			elements = append(elements, element.Name)
+		case xml.EndElement:
+			if region != nil && len(elements) == regionDepth+1 {
+				if region.isNamedFace() {
+					metadata.faces = append(metadata.faces, *region)
+				}
+				region = nil
+			}
+			if len(elements) > 0 {
+				elements = elements[:len(elements)-1]
+			}
+		case xml.CharData:
+			value := strings.TrimSpace(string(element))
+			if value == "" || len(elements) == 0 {
+				continue
+			}
+
+			current := elements[len(elements)-1]
+			if region != nil {
+				setRegionProperty(region, current, value)
+				continue
+			}
+			if current.Space == xmpNamespace || current.Space == dmNamespace {
+				setXMPProperty(&metadata, current.Local, value)
+				continue
+			}
+
+			// Captions and keywords are list values: dc:description/rdf:Alt/rdf:li
+			// and dc:subject/rdf:Bag/rdf:li respectively
+			if current.Space == rdfNamespace && current.Local == "li" && len(elements) >= 3 {
+				property := elements[len(elements)-3]
+				if property.Space == dcNamespace {
+					switch property.Local {
+					case "description":
+						if metadata.caption == "" {
+							metadata.caption = value
+						}
+					case "subject":
+						metadata.keywords = append(metadata.keywords, value)
+					}
+				}
+			}
+		}
+	}
+
+	return metadata, nil
+}
+
+// setXMPProperty stores a single property from the xmp or xmpDM namespaces into the metadata struct
+func setXMPProperty(metadata *sidecarMetadata, property string, value string) {
+	switch property {
+	case "Rating":
+		rating, err := strconv.Atoi(value)
+		if err == nil {
+			metadata.rating = rating
+		}
+	case "Label":
+		metadata.label = value
+	case "album":
+		metadata.album = value
+	}
+}
+
+// isRegionListItem checks whether an element is one region of the MWG region list:
+// mwg-rs:RegionList/rdf:Bag/rdf:li
+func isRegionListItem(elements []xml.Name, name xml.Name) bool {
+	if name.Space != rdfNamespace || name.Local != "li" || len(elements) < 2 {
+		return false
+	}
+	bag := elements[len(elements)-1]
+	list := elements[len(elements)-2]
+	return bag.Space == rdfNamespace && bag.Local == "Bag" && list.Space == mwgRegionsNamespace && list.Local == "RegionList"
+}
+
+// setRegionProperty stores a single property of an MWG region, which may be an attribute
+// or an element of its own like the properties of rdf:Description
+func setRegionProperty(region *faceRegion, name xml.Name, value string) {
+	switch name.Space {
+	case mwgRegionsNamespace:
+		switch name.Local {
+		case "Name":
+			region.name = value
+		case "Type":
+			region.regionType = value
+		}
+	case stAreaNamespace:
+		if name.Local == "unit" {
+			region.unit = value
+			return
+		}
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return
+		}
+		switch name.Local {
+		case "x":
+			region.x = number
+		case "y":
+			region.y = number
+		case "w":
+			region.width = number
+		case "h":
+			region.height = number
+		}
+	}
+}
+
+// isNamedFace checks whether a region is a face with a name and a usable area. Only
+// areas as fractions of the image size are supported, which is what MWG requires.
+func (region faceRegion) isNamedFace() bool {
+	return region.regionType == "Face" && region.name != "" && region.unit == "normalized" &&
+		region.width > 0 && region.height > 0
+}
+
+// readSidecars reads the XMP sidecar of each source media file recursively and, if
+// a minimum rating is set, drops files rated below it. Files tagged with keywords or
+// people to keep private are dropped too. Directories left without any
+// media files are dropped as well, like createDirectoryTree() does for empty ones.
+func readSidecars(source *directory, config configuration) {
+	readDirectorySidecars(source, config)
+
+	for i := range source.subdirectories {
+		readSidecars(&source.subdirectories[i], config)
+	}
+	pruneEmptySubdirectories(source)
+}
+
+// readDirectorySidecars reads the XMP sidecars of the files in one source directory,
+// dropping the files rated lower than required and the ones to keep private
+func readDirectorySidecars(source *directory, config configuration) {
+	var keptFiles []file
+	for _, sourceFile := range source.files {
+		sidecarPath := findSidecar(sourceFile.absPath)
+		if sidecarPath != "" {
+			metadata, err := readSidecar(sidecarPath)
+			if err != nil {
+				log.Println("couldn't parse XMP sidecar:", sidecarPath, err.Error())
+			} else {
+				sourceFile.sidecar = metadata
+			}
+		}
+
+		if config.media.minRating > 0 && sourceFile.sidecar.rating < config.media.minRating {
+			continue
+		}
+		if isExcludedByTags(sourceFile.sidecar, config) {
+			continue
+		}
+		keptFiles = append(keptFiles, sourceFile)
+	}
+	source.files = keptFiles
+}
+
+// isExcludedByTags checks whether a file is tagged with one of the keywords or has the
+// face of one of the people to keep private. Tags are compared case-insensitively.
+func isExcludedByTags(metadata sidecarMetadata, config configuration) bool {
+	for _, keyword := range metadata.keywords {
+		if containsFold(config.media.excludeKeywords, keyword) {
+			return true
+		}
+	}
+	for _, face := range metadata.faces {
+		if containsFold(config.media.excludePeople, face.name) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsFold checks whether the list contains the value, ignoring case
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// pruneEmptySubdirectories removes the subdirectories left without any media files,
+// e.g. because all of them were rated too low. Returns the removed directories.
+func pruneEmptySubdirectories(source *directory) (pruned []directory) {
+	var keptSubdirectories []directory
+	for _, subdir := range source.subdirectories {
+		if len(subdir.files) > 0 || len(subdir.subdirectories) > 0 || subdir.keptStats != nil {
+			keptSubdirectories = append(keptSubdirectories, subdir)
+		} else {
+			pruned = append(pruned, subdir)
+		}
+	}
+	source.subdirectories = keptSubdirectories
+	return pruned
+}
@@ -0,0 +1,166 @@
+package gallery
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testXMPAttributes = `<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+    xmlns:dc="http://purl.org/dc/elements/1.1/"
+   xmp:Rating="4"
+   xmp:Label="Red">
+   <dc:description>
+    <rdf:Alt>
+     <rdf:li xml:lang="x-default">Sunset over the harbour</rdf:li>
+    </rdf:Alt>
+   </dc:description>
+   <dc:subject>
+    <rdf:Bag>
+     <rdf:li>harbour</rdf:li>
+     <rdf:li>sunset</rdf:li>
+    </rdf:Bag>
+   </dc:subject>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>`
+
+const testXMPElements = `<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/">
+   <xmp:Rating>2</xmp:Rating>
+   <xmp:Label>Green</xmp:Label>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>`
+
+// digiKam writes region properties as attributes, other applications as elements
+const testXMPRegions = `<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:mwg-rs="http://www.metadataworkinggroup.com/schemas/regions/"
+    xmlns:stArea="http://ns.adobe.com/xmp/sType/Area#"
+    xmlns:stDim="http://ns.adobe.com/xap/1.0/sType/Dimensions#">
+   <mwg-rs:Regions rdf:parseType="Resource">
+    <mwg-rs:AppliedToDimensions stDim:w="4000" stDim:h="3000" stDim:unit="pixel"/>
+    <mwg-rs:RegionList>
+     <rdf:Bag>
+      <rdf:li>
+       <rdf:Description mwg-rs:Name="Alice" mwg-rs:Type="Face">
+        <mwg-rs:Area stArea:x="0.5" stArea:y="0.4" stArea:w="0.2" stArea:h="0.3" stArea:unit="normalized"/>
+       </rdf:Description>
+      </rdf:li>
+      <rdf:li rdf:parseType="Resource">
+       <mwg-rs:Name>Bob</mwg-rs:Name>
+       <mwg-rs:Type>Face</mwg-rs:Type>
+       <mwg-rs:Area rdf:parseType="Resource">
+        <stArea:x>0.25</stArea:x>
+        <stArea:y>0.5</stArea:y>
+        <stArea:w>0.1</stArea:w>
+        <stArea:h>0.1</stArea:h>
+        <stArea:unit>normalized</stArea:unit>
+       </mwg-rs:Area>
+      </rdf:li>
+      <rdf:li>
+       <rdf:Description mwg-rs:Type="Face">
+        <mwg-rs:Area stArea:x="0.8" stArea:y="0.4" stArea:w="0.1" stArea:h="0.1" stArea:unit="normalized"/>
+       </rdf:Description>
+      </rdf:li>
+      <rdf:li>
+       <rdf:Description mwg-rs:Name="Rex" mwg-rs:Type="Pet">
+        <mwg-rs:Area stArea:x="0.1" stArea:y="0.9" stArea:w="0.1" stArea:h="0.1" stArea:unit="normalized"/>
+       </rdf:Description>
+      </rdf:li>
+     </rdf:Bag>
+    </mwg-rs:RegionList>
+   </mwg-rs:Regions>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>`
+
+func TestParseXMP(t *testing.T) {
+	metadata, err := parseXMP(strings.NewReader(testXMPAttributes))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 4, metadata.rating)
+	assert.EqualValues(t, "Red", metadata.label)
+	assert.EqualValues(t, "Sunset over the harbour", metadata.caption)
+	assert.EqualValues(t, []string{"harbour", "sunset"}, metadata.keywords)
+
+	metadata, err = parseXMP(strings.NewReader(testXMPElements))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, metadata.rating)
+	assert.EqualValues(t, "Green", metadata.label)
+	assert.EqualValues(t, "", metadata.caption)
+	assert.Empty(t, metadata.keywords)
+
+	// Only named faces are read
+	metadata, err = parseXMP(strings.NewReader(testXMPRegions))
+	assert.NoError(t, err)
+	assert.Len(t, metadata.faces, 2)
+	assert.EqualValues(t, faceRegion{name: "Alice", regionType: "Face", unit: "normalized", x: 0.5, y: 0.4, width: 0.2, height: 0.3}, metadata.faces[0])
+	assert.EqualValues(t, "Bob", metadata.faces[1].name)
+	assert.EqualValues(t, 0.25, metadata.faces[1].x)
+
+	_, err = parseXMP(strings.NewReader("<x:xmpmeta><unclosed>"))
+	assert.Error(t, err)
+}
+
+func TestReadSidecars(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "fastgallery-test-")
+	if err != nil {
+		t.Error("couldn't create temporary directory")
+	}
+	defer os.RemoveAll(tempDir)
+
+	err = os.Mkdir(filepath.Join(tempDir, "subdir"), 0755)
+	assert.NoError(t, err)
+
+	// Lightroom style sidecar for good.jpg, Darktable style for subdir/bad.jpg
+	for _, filename := range []string{"good.jpg", "unrated.jpg", filepath.Join("subdir", "bad.jpg")} {
+		err = os.WriteFile(filepath.Join(tempDir, filename), []byte{}, 0644)
+		assert.NoError(t, err)
+	}
+	err = os.WriteFile(filepath.Join(tempDir, "good.xmp"), []byte(testXMPAttributes), 0644)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(tempDir, "subdir", "bad.jpg.xmp"), []byte(testXMPElements), 0644)
+	assert.NoError(t, err)
+
+	assert.EqualValues(t, filepath.Join(tempDir, "good.xmp"), findSidecar(filepath.Join(tempDir, "good.jpg")))
+	assert.EqualValues(t, filepath.Join(tempDir, "subdir", "bad.jpg.xmp"), findSidecar(filepath.Join(tempDir, "subdir", "bad.jpg")))
+	assert.EqualValues(t, "", findSidecar(filepath.Join(tempDir, "unrated.jpg")))
+
+	config := initializeConfig()
+
+	source, _ := createDirectoryTree(tempDir, "", false, config)
+	readSidecars(&source, config)
+	assert.Len(t, source.files, 2)
+	assert.Len(t, source.subdirectories, 1)
+
+	config.media.minRating = 3
+	source, _ = createDirectoryTree(tempDir, "", false, config)
+	readSidecars(&source, config)
+	assert.Len(t, source.files, 1)
+	assert.EqualValues(t, "good.jpg", source.files[0].name)
+	assert.EqualValues(t, "Sunset over the harbour", source.files[0].sidecar.caption)
+	assert.Len(t, source.subdirectories, 0)
+}
+
+func TestIsExcludedByTags(t *testing.T) {
+	config := initializeConfig()
+	metadata := sidecarMetadata{keywords: []string{"harbour", "Private"}, faces: []faceRegion{{name: "Alice"}}}
+	assert.False(t, isExcludedByTags(metadata, config))
+
+	config.media.excludeKeywords = []string{"private"}
+	assert.True(t, isExcludedByTags(metadata, config))
+
+	config.media.excludeKeywords = nil
+	config.media.excludePeople = []string{"Bob", "alice"}
+	assert.True(t, isExcludedByTags(metadata, config))
+	assert.False(t, isExcludedByTags(sidecarMetadata{}, config))
+}